@@ -17,6 +17,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -57,6 +58,14 @@ func InitCmdFlags(cmd *cobra.Command) {
 	case "dumpBridgePort":
 		cmd.Flags().StringP("bridge", "b", "br0", "bridge")
 		cmd.Flags().StringP("port", "p", "", "port")
+	case "announceGuest":
+		cmd.Flags().StringP("guest", "g", "", "guest id")
+		cmd.Flags().StringP("mac", "m", "", "mac of the nic, all nics if empty")
+		cmd.Flags().Uint32P("count", "c", 0, "times to send, configured count if zero")
+	case "stats":
+		cmd.Flags().StringP("mac", "m", "", "mac of the nic, all nics if empty")
+	case "list":
+		cmd.Flags().StringP("phase", "p", "", "phase of guests, all phases if empty")
 	}
 }
 
@@ -73,7 +82,7 @@ func handleResponse(resp pb.CommonResponse, err error, fmt string) bool {
 	return true
 }
 
-func DoCmd(cmd *cobra.Command) {
+func DoCmd(cmd *cobra.Command, args []string) {
 	sockPath, err := cmd.Flags().GetString("sock")
 	if err != nil {
 		log.Fatalf("get sock option: %v", err)
@@ -117,5 +126,104 @@ func DoCmd(cmd *cobra.Command) {
 		if ok {
 			fmt.Printf("%d\n", resp.PortStats.PortNo)
 		}
+	case "announceGuest":
+		req := &pb.AnnounceGuestRequest{
+			GuestId: flagSetMustGet(cmd.Flags().GetString("guest")).(string),
+			Mac:     flagSetMustGet(cmd.Flags().GetString("mac")).(string),
+			Count:   flagSetMustGet(cmd.Flags().GetUint32("count")).(uint32),
+		}
+		resp, err := c.Openflow.AnnounceGuest(context.Background(), req)
+		handleResponse(resp, err, "announceGuest failure: %s")
+	case "stats":
+		req := &pb.GetGuestTcStatsRequest{
+			GuestId: args[0],
+			Mac:     flagSetMustGet(cmd.Flags().GetString("mac")).(string),
+		}
+		resp, err := c.Openflow.GetGuestTcStats(context.Background(), req)
+		ok := handleResponse(resp, err, "tc stats failure: %s")
+		if ok {
+			printTcStats(resp.Nics)
+		}
+	case "status":
+		req := &pb.GetGuestStatusRequest{
+			GuestId: args[0],
+		}
+		resp, err := c.GuestMan.GetGuestStatus(context.Background(), req)
+		ok := handleResponse(resp, err, "guest status failure: %s")
+		if ok {
+			printGuestStatus(resp.Status)
+		}
+	case "list":
+		req := &pb.ListGuestsRequest{
+			Phase: flagSetMustGet(cmd.Flags().GetString("phase")).(string),
+		}
+		resp, err := c.GuestMan.ListGuests(context.Background(), req)
+		ok := handleResponse(resp, err, "guest list failure: %s")
+		if ok {
+			for _, st := range resp.Guests {
+				fmt.Printf("%s %s %d flows %s\n", st.GuestId, st.Phase, st.Flows, st.Mesg)
+			}
+		}
+	case "metadata":
+		req := &pb.GetMetadataStatsRequest{}
+		if len(args) > 0 {
+			req.GuestId = args[0]
+		}
+		resp, err := c.GuestMan.GetMetadataStats(context.Background(), req)
+		ok := handleResponse(resp, err, "metadata stats failure: %s")
+		if ok {
+			for _, st := range resp.Stats {
+				fmt.Printf("%s %s requests %d (throttled %d, denied %d, errors %d)\n",
+					st.GuestId, st.Bridge, st.Requests, st.Throttled, st.Denied, st.Errors)
+			}
+		}
+	case "ctZones":
+		req := &pb.ListCtZonesRequest{}
+		resp, err := c.Openflow.ListCtZones(context.Background(), req)
+		ok := handleResponse(resp, err, "ctZones failure: %s")
+		if ok {
+			printCtZones(resp.Zones)
+		}
+	}
+}
+
+func printGuestStatus(st *pb.GuestStatus) {
+	fmt.Printf("guest %s %s %s\n", st.GuestId, st.Phase, st.Mesg)
+	if st.LastApplied > 0 {
+		fmt.Printf("  last applied %s\n", time.Unix(st.LastApplied, 0).Format(time.RFC3339))
+	}
+	fmt.Printf("  %d flows\n", st.Flows)
+	for _, nic := range st.Nics {
+		fmt.Printf("  nic %s %s bridge %s port %d ct zone %d\n", nic.Mac, nic.Ifname, nic.Bridge, nic.PortNo, nic.CtZone)
+		fmt.Printf("    %d flows, tc %s %s\n", nic.Flows, nic.TcState, nic.TcMesg)
+		if nic.Mesg != "" {
+			fmt.Printf("    error: %s\n", nic.Mesg)
+		}
+	}
+}
+
+func printCtZones(zones []*pb.CtZone) {
+	for _, zone := range zones {
+		if zone.Mac == "" {
+			fmt.Printf("%d reserved %s\n", zone.Zone, zone.Owner)
+			continue
+		}
+		stale := ""
+		if zone.Stale {
+			stale = " (stale)"
+		}
+		fmt.Printf("%d %s%s\n", zone.Zone, zone.Mac, stale)
+	}
+}
+
+func printTcStats(nics []*pb.GuestNicTcStats) {
+	for _, nic := range nics {
+		fmt.Printf("nic %s %s\n", nic.Mac, nic.Ifname)
+		for _, st := range nic.Stats {
+			fmt.Printf("  %s %s %s %s %s\n", st.Ifname, st.Type, st.Kind, st.Id, st.Parent)
+			fmt.Printf("    sent %d bytes %d pkt (dropped %d, overlimits %d requeues %d)\n",
+				st.Bytes, st.Packets, st.Drops, st.Overlimits, st.Requeues)
+			fmt.Printf("    backlog %db %dp\n", st.BacklogBytes, st.BacklogPackets)
+		}
 	}
 }
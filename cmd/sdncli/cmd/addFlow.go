@@ -27,7 +27,7 @@ var addFlowCmd = &cobra.Command{
 	Short: "Tell sdnagent to add flow",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		cli.DoCmd(cmd)
+		cli.DoCmd(cmd, args)
 	},
 }
 
@@ -0,0 +1,37 @@
+// Copyright 2019 Yunion
+// Copyright © 2018 Yousong Zhou <zhouyousong@yunionyun.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"yunion.io/x/sdnagent/cmd/sdncli/cli"
+)
+
+// announceGuestCmd represents the announceGuest command
+var announceGuestCmd = &cobra.Command{
+	Use:   "announceGuest",
+	Short: "Tell sdnagent to send gratuitous arp and unsolicited na for guest addresses",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		cli.DoCmd(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(announceGuestCmd)
+	cli.InitCmdFlags(announceGuestCmd)
+}
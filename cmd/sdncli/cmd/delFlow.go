@@ -27,7 +27,7 @@ var delFlowCmd = &cobra.Command{
 	Short: "Tell sdnagent to delete a flow",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		cli.DoCmd(cmd)
+		cli.DoCmd(cmd, args)
 	},
 }
 
@@ -27,7 +27,7 @@ var dumpBridgePortCmd = &cobra.Command{
 	Short: "Dump OpenFlow port number",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		cli.DoCmd(cmd)
+		cli.DoCmd(cmd, args)
 	},
 }
 
@@ -0,0 +1,70 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"yunion.io/x/sdnagent/cmd/sdncli/cli"
+)
+
+// guestCmd groups guest commands
+var guestCmd = &cobra.Command{
+	Use:   "guest",
+	Short: "Inspect guests served by sdnagent",
+	Long:  ``,
+}
+
+// guestStatusCmd represents the guest status command
+var guestStatusCmd = &cobra.Command{
+	Use:   "status <guest>",
+	Short: "Show status of guest and its nics after the last update",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cli.DoCmd(cmd, args)
+	},
+}
+
+// guestListCmd represents the guest list command
+var guestListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List guests with their phases",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		cli.DoCmd(cmd, args)
+	},
+}
+
+// guestMetadataCmd represents the guest metadata command
+var guestMetadataCmd = &cobra.Command{
+	Use:   "metadata [guest]",
+	Short: "Show counters of requests of guests to the metadata server",
+	Long:  ``,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cli.DoCmd(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(guestCmd)
+	guestCmd.AddCommand(guestStatusCmd)
+	guestCmd.AddCommand(guestListCmd)
+	guestCmd.AddCommand(guestMetadataCmd)
+	cli.InitCmdFlags(guestStatusCmd)
+	cli.InitCmdFlags(guestListCmd)
+	cli.InitCmdFlags(guestMetadataCmd)
+}
@@ -27,7 +27,7 @@ var syncFlowsCmd = &cobra.Command{
 	Short: "Tell sdnagent to sync flows",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		cli.DoCmd(cmd)
+		cli.DoCmd(cmd, args)
 	},
 }
 
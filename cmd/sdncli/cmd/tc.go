@@ -0,0 +1,45 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"yunion.io/x/sdnagent/cmd/sdncli/cli"
+)
+
+// tcCmd groups traffic control commands
+var tcCmd = &cobra.Command{
+	Use:   "tc",
+	Short: "Inspect traffic control of guests",
+	Long:  ``,
+}
+
+// tcStatsCmd represents the tc stats command
+var tcStatsCmd = &cobra.Command{
+	Use:   "stats <guest>",
+	Short: "Show statistics of qdiscs and classes limiting bandwidth of guest nics",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cli.DoCmd(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tcCmd)
+	tcCmd.AddCommand(tcStatsCmd)
+	cli.InitCmdFlags(tcStatsCmd)
+}
@@ -15,12 +15,15 @@ require (
 	github.com/vishvananda/netlink v1.2.1-beta.2
 	github.com/vishvananda/netns v0.0.5-0.20240412164733-9469873f4601
 	golang.org/x/net v0.43.0
+	golang.org/x/sys v0.35.0
+	golang.org/x/time v0.5.0
 	google.golang.org/grpc v1.62.0
 	google.golang.org/protobuf v1.35.1
 	yunion.io/x/jsonutils v1.0.1-0.20250507052344-1abcf4f443b1
 	yunion.io/x/log v1.0.1-0.20240305175729-7cf2d6cd5a91
 	yunion.io/x/onecloud v0.0.0-20260617065020-2b927e742dd1
 	yunion.io/x/pkg v1.10.4-0.20260422030155-01b100134978
+	yunion.io/x/structarg v0.0.0-20231017124457-df4d5009457c
 )
 
 require (
@@ -102,10 +105,8 @@ require (
 	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/oauth2 v0.17.0 // indirect
 	golang.org/x/sync v0.16.0 // indirect
-	golang.org/x/sys v0.35.0 // indirect
 	golang.org/x/term v0.34.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
-	golang.org/x/time v0.5.0 // indirect
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240304161311-37d4d3c04a78 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240228224816-df926f6c8641 // indirect
@@ -130,7 +131,6 @@ require (
 	yunion.io/x/executor v0.0.0-20260312022053-f538abd2b005 // indirect
 	yunion.io/x/s3cli v0.0.0-20241221171442-1c11599d28e1 // indirect
 	yunion.io/x/sqlchemy v1.1.3-0.20251231025938-b0a38f6e9fab // indirect
-	yunion.io/x/structarg v0.0.0-20231017124457-df4d5009457c // indirect
 )
 
 replace (
@@ -25,6 +25,7 @@ import (
 type AgentClient struct {
 	VSwitch  pb.VSwitchClient
 	Openflow pb.OpenflowClient
+	GuestMan pb.GuestManClient
 }
 
 func (c *AgentClient) W(resp pb.CommonResponse, err error) error {
@@ -45,6 +46,7 @@ func NewClient(sockPath string) (*AgentClient, error) {
 	c := &AgentClient{
 		VSwitch:  pb.NewVSwitchClient(conn),
 		Openflow: pb.NewOpenflowClient(conn),
+		GuestMan: pb.NewGuestManClient(conn),
 	}
 	return c, nil
 }
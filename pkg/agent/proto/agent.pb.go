@@ -49,7 +49,7 @@ func (m *Response) Reset()         { *m = Response{} }
 func (m *Response) String() string { return proto.CompactTextString(m) }
 func (*Response) ProtoMessage()    {}
 func (*Response) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{0}
+	return fileDescriptor_agent_1b27343cc2913682, []int{0}
 }
 func (m *Response) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Response.Unmarshal(m, b)
@@ -94,7 +94,7 @@ func (m *AddBridgeRequest) Reset()         { *m = AddBridgeRequest{} }
 func (m *AddBridgeRequest) String() string { return proto.CompactTextString(m) }
 func (*AddBridgeRequest) ProtoMessage()    {}
 func (*AddBridgeRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{1}
+	return fileDescriptor_agent_1b27343cc2913682, []int{1}
 }
 func (m *AddBridgeRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AddBridgeRequest.Unmarshal(m, b)
@@ -132,7 +132,7 @@ func (m *DelBridgeRequest) Reset()         { *m = DelBridgeRequest{} }
 func (m *DelBridgeRequest) String() string { return proto.CompactTextString(m) }
 func (*DelBridgeRequest) ProtoMessage()    {}
 func (*DelBridgeRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{2}
+	return fileDescriptor_agent_1b27343cc2913682, []int{2}
 }
 func (m *DelBridgeRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DelBridgeRequest.Unmarshal(m, b)
@@ -171,7 +171,7 @@ func (m *AddBridgePortRequest) Reset()         { *m = AddBridgePortRequest{} }
 func (m *AddBridgePortRequest) String() string { return proto.CompactTextString(m) }
 func (*AddBridgePortRequest) ProtoMessage()    {}
 func (*AddBridgePortRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{3}
+	return fileDescriptor_agent_1b27343cc2913682, []int{3}
 }
 func (m *AddBridgePortRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AddBridgePortRequest.Unmarshal(m, b)
@@ -217,7 +217,7 @@ func (m *DelBridgePortRequest) Reset()         { *m = DelBridgePortRequest{} }
 func (m *DelBridgePortRequest) String() string { return proto.CompactTextString(m) }
 func (*DelBridgePortRequest) ProtoMessage()    {}
 func (*DelBridgePortRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{4}
+	return fileDescriptor_agent_1b27343cc2913682, []int{4}
 }
 func (m *DelBridgePortRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DelBridgePortRequest.Unmarshal(m, b)
@@ -263,7 +263,7 @@ func (m *AddFlowRequest) Reset()         { *m = AddFlowRequest{} }
 func (m *AddFlowRequest) String() string { return proto.CompactTextString(m) }
 func (*AddFlowRequest) ProtoMessage()    {}
 func (*AddFlowRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{5}
+	return fileDescriptor_agent_1b27343cc2913682, []int{5}
 }
 func (m *AddFlowRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AddFlowRequest.Unmarshal(m, b)
@@ -309,7 +309,7 @@ func (m *DelFlowRequest) Reset()         { *m = DelFlowRequest{} }
 func (m *DelFlowRequest) String() string { return proto.CompactTextString(m) }
 func (*DelFlowRequest) ProtoMessage()    {}
 func (*DelFlowRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{6}
+	return fileDescriptor_agent_1b27343cc2913682, []int{6}
 }
 func (m *DelFlowRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DelFlowRequest.Unmarshal(m, b)
@@ -354,7 +354,7 @@ func (m *SyncFlowsRequest) Reset()         { *m = SyncFlowsRequest{} }
 func (m *SyncFlowsRequest) String() string { return proto.CompactTextString(m) }
 func (*SyncFlowsRequest) ProtoMessage()    {}
 func (*SyncFlowsRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{7}
+	return fileDescriptor_agent_1b27343cc2913682, []int{7}
 }
 func (m *SyncFlowsRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SyncFlowsRequest.Unmarshal(m, b)
@@ -396,7 +396,7 @@ func (m *Flow) Reset()         { *m = Flow{} }
 func (m *Flow) String() string { return proto.CompactTextString(m) }
 func (*Flow) ProtoMessage()    {}
 func (*Flow) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{8}
+	return fileDescriptor_agent_1b27343cc2913682, []int{8}
 }
 func (m *Flow) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Flow.Unmarshal(m, b)
@@ -462,7 +462,7 @@ func (m *PortStats) Reset()         { *m = PortStats{} }
 func (m *PortStats) String() string { return proto.CompactTextString(m) }
 func (*PortStats) ProtoMessage()    {}
 func (*PortStats) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{9}
+	return fileDescriptor_agent_1b27343cc2913682, []int{9}
 }
 func (m *PortStats) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PortStats.Unmarshal(m, b)
@@ -501,7 +501,7 @@ func (m *DumpBridgePortRequest) Reset()         { *m = DumpBridgePortRequest{} }
 func (m *DumpBridgePortRequest) String() string { return proto.CompactTextString(m) }
 func (*DumpBridgePortRequest) ProtoMessage()    {}
 func (*DumpBridgePortRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{10}
+	return fileDescriptor_agent_1b27343cc2913682, []int{10}
 }
 func (m *DumpBridgePortRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DumpBridgePortRequest.Unmarshal(m, b)
@@ -548,7 +548,7 @@ func (m *DumpBridgePortResponse) Reset()         { *m = DumpBridgePortResponse{}
 func (m *DumpBridgePortResponse) String() string { return proto.CompactTextString(m) }
 func (*DumpBridgePortResponse) ProtoMessage()    {}
 func (*DumpBridgePortResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_agent_3f2a378016922cd7, []int{11}
+	return fileDescriptor_agent_1b27343cc2913682, []int{11}
 }
 func (m *DumpBridgePortResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DumpBridgePortResponse.Unmarshal(m, b)
@@ -589,6 +589,1320 @@ func (m *DumpBridgePortResponse) GetPortStats() *PortStats {
 	return nil
 }
 
+type AnnounceGuestRequest struct {
+	GuestId string `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	// announce all nics of the guest if empty
+	Mac string `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	// use configured count if zero
+	Count                uint32   `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AnnounceGuestRequest) Reset()         { *m = AnnounceGuestRequest{} }
+func (m *AnnounceGuestRequest) String() string { return proto.CompactTextString(m) }
+func (*AnnounceGuestRequest) ProtoMessage()    {}
+func (*AnnounceGuestRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{12}
+}
+func (m *AnnounceGuestRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AnnounceGuestRequest.Unmarshal(m, b)
+}
+func (m *AnnounceGuestRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AnnounceGuestRequest.Marshal(b, m, deterministic)
+}
+func (dst *AnnounceGuestRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AnnounceGuestRequest.Merge(dst, src)
+}
+func (m *AnnounceGuestRequest) XXX_Size() int {
+	return xxx_messageInfo_AnnounceGuestRequest.Size(m)
+}
+func (m *AnnounceGuestRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AnnounceGuestRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AnnounceGuestRequest proto.InternalMessageInfo
+
+func (m *AnnounceGuestRequest) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+func (m *AnnounceGuestRequest) GetMac() string {
+	if m != nil {
+		return m.Mac
+	}
+	return ""
+}
+
+func (m *AnnounceGuestRequest) GetCount() uint32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+type ListVipOwnersRequest struct {
+	// all bridges if empty
+	Bridge               string   `protobuf:"bytes,1,opt,name=bridge,proto3" json:"bridge,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListVipOwnersRequest) Reset()         { *m = ListVipOwnersRequest{} }
+func (m *ListVipOwnersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListVipOwnersRequest) ProtoMessage()    {}
+func (*ListVipOwnersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{13}
+}
+func (m *ListVipOwnersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListVipOwnersRequest.Unmarshal(m, b)
+}
+func (m *ListVipOwnersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListVipOwnersRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListVipOwnersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListVipOwnersRequest.Merge(dst, src)
+}
+func (m *ListVipOwnersRequest) XXX_Size() int {
+	return xxx_messageInfo_ListVipOwnersRequest.Size(m)
+}
+func (m *ListVipOwnersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListVipOwnersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListVipOwnersRequest proto.InternalMessageInfo
+
+func (m *ListVipOwnersRequest) GetBridge() string {
+	if m != nil {
+		return m.Bridge
+	}
+	return ""
+}
+
+type VipOwner struct {
+	Vip                  string   `protobuf:"bytes,1,opt,name=vip,proto3" json:"vip,omitempty"`
+	Bridge               string   `protobuf:"bytes,2,opt,name=bridge,proto3" json:"bridge,omitempty"`
+	PortNo               uint32   `protobuf:"varint,3,opt,name=port_no,json=portNo,proto3" json:"port_no,omitempty"`
+	GuestId              string   `protobuf:"bytes,4,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	Mac                  string   `protobuf:"bytes,5,opt,name=mac,proto3" json:"mac,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VipOwner) Reset()         { *m = VipOwner{} }
+func (m *VipOwner) String() string { return proto.CompactTextString(m) }
+func (*VipOwner) ProtoMessage()    {}
+func (*VipOwner) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{14}
+}
+func (m *VipOwner) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VipOwner.Unmarshal(m, b)
+}
+func (m *VipOwner) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VipOwner.Marshal(b, m, deterministic)
+}
+func (dst *VipOwner) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VipOwner.Merge(dst, src)
+}
+func (m *VipOwner) XXX_Size() int {
+	return xxx_messageInfo_VipOwner.Size(m)
+}
+func (m *VipOwner) XXX_DiscardUnknown() {
+	xxx_messageInfo_VipOwner.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VipOwner proto.InternalMessageInfo
+
+func (m *VipOwner) GetVip() string {
+	if m != nil {
+		return m.Vip
+	}
+	return ""
+}
+
+func (m *VipOwner) GetBridge() string {
+	if m != nil {
+		return m.Bridge
+	}
+	return ""
+}
+
+func (m *VipOwner) GetPortNo() uint32 {
+	if m != nil {
+		return m.PortNo
+	}
+	return 0
+}
+
+func (m *VipOwner) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+func (m *VipOwner) GetMac() string {
+	if m != nil {
+		return m.Mac
+	}
+	return ""
+}
+
+type ListVipOwnersResponse struct {
+	Code                 uint32      `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string      `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Owners               []*VipOwner `protobuf:"bytes,3,rep,name=owners,proto3" json:"owners,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ListVipOwnersResponse) Reset()         { *m = ListVipOwnersResponse{} }
+func (m *ListVipOwnersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListVipOwnersResponse) ProtoMessage()    {}
+func (*ListVipOwnersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{15}
+}
+func (m *ListVipOwnersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListVipOwnersResponse.Unmarshal(m, b)
+}
+func (m *ListVipOwnersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListVipOwnersResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListVipOwnersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListVipOwnersResponse.Merge(dst, src)
+}
+func (m *ListVipOwnersResponse) XXX_Size() int {
+	return xxx_messageInfo_ListVipOwnersResponse.Size(m)
+}
+func (m *ListVipOwnersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListVipOwnersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListVipOwnersResponse proto.InternalMessageInfo
+
+func (m *ListVipOwnersResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *ListVipOwnersResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *ListVipOwnersResponse) GetOwners() []*VipOwner {
+	if m != nil {
+		return m.Owners
+	}
+	return nil
+}
+
+type GetGuestTcStatsRequest struct {
+	GuestId string `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	// all nics of the guest if empty
+	Mac                  string   `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetGuestTcStatsRequest) Reset()         { *m = GetGuestTcStatsRequest{} }
+func (m *GetGuestTcStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetGuestTcStatsRequest) ProtoMessage()    {}
+func (*GetGuestTcStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{16}
+}
+func (m *GetGuestTcStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetGuestTcStatsRequest.Unmarshal(m, b)
+}
+func (m *GetGuestTcStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetGuestTcStatsRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetGuestTcStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetGuestTcStatsRequest.Merge(dst, src)
+}
+func (m *GetGuestTcStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetGuestTcStatsRequest.Size(m)
+}
+func (m *GetGuestTcStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetGuestTcStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetGuestTcStatsRequest proto.InternalMessageInfo
+
+func (m *GetGuestTcStatsRequest) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+func (m *GetGuestTcStatsRequest) GetMac() string {
+	if m != nil {
+		return m.Mac
+	}
+	return ""
+}
+
+type TcStats struct {
+	// device of the object, e.g. tap, ifb or host interface, or bridge
+	// of meters
+	Ifname string `protobuf:"bytes,1,opt,name=ifname,proto3" json:"ifname,omitempty"`
+	// "qdisc", "class", or "meter" of ovs
+	Type string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Kind string `protobuf:"bytes,3,opt,name=kind,proto3" json:"kind,omitempty"`
+	// handle of qdisc, classid of class or id of meter
+	Id                   string   `protobuf:"bytes,4,opt,name=id,proto3" json:"id,omitempty"`
+	Parent               string   `protobuf:"bytes,5,opt,name=parent,proto3" json:"parent,omitempty"`
+	Bytes                uint64   `protobuf:"varint,6,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Packets              uint64   `protobuf:"varint,7,opt,name=packets,proto3" json:"packets,omitempty"`
+	Drops                uint64   `protobuf:"varint,8,opt,name=drops,proto3" json:"drops,omitempty"`
+	Overlimits           uint64   `protobuf:"varint,9,opt,name=overlimits,proto3" json:"overlimits,omitempty"`
+	Requeues             uint64   `protobuf:"varint,10,opt,name=requeues,proto3" json:"requeues,omitempty"`
+	BacklogBytes         uint64   `protobuf:"varint,11,opt,name=backlog_bytes,json=backlogBytes,proto3" json:"backlog_bytes,omitempty"`
+	BacklogPackets       uint64   `protobuf:"varint,12,opt,name=backlog_packets,json=backlogPackets,proto3" json:"backlog_packets,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TcStats) Reset()         { *m = TcStats{} }
+func (m *TcStats) String() string { return proto.CompactTextString(m) }
+func (*TcStats) ProtoMessage()    {}
+func (*TcStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{17}
+}
+func (m *TcStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TcStats.Unmarshal(m, b)
+}
+func (m *TcStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TcStats.Marshal(b, m, deterministic)
+}
+func (dst *TcStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TcStats.Merge(dst, src)
+}
+func (m *TcStats) XXX_Size() int {
+	return xxx_messageInfo_TcStats.Size(m)
+}
+func (m *TcStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_TcStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TcStats proto.InternalMessageInfo
+
+func (m *TcStats) GetIfname() string {
+	if m != nil {
+		return m.Ifname
+	}
+	return ""
+}
+
+func (m *TcStats) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *TcStats) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *TcStats) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *TcStats) GetParent() string {
+	if m != nil {
+		return m.Parent
+	}
+	return ""
+}
+
+func (m *TcStats) GetBytes() uint64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+func (m *TcStats) GetPackets() uint64 {
+	if m != nil {
+		return m.Packets
+	}
+	return 0
+}
+
+func (m *TcStats) GetDrops() uint64 {
+	if m != nil {
+		return m.Drops
+	}
+	return 0
+}
+
+func (m *TcStats) GetOverlimits() uint64 {
+	if m != nil {
+		return m.Overlimits
+	}
+	return 0
+}
+
+func (m *TcStats) GetRequeues() uint64 {
+	if m != nil {
+		return m.Requeues
+	}
+	return 0
+}
+
+func (m *TcStats) GetBacklogBytes() uint64 {
+	if m != nil {
+		return m.BacklogBytes
+	}
+	return 0
+}
+
+func (m *TcStats) GetBacklogPackets() uint64 {
+	if m != nil {
+		return m.BacklogPackets
+	}
+	return 0
+}
+
+type GuestNicTcStats struct {
+	Mac                  string     `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	Ifname               string     `protobuf:"bytes,2,opt,name=ifname,proto3" json:"ifname,omitempty"`
+	Stats                []*TcStats `protobuf:"bytes,3,rep,name=stats,proto3" json:"stats,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *GuestNicTcStats) Reset()         { *m = GuestNicTcStats{} }
+func (m *GuestNicTcStats) String() string { return proto.CompactTextString(m) }
+func (*GuestNicTcStats) ProtoMessage()    {}
+func (*GuestNicTcStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{18}
+}
+func (m *GuestNicTcStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GuestNicTcStats.Unmarshal(m, b)
+}
+func (m *GuestNicTcStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GuestNicTcStats.Marshal(b, m, deterministic)
+}
+func (dst *GuestNicTcStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GuestNicTcStats.Merge(dst, src)
+}
+func (m *GuestNicTcStats) XXX_Size() int {
+	return xxx_messageInfo_GuestNicTcStats.Size(m)
+}
+func (m *GuestNicTcStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_GuestNicTcStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GuestNicTcStats proto.InternalMessageInfo
+
+func (m *GuestNicTcStats) GetMac() string {
+	if m != nil {
+		return m.Mac
+	}
+	return ""
+}
+
+func (m *GuestNicTcStats) GetIfname() string {
+	if m != nil {
+		return m.Ifname
+	}
+	return ""
+}
+
+func (m *GuestNicTcStats) GetStats() []*TcStats {
+	if m != nil {
+		return m.Stats
+	}
+	return nil
+}
+
+type GetGuestTcStatsResponse struct {
+	Code                 uint32             `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string             `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Nics                 []*GuestNicTcStats `protobuf:"bytes,3,rep,name=nics,proto3" json:"nics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *GetGuestTcStatsResponse) Reset()         { *m = GetGuestTcStatsResponse{} }
+func (m *GetGuestTcStatsResponse) String() string { return proto.CompactTextString(m) }
+func (*GetGuestTcStatsResponse) ProtoMessage()    {}
+func (*GetGuestTcStatsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{19}
+}
+func (m *GetGuestTcStatsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetGuestTcStatsResponse.Unmarshal(m, b)
+}
+func (m *GetGuestTcStatsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetGuestTcStatsResponse.Marshal(b, m, deterministic)
+}
+func (dst *GetGuestTcStatsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetGuestTcStatsResponse.Merge(dst, src)
+}
+func (m *GetGuestTcStatsResponse) XXX_Size() int {
+	return xxx_messageInfo_GetGuestTcStatsResponse.Size(m)
+}
+func (m *GetGuestTcStatsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetGuestTcStatsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetGuestTcStatsResponse proto.InternalMessageInfo
+
+func (m *GetGuestTcStatsResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *GetGuestTcStatsResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *GetGuestTcStatsResponse) GetNics() []*GuestNicTcStats {
+	if m != nil {
+		return m.Nics
+	}
+	return nil
+}
+
+type ListCtZonesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListCtZonesRequest) Reset()         { *m = ListCtZonesRequest{} }
+func (m *ListCtZonesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListCtZonesRequest) ProtoMessage()    {}
+func (*ListCtZonesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{20}
+}
+func (m *ListCtZonesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListCtZonesRequest.Unmarshal(m, b)
+}
+func (m *ListCtZonesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListCtZonesRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListCtZonesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListCtZonesRequest.Merge(dst, src)
+}
+func (m *ListCtZonesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListCtZonesRequest.Size(m)
+}
+func (m *ListCtZonesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListCtZonesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListCtZonesRequest proto.InternalMessageInfo
+
+type CtZone struct {
+	Zone uint32 `protobuf:"varint,1,opt,name=zone,proto3" json:"zone,omitempty"`
+	// mac of guest nic the zone is allocated to, empty for zones used by
+	// others
+	Mac string `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	// owner of zones used by others, e.g. "br-int:ct-zone-<port>"
+	Owner string `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	// loaded from file and not allocated since restart
+	Stale                bool     `protobuf:"varint,4,opt,name=stale,proto3" json:"stale,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CtZone) Reset()         { *m = CtZone{} }
+func (m *CtZone) String() string { return proto.CompactTextString(m) }
+func (*CtZone) ProtoMessage()    {}
+func (*CtZone) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{21}
+}
+func (m *CtZone) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CtZone.Unmarshal(m, b)
+}
+func (m *CtZone) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CtZone.Marshal(b, m, deterministic)
+}
+func (dst *CtZone) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CtZone.Merge(dst, src)
+}
+func (m *CtZone) XXX_Size() int {
+	return xxx_messageInfo_CtZone.Size(m)
+}
+func (m *CtZone) XXX_DiscardUnknown() {
+	xxx_messageInfo_CtZone.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CtZone proto.InternalMessageInfo
+
+func (m *CtZone) GetZone() uint32 {
+	if m != nil {
+		return m.Zone
+	}
+	return 0
+}
+
+func (m *CtZone) GetMac() string {
+	if m != nil {
+		return m.Mac
+	}
+	return ""
+}
+
+func (m *CtZone) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *CtZone) GetStale() bool {
+	if m != nil {
+		return m.Stale
+	}
+	return false
+}
+
+type ListCtZonesResponse struct {
+	Code                 uint32    `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string    `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Zones                []*CtZone `protobuf:"bytes,3,rep,name=zones,proto3" json:"zones,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListCtZonesResponse) Reset()         { *m = ListCtZonesResponse{} }
+func (m *ListCtZonesResponse) String() string { return proto.CompactTextString(m) }
+func (*ListCtZonesResponse) ProtoMessage()    {}
+func (*ListCtZonesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{22}
+}
+func (m *ListCtZonesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListCtZonesResponse.Unmarshal(m, b)
+}
+func (m *ListCtZonesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListCtZonesResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListCtZonesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListCtZonesResponse.Merge(dst, src)
+}
+func (m *ListCtZonesResponse) XXX_Size() int {
+	return xxx_messageInfo_ListCtZonesResponse.Size(m)
+}
+func (m *ListCtZonesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListCtZonesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListCtZonesResponse proto.InternalMessageInfo
+
+func (m *ListCtZonesResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *ListCtZonesResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *ListCtZonesResponse) GetZones() []*CtZone {
+	if m != nil {
+		return m.Zones
+	}
+	return nil
+}
+
+type GuestEventRequest struct {
+	GuestId string `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	// "started", "stopped", "migrated", "nic_hotplug", or "desc" for other
+	// desc changes
+	Event string `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	// content of the desc file, which is read instead if empty
+	Desc                 string   `protobuf:"bytes,3,opt,name=desc,proto3" json:"desc,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GuestEventRequest) Reset()         { *m = GuestEventRequest{} }
+func (m *GuestEventRequest) String() string { return proto.CompactTextString(m) }
+func (*GuestEventRequest) ProtoMessage()    {}
+func (*GuestEventRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{23}
+}
+func (m *GuestEventRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GuestEventRequest.Unmarshal(m, b)
+}
+func (m *GuestEventRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GuestEventRequest.Marshal(b, m, deterministic)
+}
+func (dst *GuestEventRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GuestEventRequest.Merge(dst, src)
+}
+func (m *GuestEventRequest) XXX_Size() int {
+	return xxx_messageInfo_GuestEventRequest.Size(m)
+}
+func (m *GuestEventRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GuestEventRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GuestEventRequest proto.InternalMessageInfo
+
+func (m *GuestEventRequest) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+func (m *GuestEventRequest) GetEvent() string {
+	if m != nil {
+		return m.Event
+	}
+	return ""
+}
+
+func (m *GuestEventRequest) GetDesc() string {
+	if m != nil {
+		return m.Desc
+	}
+	return ""
+}
+
+type GuestStatus struct {
+	GuestId string `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	// "active", "pending", "stopped", "migration_staged", "volatile" or
+	// "error"
+	Phase string `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
+	// error of the last update
+	Mesg string `protobuf:"bytes,3,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	// unix time settings were last applied without error, 0 for never
+	LastApplied int64 `protobuf:"varint,4,opt,name=last_applied,json=lastApplied,proto3" json:"last_applied,omitempty"`
+	// number of flows of all nics
+	Flows                uint32            `protobuf:"varint,5,opt,name=flows,proto3" json:"flows,omitempty"`
+	Nics                 []*GuestNicStatus `protobuf:"bytes,6,rep,name=nics,proto3" json:"nics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *GuestStatus) Reset()         { *m = GuestStatus{} }
+func (m *GuestStatus) String() string { return proto.CompactTextString(m) }
+func (*GuestStatus) ProtoMessage()    {}
+func (*GuestStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{24}
+}
+func (m *GuestStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GuestStatus.Unmarshal(m, b)
+}
+func (m *GuestStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GuestStatus.Marshal(b, m, deterministic)
+}
+func (dst *GuestStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GuestStatus.Merge(dst, src)
+}
+func (m *GuestStatus) XXX_Size() int {
+	return xxx_messageInfo_GuestStatus.Size(m)
+}
+func (m *GuestStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_GuestStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GuestStatus proto.InternalMessageInfo
+
+func (m *GuestStatus) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+func (m *GuestStatus) GetPhase() string {
+	if m != nil {
+		return m.Phase
+	}
+	return ""
+}
+
+func (m *GuestStatus) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *GuestStatus) GetLastApplied() int64 {
+	if m != nil {
+		return m.LastApplied
+	}
+	return 0
+}
+
+func (m *GuestStatus) GetFlows() uint32 {
+	if m != nil {
+		return m.Flows
+	}
+	return 0
+}
+
+func (m *GuestStatus) GetNics() []*GuestNicStatus {
+	if m != nil {
+		return m.Nics
+	}
+	return nil
+}
+
+type GuestNicStatus struct {
+	Mac    string `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	Ifname string `protobuf:"bytes,2,opt,name=ifname,proto3" json:"ifname,omitempty"`
+	Bridge string `protobuf:"bytes,3,opt,name=bridge,proto3" json:"bridge,omitempty"`
+	// openflow port number, 0 if not resolved
+	PortNo uint32 `protobuf:"varint,4,opt,name=port_no,json=portNo,proto3" json:"port_no,omitempty"`
+	CtZone uint32 `protobuf:"varint,5,opt,name=ct_zone,json=ctZone,proto3" json:"ct_zone,omitempty"`
+	Flows  uint32 `protobuf:"varint,6,opt,name=flows,proto3" json:"flows,omitempty"`
+	// "disabled", "pending", "ok" or "error"
+	TcState string `protobuf:"bytes,7,opt,name=tc_state,json=tcState,proto3" json:"tc_state,omitempty"`
+	TcMesg  string `protobuf:"bytes,8,opt,name=tc_mesg,json=tcMesg,proto3" json:"tc_mesg,omitempty"`
+	// error of the nic in the last update, e.g. port not found
+	Mesg                 string   `protobuf:"bytes,9,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GuestNicStatus) Reset()         { *m = GuestNicStatus{} }
+func (m *GuestNicStatus) String() string { return proto.CompactTextString(m) }
+func (*GuestNicStatus) ProtoMessage()    {}
+func (*GuestNicStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{25}
+}
+func (m *GuestNicStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GuestNicStatus.Unmarshal(m, b)
+}
+func (m *GuestNicStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GuestNicStatus.Marshal(b, m, deterministic)
+}
+func (dst *GuestNicStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GuestNicStatus.Merge(dst, src)
+}
+func (m *GuestNicStatus) XXX_Size() int {
+	return xxx_messageInfo_GuestNicStatus.Size(m)
+}
+func (m *GuestNicStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_GuestNicStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GuestNicStatus proto.InternalMessageInfo
+
+func (m *GuestNicStatus) GetMac() string {
+	if m != nil {
+		return m.Mac
+	}
+	return ""
+}
+
+func (m *GuestNicStatus) GetIfname() string {
+	if m != nil {
+		return m.Ifname
+	}
+	return ""
+}
+
+func (m *GuestNicStatus) GetBridge() string {
+	if m != nil {
+		return m.Bridge
+	}
+	return ""
+}
+
+func (m *GuestNicStatus) GetPortNo() uint32 {
+	if m != nil {
+		return m.PortNo
+	}
+	return 0
+}
+
+func (m *GuestNicStatus) GetCtZone() uint32 {
+	if m != nil {
+		return m.CtZone
+	}
+	return 0
+}
+
+func (m *GuestNicStatus) GetFlows() uint32 {
+	if m != nil {
+		return m.Flows
+	}
+	return 0
+}
+
+func (m *GuestNicStatus) GetTcState() string {
+	if m != nil {
+		return m.TcState
+	}
+	return ""
+}
+
+func (m *GuestNicStatus) GetTcMesg() string {
+	if m != nil {
+		return m.TcMesg
+	}
+	return ""
+}
+
+func (m *GuestNicStatus) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+type GuestEventResponse struct {
+	Code                 uint32       `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string       `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Status               *GuestStatus `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *GuestEventResponse) Reset()         { *m = GuestEventResponse{} }
+func (m *GuestEventResponse) String() string { return proto.CompactTextString(m) }
+func (*GuestEventResponse) ProtoMessage()    {}
+func (*GuestEventResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{26}
+}
+func (m *GuestEventResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GuestEventResponse.Unmarshal(m, b)
+}
+func (m *GuestEventResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GuestEventResponse.Marshal(b, m, deterministic)
+}
+func (dst *GuestEventResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GuestEventResponse.Merge(dst, src)
+}
+func (m *GuestEventResponse) XXX_Size() int {
+	return xxx_messageInfo_GuestEventResponse.Size(m)
+}
+func (m *GuestEventResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GuestEventResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GuestEventResponse proto.InternalMessageInfo
+
+func (m *GuestEventResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *GuestEventResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *GuestEventResponse) GetStatus() *GuestStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type GetGuestStatusRequest struct {
+	GuestId              string   `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetGuestStatusRequest) Reset()         { *m = GetGuestStatusRequest{} }
+func (m *GetGuestStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*GetGuestStatusRequest) ProtoMessage()    {}
+func (*GetGuestStatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{27}
+}
+func (m *GetGuestStatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetGuestStatusRequest.Unmarshal(m, b)
+}
+func (m *GetGuestStatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetGuestStatusRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetGuestStatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetGuestStatusRequest.Merge(dst, src)
+}
+func (m *GetGuestStatusRequest) XXX_Size() int {
+	return xxx_messageInfo_GetGuestStatusRequest.Size(m)
+}
+func (m *GetGuestStatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetGuestStatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetGuestStatusRequest proto.InternalMessageInfo
+
+func (m *GetGuestStatusRequest) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+type GetGuestStatusResponse struct {
+	Code                 uint32       `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string       `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Status               *GuestStatus `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *GetGuestStatusResponse) Reset()         { *m = GetGuestStatusResponse{} }
+func (m *GetGuestStatusResponse) String() string { return proto.CompactTextString(m) }
+func (*GetGuestStatusResponse) ProtoMessage()    {}
+func (*GetGuestStatusResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{28}
+}
+func (m *GetGuestStatusResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetGuestStatusResponse.Unmarshal(m, b)
+}
+func (m *GetGuestStatusResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetGuestStatusResponse.Marshal(b, m, deterministic)
+}
+func (dst *GetGuestStatusResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetGuestStatusResponse.Merge(dst, src)
+}
+func (m *GetGuestStatusResponse) XXX_Size() int {
+	return xxx_messageInfo_GetGuestStatusResponse.Size(m)
+}
+func (m *GetGuestStatusResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetGuestStatusResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetGuestStatusResponse proto.InternalMessageInfo
+
+func (m *GetGuestStatusResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *GetGuestStatusResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *GetGuestStatusResponse) GetStatus() *GuestStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type ListGuestsRequest struct {
+	// guests in all phases if empty
+	Phase                string   `protobuf:"bytes,1,opt,name=phase,proto3" json:"phase,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListGuestsRequest) Reset()         { *m = ListGuestsRequest{} }
+func (m *ListGuestsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListGuestsRequest) ProtoMessage()    {}
+func (*ListGuestsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{29}
+}
+func (m *ListGuestsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListGuestsRequest.Unmarshal(m, b)
+}
+func (m *ListGuestsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListGuestsRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListGuestsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListGuestsRequest.Merge(dst, src)
+}
+func (m *ListGuestsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListGuestsRequest.Size(m)
+}
+func (m *ListGuestsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListGuestsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListGuestsRequest proto.InternalMessageInfo
+
+func (m *ListGuestsRequest) GetPhase() string {
+	if m != nil {
+		return m.Phase
+	}
+	return ""
+}
+
+type ListGuestsResponse struct {
+	Code                 uint32         `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string         `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Guests               []*GuestStatus `protobuf:"bytes,3,rep,name=guests,proto3" json:"guests,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ListGuestsResponse) Reset()         { *m = ListGuestsResponse{} }
+func (m *ListGuestsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListGuestsResponse) ProtoMessage()    {}
+func (*ListGuestsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{30}
+}
+func (m *ListGuestsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListGuestsResponse.Unmarshal(m, b)
+}
+func (m *ListGuestsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListGuestsResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListGuestsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListGuestsResponse.Merge(dst, src)
+}
+func (m *ListGuestsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListGuestsResponse.Size(m)
+}
+func (m *ListGuestsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListGuestsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListGuestsResponse proto.InternalMessageInfo
+
+func (m *ListGuestsResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *ListGuestsResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *ListGuestsResponse) GetGuests() []*GuestStatus {
+	if m != nil {
+		return m.Guests
+	}
+	return nil
+}
+
+type GetMetadataStatsRequest struct {
+	// all guests if empty
+	GuestId              string   `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetMetadataStatsRequest) Reset()         { *m = GetMetadataStatsRequest{} }
+func (m *GetMetadataStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetMetadataStatsRequest) ProtoMessage()    {}
+func (*GetMetadataStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{31}
+}
+func (m *GetMetadataStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetMetadataStatsRequest.Unmarshal(m, b)
+}
+func (m *GetMetadataStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetMetadataStatsRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetMetadataStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetMetadataStatsRequest.Merge(dst, src)
+}
+func (m *GetMetadataStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetMetadataStatsRequest.Size(m)
+}
+func (m *GetMetadataStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetMetadataStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetMetadataStatsRequest proto.InternalMessageInfo
+
+func (m *GetMetadataStatsRequest) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+// MetadataStats counts requests of a guest to the classic metadata server
+// on a bridge
+type MetadataStats struct {
+	GuestId  string `protobuf:"bytes,1,opt,name=guest_id,json=guestId,proto3" json:"guest_id,omitempty"`
+	Bridge   string `protobuf:"bytes,2,opt,name=bridge,proto3" json:"bridge,omitempty"`
+	Requests uint64 `protobuf:"varint,3,opt,name=requests,proto3" json:"requests,omitempty"`
+	// rejected for going over the rate or concurrency limits
+	Throttled uint64 `protobuf:"varint,4,opt,name=throttled,proto3" json:"throttled,omitempty"`
+	// rejected for paths not allowed
+	Denied uint64 `protobuf:"varint,5,opt,name=denied,proto3" json:"denied,omitempty"`
+	// responded with 5xx
+	Errors               uint64   `protobuf:"varint,6,opt,name=errors,proto3" json:"errors,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MetadataStats) Reset()         { *m = MetadataStats{} }
+func (m *MetadataStats) String() string { return proto.CompactTextString(m) }
+func (*MetadataStats) ProtoMessage()    {}
+func (*MetadataStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{32}
+}
+func (m *MetadataStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetadataStats.Unmarshal(m, b)
+}
+func (m *MetadataStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetadataStats.Marshal(b, m, deterministic)
+}
+func (dst *MetadataStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetadataStats.Merge(dst, src)
+}
+func (m *MetadataStats) XXX_Size() int {
+	return xxx_messageInfo_MetadataStats.Size(m)
+}
+func (m *MetadataStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetadataStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetadataStats proto.InternalMessageInfo
+
+func (m *MetadataStats) GetGuestId() string {
+	if m != nil {
+		return m.GuestId
+	}
+	return ""
+}
+
+func (m *MetadataStats) GetBridge() string {
+	if m != nil {
+		return m.Bridge
+	}
+	return ""
+}
+
+func (m *MetadataStats) GetRequests() uint64 {
+	if m != nil {
+		return m.Requests
+	}
+	return 0
+}
+
+func (m *MetadataStats) GetThrottled() uint64 {
+	if m != nil {
+		return m.Throttled
+	}
+	return 0
+}
+
+func (m *MetadataStats) GetDenied() uint64 {
+	if m != nil {
+		return m.Denied
+	}
+	return 0
+}
+
+func (m *MetadataStats) GetErrors() uint64 {
+	if m != nil {
+		return m.Errors
+	}
+	return 0
+}
+
+type GetMetadataStatsResponse struct {
+	Code                 uint32           `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Mesg                 string           `protobuf:"bytes,2,opt,name=mesg,proto3" json:"mesg,omitempty"`
+	Stats                []*MetadataStats `protobuf:"bytes,3,rep,name=stats,proto3" json:"stats,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *GetMetadataStatsResponse) Reset()         { *m = GetMetadataStatsResponse{} }
+func (m *GetMetadataStatsResponse) String() string { return proto.CompactTextString(m) }
+func (*GetMetadataStatsResponse) ProtoMessage()    {}
+func (*GetMetadataStatsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_agent_1b27343cc2913682, []int{33}
+}
+func (m *GetMetadataStatsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetMetadataStatsResponse.Unmarshal(m, b)
+}
+func (m *GetMetadataStatsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetMetadataStatsResponse.Marshal(b, m, deterministic)
+}
+func (dst *GetMetadataStatsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetMetadataStatsResponse.Merge(dst, src)
+}
+func (m *GetMetadataStatsResponse) XXX_Size() int {
+	return xxx_messageInfo_GetMetadataStatsResponse.Size(m)
+}
+func (m *GetMetadataStatsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetMetadataStatsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetMetadataStatsResponse proto.InternalMessageInfo
+
+func (m *GetMetadataStatsResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *GetMetadataStatsResponse) GetMesg() string {
+	if m != nil {
+		return m.Mesg
+	}
+	return ""
+}
+
+func (m *GetMetadataStatsResponse) GetStats() []*MetadataStats {
+	if m != nil {
+		return m.Stats
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Response)(nil), "pb.Response")
 	proto.RegisterType((*AddBridgeRequest)(nil), "pb.AddBridgeRequest")
@@ -602,6 +1916,28 @@ func init() {
 	proto.RegisterType((*PortStats)(nil), "pb.PortStats")
 	proto.RegisterType((*DumpBridgePortRequest)(nil), "pb.DumpBridgePortRequest")
 	proto.RegisterType((*DumpBridgePortResponse)(nil), "pb.DumpBridgePortResponse")
+	proto.RegisterType((*AnnounceGuestRequest)(nil), "pb.AnnounceGuestRequest")
+	proto.RegisterType((*ListVipOwnersRequest)(nil), "pb.ListVipOwnersRequest")
+	proto.RegisterType((*VipOwner)(nil), "pb.VipOwner")
+	proto.RegisterType((*ListVipOwnersResponse)(nil), "pb.ListVipOwnersResponse")
+	proto.RegisterType((*GetGuestTcStatsRequest)(nil), "pb.GetGuestTcStatsRequest")
+	proto.RegisterType((*TcStats)(nil), "pb.TcStats")
+	proto.RegisterType((*GuestNicTcStats)(nil), "pb.GuestNicTcStats")
+	proto.RegisterType((*GetGuestTcStatsResponse)(nil), "pb.GetGuestTcStatsResponse")
+	proto.RegisterType((*ListCtZonesRequest)(nil), "pb.ListCtZonesRequest")
+	proto.RegisterType((*CtZone)(nil), "pb.CtZone")
+	proto.RegisterType((*ListCtZonesResponse)(nil), "pb.ListCtZonesResponse")
+	proto.RegisterType((*GuestEventRequest)(nil), "pb.GuestEventRequest")
+	proto.RegisterType((*GuestStatus)(nil), "pb.GuestStatus")
+	proto.RegisterType((*GuestNicStatus)(nil), "pb.GuestNicStatus")
+	proto.RegisterType((*GuestEventResponse)(nil), "pb.GuestEventResponse")
+	proto.RegisterType((*GetGuestStatusRequest)(nil), "pb.GetGuestStatusRequest")
+	proto.RegisterType((*GetGuestStatusResponse)(nil), "pb.GetGuestStatusResponse")
+	proto.RegisterType((*ListGuestsRequest)(nil), "pb.ListGuestsRequest")
+	proto.RegisterType((*ListGuestsResponse)(nil), "pb.ListGuestsResponse")
+	proto.RegisterType((*GetMetadataStatsRequest)(nil), "pb.GetMetadataStatsRequest")
+	proto.RegisterType((*MetadataStats)(nil), "pb.MetadataStats")
+	proto.RegisterType((*GetMetadataStatsResponse)(nil), "pb.GetMetadataStatsResponse")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -783,6 +2119,10 @@ type OpenflowClient interface {
 	DelFlow(ctx context.Context, in *DelFlowRequest, opts ...grpc.CallOption) (*Response, error)
 	SyncFlows(ctx context.Context, in *SyncFlowsRequest, opts ...grpc.CallOption) (*Response, error)
 	DumpBridgePort(ctx context.Context, in *DumpBridgePortRequest, opts ...grpc.CallOption) (*DumpBridgePortResponse, error)
+	AnnounceGuest(ctx context.Context, in *AnnounceGuestRequest, opts ...grpc.CallOption) (*Response, error)
+	ListVipOwners(ctx context.Context, in *ListVipOwnersRequest, opts ...grpc.CallOption) (*ListVipOwnersResponse, error)
+	GetGuestTcStats(ctx context.Context, in *GetGuestTcStatsRequest, opts ...grpc.CallOption) (*GetGuestTcStatsResponse, error)
+	ListCtZones(ctx context.Context, in *ListCtZonesRequest, opts ...grpc.CallOption) (*ListCtZonesResponse, error)
 }
 
 type openflowClient struct {
@@ -829,12 +2169,52 @@ func (c *openflowClient) DumpBridgePort(ctx context.Context, in *DumpBridgePortR
 	return out, nil
 }
 
+func (c *openflowClient) AnnounceGuest(ctx context.Context, in *AnnounceGuestRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/pb.Openflow/AnnounceGuest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openflowClient) ListVipOwners(ctx context.Context, in *ListVipOwnersRequest, opts ...grpc.CallOption) (*ListVipOwnersResponse, error) {
+	out := new(ListVipOwnersResponse)
+	err := c.cc.Invoke(ctx, "/pb.Openflow/ListVipOwners", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openflowClient) GetGuestTcStats(ctx context.Context, in *GetGuestTcStatsRequest, opts ...grpc.CallOption) (*GetGuestTcStatsResponse, error) {
+	out := new(GetGuestTcStatsResponse)
+	err := c.cc.Invoke(ctx, "/pb.Openflow/GetGuestTcStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openflowClient) ListCtZones(ctx context.Context, in *ListCtZonesRequest, opts ...grpc.CallOption) (*ListCtZonesResponse, error) {
+	out := new(ListCtZonesResponse)
+	err := c.cc.Invoke(ctx, "/pb.Openflow/ListCtZones", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // OpenflowServer is the server API for Openflow service.
 type OpenflowServer interface {
 	AddFlow(context.Context, *AddFlowRequest) (*Response, error)
 	DelFlow(context.Context, *DelFlowRequest) (*Response, error)
 	SyncFlows(context.Context, *SyncFlowsRequest) (*Response, error)
 	DumpBridgePort(context.Context, *DumpBridgePortRequest) (*DumpBridgePortResponse, error)
+	AnnounceGuest(context.Context, *AnnounceGuestRequest) (*Response, error)
+	ListVipOwners(context.Context, *ListVipOwnersRequest) (*ListVipOwnersResponse, error)
+	GetGuestTcStats(context.Context, *GetGuestTcStatsRequest) (*GetGuestTcStatsResponse, error)
+	ListCtZones(context.Context, *ListCtZonesRequest) (*ListCtZonesResponse, error)
 }
 
 func RegisterOpenflowServer(s *grpc.Server, srv OpenflowServer) {
@@ -913,6 +2293,78 @@ func _Openflow_DumpBridgePort_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Openflow_AnnounceGuest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnnounceGuestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenflowServer).AnnounceGuest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Openflow/AnnounceGuest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenflowServer).AnnounceGuest(ctx, req.(*AnnounceGuestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Openflow_ListVipOwners_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVipOwnersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenflowServer).ListVipOwners(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Openflow/ListVipOwners",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenflowServer).ListVipOwners(ctx, req.(*ListVipOwnersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Openflow_GetGuestTcStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGuestTcStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenflowServer).GetGuestTcStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Openflow/GetGuestTcStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenflowServer).GetGuestTcStats(ctx, req.(*GetGuestTcStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Openflow_ListCtZones_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCtZonesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OpenflowServer).ListCtZones(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Openflow/ListCtZones",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OpenflowServer).ListCtZones(ctx, req.(*ListCtZonesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Openflow_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.Openflow",
 	HandlerType: (*OpenflowServer)(nil),
@@ -933,43 +2385,275 @@ var _Openflow_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DumpBridgePort",
 			Handler:    _Openflow_DumpBridgePort_Handler,
 		},
+		{
+			MethodName: "AnnounceGuest",
+			Handler:    _Openflow_AnnounceGuest_Handler,
+		},
+		{
+			MethodName: "ListVipOwners",
+			Handler:    _Openflow_ListVipOwners_Handler,
+		},
+		{
+			MethodName: "GetGuestTcStats",
+			Handler:    _Openflow_GetGuestTcStats_Handler,
+		},
+		{
+			MethodName: "ListCtZones",
+			Handler:    _Openflow_ListCtZones_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "agent.proto",
+}
+
+// GuestManClient is the client API for GuestMan service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type GuestManClient interface {
+	GuestEvent(ctx context.Context, in *GuestEventRequest, opts ...grpc.CallOption) (*GuestEventResponse, error)
+	GetGuestStatus(ctx context.Context, in *GetGuestStatusRequest, opts ...grpc.CallOption) (*GetGuestStatusResponse, error)
+	ListGuests(ctx context.Context, in *ListGuestsRequest, opts ...grpc.CallOption) (*ListGuestsResponse, error)
+	GetMetadataStats(ctx context.Context, in *GetMetadataStatsRequest, opts ...grpc.CallOption) (*GetMetadataStatsResponse, error)
+}
+
+type guestManClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewGuestManClient(cc *grpc.ClientConn) GuestManClient {
+	return &guestManClient{cc}
+}
+
+func (c *guestManClient) GuestEvent(ctx context.Context, in *GuestEventRequest, opts ...grpc.CallOption) (*GuestEventResponse, error) {
+	out := new(GuestEventResponse)
+	err := c.cc.Invoke(ctx, "/pb.GuestMan/GuestEvent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestManClient) GetGuestStatus(ctx context.Context, in *GetGuestStatusRequest, opts ...grpc.CallOption) (*GetGuestStatusResponse, error) {
+	out := new(GetGuestStatusResponse)
+	err := c.cc.Invoke(ctx, "/pb.GuestMan/GetGuestStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestManClient) ListGuests(ctx context.Context, in *ListGuestsRequest, opts ...grpc.CallOption) (*ListGuestsResponse, error) {
+	out := new(ListGuestsResponse)
+	err := c.cc.Invoke(ctx, "/pb.GuestMan/ListGuests", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *guestManClient) GetMetadataStats(ctx context.Context, in *GetMetadataStatsRequest, opts ...grpc.CallOption) (*GetMetadataStatsResponse, error) {
+	out := new(GetMetadataStatsResponse)
+	err := c.cc.Invoke(ctx, "/pb.GuestMan/GetMetadataStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GuestManServer is the server API for GuestMan service.
+type GuestManServer interface {
+	GuestEvent(context.Context, *GuestEventRequest) (*GuestEventResponse, error)
+	GetGuestStatus(context.Context, *GetGuestStatusRequest) (*GetGuestStatusResponse, error)
+	ListGuests(context.Context, *ListGuestsRequest) (*ListGuestsResponse, error)
+	GetMetadataStats(context.Context, *GetMetadataStatsRequest) (*GetMetadataStatsResponse, error)
+}
+
+func RegisterGuestManServer(s *grpc.Server, srv GuestManServer) {
+	s.RegisterService(&_GuestMan_serviceDesc, srv)
+}
+
+func _GuestMan_GuestEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GuestEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestManServer).GuestEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.GuestMan/GuestEvent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestManServer).GuestEvent(ctx, req.(*GuestEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestMan_GetGuestStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGuestStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestManServer).GetGuestStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.GuestMan/GetGuestStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestManServer).GetGuestStatus(ctx, req.(*GetGuestStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestMan_ListGuests_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGuestsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestManServer).ListGuests(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.GuestMan/ListGuests",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestManServer).ListGuests(ctx, req.(*ListGuestsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GuestMan_GetMetadataStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetadataStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GuestManServer).GetMetadataStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.GuestMan/GetMetadataStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GuestManServer).GetMetadataStats(ctx, req.(*GetMetadataStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _GuestMan_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.GuestMan",
+	HandlerType: (*GuestManServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GuestEvent",
+			Handler:    _GuestMan_GuestEvent_Handler,
+		},
+		{
+			MethodName: "GetGuestStatus",
+			Handler:    _GuestMan_GetGuestStatus_Handler,
+		},
+		{
+			MethodName: "ListGuests",
+			Handler:    _GuestMan_ListGuests_Handler,
+		},
+		{
+			MethodName: "GetMetadataStats",
+			Handler:    _GuestMan_GetMetadataStats_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "agent.proto",
 }
 
-func init() { proto.RegisterFile("agent.proto", fileDescriptor_agent_3f2a378016922cd7) }
-
-var fileDescriptor_agent_3f2a378016922cd7 = []byte{
-	// 469 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x54, 0x4b, 0x6f, 0xd3, 0x40,
-	0x10, 0xc6, 0xc5, 0x8d, 0xe3, 0x09, 0xae, 0xaa, 0x51, 0x28, 0xc6, 0xe2, 0x50, 0x59, 0x1c, 0xaa,
-	0x8a, 0x46, 0xc2, 0x9c, 0x38, 0xb6, 0x44, 0x95, 0xb8, 0x00, 0xda, 0x48, 0x5c, 0x91, 0x1f, 0x4b,
-	0x6a, 0xe1, 0x78, 0x17, 0xef, 0x56, 0x51, 0xef, 0xfc, 0x55, 0xf8, 0x1d, 0x68, 0xd6, 0x0f, 0xd5,
-	0x8e, 0xa5, 0x40, 0x7b, 0x9b, 0xd7, 0x37, 0x33, 0x9e, 0xfd, 0x3e, 0xc3, 0x2c, 0x5e, 0xf3, 0x52,
-	0x2f, 0x64, 0x25, 0xb4, 0xc0, 0x03, 0x99, 0x84, 0x11, 0x4c, 0x19, 0x57, 0x52, 0x94, 0x8a, 0x23,
-	0x82, 0x9d, 0x8a, 0x8c, 0xfb, 0xd6, 0xa9, 0x75, 0xe6, 0x31, 0x63, 0x53, 0x6c, 0xc3, 0xd5, 0xda,
-	0x3f, 0x38, 0xb5, 0xce, 0x5c, 0x66, 0xec, 0xf0, 0x1c, 0x8e, 0x2f, 0xb3, 0xec, 0xaa, 0xca, 0xb3,
-	0x35, 0x67, 0xfc, 0xe7, 0x2d, 0x57, 0x1a, 0x4f, 0x60, 0x92, 0x98, 0x80, 0x41, 0xbb, 0xac, 0xf1,
-	0xa8, 0x76, 0xc9, 0x8b, 0x7f, 0xab, 0xbd, 0x82, 0x79, 0xd7, 0xf7, 0x8b, 0xa8, 0xf4, 0x9e, 0x7a,
-	0xda, 0x4d, 0x8a, 0x4a, 0xb7, 0xbb, 0x91, 0x4d, 0x3d, 0xba, 0x79, 0x0f, 0xed, 0x71, 0x0d, 0x47,
-	0x97, 0x59, 0x76, 0x5d, 0x88, 0xed, 0x3e, 0xf4, 0x2b, 0xb0, 0xbf, 0x17, 0x62, 0x6b, 0xd0, 0xb3,
-	0x68, 0xba, 0x90, 0xc9, 0xc2, 0xc0, 0x4c, 0x94, 0xfa, 0x2c, 0x79, 0xf1, 0xf8, 0x3e, 0xe7, 0x70,
-	0xbc, 0xba, 0x2b, 0x53, 0x8a, 0xa8, 0x7d, 0x37, 0xfc, 0x65, 0x81, 0x4d, 0x85, 0x54, 0x90, 0x0a,
-	0xf1, 0x23, 0xaf, 0x0b, 0x6c, 0xd6, 0x78, 0x18, 0xc0, 0x54, 0x56, 0xb9, 0xa8, 0x72, 0x7d, 0x67,
-	0xc6, 0x79, 0xac, 0xf3, 0x71, 0x0e, 0x87, 0x3a, 0x4e, 0x0a, 0xee, 0x3f, 0x35, 0x89, 0xda, 0x41,
-	0x1f, 0x9c, 0x4d, 0xac, 0xd3, 0x1b, 0xae, 0x7c, 0xdb, 0xcc, 0x6a, 0x5d, 0xca, 0xc4, 0xa9, 0xce,
-	0x45, 0xa9, 0xfc, 0xc3, 0x3a, 0xd3, 0xb8, 0xe1, 0x6b, 0x70, 0xe9, 0xfa, 0x2b, 0x1d, 0x6b, 0x85,
-	0x2f, 0xc0, 0xa1, 0xbb, 0x7e, 0x2b, 0x45, 0x43, 0xad, 0x09, 0xb9, 0x9f, 0x44, 0xf8, 0x01, 0x9e,
-	0x2f, 0x6f, 0x37, 0xf2, 0x71, 0xaf, 0x55, 0xc2, 0xc9, 0xb0, 0xc9, 0xff, 0xf1, 0x19, 0xdf, 0x00,
-	0x98, 0xfd, 0x14, 0x6d, 0x6b, 0xbe, 0x7d, 0x16, 0x79, 0xf4, 0x06, 0xdd, 0x27, 0x30, 0x57, 0xb6,
-	0x66, 0xf4, 0xdb, 0x02, 0xe7, 0xeb, 0x6a, 0x9b, 0xeb, 0xf4, 0x06, 0xdf, 0x82, 0xdb, 0x31, 0x16,
-	0xe7, 0x04, 0x19, 0x0a, 0x23, 0x78, 0x46, 0xd1, 0x76, 0xa5, 0xf0, 0x09, 0x41, 0x3a, 0x82, 0xd6,
-	0x90, 0xa1, 0x3e, 0x76, 0x20, 0xef, 0xc1, 0xeb, 0xe9, 0x02, 0xfd, 0xde, 0xa4, 0x7b, 0x87, 0x1b,
-	0x83, 0xf6, 0xe4, 0x50, 0x43, 0xc7, 0x14, 0x32, 0x84, 0x46, 0x7f, 0x2c, 0x98, 0x7e, 0x96, 0xbc,
-	0x24, 0x0a, 0xe2, 0x05, 0x38, 0x8d, 0x24, 0x10, 0x9b, 0xe1, 0xf7, 0x78, 0xbd, 0x33, 0xf6, 0x02,
-	0x9c, 0x86, 0xf9, 0x75, 0x79, 0x5f, 0x06, 0x63, 0x37, 0xe9, 0x08, 0x5e, 0xdf, 0x64, 0xc8, 0xf7,
-	0x1d, 0xc8, 0x47, 0x38, 0xea, 0xbf, 0x3a, 0xbe, 0x34, 0x83, 0xc6, 0xe8, 0x14, 0x04, 0x63, 0xa9,
-	0xb6, 0x55, 0x32, 0x31, 0x7f, 0xc3, 0x77, 0x7f, 0x03, 0x00, 0x00, 0xff, 0xff, 0xe3, 0x56, 0xf3,
-	0x6a, 0x1c, 0x05, 0x00, 0x00,
+func init() { proto.RegisterFile("agent.proto", fileDescriptor_agent_1b27343cc2913682) }
+
+var fileDescriptor_agent_1b27343cc2913682 = []byte{
+	// 1326 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x58, 0xcd, 0x6e, 0xdb, 0xc6,
+	0x13, 0xff, 0xeb, 0x5b, 0x1a, 0x59, 0xb6, 0xb3, 0x91, 0x65, 0x9a, 0xff, 0xa0, 0x70, 0xd8, 0xa0,
+	0x49, 0x83, 0xc6, 0x40, 0xd5, 0x5e, 0x7a, 0x08, 0x50, 0xe7, 0x13, 0x01, 0xf2, 0x05, 0xa6, 0x08,
+	0xda, 0x1c, 0x2a, 0x50, 0xe4, 0xc6, 0x66, 0x2d, 0x73, 0x59, 0xee, 0x3a, 0x86, 0x73, 0xee, 0xa3,
+	0xf4, 0xd8, 0x5b, 0x9f, 0xa0, 0xaf, 0x52, 0xa0, 0x0f, 0xd1, 0x5b, 0x31, 0xb3, 0xbb, 0x34, 0x49,
+	0x31, 0x75, 0x94, 0xa0, 0x37, 0xce, 0xf7, 0xec, 0x6f, 0x66, 0x67, 0x77, 0x09, 0xc3, 0xe0, 0x80,
+	0x27, 0x6a, 0x2f, 0xcd, 0x84, 0x12, 0xac, 0x99, 0xce, 0xbd, 0x29, 0xf4, 0x7d, 0x2e, 0x53, 0x91,
+	0x48, 0xce, 0x18, 0xb4, 0x43, 0x11, 0x71, 0xa7, 0xb1, 0xdb, 0xb8, 0x31, 0xf2, 0xe9, 0x1b, 0x79,
+	0xc7, 0x5c, 0x1e, 0x38, 0xcd, 0xdd, 0xc6, 0x8d, 0x81, 0x4f, 0xdf, 0xde, 0x4d, 0xd8, 0xdc, 0x8f,
+	0xa2, 0x3b, 0x59, 0x1c, 0x1d, 0x70, 0x9f, 0xff, 0x7c, 0xc2, 0xa5, 0x62, 0x13, 0xe8, 0xce, 0x89,
+	0x41, 0xd6, 0x03, 0xdf, 0x50, 0xa8, 0x7b, 0x8f, 0x2f, 0xde, 0x4f, 0xf7, 0x0e, 0x8c, 0x73, 0xbf,
+	0xcf, 0x45, 0xa6, 0x2e, 0xd0, 0xc7, 0xdc, 0x52, 0x91, 0x29, 0x9b, 0x1b, 0x7e, 0xa3, 0x8f, 0x3c,
+	0xde, 0x87, 0xfa, 0x78, 0x00, 0xeb, 0xfb, 0x51, 0xf4, 0x60, 0x21, 0x4e, 0x2f, 0xb2, 0xbe, 0x02,
+	0xed, 0xd7, 0x0b, 0x71, 0x4a, 0xd6, 0xc3, 0x69, 0x7f, 0x2f, 0x9d, 0xef, 0x91, 0x19, 0x71, 0xd1,
+	0xcf, 0x3d, 0xbe, 0xf8, 0x78, 0x3f, 0x37, 0x61, 0xf3, 0xc5, 0x59, 0x12, 0x22, 0x47, 0x5e, 0x84,
+	0xe1, 0x2f, 0x0d, 0x68, 0xa3, 0x22, 0x2a, 0x84, 0x42, 0x1c, 0xc5, 0x5a, 0xa1, 0xed, 0x1b, 0x8a,
+	0xb9, 0xd0, 0x4f, 0xb3, 0x58, 0x64, 0xb1, 0x3a, 0xa3, 0x70, 0x23, 0x3f, 0xa7, 0xd9, 0x18, 0x3a,
+	0x2a, 0x98, 0x2f, 0xb8, 0xd3, 0x22, 0x81, 0x26, 0x98, 0x03, 0xbd, 0xe3, 0x40, 0x85, 0x87, 0x5c,
+	0x3a, 0x6d, 0x8a, 0x65, 0x49, 0x94, 0x04, 0xa1, 0x8a, 0x45, 0x22, 0x9d, 0x8e, 0x96, 0x18, 0xd2,
+	0xbb, 0x06, 0x03, 0x44, 0xff, 0x85, 0x0a, 0x94, 0x64, 0xdb, 0xd0, 0x43, 0x5c, 0x67, 0x89, 0x30,
+	0xad, 0xd5, 0x45, 0xf2, 0xa9, 0xf0, 0xee, 0xc2, 0xd6, 0xbd, 0x93, 0xe3, 0xf4, 0xe3, 0xaa, 0x95,
+	0xc0, 0xa4, 0xea, 0x64, 0xb5, 0x7e, 0x66, 0x5f, 0x00, 0x50, 0x7e, 0x12, 0xb3, 0xa5, 0xb5, 0x0f,
+	0xa7, 0x23, 0xac, 0x41, 0xbe, 0x04, 0x7f, 0x90, 0xda, 0x4f, 0xef, 0x07, 0x18, 0xef, 0x27, 0x89,
+	0x38, 0x49, 0x42, 0xfe, 0x10, 0x93, 0xb5, 0x39, 0xef, 0x40, 0xff, 0x00, 0x3f, 0x66, 0x71, 0x64,
+	0xb2, 0xee, 0x11, 0xfd, 0x28, 0x62, 0x9b, 0xd0, 0x3a, 0x0e, 0x42, 0x13, 0x13, 0x3f, 0x11, 0xe9,
+	0x50, 0x9c, 0x24, 0xca, 0x22, 0x4d, 0x84, 0xb7, 0x07, 0xe3, 0xc7, 0xb1, 0x54, 0x2f, 0xe3, 0xf4,
+	0xd9, 0x69, 0xc2, 0xb3, 0x0b, 0x8b, 0xfd, 0x16, 0xfa, 0x56, 0x17, 0x63, 0xbc, 0x89, 0x53, 0xa3,
+	0x80, 0x9f, 0x05, 0xab, 0x66, 0x09, 0xc4, 0x42, 0x39, 0x5a, 0xc5, 0x72, 0x94, 0x56, 0xd0, 0xae,
+	0x5d, 0x41, 0x27, 0x5f, 0x81, 0xc7, 0x61, 0xab, 0x92, 0xeb, 0x8a, 0xa8, 0x5f, 0x83, 0xae, 0x20,
+	0x4b, 0xa7, 0xb5, 0xdb, 0xba, 0x31, 0x9c, 0xae, 0x21, 0xe2, 0xd6, 0x9d, 0x6f, 0x64, 0xde, 0x7d,
+	0x98, 0x3c, 0xe4, 0x8a, 0x80, 0xfe, 0x2e, 0xd4, 0xb5, 0xf8, 0x00, 0xbc, 0xbd, 0x3f, 0x9a, 0xd0,
+	0x33, 0xf6, 0x88, 0x4b, 0xfc, 0x3a, 0x09, 0x8e, 0x73, 0x34, 0x35, 0x85, 0x49, 0xaa, 0xb3, 0xd4,
+	0xa2, 0x45, 0xdf, 0xc8, 0x3b, 0x8a, 0x93, 0x88, 0x80, 0x1a, 0xf8, 0xf4, 0xcd, 0xd6, 0xa1, 0x99,
+	0x03, 0xd4, 0x8c, 0x23, 0xf4, 0x97, 0x06, 0x19, 0x4f, 0x94, 0x81, 0xc7, 0x50, 0x58, 0xe3, 0xf9,
+	0x99, 0xe2, 0xd2, 0xe9, 0xd2, 0x06, 0xd4, 0x04, 0xee, 0x99, 0x34, 0x08, 0x8f, 0xb8, 0x92, 0x4e,
+	0x8f, 0xf8, 0x96, 0x44, 0xfd, 0x28, 0x13, 0xa9, 0x74, 0xfa, 0x5a, 0x9f, 0x08, 0xf6, 0x09, 0x80,
+	0x78, 0xc3, 0xb3, 0x45, 0x7c, 0x1c, 0x2b, 0xe9, 0x0c, 0x48, 0x54, 0xe0, 0xe0, 0x7e, 0xce, 0x10,
+	0x91, 0x13, 0x2e, 0x1d, 0x20, 0x69, 0x4e, 0xb3, 0x4f, 0x61, 0x34, 0x0f, 0xc2, 0xa3, 0x85, 0x38,
+	0x98, 0xe9, 0x4c, 0x86, 0xa4, 0xb0, 0x66, 0x98, 0x77, 0x28, 0xa1, 0xeb, 0xb0, 0x61, 0x95, 0x6c,
+	0x62, 0x6b, 0xa4, 0xb6, 0x6e, 0xd8, 0xcf, 0x35, 0xd7, 0xfb, 0x11, 0x36, 0xa8, 0x0e, 0x4f, 0xe3,
+	0xd0, 0x42, 0x69, 0x80, 0x6e, 0x9c, 0x37, 0xf6, 0x39, 0xb8, 0xcd, 0x12, 0xb8, 0x57, 0xa1, 0x63,
+	0xb7, 0x17, 0x16, 0x7b, 0x88, 0xc5, 0xb6, 0x05, 0xd5, 0x12, 0xef, 0x27, 0xd8, 0x5e, 0x2a, 0xf5,
+	0x8a, 0x3d, 0x75, 0x1d, 0xda, 0x49, 0x1c, 0xda, 0x20, 0x97, 0x31, 0x48, 0x25, 0x65, 0x9f, 0x14,
+	0xbc, 0x31, 0x30, 0xec, 0xde, 0xbb, 0xea, 0x95, 0x48, 0xb8, 0x6d, 0x29, 0xef, 0x15, 0x74, 0x35,
+	0x07, 0x9d, 0xbf, 0x15, 0x49, 0x1e, 0x10, 0xbf, 0xeb, 0x77, 0x31, 0xb5, 0xa9, 0x69, 0x0f, 0x4d,
+	0x20, 0x57, 0xaa, 0x60, 0xc1, 0xa9, 0x45, 0xfa, 0xbe, 0x26, 0xbc, 0x19, 0x5c, 0x2e, 0x45, 0x5c,
+	0x71, 0x65, 0xbb, 0xd0, 0xc1, 0x24, 0xec, 0xd2, 0x00, 0x97, 0xa6, 0x7d, 0xf9, 0x5a, 0xe0, 0x7d,
+	0x0f, 0x97, 0x68, 0xad, 0xf7, 0xdf, 0xf0, 0xe4, 0x7d, 0x86, 0xd2, 0x18, 0x3a, 0x1c, 0x55, 0x4d,
+	0x18, 0x4d, 0x60, 0xec, 0x88, 0xcb, 0xd0, 0x36, 0x3c, 0x7e, 0x7b, 0xbf, 0x37, 0x60, 0x48, 0xae,
+	0x11, 0xc1, 0x13, 0x79, 0x81, 0xd3, 0xf4, 0x30, 0x90, 0xb6, 0xfa, 0x9a, 0xc8, 0x17, 0xd4, 0x2a,
+	0x2c, 0xe8, 0x2a, 0xac, 0x2d, 0x02, 0xa9, 0x66, 0x41, 0x9a, 0x2e, 0x62, 0xae, 0xf7, 0x53, 0xcb,
+	0x1f, 0x22, 0x6f, 0x5f, 0xb3, 0xd0, 0x19, 0x9e, 0x7f, 0xfa, 0x70, 0x19, 0xf9, 0x9a, 0x60, 0x9f,
+	0x99, 0x1a, 0x77, 0x09, 0x08, 0x56, 0xac, 0xb1, 0xce, 0xcf, 0x94, 0xf8, 0xcf, 0x06, 0xac, 0x97,
+	0x05, 0x2b, 0xb4, 0xeb, 0xf9, 0xec, 0x6c, 0xbd, 0x6b, 0x76, 0xb6, 0x4b, 0xb3, 0x73, 0x1b, 0x7a,
+	0xa1, 0x9a, 0x51, 0xcf, 0xe8, 0x6c, 0xbb, 0xa1, 0xee, 0xa4, 0x7c, 0x11, 0xdd, 0xe2, 0x22, 0x76,
+	0xa0, 0xaf, 0x42, 0x3a, 0x70, 0x38, 0x8d, 0x81, 0x81, 0xdf, 0x53, 0x94, 0x25, 0x85, 0x50, 0xe1,
+	0x8c, 0xf0, 0xea, 0xeb, 0xd8, 0x2a, 0x7c, 0x82, 0x88, 0x59, 0x14, 0x07, 0x85, 0xab, 0x18, 0x07,
+	0x56, 0x2c, 0xfa, 0xca, 0xdb, 0xa5, 0x2b, 0x09, 0x19, 0x73, 0xe8, 0x6d, 0xe4, 0x60, 0x1a, 0x24,
+	0x8d, 0xd8, 0x9b, 0xc2, 0x96, 0xdd, 0x9a, 0x46, 0x72, 0x61, 0x7f, 0x79, 0x31, 0x4c, 0xaa, 0x36,
+	0xff, 0x55, 0x7a, 0x9f, 0xc3, 0x25, 0xdc, 0x5b, 0x24, 0xca, 0x53, 0xcb, 0x5b, 0xb1, 0x51, 0x68,
+	0x45, 0x04, 0xac, 0xa8, 0xba, 0x7a, 0x46, 0xb4, 0x3c, 0xbb, 0x0d, 0x97, 0x33, 0xd2, 0x62, 0xef,
+	0x6b, 0x9a, 0x65, 0x4f, 0xb8, 0x0a, 0xa2, 0x40, 0x05, 0xef, 0x79, 0x6e, 0x79, 0xbf, 0x35, 0x60,
+	0x54, 0xb2, 0xf9, 0xb7, 0xad, 0xf6, 0xae, 0xe3, 0xdd, 0x1e, 0x08, 0xd2, 0xdc, 0x65, 0xec, 0x81,
+	0x20, 0x95, 0x64, 0x57, 0x60, 0xa0, 0x0e, 0x33, 0xa1, 0xd4, 0xc2, 0xec, 0xb8, 0xb6, 0x7f, 0xce,
+	0x40, 0x8f, 0x11, 0x4f, 0x70, 0x33, 0x76, 0x48, 0x64, 0x28, 0xe4, 0xf3, 0x2c, 0x13, 0x99, 0x3d,
+	0xc9, 0x0c, 0xe5, 0x1d, 0x81, 0xb3, 0xbc, 0xc8, 0x95, 0x11, 0x2d, 0x9d, 0x0b, 0x97, 0x10, 0xd0,
+	0xb2, 0x47, 0x2d, 0x9f, 0xfe, 0xd5, 0x80, 0xde, 0xcb, 0x17, 0xa7, 0xb1, 0x0a, 0x0f, 0xd9, 0x97,
+	0x30, 0xc8, 0x1f, 0x0a, 0x6c, 0x8c, 0x26, 0xd5, 0xf7, 0x88, 0x4b, 0xb7, 0x09, 0x9b, 0x8d, 0xf7,
+	0x3f, 0x34, 0xc9, 0xdf, 0x05, 0xda, 0xa4, 0xfa, 0x2c, 0x59, 0x32, 0xf9, 0x06, 0x46, 0xa5, 0xe7,
+	0x08, 0x73, 0x4a, 0x91, 0x0a, 0xf7, 0xd5, 0x3a, 0xd3, 0xd2, 0x2b, 0x44, 0x9b, 0xd6, 0x3d, 0x4c,
+	0xaa, 0xa6, 0xd3, 0xbf, 0x5b, 0xd0, 0x7f, 0x96, 0xf2, 0x04, 0xe7, 0x04, 0xbb, 0x05, 0x3d, 0xf3,
+	0x12, 0x61, 0xcc, 0x04, 0x2f, 0x3c, 0x27, 0x96, 0xc2, 0xde, 0x82, 0x9e, 0x79, 0x70, 0x68, 0xf5,
+	0xf2, 0xeb, 0xa3, 0x0e, 0x93, 0xfc, 0x5d, 0xa1, 0x31, 0xa9, 0x3e, 0x33, 0x96, 0x4c, 0x1e, 0xc1,
+	0x7a, 0xf9, 0xb2, 0xcd, 0x76, 0x28, 0x50, 0xdd, 0x2d, 0xde, 0x75, 0xeb, 0x44, 0x25, 0x78, 0x8b,
+	0xf7, 0x68, 0x03, 0x6f, 0xcd, 0xd5, 0x7a, 0x29, 0x8b, 0x07, 0x30, 0x2a, 0xdd, 0x3d, 0xb5, 0x69,
+	0xdd, 0xd5, 0xd9, 0xdd, 0xa9, 0x91, 0xe4, 0x7e, 0x1e, 0xc3, 0x46, 0xe5, 0xc6, 0xc1, 0x28, 0xe7,
+	0xfa, 0x1b, 0xa7, 0xfb, 0xff, 0x5a, 0x59, 0xee, 0xed, 0x5b, 0x18, 0x16, 0x4e, 0x78, 0x36, 0xb1,
+	0x91, 0xcb, 0x97, 0x0c, 0x77, 0x7b, 0x89, 0x9f, 0xd7, 0xfe, 0xd7, 0x26, 0xf4, 0xc9, 0xf9, 0x93,
+	0x20, 0x61, 0xb7, 0x01, 0xce, 0x47, 0x3b, 0xdb, 0xca, 0x27, 0x4d, 0xf1, 0x7c, 0x77, 0x27, 0x55,
+	0x76, 0xb1, 0x52, 0xe5, 0xf1, 0xab, 0x2b, 0x55, 0x3b, 0xc6, 0x5d, 0xb7, 0x4e, 0x94, 0xbb, 0xba,
+	0x0d, 0x70, 0x3e, 0x33, 0x75, 0x26, 0x4b, 0xe3, 0xd6, 0x9d, 0x54, 0xd9, 0xb9, 0xf9, 0x33, 0xd8,
+	0xac, 0x8e, 0x09, 0x66, 0xa1, 0xac, 0x9b, 0x90, 0xee, 0x95, 0x7a, 0xa1, 0x75, 0x38, 0xef, 0xd2,
+	0xef, 0x8b, 0xaf, 0xfe, 0x19, 0x00, 0xfa, 0x18, 0x55, 0x56, 0xcd, 0x10, 0x00, 0x00,
 }
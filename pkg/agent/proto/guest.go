@@ -0,0 +1,60 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pb
+
+// Events of GuestEventRequest
+const (
+	GuestEventStarted    = "started"
+	GuestEventStopped    = "stopped"
+	GuestEventMigrated   = "migrated"
+	GuestEventNicHotplug = "nic_hotplug"
+	GuestEventDesc       = "desc"
+)
+
+// Phases of GuestStatus
+const (
+	// GuestPhaseActive is for guests with flows in place
+	GuestPhaseActive = "active"
+	// GuestPhasePending is for guests waiting for their ports
+	GuestPhasePending = "pending"
+	GuestPhaseStopped = "stopped"
+	// GuestPhaseMigrationStaged is for guests migrating onto this host,
+	// with ports not ready yet
+	GuestPhaseMigrationStaged = "migration_staged"
+	// GuestPhaseVolatile is for guests not served on this host, e.g.
+	// slave of a master-slave pair
+	GuestPhaseVolatile = "volatile"
+	// GuestPhaseError is for guests failed to be updated, e.g. for bad
+	// desc
+	GuestPhaseError = "error"
+)
+
+// Tc states of GuestNicStatus
+const (
+	// TcStateDisabled is for hosts without tcman
+	TcStateDisabled = "disabled"
+	// TcStatePending is for nics not checked by tcman yet
+	TcStatePending = "pending"
+	TcStateOk      = "ok"
+	TcStateError   = "error"
+)
+
+func IsGuestEvent(event string) bool {
+	switch event {
+	case GuestEventStarted, GuestEventStopped, GuestEventMigrated, GuestEventNicHotplug, GuestEventDesc:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+// nicsToAnnounce returns nics started or moved since they were last
+// announced, and records them as announced
+func (g *Guest) nicsToAnnounce() []*utils.GuestNIC {
+	if g.announced == nil {
+		g.announced = map[string]string{}
+	}
+	nics := []*utils.GuestNIC{}
+	for _, nic := range g.NICs {
+		if nic.PortNo <= 0 {
+			continue
+		}
+		key := nic.AnnounceKey()
+		if g.announced[nic.MAC] == key {
+			continue
+		}
+		g.announced[nic.MAC] = key
+		nics = append(nics, nic)
+	}
+	return nics
+}
+
+// announceNics sends addresses of nics in the background, with count and
+// interval from host config
+func (g *Guest) announceNics(nics []*utils.GuestNIC) {
+	if len(nics) == 0 {
+		return
+	}
+	hc := g.watcher.hostConfig
+	go announceNics(g.watcher.agent.ctx, g.Who(), nics, hc.AnnounceCount, hc.AnnounceInterval)
+}
+
+// announceNics sends gratuitous arp and unsolicited neighbor advertisement
+// for addresses of nics from their ports for count times
+func announceNics(ctx context.Context, who string, nics []*utils.GuestNIC, count int, interval time.Duration) {
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+		for _, nic := range nics {
+			if err := announceNic(ctx, nic); err != nil {
+				log.Errorf("guest %s: announce %s: %v", who, nic.IfnameHost, err)
+			}
+		}
+	}
+}
+
+func announceNic(ctx context.Context, nic *utils.GuestNIC) error {
+	if nic.PortNo <= 0 {
+		return errors.Wrap(errors.ErrInvalidStatus, "port not ready")
+	}
+	pkts, err := nic.AnnouncePackets()
+	if err != nil {
+		return errors.Wrap(err, "AnnouncePackets")
+	}
+	for _, pkt := range pkts {
+		if err := utils.RunOvsctl(ctx, utils.PacketOutArgs(nic.Bridge, nic.PortNo, pkt)); err != nil {
+			return errors.Wrap(err, "packet-out")
+		}
+	}
+	return nil
+}
@@ -28,6 +28,7 @@ const (
 	WatcherRefreshRate        time.Duration = 31 * time.Second
 	WatcherRefreshRateOnError time.Duration = 3 * time.Second
 	WatcherRecentPendingTime  time.Duration = WatcherRefreshRateOnError * 5
+	WatcherMigrationPollRate  time.Duration = 500 * time.Millisecond
 	IfaceJanitorInterval      time.Duration = 57 * time.Second
 	TapManRefreshRate         time.Duration = 27 * time.Second
 )
@@ -45,12 +45,17 @@ const (
 	flowManCmdDelFlow
 	flowManCmdSyncFlows
 	flowManCmdUpdateFlows
+	flowManCmdEndWarmStart
+	flowManCmdCommitFlows
 )
 
 type flowManCmd struct {
 	Type flowManCmdType
 	Who  string
 	Arg  interface{}
+	// Done is called in the flowman goroutine once flows of the command
+	// are committed to the bridge
+	Done func(error)
 }
 
 type FlowMan struct {
@@ -59,6 +64,28 @@ type FlowMan struct {
 	idleTimer *time.Timer
 	cmdChan   chan *flowManCmd
 	waitCount int32
+
+	// callbacks waiting for the next commit
+	doneFuncs []func(error)
+
+	// warm is set while the agent starts with flows of the last run on
+	// the bridge.  Deletes are held till it ends, so that flows of guests
+	// not loaded yet are kept
+	warm *flowManWarm
+
+	// dumpFlows and commitChange read and write flows of the bridge
+	dumpFlows    func(excludeOvsTables []int) (*utils.FlowSet, error)
+	commitChange func(flowsAdd, flowsDel []*ovs.Flow) error
+}
+
+// flowManWarm is state of flowman during warm start
+type flowManWarm struct {
+	start time.Time
+	// ended is set once the initial scan is done or timed out, with
+	// deletes held till the next check
+	ended bool
+	// flows added during warm start, logged with deletes once it ends
+	added []*ovs.Flow
 }
 
 func (fm *FlowMan) doDumpFlows(excludeOvsTables []int) (*utils.FlowSet, error) {
@@ -67,8 +94,7 @@ func (fm *FlowMan) doDumpFlows(excludeOvsTables []int) (*utils.FlowSet, error) {
 	if !fileutils2.Exists(ovsDbSock) {
 		log.Fatalf("%s not exists!", ovsDbSock)
 	}
-	ofCli := ovs.New().OpenFlow
-	flows, err := ofCli.DumpFlows(fm.bridge)
+	flows, err := utils.DumpFlows(context.Background(), fm.bridge, excludeOvsTables)
 	if err != nil {
 		log.Errorf("flowman %s: dump-flows failed: %s", fm.bridge, err)
 		return nil, errors.Wrap(err, "DumpFlows")
@@ -76,26 +102,35 @@ func (fm *FlowMan) doDumpFlows(excludeOvsTables []int) (*utils.FlowSet, error) {
 	// for _, of := range flows {
 	// 	utils.OVSFlowOrderMatch(of)
 	// }
-	{
-		// filter out dynamic flow tables
-		nflows := make([]*ovs.Flow, 0, len(flows))
-		for i := range flows {
-			if len(excludeOvsTables) > 0 && pkgutils.IsInArray(flows[i].Table, excludeOvsTables) {
-				continue
-			}
-			nflows = append(nflows, flows[i])
-		}
-		flows = nflows
-	}
+	flows = filterOvsFlows(flows, excludeOvsTables)
 
 	fs := utils.NewFlowSetFromList(flows)
 	return fs, nil
 }
 
+// filterOvsFlows filters out flows of dynamic flow tables, and guard flows
+// of guest meters managed by tcman
+func filterOvsFlows(flows []*ovs.Flow, excludeOvsTables []int) []*ovs.Flow {
+	nflows := make([]*ovs.Flow, 0, len(flows))
+	for i := range flows {
+		if len(excludeOvsTables) > 0 && pkgutils.IsInArray(flows[i].Table, excludeOvsTables) {
+			continue
+		}
+		if utils.IsGuestMeterGuardFlow(flows[i]) {
+			continue
+		}
+		nflows = append(nflows, flows[i])
+	}
+	return nflows
+}
+
 var (
 	excludeOvsTables = []int{
 		10,
 		12,
+		utils.MacLimitTable,
+		utils.GuestMeterTable,
+		utils.VipOwnerTable,
 	}
 )
 
@@ -114,14 +149,15 @@ func (fm *FlowMan) doCheck() {
 	}
 	start := time.Now()
 
+	var err error
 	defer func() {
 		log.Infof("flowman %s: check done %f", fm.bridge, time.Since(start).Seconds())
+		fm.callDoneFuncs(err)
 	}()
 
 	log.Infof("flowman %s: start check", fm.bridge)
-	var err error
 	// fs0: current flows
-	fs0, err := fm.doDumpFlows(excludeOvsTables)
+	fs0, err := fm.dumpFlows(excludeOvsTables)
 	if err != nil {
 		log.Errorf("FlowMan doCheck doDumpFlows fail %s", err)
 		return
@@ -131,7 +167,26 @@ func (fm *FlowMan) doCheck() {
 	merged := fm.mergeFlows()
 	log.Infof("flowman %s: %d flows in table and %d flows in memory", fm.bridge, fs0.Len(), merged.Len())
 	flowsAdd, flowsDel := fs0.Diff(merged)
-	fm.doCommitChange(flowsAdd, flowsDel)
+	if warm := fm.warm; warm != nil {
+		if !warm.ended {
+			// flows of sources not loaded yet look stale
+			if len(flowsDel) > 0 {
+				log.Infof("flowman %s: warm start: %d flows not deleted", fm.bridge, len(flowsDel))
+			}
+			flowsDel = nil
+		}
+		err = fm.commitChange(flowsAdd, flowsDel)
+		if err != nil {
+			return
+		}
+		warm.added = append(warm.added, flowsAdd...)
+		if warm.ended {
+			fm.warm = nil
+			fm.logStartupDiff(warm, flowsDel)
+		}
+		return
+	}
+	err = fm.commitChange(flowsAdd, flowsDel)
 
 	if len(flowsAdd) > 0 || len(flowsDel) > 0 {
 		buf := &bytes.Buffer{}
@@ -144,6 +199,25 @@ func (fm *FlowMan) doCheck() {
 	}
 }
 
+// logStartupDiff logs flows added during warm start and flows deleted
+// after it as a single diff
+func (fm *FlowMan) logStartupDiff(warm *flowManWarm, flowsDel []*ovs.Flow) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("flowman %s: startup diff in %s: %d flows added, %d flows deleted\n",
+		fm.bridge, time.Since(warm.start), len(warm.added), len(flowsDel)))
+	fm.bufWriteFlows(buf, "add-flow", warm.added)
+	fm.bufWriteFlows(buf, "del-flow", flowsDel)
+	log.Infof("%s", buf.String())
+}
+
+func (fm *FlowMan) callDoneFuncs(err error) {
+	doneFuncs := fm.doneFuncs
+	fm.doneFuncs = nil
+	for _, done := range doneFuncs {
+		done(err)
+	}
+}
+
 func (fm *FlowMan) bufWriteFlows(buf *bytes.Buffer, prefix string, flows []*ovs.Flow) {
 	for i, f := range flows {
 		txt, _ := f.MarshalText()
@@ -171,6 +245,23 @@ func (fm *FlowMan) doCommitChange(flowsAdd, flowsDel []*ovs.Flow) error {
 	return nil
 }
 
+// doCommitFlows adds flows of who to the bridge in one bundle, without
+// dumping flows of the bridge first or waiting for batches holding checks.
+// Flows of who no longer wanted are deleted by the next check
+func (fm *FlowMan) doCommitFlows(who string, flows []*ovs.Flow, done func(error)) {
+	start := time.Now()
+	err := fm.commitChange(flows, nil)
+	if err == nil {
+		log.Infof("flowman %s: %s: %d flows committed in %s", fm.bridge, who, len(flows), time.Since(start))
+		if fm.warm != nil {
+			fm.warm.added = append(fm.warm.added, flows...)
+		}
+	}
+	if done != nil {
+		done(err)
+	}
+}
+
 func (fm *FlowMan) doCmd(cmd *flowManCmd) {
 	switch cmd.Type {
 	case flowManCmdAddFlow:
@@ -196,8 +287,23 @@ func (fm *FlowMan) doCmd(cmd *flowManCmd) {
 		flows, _ := cmd.Arg.([]*ovs.Flow)
 		fs := utils.NewFlowSetFromList(flows)
 		fm.flowSets[cmd.Who] = fs
+		if cmd.Done != nil {
+			fm.doneFuncs = append(fm.doneFuncs, cmd.Done)
+		}
 		fm.doCheck()
 		fm.scheduleIdleCheck(true)
+	case flowManCmdCommitFlows:
+		flows, _ := cmd.Arg.([]*ovs.Flow)
+		fm.flowSets[cmd.Who] = utils.NewFlowSetFromList(flows)
+		fm.doCommitFlows(cmd.Who, flows, cmd.Done)
+		fm.doCheck()
+		fm.scheduleIdleCheck(true)
+	case flowManCmdEndWarmStart:
+		if fm.warm != nil {
+			fm.warm.ended = true
+			fm.doCheck()
+			fm.scheduleIdleCheck(true)
+		}
 	}
 }
 
@@ -294,22 +400,24 @@ func (fm *FlowMan) SyncFlows(ctx context.Context) {
 	fm.sendCmd(ctx, cmd)
 }
 
+// endWarmStart lets deletes held during warm start through
+func (fm *FlowMan) endWarmStart(ctx context.Context) {
+	cmd := &flowManCmd{
+		Type: flowManCmdEndWarmStart,
+	}
+	fm.sendCmd(ctx, cmd)
+}
+
 func (fm *FlowMan) updateFlows(ctx context.Context, who string, ofs []*ovs.Flow) {
+	fm.updateFlowsNotify(ctx, who, ofs, nil)
+}
+
+// updateFlowsNotify is like updateFlows, with done called once the flows
+// are committed, or failed to be
+func (fm *FlowMan) updateFlowsNotify(ctx context.Context, who string, ofs []*ovs.Flow, done func(error)) {
 	log.Debugf("flowman %s: updateFlows %s", fm.bridge, who)
-	{
-		v := ctx.Value("waitData")
-		// The caller is responsible for coordinating access
-		if wdm, ok := v.(map[string]*FlowManWaitData); ok {
-			if wd, exist := wdm[fm.bridge]; !exist {
-				wdm[fm.bridge] = &FlowManWaitData{
-					Count:   1,
-					FlowMan: fm,
-				}
-			} else {
-				wd.Count += 1
-			}
-			atomic.AddInt32(&fm.waitCount, 1)
-		}
+	if fw, ok := ctx.Value("waitData").(*FlowManWait); ok {
+		fw.add(fm)
 	}
 	// for _, of := range ofs {
 	//	utils.OVSFlowOrderMatch(of)
@@ -318,6 +426,21 @@ func (fm *FlowMan) updateFlows(ctx context.Context, who string, ofs []*ovs.Flow)
 		Type: flowManCmdUpdateFlows,
 		Who:  who,
 		Arg:  ofs,
+		Done: done,
+	}
+	fm.sendCmd(ctx, cmd)
+}
+
+// commitFlowsNotify is like updateFlowsNotify, but flows are committed
+// right away, even while checks are held by batches.  It is for flows
+// whose delay costs packets, like those of guests migrated onto this host
+func (fm *FlowMan) commitFlowsNotify(ctx context.Context, who string, ofs []*ovs.Flow, done func(error)) {
+	log.Debugf("flowman %s: commitFlows %s", fm.bridge, who)
+	cmd := &flowManCmd{
+		Type: flowManCmdCommitFlows,
+		Who:  who,
+		Arg:  ofs,
+		Done: done,
 	}
 	fm.sendCmd(ctx, cmd)
 }
@@ -339,14 +462,57 @@ func NewFlowMan(bridge string) (*FlowMan, error) {
 		THEMAN:   utils.NewFlowSet(),
 		FAILSAFE: utils.NewFlowSet(),
 	}
-	return &FlowMan{
+	fm := &FlowMan{
 		bridge:   bridge,
 		cmdChan:  make(chan *flowManCmd),
 		flowSets: flowSets,
-	}, nil
+	}
+	fm.dumpFlows = fm.doDumpFlows
+	fm.commitChange = fm.doCommitChange
+	return fm, nil
 }
 
 type FlowManWaitData struct {
 	Count   int32
 	FlowMan *FlowMan
 }
+
+// FlowManWait holds off checks of flowmans updated in a batch, so that each
+// of them commits once when the batch is done.  It is safe for concurrent
+// use
+type FlowManWait struct {
+	mu       sync.Mutex
+	waitData map[string]*FlowManWaitData
+}
+
+func NewFlowManWait() *FlowManWait {
+	return &FlowManWait{
+		waitData: map[string]*FlowManWaitData{},
+	}
+}
+
+func (fw *FlowManWait) add(fm *FlowMan) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if wd, exist := fw.waitData[fm.bridge]; !exist {
+		fw.waitData[fm.bridge] = &FlowManWaitData{
+			Count:   1,
+			FlowMan: fm,
+		}
+	} else {
+		wd.Count += 1
+	}
+	atomic.AddInt32(&fm.waitCount, 1)
+}
+
+// Done releases flowmans updated and syncs each of them
+func (fw *FlowManWait) Done(ctx context.Context) {
+	fw.mu.Lock()
+	waitData := fw.waitData
+	fw.waitData = map[string]*FlowManWaitData{}
+	fw.mu.Unlock()
+	for _, wd := range waitData {
+		wd.FlowMan.waitDecr(wd.Count)
+		wd.FlowMan.SyncFlows(ctx)
+	}
+}
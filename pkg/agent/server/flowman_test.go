@@ -0,0 +1,199 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+func flowTexts(flows []*ovs.Flow) []string {
+	r := []string{}
+	for _, f := range flows {
+		txt, _ := f.MarshalText()
+		r = append(r, string(txt))
+	}
+	sort.Strings(r)
+	return r
+}
+
+func TestFlowManWarmStart(t *testing.T) {
+	var (
+		flowA = utils.F(0, 100, "in_port=1", "normal")
+		flowB = utils.F(0, 100, "in_port=2", "normal")
+		flowC = utils.F(0, 100, "in_port=3", "normal")
+	)
+	// flows of the last run on the bridge
+	current := utils.NewFlowSetFromList([]*ovs.Flow{flowA, flowB})
+	var added, deleted []*ovs.Flow
+	fm := fakeFlowMan("br0")
+	fm.idleTimer = time.NewTimer(time.Hour)
+	defer fm.idleTimer.Stop()
+	fm.dumpFlows = func([]int) (*utils.FlowSet, error) {
+		return utils.NewFlowSetFromList(current.Flows()), nil
+	}
+	fm.commitChange = func(flowsAdd, flowsDel []*ovs.Flow) error {
+		added, deleted = flowsAdd, flowsDel
+		for _, f := range flowsDel {
+			current.Remove(f)
+		}
+		for _, f := range flowsAdd {
+			current.Add(f)
+		}
+		return nil
+	}
+	fm.warm = &flowManWarm{start: time.Now()}
+	check := func(name string, wantAdd, wantDel []*ovs.Flow) {
+		t.Helper()
+		if got, want := flowTexts(added), flowTexts(wantAdd); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: add %v, want %v", name, got, want)
+		}
+		if got, want := flowTexts(deleted), flowTexts(wantDel); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: del %v, want %v", name, got, want)
+		}
+		added, deleted = nil, nil
+	}
+
+	// flowB of guests not loaded yet is kept
+	fm.doCmd(&flowManCmd{
+		Type: flowManCmdUpdateFlows,
+		Who:  "guest0",
+		Arg:  []*ovs.Flow{flowA, flowC},
+	})
+	check("warm update", []*ovs.Flow{flowC}, nil)
+	fm.doCmd(&flowManCmd{Type: flowManCmdSyncFlows})
+	check("warm sync", nil, nil)
+
+	fm.doCmd(&flowManCmd{Type: flowManCmdEndWarmStart})
+	check("warm start ended", nil, []*ovs.Flow{flowB})
+	if fm.warm != nil {
+		t.Errorf("warm start not ended")
+	}
+
+	// deletes go through right away after warm start
+	fm.doCmd(&flowManCmd{
+		Type: flowManCmdUpdateFlows,
+		Who:  "guest0",
+		Arg:  []*ovs.Flow{flowA},
+	})
+	check("update", nil, []*ovs.Flow{flowC})
+}
+
+func TestFlowManCommitFlows(t *testing.T) {
+	var (
+		flowA = utils.F(0, 100, "in_port=1", "normal")
+		flowB = utils.F(0, 100, "in_port=2", "normal")
+	)
+	current := utils.NewFlowSetFromList([]*ovs.Flow{flowA})
+	commits, changes := 0, 0
+	fm := fakeFlowMan("br0")
+	fm.idleTimer = time.NewTimer(time.Hour)
+	defer fm.idleTimer.Stop()
+	fm.dumpFlows = func([]int) (*utils.FlowSet, error) {
+		return utils.NewFlowSetFromList(current.Flows()), nil
+	}
+	fm.commitChange = func(flowsAdd, flowsDel []*ovs.Flow) error {
+		commits += 1
+		changes += len(flowsAdd) + len(flowsDel)
+		for _, f := range flowsDel {
+			current.Remove(f)
+		}
+		for _, f := range flowsAdd {
+			current.Add(f)
+		}
+		return nil
+	}
+	fm.flowSets["guest0"] = utils.NewFlowSetFromList([]*ovs.Flow{flowA})
+
+	// checks are held by a batch of other guests
+	fm.waitCount = 1
+	var doneErr error
+	done := false
+	fm.doCmd(&flowManCmd{
+		Type: flowManCmdCommitFlows,
+		Who:  "guest1",
+		Arg:  []*ovs.Flow{flowB},
+		Done: func(err error) {
+			done = true
+			doneErr = err
+		},
+	})
+	if !done || doneErr != nil {
+		t.Errorf("commit done %v, err %v", done, doneErr)
+	}
+	if commits != 1 || changes != 1 {
+		t.Errorf("%d commits of %d changes, want 1 of 1", commits, changes)
+	}
+	want := flowTexts([]*ovs.Flow{flowA, flowB})
+	if got := flowTexts(current.Flows()); !reflect.DeepEqual(got, want) {
+		t.Errorf("flows %v, want %v", got, want)
+	}
+
+	// nothing left for the check after the batch
+	fm.waitCount = 0
+	fm.doCmd(&flowManCmd{Type: flowManCmdSyncFlows})
+	if changes != 1 {
+		t.Errorf("%d changes after sync, want 1", changes)
+	}
+}
+
+func TestAgentServerWarmStart(t *testing.T) {
+	ctx := context.Background()
+	fm := fakeFlowMan("br0")
+	s := &AgentServer{
+		flowMansLock: &sync.RWMutex{},
+		flowMans: map[string]*FlowMan{
+			fm.bridge: fm,
+		},
+	}
+	s.startWarm(ctx, 10*time.Millisecond)
+	select {
+	case cmd := <-fm.cmdChan:
+		if cmd.Type != flowManCmdEndWarmStart {
+			t.Errorf("cmd type %v, want end of warm start", cmd.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("warm start not ended on timeout")
+	}
+
+	s.endWarmStart(ctx, "initial scan done")
+	select {
+	case cmd := <-fm.cmdChan:
+		t.Errorf("unexpected cmd %v after warm start ended", cmd.Type)
+	default:
+	}
+}
+
+func TestFilterOvsFlows(t *testing.T) {
+	flows := []*ovs.Flow{
+		utils.F(0, 100, "in_port=1", "normal"),
+		utils.F(10, 10000, "in_port=1", "normal"),
+		utils.F(utils.GuestMeterTable, 10000, "dl_dst=00:22:33:44:55:66", "load:0x1->NXM_NX_REG6[],resubmit(,1)"),
+		utils.F(0, 29110, "dl_dst=00:22:33:44:55:66,reg6=0", "resubmit(,14)"),
+	}
+	// meter guards are left to tcman, and not there without it
+	want := flowTexts(flows[:1])
+	if got := flowTexts(filterOvsFlows(flows, excludeOvsTables)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
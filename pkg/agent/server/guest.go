@@ -17,6 +17,8 @@ package server
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/digitalocean/go-openvswitch/ovs"
@@ -32,12 +34,48 @@ var (
 	errNotRunning   = fmt.Errorf("not running")
 	errPortNotReady = fmt.Errorf("port not ready") // no port is ready
 	errVolatileHost = fmt.Errorf("volatile host")
+	// guest migrating onto this host with ports not ready yet
+	errMigrationStaged = fmt.Errorf("migration staged")
 )
 
 type Guest struct {
 	*utils.Guest
+	// mu is held by tasks updating the guest, and by the watcher goroutine
+	// reading its status
+	mu              sync.Mutex
 	watcher         *serversWatcher
 	lastSeenPending *time.Time
+	// watched is true if the guest dir is added to inotify watch
+	watched bool
+	// deleted is true after the guest dir is removed
+	deleted bool
+	// lastErr is error of the last update
+	lastErr error
+	// lastApplied is when settings were last applied without error
+	lastApplied time.Time
+	// errors and number of flows of nics in the last update, keyed by
+	// nic mac
+	nicErrs  map[string]error
+	nicFlows map[string]int
+	// savedStatus is status last written to guestStatusFile
+	savedStatus []byte
+
+	// vlan settings applied to trunk ports with their openflow port
+	// numbers, keyed by port name.  Recreated ports come with new numbers
+	trunkPorts map[string]string
+	// openflow port numbers of ports made protected for isolated nics,
+	// keyed by port name
+	isolatedPorts map[string]int
+	// learn flows of nics with mac limit, keyed by port name, and packets
+	// dropped for exceeding mac limit, keyed by nic mac
+	macLimitPorts map[string]macLimitPort
+	macLimitDrops map[string]uint64
+
+	// flowsActive is true if guest flows were handed to flowman
+	flowsActive bool
+	migration   *guestMigration
+	// where nics were announced, keyed by nic mac
+	announced map[string]string
 }
 
 func NewGuest(guest *utils.Guest, watcher *serversWatcher) *Guest {
@@ -55,10 +93,12 @@ func (g *Guest) refreshNicPortNo(ctx context.Context, nics []*utils.GuestNIC) bo
 	for _, nic := range nics {
 		bridge := nic.Bridge
 		ifname := nic.IfnameHost
-		portStats, err := utils.DumpPort(bridge, ifname)
+		portStats, err := g.watcher.dumpPort(bridge, ifname)
 		if err == nil {
 			someOk = true
 			nic.PortNo = portStats.PortID
+		} else {
+			g.setNicError(nic.MAC, fmt.Errorf("port %s of bridge %s: %v", ifname, bridge, err))
 		}
 	}
 	return someOk
@@ -77,6 +117,10 @@ func (g *Guest) reloadDesc(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	for _, err := range g.watcher.portMappingMan.Claim(g.Id, g.NICs) {
+		log.Warningf("guest %s: %v, skipped", g.Id, err)
+		g.setNicError(err.MAC, err)
+	}
 	if g.NeedsSync() {
 		go func() {
 			// desc change will be picked up by watcher
@@ -91,11 +135,9 @@ func (g *Guest) reloadDesc(ctx context.Context) error {
 	}
 
 	for _, nic := range g.NICs {
-		if i, ok := oldM[nic.MAC]; ok {
-			delete(oldM, nic.MAC)
-			nic.CtZoneId = i
-			continue
-		}
+		// allocation is kept by zoneMan, and may have moved away from
+		// zones found reserved for others
+		delete(oldM, nic.MAC)
 		zoneId, err := g.watcher.zoneMan.AllocateZoneId(nic.MAC)
 		if err != nil {
 			return fmt.Errorf("ct zone id allocation failed: %s", err)
@@ -133,7 +175,9 @@ func (g *Guest) IsPending() bool {
 func (g *Guest) refresh(ctx context.Context) (err error) {
 	setPending := true
 	defer func() {
-		if err != nil {
+		if err == errMigrationStaged {
+			log.Debugf("update guest flows %s: %s", g.Id, err)
+		} else if err != nil {
 			log.Warningf("update guest flows %s: %s", g.Id, err)
 			if setPending {
 				g.setPending()
@@ -143,10 +187,21 @@ func (g *Guest) refresh(ctx context.Context) (err error) {
 		}
 	}()
 
+	g.nicErrs = nil
 	err = g.reloadDesc(ctx)
 	if err != nil {
 		return
 	}
+	if g.IsMigrationTarget() {
+		g.stageMigration()
+		someOk0 := g.refreshNicPortNo(ctx, g.NICs)
+		someOk1 := g.refreshNicPortNo(ctx, g.VpcNICs)
+		if !someOk0 && !someOk1 {
+			err = errMigrationStaged
+			setPending = false
+		}
+		return
+	}
 	if g.IsVolatileHost() {
 		err = errVolatileHost
 		setPending = false
@@ -170,15 +225,47 @@ func (g *Guest) refresh(ctx context.Context) (err error) {
 	return
 }
 
-func (g *Guest) updateClassicFlows(ctx context.Context) (err error) {
-	bfs, err := g.FlowsMap()
+// flowsMap returns flows of nics keyed by bridge like FlowsMap, recording
+// number of flows and error of each nic
+func (g *Guest) flowsMap() map[string][]*ovs.Flow {
+	r := map[string][]*ovs.Flow{}
+	g.nicFlows = map[string]int{}
+	for _, nic := range g.NICs {
+		flowsMap, err := g.FlowsMapForNic(nic)
+		if err != nil {
+			log.Warningf("FlowsMapForNic %s fail: %s", nic.MAC, err)
+			g.setNicError(nic.MAC, fmt.Errorf("flows: %v", err))
+			continue
+		}
+		for bridge, flows := range flowsMap {
+			r[bridge] = append(r[bridge], flows...)
+			g.nicFlows[nic.MAC] += len(flows)
+		}
+	}
+	return r
+}
+
+func (g *Guest) updateClassicFlows(ctx context.Context) {
+	bfs := g.flowsMap()
+	activating := g.migration.isActivating(g)
+	done := g.flowsDone(len(bfs))
 	for bridge, flows := range bfs {
 		flowman := g.watcher.agent.GetFlowMan(bridge)
-		if flowman != nil {
-			flowman.updateFlows(ctx, g.Who(), flows)
+		if flowman != nil && activating {
+			flowman.commitFlowsNotify(ctx, g.Who(), flows, done)
+		} else if flowman != nil {
+			flowman.updateFlowsNotify(ctx, g.Who(), flows, done)
+		} else {
+			for _, nic := range g.NICs {
+				if nic.Bridge == bridge {
+					g.setNicError(nic.MAC, fmt.Errorf("bridge %s not available", bridge))
+					delete(g.nicFlows, nic.MAC)
+				}
+			}
+			done(nil)
 		}
 	}
-	return
+	g.flowsActive = true
 }
 
 func (g *Guest) clearClassicFlows(ctx context.Context) {
@@ -187,15 +274,178 @@ func (g *Guest) clearClassicFlows(ctx context.Context) {
 		bridges[nic.Bridge] = true
 		g.watcher.zoneMan.FreeZoneId(nic.MAC)
 	}
+	g.watcher.portMappingMan.Release(g.Id)
+	g.clearMacLimitPorts(ctx)
+	done := func(error) {}
+	if g.flowsActive {
+		done = g.clearFlowsDone(len(bridges))
+	}
 	for bridge, _ := range bridges {
 		flowman := g.watcher.agent.GetFlowMan(bridge)
 		if flowman != nil {
-			flowman.updateFlows(ctx, g.Who(), []*ovs.Flow{})
+			flowman.updateFlowsNotify(ctx, g.Who(), []*ovs.Flow{}, done)
+		} else {
+			done(nil)
 		}
 	}
+	g.flowsActive = false
+	g.nicFlows = nil
+	g.announced = nil
+	// ports may be recreated with default settings before the guest is
+	// back
+	g.trunkPorts = nil
+	g.isolatedPorts = nil
 	g.clearPending()
 }
 
+// updateTrunkPorts configures trunk vlans on nic ports, and restores ports
+// that are no longer trunks
+func (g *Guest) updateTrunkPorts(ctx context.Context) {
+	if g.trunkPorts == nil {
+		g.trunkPorts = map[string]string{}
+	}
+	for _, nic := range g.NICs {
+		applied, ok := g.trunkPorts[nic.IfnameHost]
+		if !ok && !nic.IsTrunk() {
+			continue
+		}
+		args := nic.OvsPortVlanArgs()
+		key := fmt.Sprintf("%d %s", nic.PortNo, strings.Join(args, " "))
+		if applied == key {
+			continue
+		}
+		if err := g.watcher.runOvsctl(ctx, args); err != nil {
+			log.Errorf("guest %s: configure vlans of port %s: %v", g.Id, nic.IfnameHost, err)
+			continue
+		}
+		if nic.IsTrunk() {
+			g.trunkPorts[nic.IfnameHost] = key
+		} else {
+			delete(g.trunkPorts, nic.IfnameHost)
+		}
+	}
+}
+
+// updateIsolatedPorts protects ports of isolated nics, and unprotects ports
+// whose nics are no longer isolated
+func (g *Guest) updateIsolatedPorts(ctx context.Context) {
+	if g.isolatedPorts == nil {
+		g.isolatedPorts = map[string]int{}
+	}
+	for _, nic := range g.NICs {
+		portNo, ok := g.isolatedPorts[nic.IfnameHost]
+		if ok == nic.Isolated && (!ok || portNo == nic.PortNo) {
+			continue
+		}
+		if err := g.watcher.runOvsctl(ctx, nic.OvsPortIsolationArgs()); err != nil {
+			log.Errorf("guest %s: configure isolation of port %s: %v", g.Id, nic.IfnameHost, err)
+			continue
+		}
+		if nic.Isolated {
+			g.isolatedPorts[nic.IfnameHost] = nic.PortNo
+		} else {
+			delete(g.isolatedPorts, nic.IfnameHost)
+		}
+	}
+}
+
+// macLimitPort is the learn flow of the port in utils.MacLimitTable
+type macLimitPort struct {
+	bridge string
+	portNo int
+	flow   string
+}
+
+// updateMacLimitPorts adds learn flows of nics with mac limit, and deletes
+// those of nics that are no longer limited, along with macs they learned
+func (g *Guest) updateMacLimitPorts(ctx context.Context) {
+	if g.macLimitPorts == nil {
+		g.macLimitPorts = map[string]macLimitPort{}
+	}
+	ports := map[string]bool{}
+	for _, nic := range g.NICs {
+		ports[nic.IfnameHost] = true
+		flow := ""
+		if !g.SrcMacCheck() && nic.HasMacLimit() {
+			flow = nic.MacLimitLearnFlow()
+		}
+		applied, ok := g.macLimitPorts[nic.IfnameHost]
+		if applied.flow == flow && applied.bridge == nic.Bridge {
+			continue
+		}
+		if ok && !g.delMacLimitPort(ctx, nic.IfnameHost, applied) {
+			continue
+		}
+		if flow == "" {
+			continue
+		}
+		if err := g.watcher.runOvsctl(ctx, []string{"ovs-ofctl", "add-flow", nic.Bridge, flow}); err != nil {
+			log.Errorf("guest %s: add mac limit flow of port %s: %v", g.Id, nic.IfnameHost, err)
+			continue
+		}
+		g.macLimitPorts[nic.IfnameHost] = macLimitPort{
+			bridge: nic.Bridge,
+			portNo: nic.PortNo,
+			flow:   flow,
+		}
+	}
+	for name, applied := range g.macLimitPorts {
+		if !ports[name] {
+			g.delMacLimitPort(ctx, name, applied)
+		}
+	}
+}
+
+// clearMacLimitPorts deletes learn flows of all nics with mac limit
+func (g *Guest) clearMacLimitPorts(ctx context.Context) {
+	for name, applied := range g.macLimitPorts {
+		g.delMacLimitPort(ctx, name, applied)
+	}
+	g.macLimitPorts = nil
+}
+
+func (g *Guest) delMacLimitPort(ctx context.Context, name string, applied macLimitPort) bool {
+	if err := g.watcher.runOvsctl(ctx, []string{"ovs-ofctl", "del-flows", applied.bridge, utils.MacLimitMatch(applied.portNo)}); err != nil {
+		log.Errorf("guest %s: delete mac limit flows of port %s: %v", g.Id, name, err)
+		return false
+	}
+	delete(g.macLimitPorts, name)
+	return true
+}
+
+// checkMacLimitDrops reports nics dropping packets from source macs beyond
+// their mac limit
+func (g *Guest) checkMacLimitDrops(ctx context.Context) {
+	if g.SrcMacCheck() {
+		return
+	}
+	if g.macLimitDrops == nil {
+		g.macLimitDrops = map[string]uint64{}
+	}
+	ofCli := ovs.New().OpenFlow
+	for _, nic := range g.NICs {
+		if !nic.HasMacLimit() {
+			delete(g.macLimitDrops, nic.MAC)
+			continue
+		}
+		stats, err := ofCli.DumpAggregate(nic.Bridge, &ovs.MatchFlow{
+			Table:      utils.MacLimitCheckTable,
+			Cookie:     utils.MacLimitCookie(nic.PortNo),
+			CookieMask: ^uint64(0),
+		})
+		if err != nil {
+			log.Debugf("guest %s: dump mac limit drops of %s: %v", g.Id, nic.IfnameHost, err)
+			continue
+		}
+		last, ok := g.macLimitDrops[nic.MAC]
+		if ok && stats.PacketCount > last {
+			log.Warningf("guest %s(%s) nic %s: %d packets dropped for exceeding mac limit %d",
+				g.Name, g.Id, nic.IfnameHost, stats.PacketCount-last, nic.MacLimit)
+		}
+		g.macLimitDrops[nic.MAC] = stats.PacketCount
+	}
+}
+
 func (g *Guest) updateTc(ctx context.Context, sync bool) {
 	if g.watcher.tcMan == nil {
 		return
@@ -203,6 +453,9 @@ func (g *Guest) updateTc(ctx context.Context, sync bool) {
 	data := []*utils.TcData{}
 	for _, nic := range g.NICs {
 		d := nic.TcData()
+		d.BpfIngress = g.HostConfig.GuestBpfIngress
+		d.BpfEgress = g.HostConfig.GuestBpfEgress
+		d.QueueShaping = g.HostConfig.SdnTapQueueShaping
 		data = append(data, d)
 	}
 	g.watcher.tcMan.AddIfaces(ctx, g.Who(), data, sync)
@@ -245,11 +498,16 @@ func (g *Guest) clearOvn(ctx context.Context) {
 func (g *Guest) UpdateSettings(ctx context.Context, sync bool) {
 	start := time.Now()
 	err := g.refresh(ctx)
+	g.lastErr = err
 	log.Debugf("guest UpdateSettings refresh %f", time.Since(start).Seconds())
 	switch err {
 	case nil:
+		g.updateTrunkPorts(ctx)
+		g.updateIsolatedPorts(ctx)
+		g.updateMacLimitPorts(ctx)
 		g.updateClassicFlows(ctx)
 		log.Debugf("guest UpdateSettings updateClassicFlows %f", time.Since(start).Seconds())
+		g.checkMacLimitDrops(ctx)
 		g.updateTc(ctx, sync)
 		log.Debugf("guest UpdateSettings updateTc %f", time.Since(start).Seconds())
 		g.updateOvn(ctx)
@@ -257,6 +515,11 @@ func (g *Guest) UpdateSettings(ctx context.Context, sync bool) {
 		if g.HostId != "" {
 			g.watcher.agent.HostId(g.HostId)
 		}
+		g.lastApplied = time.Now()
+	case errMigrationStaged:
+		if g.flowsActive {
+			g.ClearSettings(ctx)
+		}
 	case errNotRunning, errPortNotReady, errVolatileHost:
 		log.Debugf("guest %s(%s) ClearSettings due to g.refresh %s", g.Name, g.Id, err)
 		g.ClearSettings(ctx)
@@ -0,0 +1,166 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+func TestGuestTrunkPorts(t *testing.T) {
+	ctx := context.Background()
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.agent = Server()
+	cmds := []string{}
+	w.runOvsctl = func(ctx context.Context, args []string) error {
+		cmds = append(cmds, strings.Join(args, " "))
+		return nil
+	}
+	nic := &utils.GuestNIC{
+		Bridge:     "brtrunk",
+		IfnameHost: "vnet0",
+		MAC:        "00:22:00:00:00:01",
+		TrunkVlans: []int{10, 20},
+		PortNo:     3,
+	}
+	g := NewGuest(&utils.Guest{
+		Id:   "00000000-0000-4000-8000-000000000000",
+		NICs: []*utils.GuestNIC{nic},
+	}, w)
+	update := func(name string, want int) {
+		t.Helper()
+		cmds = nil
+		g.updateTrunkPorts(ctx)
+		if len(cmds) != want {
+			t.Errorf("%s: want %d commands, got %q", name, want, cmds)
+		}
+	}
+
+	update("trunk", 1)
+	update("applied", 0)
+	nic.PortNo = 4
+	update("port recreated", 1)
+	g.clearClassicFlows(ctx)
+	update("guest back", 1)
+	nic.TrunkVlans = nil
+	update("no longer trunk", 1)
+	update("restored", 0)
+}
+
+func TestGuestIsolatedPorts(t *testing.T) {
+	ctx := context.Background()
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.agent = Server()
+	cmds := []string{}
+	w.runOvsctl = func(ctx context.Context, args []string) error {
+		cmds = append(cmds, strings.Join(args, " "))
+		return nil
+	}
+	nic := &utils.GuestNIC{
+		Bridge:     "brisolated",
+		IfnameHost: "vnet0",
+		MAC:        "00:22:00:00:00:01",
+		Isolated:   true,
+		PortNo:     3,
+	}
+	g := NewGuest(&utils.Guest{
+		Id:   "00000000-0000-4000-8000-000000000000",
+		NICs: []*utils.GuestNIC{nic},
+	}, w)
+	update := func(name string, want int) {
+		t.Helper()
+		cmds = nil
+		g.updateIsolatedPorts(ctx)
+		if len(cmds) != want {
+			t.Errorf("%s: want %d commands, got %q", name, want, cmds)
+		}
+	}
+
+	update("isolated", 1)
+	update("applied", 0)
+	nic.PortNo = 4
+	update("port recreated", 1)
+	g.clearClassicFlows(ctx)
+	update("guest back", 1)
+	nic.Isolated = false
+	update("no longer isolated", 1)
+	update("unprotected", 0)
+}
+
+func TestGuestMacLimitPorts(t *testing.T) {
+	ctx := context.Background()
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.agent = Server()
+	cmds := []string{}
+	w.runOvsctl = func(ctx context.Context, args []string) error {
+		cmds = append(cmds, strings.Join(args[:2], " "))
+		return nil
+	}
+	nic := &utils.GuestNIC{
+		Bridge:     "brlimit",
+		IfnameHost: "vnet0",
+		MAC:        "00:22:00:00:00:01",
+		MacLimit:   4,
+		PortNo:     3,
+	}
+	ug := &utils.Guest{
+		Id:         "00000000-0000-4000-8000-000000000000",
+		HostConfig: &utils.HostConfig{},
+		NICs:       []*utils.GuestNIC{nic},
+	}
+	// guests may turn off src mac check only when switch vms are allowed
+	ug.HostConfig.AllowSwitchVMs = true
+	g := NewGuest(ug, w)
+	update := func(name string, want ...string) {
+		t.Helper()
+		cmds = nil
+		g.updateMacLimitPorts(ctx)
+		if strings.Join(cmds, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: want commands %q, got %q", name, want, cmds)
+		}
+	}
+
+	update("limited", "ovs-ofctl add-flow")
+	update("applied")
+	nic.PortNo = 4
+	update("port recreated", "ovs-ofctl del-flows", "ovs-ofctl add-flow")
+	nic.MacLimit = 8
+	update("limit changed", "ovs-ofctl del-flows", "ovs-ofctl add-flow")
+	cmds = nil
+	g.clearClassicFlows(ctx)
+	if len(cmds) != 1 {
+		t.Errorf("clear: want 1 command, got %q", cmds)
+	}
+	update("guest back", "ovs-ofctl add-flow")
+	ug.NICs = nil
+	update("nic removed", "ovs-ofctl del-flows")
+	ug.NICs = []*utils.GuestNIC{nic}
+	update("nic back", "ovs-ofctl add-flow")
+	nic.MacLimit = 0
+	update("no longer limited", "ovs-ofctl del-flows")
+	update("unlimited")
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+func copyGuestNics(nics []*utils.GuestNIC) []*utils.GuestNIC {
+	r := make([]*utils.GuestNIC, 0, len(nics))
+	for _, nic := range nics {
+		n := *nic
+		r = append(r, &n)
+	}
+	return r
+}
+
+// snapshotLookup saves a copy of the guest for lookups and its status st,
+// or drops them if the guest is deleted.  It is called with g.mu held at
+// the end of guest tasks, so that lookups from metadata and openflow
+// servers, and status queries, never wait for guest updates
+func (w *serversWatcher) snapshotLookup(g *Guest, st *guestStatus) {
+	w.lookupMu.Lock()
+	defer w.lookupMu.Unlock()
+	if g.deleted {
+		delete(w.lookups, g.Id)
+		delete(w.statuses, g.Id)
+		return
+	}
+	ug := *g.Guest
+	ug.NICs = copyGuestNics(g.NICs)
+	ug.VpcNICs = copyGuestNics(g.VpcNICs)
+	w.lookups[g.Id] = &ug
+	w.statuses[g.Id] = st
+}
+
+// findLookup returns snapshot of the first guest f returns true for
+func (w *serversWatcher) findLookup(f func(ug *utils.Guest) bool) *utils.Guest {
+	w.lookupMu.RLock()
+	defer w.lookupMu.RUnlock()
+	for _, ug := range w.lookups {
+		if f(ug) {
+			return ug
+		}
+	}
+	return nil
+}
+
+// lookupDesc parses desc of the guest snapshot.  The snapshot is copied as
+// reading desc may drop its stale pushed desc
+func lookupDesc(ug *utils.Guest) *desc.SGuestDesc {
+	if ug == nil {
+		return nil
+	}
+	cp := *ug
+	obj, err := cp.GetJSONObjectDesc()
+	if err != nil {
+		log.Errorf("guest %s: GetJSONObjectDesc: %v", ug.Id, err)
+	}
+	return obj
+}
+
+func (w *serversWatcher) FindGuestDescByNetIdIP(netId, ip string) *desc.SGuestDesc {
+	if obj := w.netIdIpNicCache.Get(netId); obj != nil {
+		return obj.(*desc.SGuestDesc)
+	}
+	ug := w.findLookup(func(ug *utils.Guest) bool {
+		return ug.FindNicByNetIdIP(netId, ip) != nil
+	})
+	robj := lookupDesc(ug)
+	if robj != nil {
+		w.netIdIpNicCache.Set(netId, robj)
+	}
+	return robj
+}
+
+func (w *serversWatcher) FindGuestDescByHostLocalIp(hostLocal *utils.HostLocal, ip string) *desc.SGuestDesc {
+	mapKey := fmt.Sprintf("%s:%s", hostLocal.Bridge, ip)
+	if obj := w.bridgeIpNicCache.Get(mapKey); obj != nil {
+		return obj.(*desc.SGuestDesc)
+	}
+	ug := w.findLookup(func(ug *utils.Guest) bool {
+		return ug.FindNicByHostLocalIP(hostLocal, ip) != nil
+	})
+	robj := lookupDesc(ug)
+	if robj != nil {
+		w.bridgeIpNicCache.Set(mapKey, robj)
+	}
+	return robj
+}
+
+// FindMetadataGuestByHostLocalIp returns guest sending metadata requests
+// from fake source ip of the host local network
+func (w *serversWatcher) FindMetadataGuestByHostLocalIp(hostLocal *utils.HostLocal, ip string) *utils.MetadataGuest {
+	ug := w.findLookup(func(ug *utils.Guest) bool {
+		return ug.FindNicByHostLocalIP(hostLocal, ip) != nil
+	})
+	if ug == nil {
+		return nil
+	}
+	return &utils.MetadataGuest{
+		Id:    ug.Id,
+		Paths: ug.MetadataPaths,
+	}
+}
+
+// FindGuestNicByPort returns guest id and nic mac of the port on bridge
+func (w *serversWatcher) FindGuestNicByPort(bridge string, portNo int) (string, string, bool) {
+	var mac string
+	ug := w.findLookup(func(ug *utils.Guest) bool {
+		for _, nic := range ug.NICs {
+			if nic.Bridge == bridge && nic.PortNo == portNo {
+				mac = nic.MAC
+				return true
+			}
+		}
+		return false
+	})
+	if ug == nil {
+		return "", "", false
+	}
+	return ug.Id, mac, true
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	pb "yunion.io/x/sdnagent/pkg/agent/proto"
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+// applyEvent applies guest desc and lifecycle event pushed by host agent.
+// Desc pushed is loaded instead of the desc file, which is still watched for
+// changes not pushed
+func (g *Guest) applyEvent(ctx context.Context, event string, desc []byte) *guestStatus {
+	if len(desc) > 0 {
+		g.SetDesc(desc)
+	}
+	log.Infof("guest %s: %s event pushed", g.Id, event)
+	switch event {
+	case pb.GuestEventStopped:
+		g.ClearSettings(ctx)
+		g.lastErr = errNotRunning
+	default:
+		// migration, nic hotplug and the like are all told by desc
+		g.UpdateSettings(ctx, true)
+	}
+	return g.status()
+}
+
+// guestEvent queues event pushed on the guest, to be acked once applied.
+// It is applied with ctx of the watcher, as the caller may be gone before
+// the guest task runs
+func (w *serversWatcher) guestEvent(ctx context.Context, data wCmdGuestEventData) {
+	if !REGEX_UUID.MatchString(data.GuestId) {
+		data.RespCh <- &wGuestEventResult{
+			Err: errors.Wrapf(errors.ErrInvalidFormat, "guest id %q", data.GuestId),
+		}
+		return
+	}
+	if !pb.IsGuestEvent(data.Event) {
+		data.RespCh <- &wGuestEventResult{
+			Err: errors.Wrapf(errors.ErrNotSupported, "guest event %q", data.Event),
+		}
+		return
+	}
+	guestPath := path.Join(w.hostConfig.ServersPath, data.GuestId)
+	if _, ok := w.guests[data.GuestId]; !ok {
+		// guests are removed when their dirs are, so unknown ones are
+		// taken only with desc on disk
+		descPath := path.Join(guestPath, "desc")
+		if _, err := os.Stat(descPath); err != nil {
+			data.RespCh <- &wGuestEventResult{
+				Err: errors.Wrapf(errors.ErrNotFound, "guest %s: no desc at %s", data.GuestId, descPath),
+			}
+			return
+		}
+	}
+	g, err := w.addGuestWatch(data.GuestId, guestPath)
+	if err != nil {
+		// retried on scan
+		log.Warningf("watch guest %s pushed: %v", guestPath, err)
+	}
+	w.guestTask(g, func() {
+		data.RespCh <- &wGuestEventResult{
+			Status: g.applyEvent(ctx, data.Event, data.Desc),
+		}
+	})
+}
+
+// GuestEvent applies guest event pushed, and returns status of the guest
+// after that
+func (w *serversWatcher) GuestEvent(ctx context.Context, guestId, event string, desc []byte) (*guestStatus, error) {
+	// buffered for the guest task not to block when ctx is done
+	respCh := make(chan *wGuestEventResult, 1)
+	req := wCmdReq{
+		cmd: wCmdGuestEvent,
+		data: wCmdGuestEventData{
+			GuestId: guestId,
+			Event:   event,
+			Desc:    desc,
+			RespCh:  respCh,
+		},
+	}
+	select {
+	case w.cmdCh <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case r := <-respCh:
+		return r.Status, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GuestStatuses returns status of guest with id, or of all guests in phase
+// if id is empty.  It does not wait for the watcher goroutine
+func (w *serversWatcher) GuestStatuses(ctx context.Context, guestId, phase string) ([]*guestStatus, error) {
+	return w.guestStatuses(guestId, phase)
+}
+
+type guestManService struct {
+	agent *AgentServer
+}
+
+func newGuestManService(agent *AgentServer) *guestManService {
+	return &guestManService{
+		agent: agent,
+	}
+}
+
+func (s *guestManService) GuestEvent(ctx context.Context, in *pb.GuestEventRequest) (*pb.GuestEventResponse, error) {
+	st, err := s.agent.watcher.GuestEvent(ctx, in.GuestId, in.Event, []byte(in.Desc))
+	if err != nil {
+		resp := &pb.GuestEventResponse{
+			Code: 1,
+			Mesg: err.Error(),
+		}
+		return resp, nil
+	}
+	resp := &pb.GuestEventResponse{
+		Code:   0,
+		Mesg:   "ok",
+		Status: st.pb(),
+	}
+	return resp, nil
+}
+
+func (s *guestManService) GetGuestStatus(ctx context.Context, in *pb.GetGuestStatusRequest) (*pb.GetGuestStatusResponse, error) {
+	if in.GuestId == "" {
+		resp := &pb.GetGuestStatusResponse{
+			Code: 1,
+			Mesg: "empty guest id",
+		}
+		return resp, nil
+	}
+	sts, err := s.agent.watcher.GuestStatuses(ctx, in.GuestId, "")
+	if err != nil {
+		resp := &pb.GetGuestStatusResponse{
+			Code: 1,
+			Mesg: err.Error(),
+		}
+		return resp, nil
+	}
+	resp := &pb.GetGuestStatusResponse{
+		Code:   0,
+		Mesg:   "ok",
+		Status: sts[0].pb(),
+	}
+	return resp, nil
+}
+
+func (s *guestManService) ListGuests(ctx context.Context, in *pb.ListGuestsRequest) (*pb.ListGuestsResponse, error) {
+	sts, err := s.agent.watcher.GuestStatuses(ctx, "", in.Phase)
+	if err != nil {
+		resp := &pb.ListGuestsResponse{
+			Code: 1,
+			Mesg: err.Error(),
+		}
+		return resp, nil
+	}
+	resp := &pb.ListGuestsResponse{
+		Code: 0,
+		Mesg: "ok",
+	}
+	for _, st := range sts {
+		resp.Guests = append(resp.Guests, st.pb())
+	}
+	return resp, nil
+}
+
+func (s *guestManService) GetMetadataStats(ctx context.Context, in *pb.GetMetadataStatsRequest) (*pb.GetMetadataStatsResponse, error) {
+	resp := &pb.GetMetadataStatsResponse{
+		Code: 0,
+		Mesg: "ok",
+	}
+	for bridge, guests := range utils.HostLocalMetadataStats() {
+		for guestId, st := range guests {
+			if in.GuestId != "" && guestId != in.GuestId {
+				continue
+			}
+			resp.Stats = append(resp.Stats, &pb.MetadataStats{
+				GuestId:   guestId,
+				Bridge:    bridge,
+				Requests:  st.Requests,
+				Throttled: st.Throttled,
+				Denied:    st.Denied,
+				Errors:    st.Errors,
+			})
+		}
+	}
+	sort.Slice(resp.Stats, func(i, j int) bool {
+		si, sj := resp.Stats[i], resp.Stats[j]
+		if si.GuestId != sj.GuestId {
+			return si.GuestId < sj.GuestId
+		}
+		return si.Bridge < sj.Bridge
+	})
+	return resp, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+
+	pb "yunion.io/x/sdnagent/pkg/agent/proto"
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+func TestGuestEvent(t *testing.T) {
+	ctx := context.Background()
+	serversPath := t.TempDir()
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.agent = Server()
+	w.workers = newGuestWorkers(2)
+	w.hostConfig = &utils.HostConfig{}
+	w.hostConfig.ServersPath = serversPath
+	w.hostConfig.DisableLocalVpc = true
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("new fsnotify watcher: %v", err)
+	}
+	defer w.watcher.Close()
+	pushEvent := func(guestId, event string, desc []byte) (*guestStatus, error) {
+		respCh := make(chan *wGuestEventResult, 1)
+		w.guestEvent(ctx, wCmdGuestEventData{
+			GuestId: guestId,
+			Event:   event,
+			Desc:    desc,
+			RespCh:  respCh,
+		})
+		r := <-respCh
+		return r.Status, r.Err
+	}
+
+	const (
+		guestId        = "0c1d2e3f-4a5b-4c6d-8e9f-a0b1c2d3e4f5"
+		unknownGuestId = "1d2e3f4a-5b6c-4d7e-8f9a-b0c1d2e3f4a5"
+		// ports on the bridge are never found
+		nicDesc = `"nics":[{"bridge":"sdntest-none","ifname":"sdntest-vnet0","mac":"00:22:00:00:00:01","ip":"10.0.0.2"}]`
+	)
+	guestPath := path.Join(serversPath, guestId)
+	if err := os.Mkdir(guestPath, 0755); err != nil {
+		t.Fatalf("mkdir guest: %v", err)
+	}
+	if err := os.WriteFile(path.Join(guestPath, "desc"), []byte(`{"name":"vm0"}`), 0644); err != nil {
+		t.Fatalf("write desc: %v", err)
+	}
+	cases := []struct {
+		name    string
+		guestId string
+		event   string
+		desc    string
+		wantErr bool
+		phase   string
+	}{
+		{
+			name:    "bad guest id",
+			guestId: "vm0",
+			event:   pb.GuestEventStarted,
+			wantErr: true,
+		},
+		{
+			name:    "unknown guest without desc",
+			guestId: unknownGuestId,
+			event:   pb.GuestEventStarted,
+			desc:    `{"name":"vm1",` + nicDesc + `}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad event",
+			guestId: guestId,
+			event:   "rebooted",
+			wantErr: true,
+		},
+		{
+			name:    "started",
+			guestId: guestId,
+			event:   pb.GuestEventStarted,
+			desc:    `{"name":"vm0",` + nicDesc + `}`,
+			phase:   pb.GuestPhasePending,
+		},
+		{
+			name:    "bad desc",
+			guestId: guestId,
+			event:   pb.GuestEventNicHotplug,
+			desc:    `{"name":"vm0",`,
+			phase:   pb.GuestPhaseError,
+		},
+		{
+			name:    "migration staged",
+			guestId: guestId,
+			event:   pb.GuestEventDesc,
+			desc:    `{"name":"vm0","is_volatile_host":true,` + nicDesc + `}`,
+			phase:   pb.GuestPhaseMigrationStaged,
+		},
+		{
+			name:    "stopped",
+			guestId: guestId,
+			event:   pb.GuestEventStopped,
+			phase:   pb.GuestPhaseStopped,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			st, err := pushEvent(c.guestId, c.event, []byte(c.desc))
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("expect error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("guest event: %v", err)
+			}
+			if st.Id != c.guestId {
+				t.Errorf("guest id: want %s, got %s", c.guestId, st.Id)
+			}
+			if st.Phase != c.phase {
+				t.Errorf("phase: want %s, got %s (%s)", c.phase, st.Phase, st.Error)
+			}
+			if st.Phase != pb.GuestPhaseActive && st.Error == "" {
+				t.Errorf("expect error message for phase %s", st.Phase)
+			}
+		})
+	}
+
+	if _, ok := w.guests[unknownGuestId]; ok {
+		t.Errorf("unknown guest without desc added")
+	}
+	g, ok := w.guests[guestId]
+	if !ok {
+		t.Fatalf("guest pushed not found")
+	}
+	if g.Name != "vm0" {
+		t.Errorf("name from pushed desc: got %q", g.Name)
+	}
+	if !g.watched {
+		t.Errorf("guest pushed not watched")
+	}
+}
+
+func TestGuestEventCtxDone(t *testing.T) {
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.GuestEvent(ctx, "0c1d2e3f-4a5b-4c6d-8e9f-a0b1c2d3e4f5", pb.GuestEventStarted, nil)
+		done <- err
+	}()
+	// the command is taken but never answered
+	req := <-w.cmdCh
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("want %v, got %v", context.Canceled, err)
+	}
+	// answering later does not block
+	data := req.data.(wCmdGuestEventData)
+	data.RespCh <- &wGuestEventResult{}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	pb "yunion.io/x/sdnagent/pkg/agent/proto"
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+)
+
+// guestStatusFile is the file in guest dir status of the guest is saved to,
+// for those without access to the grpc socket
+const guestStatusFile = "sdn-status"
+
+// guestStatus is state of guest settings after the last update
+type guestStatus struct {
+	Id    string `json:"id"`
+	Phase string `json:"phase"`
+	Error string `json:"error,omitempty"`
+	// LastApplied is when settings were last applied without error
+	LastApplied *time.Time        `json:"last_applied,omitempty"`
+	Flows       int               `json:"flows"`
+	Nics        []*guestNicStatus `json:"nics"`
+}
+
+// guestNicStatus is state of guest nic settings after the last update
+type guestNicStatus struct {
+	MAC     string `json:"mac"`
+	Ifname  string `json:"ifname"`
+	Bridge  string `json:"bridge"`
+	PortNo  int    `json:"port_no"`
+	CtZone  uint16 `json:"ct_zone"`
+	Flows   int    `json:"flows"`
+	TcState string `json:"tc_state"`
+	TcError string `json:"tc_error,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (st *guestStatus) pb() *pb.GuestStatus {
+	r := &pb.GuestStatus{
+		GuestId: st.Id,
+		Phase:   st.Phase,
+		Mesg:    st.Error,
+		Flows:   uint32(st.Flows),
+	}
+	if st.LastApplied != nil {
+		r.LastApplied = st.LastApplied.Unix()
+	}
+	for _, nic := range st.Nics {
+		r.Nics = append(r.Nics, &pb.GuestNicStatus{
+			Mac:     nic.MAC,
+			Ifname:  nic.Ifname,
+			Bridge:  nic.Bridge,
+			PortNo:  uint32(nic.PortNo),
+			CtZone:  uint32(nic.CtZone),
+			Flows:   uint32(nic.Flows),
+			TcState: nic.TcState,
+			TcMesg:  nic.TcError,
+			Mesg:    nic.Error,
+		})
+	}
+	return r
+}
+
+func (g *Guest) phase() string {
+	switch g.lastErr {
+	case nil:
+		if g.flowsActive {
+			return pb.GuestPhaseActive
+		}
+		return pb.GuestPhasePending
+	case errPortNotReady:
+		return pb.GuestPhasePending
+	case errNotRunning:
+		return pb.GuestPhaseStopped
+	case errMigrationStaged:
+		return pb.GuestPhaseMigrationStaged
+	case errVolatileHost:
+		return pb.GuestPhaseVolatile
+	default:
+		return pb.GuestPhaseError
+	}
+}
+
+// setNicError records error of the nic in the current update, unless one is
+// recorded already
+func (g *Guest) setNicError(mac string, err error) {
+	if g.nicErrs == nil {
+		g.nicErrs = map[string]error{}
+	}
+	if _, ok := g.nicErrs[mac]; !ok {
+		g.nicErrs[mac] = err
+	}
+}
+
+// tcState returns state of limits of guest nic ifname applied by tcman
+func (w *serversWatcher) tcState(ifname string) (string, error) {
+	tcMan := w.tcMan
+	if tcMan == nil {
+		return pb.TcStateDisabled, nil
+	}
+	checked, err := tcMan.IfaceChecked(ifname)
+	switch {
+	case !checked:
+		return pb.TcStatePending, nil
+	case err != nil:
+		return pb.TcStateError, err
+	default:
+		return pb.TcStateOk, nil
+	}
+}
+
+func (g *Guest) nicStatus(nic *utils.GuestNIC) *guestNicStatus {
+	st := &guestNicStatus{
+		MAC:    nic.MAC,
+		Ifname: nic.IfnameHost,
+		Bridge: nic.Bridge,
+		PortNo: nic.PortNo,
+		CtZone: nic.CtZoneId,
+		Flows:  g.nicFlows[nic.MAC],
+	}
+	if err := g.nicErrs[nic.MAC]; err != nil {
+		st.Error = err.Error()
+	}
+	tcState, err := g.watcher.tcState(nic.IfnameHost)
+	st.TcState = tcState
+	if err != nil {
+		st.TcError = err.Error()
+	}
+	return st
+}
+
+// status returns status of the guest.  It is called with g.mu held
+func (g *Guest) status() *guestStatus {
+	st := &guestStatus{
+		Id:    g.Id,
+		Phase: g.phase(),
+		Nics:  []*guestNicStatus{},
+	}
+	if g.lastErr != nil {
+		st.Error = g.lastErr.Error()
+	}
+	if !g.lastApplied.IsZero() {
+		lastApplied := g.lastApplied
+		st.LastApplied = &lastApplied
+	}
+	for _, nic := range g.NICs {
+		nicSt := g.nicStatus(nic)
+		st.Flows += nicSt.Flows
+		st.Nics = append(st.Nics, nicSt)
+	}
+	for _, nic := range g.VpcNICs {
+		nicSt := g.nicStatus(nic)
+		// vpc nics are served by ovn, not tcman and flowman of ours
+		nicSt.TcState = ""
+		st.Nics = append(st.Nics, nicSt)
+	}
+	return st
+}
+
+// saveStatus writes status st of the guest next to its desc if it changed
+// since last saved.  It is called with g.mu held
+func (g *Guest) saveStatus(st *guestStatus) {
+	if g.Path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		log.Errorf("guest %s: marshal status: %v", g.Id, err)
+		return
+	}
+	if bytes.Equal(data, g.savedStatus) {
+		return
+	}
+	p := path.Join(g.Path, guestStatusFile)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		// guest dir removed
+		if !os.IsNotExist(err) {
+			log.Errorf("guest %s: write status: %v", g.Id, err)
+		}
+		return
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		log.Errorf("guest %s: rename status: %v", g.Id, err)
+		return
+	}
+	g.savedStatus = data
+}
+
+// guestStatuses returns status of guest with id, or of all guests in phase
+// if id is empty.  All phases if phase is empty.  Statuses are those of the
+// last guest tasks, see snapshotLookup, with tc state of nics as of now
+func (w *serversWatcher) guestStatuses(id, phase string) ([]*guestStatus, error) {
+	w.lookupMu.RLock()
+	defer w.lookupMu.RUnlock()
+	if id != "" {
+		st, ok := w.statuses[id]
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrNotFound, "guest %s", id)
+		}
+		return []*guestStatus{w.withTcState(st)}, nil
+	}
+	r := []*guestStatus{}
+	for _, st := range w.statuses {
+		if phase == "" || st.Phase == phase {
+			r = append(r, w.withTcState(st))
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Id < r[j].Id
+	})
+	return r, nil
+}
+
+// withTcState returns copy of status st with tc state of nics as of now,
+// as tcman checks nics after guest tasks
+func (w *serversWatcher) withTcState(st *guestStatus) *guestStatus {
+	cp := *st
+	cp.Nics = make([]*guestNicStatus, 0, len(st.Nics))
+	for _, nic := range st.Nics {
+		nicSt := *nic
+		// vpc nics are not served by tcman
+		if nicSt.TcState != "" {
+			tcState, err := w.tcState(nicSt.Ifname)
+			nicSt.TcState = tcState
+			nicSt.TcError = ""
+			if err != nil {
+				nicSt.TcError = err.Error()
+			}
+		}
+		cp.Nics = append(cp.Nics, &nicSt)
+	}
+	return &cp
+}
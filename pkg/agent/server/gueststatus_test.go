@@ -0,0 +1,137 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+	"github.com/fsnotify/fsnotify"
+
+	pb "yunion.io/x/sdnagent/pkg/agent/proto"
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+func TestGuestStatus(t *testing.T) {
+	ctx := context.Background()
+	serversPath := t.TempDir()
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.agent = Server()
+	w.workers = newGuestWorkers(2)
+	w.hostConfig = &utils.HostConfig{}
+	w.hostConfig.ServersPath = serversPath
+	w.hostConfig.DisableLocalVpc = true
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("new fsnotify watcher: %v", err)
+	}
+	defer w.watcher.Close()
+	w.tcMan = NewTcMan(tc.TcBackendCli, utils.RateLimitBackendIfb)
+	w.tcMan.tcBackend = &fakeTcBackend{}
+
+	// port of vnet0 is found, vnet1 is not there
+	w.dumpPort = func(bridge, port string) (*ovs.PortStats, error) {
+		if port == "sdntest-vnet0" {
+			return &ovs.PortStats{PortID: 5}, nil
+		}
+		return nil, fmt.Errorf("no such port")
+	}
+
+	const guestId = "3c1d2e3f-4a5b-4c6d-8e9f-a0b1c2d3e4f5"
+	dir := path.Join(serversPath, guestId)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	desc := `{"name":"vm0","nics":[` +
+		`{"bridge":"sdntest-br0","ifname":"sdntest-vnet0","mac":"00:22:00:00:00:01","ip":"10.0.0.2"},` +
+		`{"bridge":"sdntest-none","ifname":"sdntest-vnet1","mac":"00:22:00:00:00:02","ip":"10.0.1.2"}]}`
+	if err := os.WriteFile(path.Join(dir, "desc"), []byte(desc), 0644); err != nil {
+		t.Fatalf("write desc: %v", err)
+	}
+	<-w.withWait(ctx, w.scan)
+
+	sts, err := w.guestStatuses(guestId, "")
+	if err != nil {
+		t.Fatalf("guest status: %v", err)
+	}
+	st := sts[0]
+	if st.Phase != pb.GuestPhaseActive || st.Error != "" {
+		t.Errorf("phase: %s: %s", st.Phase, st.Error)
+	}
+	if st.LastApplied == nil {
+		t.Errorf("last applied not set")
+	}
+	if len(st.Nics) != 2 {
+		t.Fatalf("%d nics, want 2", len(st.Nics))
+	}
+	nic0, nic1 := st.Nics[0], st.Nics[1]
+	// without host network of the bridge, flows of nic0 fail to generate
+	if nic0.PortNo != 5 || nic0.Flows != 0 || nic0.CtZone < GuestCtZoneBase || !strings.Contains(nic0.Error, "host network") {
+		t.Errorf("nic0: %#v", nic0)
+	}
+	if nic0.TcState != pb.TcStatePending {
+		t.Errorf("nic0 tc state before check: %s", nic0.TcState)
+	}
+	if nic1.Flows != 0 || !strings.Contains(nic1.Error, "sdntest-vnet1") {
+		t.Errorf("nic1: %#v", nic1)
+	}
+	if st.Flows != 0 {
+		t.Errorf("flows: want 0, got %d", st.Flows)
+	}
+
+	// status saved next to desc
+	data, err := os.ReadFile(path.Join(dir, guestStatusFile))
+	if err != nil {
+		t.Fatalf("read status file: %v", err)
+	}
+	saved := &guestStatus{}
+	if err := json.Unmarshal(data, saved); err != nil {
+		t.Fatalf("unmarshal status file: %v", err)
+	}
+	if saved.Phase != st.Phase || !reflect.DeepEqual(saved.Nics, st.Nics) {
+		t.Errorf("saved status: %s", data)
+	}
+
+	w.tcMan.setChecked("sdntest-vnet0", nil)
+	w.tcMan.setChecked("sdntest-vnet1", fmt.Errorf("qdisc show failed"))
+	sts, _ = w.guestStatuses(guestId, "")
+	if nic := sts[0].Nics[0]; nic.TcState != pb.TcStateOk {
+		t.Errorf("nic0 tc state: %s", nic.TcState)
+	}
+	if nic := sts[0].Nics[1]; nic.TcState != pb.TcStateError || nic.TcError == "" {
+		t.Errorf("nic1 tc state: %s: %s", nic.TcState, nic.TcError)
+	}
+
+	if sts, _ := w.guestStatuses("", pb.GuestPhaseActive); len(sts) != 1 {
+		t.Errorf("%d active guests, want 1", len(sts))
+	}
+	if sts, _ := w.guestStatuses("", pb.GuestPhaseStopped); len(sts) != 0 {
+		t.Errorf("%d stopped guests, want 0", len(sts))
+	}
+	if _, err := w.guestStatuses("4c1d2e3f-4a5b-4c6d-8e9f-a0b1c2d3e4f5", ""); err == nil {
+		t.Errorf("expect error for unknown guest")
+	}
+}
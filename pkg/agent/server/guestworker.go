@@ -0,0 +1,96 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+)
+
+// guestWorkers runs tasks of guests on at most n goroutines at a time.
+// Tasks of the same guest run one after another in the order submitted
+type guestWorkers struct {
+	sem chan struct{}
+
+	mu sync.Mutex
+	// tasks not yet run, keyed by guest id.  A guest is busy while it
+	// has an entry here
+	queues map[string][]func()
+	// idle is broadcast when a guest is no longer busy
+	idle *sync.Cond
+}
+
+func newGuestWorkers(n int) *guestWorkers {
+	if n <= 0 {
+		n = 1
+	}
+	gw := &guestWorkers{
+		sem:    make(chan struct{}, n),
+		queues: map[string][]func(){},
+	}
+	gw.idle = sync.NewCond(&gw.mu)
+	return gw
+}
+
+// Submit queues f to run after tasks of guest id submitted earlier
+func (gw *guestWorkers) Submit(id string, f func()) {
+	gw.mu.Lock()
+	q, busy := gw.queues[id]
+	gw.queues[id] = append(q, f)
+	gw.mu.Unlock()
+	if !busy {
+		go gw.run(id)
+	}
+}
+
+// Busy returns true if guest id has tasks queued or running
+func (gw *guestWorkers) Busy(id string) bool {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	_, busy := gw.queues[id]
+	return busy
+}
+
+// WaitIdle returns when guests ids have no tasks queued or running
+func (gw *guestWorkers) WaitIdle(ids []string) {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	for _, id := range ids {
+		for {
+			if _, busy := gw.queues[id]; !busy {
+				break
+			}
+			gw.idle.Wait()
+		}
+	}
+}
+
+func (gw *guestWorkers) run(id string) {
+	gw.sem <- struct{}{}
+	defer func() { <-gw.sem }()
+	for {
+		gw.mu.Lock()
+		q := gw.queues[id]
+		if len(q) == 0 {
+			delete(gw.queues, id)
+			gw.idle.Broadcast()
+			gw.mu.Unlock()
+			return
+		}
+		f := q[0]
+		gw.queues[id] = q[1:]
+		gw.mu.Unlock()
+		f()
+	}
+}
@@ -83,11 +83,7 @@ func (hl *HostLocal) updateTc(ctx context.Context, sync bool) {
 	}
 	data := []*utils.TcData{}
 	for _, hcn := range hl.watcher.hostConfig.HostNetworkConfigs() {
-		td := &utils.TcData{
-			Ifname: hcn.Bridge,
-			Bridge: hcn.Bridge,
-		}
-		data = append(data, td)
+		data = append(data, utils.NewHostTcData(hcn.Bridge, hcn.Ifname, hl.watcher.hostConfig.SdnHostUplinkShaping))
 	}
 	hl.watcher.tcMan.AddIfaces(ctx, tcManHostLocalWho, data, sync)
 }
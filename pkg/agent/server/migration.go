@@ -0,0 +1,135 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+)
+
+// guestMigration tracks a guest live migrated onto this host.  The guest is
+// staged when its desc arrives, flows are activated once its ports appear,
+// and cutover happens when the desc is no longer marked volatile
+type guestMigration struct {
+	stagedAt    time.Time
+	activatedAt time.Time
+}
+
+func (m *guestMigration) isStaged() bool {
+	return m.activatedAt.IsZero()
+}
+
+// isActivating tells whether flows of the staged guest are to be activated,
+// as its ports appeared.  They are committed right away, instead of waiting
+// for checks held by batches of other guests
+func (m *guestMigration) isActivating(g *Guest) bool {
+	return m != nil && m.isStaged() && g.IsMigrationTarget()
+}
+
+// joinDone returns a function to be called n times.  done is called with
+// the first error seen, after the last call
+func joinDone(n int, done func(error)) func(error) {
+	if n <= 0 {
+		done(nil)
+		return func(error) {}
+	}
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	return func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		n -= 1
+		if n == 0 {
+			done(firstErr)
+		}
+	}
+}
+
+// stageMigration marks the guest as migrating onto this host
+func (g *Guest) stageMigration() {
+	if g.migration == nil {
+		g.migration = &guestMigration{
+			stagedAt: time.Now(),
+		}
+		log.Infof("guest %s(%s): staged for incoming migration", g.Name, g.Id)
+	}
+}
+
+// flowsDone returns callback for commit of guest flows on n bridges.  It
+// reports timing of migration activation and cutover, and announces guest
+// addresses once flows are in place
+func (g *Guest) flowsDone(n int) func(error) {
+	start := time.Now()
+	who := g.Who()
+	m := g.migration
+	switch {
+	case m != nil && g.IsMigrationTarget():
+		// the guest does not run here until cutover, announce then
+		if !m.isStaged() {
+			return joinDone(n, func(error) {})
+		}
+		m.activatedAt = start
+		return joinDone(n, func(err error) {
+			if err != nil {
+				log.Errorf("guest %s: migration activation commit flows: %v", who, err)
+				return
+			}
+			log.Infof("guest %s: migration flows activated in %s, %s since staged",
+				who, time.Since(start), time.Since(m.stagedAt))
+		})
+	case m != nil:
+		g.migration = nil
+		g.announced = nil
+		nics := g.nicsToAnnounce()
+		return joinDone(n, func(err error) {
+			if err != nil {
+				log.Errorf("guest %s: migration cutover commit flows: %v", who, err)
+				return
+			}
+			log.Infof("guest %s: migration cutover flows committed in %s, %s since staged",
+				who, time.Since(start), time.Since(m.stagedAt))
+			g.announceNics(nics)
+		})
+	default:
+		nics := g.nicsToAnnounce()
+		return joinDone(n, func(err error) {
+			if err != nil {
+				log.Errorf("guest %s: commit flows: %v", who, err)
+				return
+			}
+			g.announceNics(nics)
+		})
+	}
+}
+
+// clearFlowsDone returns callback for removal of guest flows on n bridges
+func (g *Guest) clearFlowsDone(n int) func(error) {
+	start := time.Now()
+	who := g.Who()
+	return joinDone(n, func(err error) {
+		if err != nil {
+			log.Errorf("guest %s: clear flows: %v", who, err)
+			return
+		}
+		log.Infof("guest %s: flows cleared in %s", who, time.Since(start))
+	})
+}
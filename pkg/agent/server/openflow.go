@@ -20,6 +20,7 @@ import (
 
 	"github.com/digitalocean/go-openvswitch/ovs"
 	pb "yunion.io/x/sdnagent/pkg/agent/proto"
+	"yunion.io/x/sdnagent/pkg/agent/utils"
 )
 
 type openflowService struct {
@@ -86,3 +87,112 @@ func (s *openflowService) DumpBridgePort(ctx context.Context, in *pb.DumpBridgeP
 	}
 	return resp, nil
 }
+
+func (s *openflowService) AnnounceGuest(ctx context.Context, in *pb.AnnounceGuestRequest) (*pb.Response, error) {
+	err := s.agent.watcher.AnnounceGuest(in.GuestId, in.Mac, int(in.Count))
+	return s.newResponse(err), nil
+}
+
+func (s *openflowService) ListVipOwners(ctx context.Context, in *pb.ListVipOwnersRequest) (*pb.ListVipOwnersResponse, error) {
+	bridges := []string{}
+	if in.Bridge != "" {
+		bridges = append(bridges, in.Bridge)
+	} else {
+		s.agent.flowMansLock.RLock()
+		for bridge := range s.agent.flowMans {
+			bridges = append(bridges, bridge)
+		}
+		s.agent.flowMansLock.RUnlock()
+	}
+	resp := &pb.ListVipOwnersResponse{
+		Code: 0,
+		Mesg: "ok",
+	}
+	for _, bridge := range bridges {
+		flows, err := s.ofCli.DumpFlowsWithFlowArgs(bridge, &ovs.MatchFlow{Table: utils.VipOwnerTable})
+		if err != nil {
+			resp.Code = 1
+			resp.Mesg = fmt.Sprintf("dump vip owners of %s: %s", bridge, err)
+			return resp, nil
+		}
+		for _, f := range flows {
+			vip, portNo, ok := utils.ParseVipOwnerFlow(f)
+			if !ok {
+				continue
+			}
+			owner := &pb.VipOwner{
+				Vip:    vip,
+				Bridge: bridge,
+				PortNo: uint32(portNo),
+			}
+			if guestId, mac, ok := s.agent.watcher.FindGuestNicByPort(bridge, portNo); ok {
+				owner.GuestId = guestId
+				owner.Mac = mac
+			}
+			resp.Owners = append(resp.Owners, owner)
+		}
+	}
+	return resp, nil
+}
+
+func (s *openflowService) GetGuestTcStats(ctx context.Context, in *pb.GetGuestTcStatsRequest) (*pb.GetGuestTcStatsResponse, error) {
+	resp := &pb.GetGuestTcStatsResponse{
+		Code: 0,
+		Mesg: "ok",
+	}
+	tcMan := s.agent.watcher.tcMan
+	if tcMan == nil {
+		resp.Code = 1
+		resp.Mesg = "tcman is not enabled"
+		return resp, nil
+	}
+	nics, err := tcMan.GuestStats(ctx, in.GuestId)
+	if err != nil {
+		resp.Code = 1
+		resp.Mesg = fmt.Sprintf("get tc stats: %s", err)
+		return resp, nil
+	}
+	for _, nic := range nics {
+		if in.Mac != "" && nic.MAC != in.Mac {
+			continue
+		}
+		nicStats := &pb.GuestNicTcStats{
+			Mac:    nic.MAC,
+			Ifname: nic.Ifname,
+		}
+		for _, st := range nic.Stats {
+			nicStats.Stats = append(nicStats.Stats, &pb.TcStats{
+				Ifname:         st.Ifname,
+				Type:           st.Type,
+				Kind:           st.Kind,
+				Id:             st.Id,
+				Parent:         st.Parent,
+				Bytes:          st.Bytes,
+				Packets:        st.Packets,
+				Drops:          st.Drops,
+				Overlimits:     st.Overlimits,
+				Requeues:       st.Requeues,
+				BacklogBytes:   st.BacklogBytes,
+				BacklogPackets: st.BacklogPackets,
+			})
+		}
+		resp.Nics = append(resp.Nics, nicStats)
+	}
+	return resp, nil
+}
+
+func (s *openflowService) ListCtZones(ctx context.Context, in *pb.ListCtZonesRequest) (*pb.ListCtZonesResponse, error) {
+	resp := &pb.ListCtZonesResponse{
+		Code: 0,
+		Mesg: "ok",
+	}
+	for _, zone := range s.agent.watcher.zoneMan.Zones() {
+		resp.Zones = append(resp.Zones, &pb.CtZone{
+			Zone:  uint32(zone.Zone),
+			Mac:   zone.MAC,
+			Owner: zone.Owner,
+			Stale: zone.Stale,
+		})
+	}
+	return resp, nil
+}
@@ -50,6 +50,9 @@ type ovnReq struct {
 }
 
 type ovnMan struct {
+	// hostIdLock serializes SetHostId from guests updated in parallel
+	hostIdLock sync.Mutex
+
 	hostId string
 	ip     string // fetch from region
 	ip6    string // fetch from region
@@ -398,6 +401,8 @@ func (man *ovnMan) ensureGuestFlows(ctx context.Context, guestId string) {
 }
 
 func (man *ovnMan) SetHostId(ctx context.Context, hostId string) {
+	man.hostIdLock.Lock()
+	defer man.hostIdLock.Unlock()
 	if man.hostId == "" {
 		man.hostId = hostId
 		if err := man.setIpMac(ctx); err != nil { // TODO make it a readiness check
@@ -37,21 +37,33 @@ type AgentServer struct {
 
 	flowMansLock *sync.RWMutex
 	flowMans     map[string]*FlowMan
+	// warmStartAt is set till flows of guests and host local are loaded
+	// after start.  Flowmans hold off deletes till then
+	warmStartAt *time.Time
 
 	ctx        context.Context
 	ctxCancel  context.CancelFunc
 	hostConfig *utils.HostConfig
+	hostIdLock *sync.RWMutex
 	hostId     string
 
 	rpcServer *grpc.Server
+	watcher   *serversWatcher
 
 	errorBridgeCache cache.Store
 }
 
 func (s *AgentServer) GetFlowMan(bridge string) *FlowMan {
-	theAgentServer.flowMansLock.RLock()
-	defer theAgentServer.flowMansLock.RUnlock()
-	if flowman, ok := theAgentServer.flowMans[bridge]; ok {
+	s.flowMansLock.RLock()
+	flowman, ok := s.flowMans[bridge]
+	s.flowMansLock.RUnlock()
+	if ok {
+		return flowman
+	}
+
+	s.flowMansLock.Lock()
+	defer s.flowMansLock.Unlock()
+	if flowman, ok := s.flowMans[bridge]; ok {
 		return flowman
 	}
 	if _, ok, _ := s.errorBridgeCache.GetByKey(bridge); ok {
@@ -63,7 +75,10 @@ func (s *AgentServer) GetFlowMan(bridge string) *FlowMan {
 		s.errorBridgeCache.Add(bridge)
 		return nil
 	}
-	theAgentServer.flowMans[bridge] = flowman
+	if s.warmStartAt != nil {
+		flowman.warm = &flowManWarm{start: *s.warmStartAt}
+	}
+	s.flowMans[bridge] = flowman
 	s.wg.Add(1)
 	go flowman.Start(s.ctx)
 	return flowman
@@ -75,30 +90,78 @@ func (s *AgentServer) HostConfig(hostConfig *utils.HostConfig) *AgentServer {
 }
 
 func (s *AgentServer) HostId(hostId string) *AgentServer {
+	s.hostIdLock.Lock()
+	defer s.hostIdLock.Unlock()
 	s.hostId = hostId
 	return s
 }
 
+func (s *AgentServer) GetHostId() string {
+	s.hostIdLock.RLock()
+	defer s.hostIdLock.RUnlock()
+	return s.hostId
+}
+
+// startWarm holds off deletes of flowmans till endWarmStart is called, or
+// timeout passes
+func (s *AgentServer) startWarm(ctx context.Context, timeout time.Duration) {
+	now := time.Now()
+	s.flowMansLock.Lock()
+	s.warmStartAt = &now
+	s.flowMansLock.Unlock()
+	log.Infof("warm start: flows not deleted till guests are loaded, or in %s", timeout)
+	time.AfterFunc(timeout, func() {
+		s.endWarmStart(ctx, "timeout")
+	})
+}
+
+// endWarmStart lets deletes of flowmans through
+func (s *AgentServer) endWarmStart(ctx context.Context, reason string) {
+	s.flowMansLock.Lock()
+	if s.warmStartAt == nil {
+		s.flowMansLock.Unlock()
+		return
+	}
+	start := *s.warmStartAt
+	s.warmStartAt = nil
+	flowMans := make([]*FlowMan, 0, len(s.flowMans))
+	for _, fm := range s.flowMans {
+		flowMans = append(flowMans, fm)
+	}
+	s.flowMansLock.Unlock()
+	log.Infof("warm start: ended in %s: %s", time.Since(start), reason)
+	for _, fm := range flowMans {
+		fm.endWarmStart(ctx)
+	}
+}
+
 func (s *AgentServer) Start(ctx context.Context) error {
 	ctx = context.WithValue(ctx, "wg", s.wg)
 	s.ctx, s.ctxCancel = context.WithCancel(ctx)
 
 	defer s.wg.Wait()
 
+	if s.hostConfig.SdnEnableGuestMan && s.hostConfig.WarmStartTimeout > 0 {
+		s.startWarm(s.ctx, s.hostConfig.WarmStartTimeout)
+	}
+
 	if s.hostConfig.SdnEnableGuestMan {
 		watcher, err := newServersWatcher()
 		if err != nil {
 			panic("creating servers watcher failed: " + err.Error())
 		}
 		watcher.agent = s
+		s.watcher = watcher
 		ifaceJanitor := newIfaceJanitor()
 
 		vSwitchService := newVSwitchService(s)
 		openflowService := newOpenflowService(s)
+		guestManService := newGuestManService(s)
 		forwardService := watcher.newForwardService()
 		rpcServer := grpc.NewServer()
 		pb.RegisterVSwitchServer(rpcServer, vSwitchService)
 		pb.RegisterOpenflowServer(rpcServer, openflowService)
+		pb.RegisterGuestManServer(rpcServer, guestManService)
 		fwdpb.RegisterForwarderServer(rpcServer, forwardService)
 		reflection.Register(rpcServer)
 		s.rpcServer = rpcServer
@@ -154,6 +217,7 @@ func init() {
 
 		flowMans:     map[string]*FlowMan{},
 		flowMansLock: &sync.RWMutex{},
+		hostIdLock:   &sync.RWMutex{},
 
 		errorBridgeCache: cache.NewTTLStore(func(key interface{}) (string, error) {
 			return key.(string), nil
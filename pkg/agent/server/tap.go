@@ -115,7 +115,7 @@ func (man *tapMan) refresh(ctx context.Context) {
 }
 
 func (man *tapMan) run(ctx context.Context) {
-	if len(man.agent.hostId) == 0 {
+	if len(man.agent.GetHostId()) == 0 {
 		// host id is empty
 		return
 	}
@@ -146,7 +146,7 @@ func (man *tapMan) fetchTapConfig(ctx context.Context) (jsonutils.JSONObject, er
 	}
 	log.Debugf("tap config from api")
 	s := auth.GetAdminSession(ctx, hc.Region)
-	cfgJson, err := compute_modules.Hosts.GetSpecific(s, man.agent.hostId, "tap-config", nil)
+	cfgJson, err := compute_modules.Hosts.GetSpecific(s, man.agent.GetHostId(), "tap-config", nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "Hosts.GetSpecific tap-config")
 	}
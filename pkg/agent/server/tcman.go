@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"sync"
 	"time"
 
@@ -54,6 +55,7 @@ const (
 	TcManCmdAdd = iota
 	TcManCmdDel
 	TcManCmdSync
+	TcManCmdStats
 )
 
 type TcManCmd struct {
@@ -62,6 +64,34 @@ type TcManCmd struct {
 	section *TcManSection
 	// if the command is executed synchronizedly
 	sync bool
+	// receives result of TcManCmdStats, nil if who is unknown
+	statsChan chan []*TcManNicStats
+}
+
+// TcManStats is statistics of a qdisc or class on device Ifname, or of a
+// meter of bridge Ifname
+type TcManStats struct {
+	Ifname string
+	*tc.STcStats
+}
+
+// TcManNicStats is statistics of objects limiting bandwidth of a guest
+// nic: tbf on the tap and its ifb device, or policing and meter of ovs, and
+// htb class on host interfaces
+type TcManNicStats struct {
+	Ifname string
+	MAC    string
+	Stats  []*TcManStats
+}
+
+// iRateLimiter limits bandwidth of guest nics
+type iRateLimiter interface {
+	// check applies limits of the guest nic
+	check(ctx context.Context, tcdata *utils.TcData) error
+	// clean removes objects created by the limiter for the guest nic
+	clean(ctx context.Context, tcdata *utils.TcData) error
+	// stats returns statistics of objects limiting the guest nic
+	stats(ctx context.Context, tcdata *utils.TcData) []*TcManStats
 }
 
 // TODO
@@ -72,15 +102,46 @@ type TcMan struct {
 	book      map[string]*TcManSection
 	idleTimer *time.Ticker
 	cmdChan   chan *TcManCmd
-	tcCli     *tc.TcCli
+	tcBackend tc.ITcBackend
+
+	rateLimiter iRateLimiter
+	// limiters not in use, whose objects are torn down the first time a
+	// guest nic is checked, in case the backend was switched
+	staleLimiters []iRateLimiter
+	// ifnames of guest nics with stale objects torn down
+	staleCleaned map[string]bool
+	// txQueues returns number of tx queues of guest taps
+	txQueues func(ifname string) int
+	// hostDirty is set when guest nics are checked or removed.  Host
+	// trees, with classes of guest nics, are checked once commands queued
+	// are done
+	hostDirty bool
+
+	// checked are results of the last check of guest nics, keyed by
+	// ifname.  They are read by others with checkedLock held
+	checked     map[string]error
+	checkedLock sync.Mutex
 }
 
-func NewTcMan() *TcMan {
-	return &TcMan{
-		book:    map[string]*TcManSection{},
-		tcCli:   tc.NewTcCli().Details(true).Force(true),
-		cmdChan: make(chan *TcManCmd, 1024),
+func NewTcMan(backend string, rateLimitBackend string) *TcMan {
+	tm := &TcMan{
+		book:         map[string]*TcManSection{},
+		tcBackend:    tc.NewTcBackend(backend),
+		cmdChan:      make(chan *TcManCmd, 1024),
+		staleCleaned: map[string]bool{},
+		txQueues:     utils.LinkTxQueues,
+		checked:      map[string]error{},
 	}
+	ifb := &ifbRateLimiter{tm: tm}
+	ovs := newOvsRateLimiter(tm, rateLimitBackend != utils.RateLimitBackendOvs)
+	if rateLimitBackend == utils.RateLimitBackendOvs {
+		tm.rateLimiter = ovs
+		tm.staleLimiters = []iRateLimiter{ifb}
+	} else {
+		tm.rateLimiter = ifb
+		tm.staleLimiters = []iRateLimiter{ovs}
+	}
+	return tm
 }
 
 func (tm *TcMan) Start(ctx context.Context) {
@@ -93,6 +154,9 @@ func (tm *TcMan) Start(ctx context.Context) {
 		select {
 		case cmd := <-tm.cmdChan:
 			tm.doCmd(ctx, cmd)
+			if tm.hostDirty && len(tm.cmdChan) == 0 {
+				tm.doCheckHostSection(ctx, tm.book[tcManHostLocalWho])
+			}
 		case <-tm.idleTimer.C:
 			tm.doIdleCheck(ctx)
 		case <-ctx.Done():
@@ -117,11 +181,11 @@ func (tm *TcMan) doIdleCheck(ctx context.Context) {
 }
 
 func (tm *TcMan) doCheckSection(ctx context.Context, who string, section *TcManSection) {
-	if who == tcManHostLocalWho {
-		tm.doCheckHostSection(ctx, section)
-	} else {
+	if who != tcManHostLocalWho {
 		tm.doCheckGuestSection(ctx, section)
 	}
+	// guest nics have their classes under host root
+	tm.hostDirty = true
 }
 
 func (tm *TcMan) doCleanSection(ctx context.Context, who string, section *TcManSection) {
@@ -132,12 +196,16 @@ func (tm *TcMan) doCleanSection(ctx context.Context, who string, section *TcManS
 
 func (tm *TcMan) doCheckGuestSection(ctx context.Context, section *TcManSection) {
 	for _, tcdata := range section.pages {
-		err := tm.doCheckGuestIfbTcData(ctx, tcdata)
-		if err != nil {
-			log.Errorf("tcman: check guest ifb tc data failed: %s", err)
-			continue
+		if !tm.staleCleaned[tcdata.Ifname] {
+			for _, limiter := range tm.staleLimiters {
+				if err := limiter.clean(ctx, tcdata); err != nil {
+					log.Errorf("tcman: clean stale limits of %s failed: %s", tcdata.Ifname, err)
+				}
+			}
+			tm.staleCleaned[tcdata.Ifname] = true
 		}
-		err = tm.doCheckGuestTcData(ctx, tcdata)
+		err := tm.rateLimiter.check(ctx, tcdata)
+		tm.setChecked(tcdata.Ifname, err)
 		if err != nil {
 			log.Errorf("tcman: check guest tc data failed: %s", err)
 			continue
@@ -145,16 +213,66 @@ func (tm *TcMan) doCheckGuestSection(ctx context.Context, section *TcManSection)
 	}
 }
 
+func (tm *TcMan) setChecked(ifname string, err error) {
+	tm.checkedLock.Lock()
+	defer tm.checkedLock.Unlock()
+	tm.checked[ifname] = err
+}
+
+// IfaceChecked returns whether guest nic ifname was checked, and error of
+// the last check
+func (tm *TcMan) IfaceChecked(ifname string) (bool, error) {
+	tm.checkedLock.Lock()
+	defer tm.checkedLock.Unlock()
+	err, ok := tm.checked[ifname]
+	return ok, err
+}
+
 func (tm *TcMan) doCleanGuestSection(ctx context.Context, section *TcManSection) {
+	tm.checkedLock.Lock()
 	for _, tcdata := range section.pages {
-		err := tm.doCleanGuestIfbTcData(ctx, tcdata)
+		delete(tm.checked, tcdata.Ifname)
+	}
+	tm.checkedLock.Unlock()
+	for _, tcdata := range section.pages {
+		delete(tm.staleCleaned, tcdata.Ifname)
+		err := tm.rateLimiter.clean(ctx, tcdata)
 		if err != nil {
-			log.Errorf("tcman: clean guest ifb tc data failed: %s", err)
+			log.Errorf("tcman: clean guest tc data failed: %s", err)
 			continue
 		}
 	}
 }
 
+// ifbRateLimiter shapes packets from the guest with tbf on the ifb device
+// they are redirected to, and packets towards the guest with tbf on the tap
+type ifbRateLimiter struct {
+	tm *TcMan
+}
+
+func (l *ifbRateLimiter) check(ctx context.Context, tcdata *utils.TcData) error {
+	err := l.tm.doCheckGuestIfbTcData(ctx, tcdata)
+	if err != nil {
+		return errors.Wrap(err, "check guest ifb tc data")
+	}
+	return l.tm.doCheckGuestTcData(ctx, tcdata, (*utils.TcData).GuestQdiscTree)
+}
+
+func (l *ifbRateLimiter) clean(ctx context.Context, tcdata *utils.TcData) error {
+	return l.tm.doCleanGuestIfbTcData(ctx, tcdata)
+}
+
+func (l *ifbRateLimiter) stats(ctx context.Context, tcdata *utils.TcData) []*TcManStats {
+	isShaper := func(st *tc.STcStats) bool {
+		return st.Kind == "tbf" || st.Kind == "htb"
+	}
+	r := l.tm.devStats(ctx, tcdata.Ifname, isShaper)
+	if ifbIfname := tcdata.IfbIfname(); l.tm.isIfnameExists(ifbIfname) {
+		r = append(r, l.tm.devStats(ctx, ifbIfname, isShaper)...)
+	}
+	return r
+}
+
 func (tm *TcMan) removeIfbIfname(ctx context.Context, ifname string) error {
 	if !tm.isIfnameExists(ifname) {
 		return nil
@@ -196,90 +314,116 @@ func (tm *TcMan) doCheckGuestIfbTcData(ctx context.Context, tcdata *utils.TcData
 		return errors.Wrapf(err, "ensure ifb ifname %s", tcdata.IfbIfname())
 	}
 
-	qt, err := tm.tcCli.QdiscShow(ctx, tcdata.IfbIfname())
+	qt, err := tm.tcBackend.QdiscShow(ctx, tcdata.IfbIfname())
 	if err != nil {
 		log.Errorf("tcman: qdisc show %s failed: %s", tcdata.IfbIfname(), err)
 		return errors.Wrapf(err, "qdisc show %s", tcdata.IfbIfname())
 	}
 	expectTree := tcdata.GuestIfbQdiscTree()
-	cmds := expectTree.Delta(qt, tcdata.IfbIfname())
-	if len(cmds) > 0 {
-		output, stderr, err := tm.tcCli.Batch(ctx, cmds)
+	ops := expectTree.DeltaOps(qt)
+	if len(ops) > 0 {
+		cmds := tc.TcOpsLines(ops, tcdata.IfbIfname())
+		err := tm.tcBackend.Apply(ctx, tcdata.IfbIfname(), ops)
 		if err != nil {
-			log.Errorf("tcman: batch failed: %s cmds: %s\n%s\nstderr:\n%s", err, cmds, output, stderr)
-			return errors.Wrapf(err, "batch failed: %s cmds: %s\n%s\nstderr:\n%s", err, cmds, output, stderr)
+			log.Errorf("tcman: apply failed: %s cmds: %s", err, cmds)
+			return errors.Wrapf(err, "apply failed: cmds: %s", cmds)
 		}
 	}
 	return nil
 }
 
-func (tm *TcMan) doCheckGuestTcData(ctx context.Context, tcdata *utils.TcData) error {
-	qt, err := tm.tcCli.QdiscShow(ctx, tcdata.Ifname)
+// doCheckGuestTcData applies tree built by expectTree on the tap.  Clsact
+// found there is kept for bpf programs attached by others, and queues of
+// multiqueue taps are shaped each with QueueShaping
+func (tm *TcMan) doCheckGuestTcData(ctx context.Context, tcdata *utils.TcData, expectTree func(*utils.TcData) *tc.QdiscTree) error {
+	qt, err := tm.tcBackend.QdiscShow(ctx, tcdata.Ifname)
 	if err != nil {
 		// if device does not exist, expect super man to tell us
 		log.Errorf("tcman: qdisc show %s failed: %s", tcdata.Ifname, err)
 		return errors.Wrapf(err, "qdisc show %s", tcdata.Ifname)
 	}
-	// if root := qt.Root(); root.BaseQdisc().Kind == "mq" {
-	//	log.Infof("skip %s: it uses mq", ifname)
-	//	return
-	// }
-	expectTree := tcdata.GuestQdiscTree()
-
-	cmds := expectTree.Delta(qt, tcdata.Ifname)
-	if len(cmds) > 0 {
-		output, stderr, err := tm.tcCli.Batch(ctx, cmds)
+	if qt.HasQdisc("clsact") {
+		tcdata = tcdata.WithClsact()
+	}
+	if n := tm.txQueues(tcdata.Ifname); n > 1 {
+		tcdata = tcdata.WithTxQueues(n)
+	}
+	ops := expectTree(tcdata).DeltaOps(qt)
+	if len(ops) > 0 {
+		cmds := tc.TcOpsLines(ops, tcdata.Ifname)
+		err := tm.tcBackend.Apply(ctx, tcdata.Ifname, ops)
 		if err != nil {
-			log.Errorf("tcman: batch failed: %s cmds: %s\n%s\nstderr:\n%s", err, cmds, output, stderr)
-			return errors.Wrapf(err, "batch failed: %s cmds: %s\n%s\nstderr:\n%s", err, cmds, output, stderr)
+			log.Errorf("tcman: apply failed: %s cmds: %s", err, cmds)
+			return errors.Wrapf(err, "apply failed: cmds: %s", cmds)
 		}
-		log.Debugf("tcman: %s: updated qdisc\n%s\n===\n%s", tcdata.Ifname, cmds, output)
+		log.Debugf("tcman: %s: updated qdisc\n%s", tcdata.Ifname, cmds)
 	}
 	return nil
 }
 
 func (tm *TcMan) doCheckHostSection(ctx context.Context, section *TcManSection) {
+	tm.hostDirty = false
+	if section == nil {
+		return
+	}
 	for _, page := range section.pages {
 		tm.doCheckHostTcData(ctx, page)
 	}
 }
 
+// doCheckHostTcData applies tree of the host uplink with classes of guest
+// nics when UplinkShaping is set.  Otherwise trees of tcman found there
+// are deleted, and so are those on the bridge, where tcman used to put
+// them
 func (tm *TcMan) doCheckHostTcData(ctx context.Context, tcdata *utils.TcData) {
-	qt, err := tm.tcCli.QdiscShow(ctx, tcdata.Ifname)
-	if err != nil {
-		log.Errorf("tcman: qdisc show %s failed: %s", tcdata.Ifname, err)
-		return
+	ifnames := []string{tcdata.Ifname}
+	if tcdata.Bridge != "" && tcdata.Bridge != tcdata.Ifname {
+		ifnames = append(ifnames, tcdata.Bridge)
 	}
-	expectTree := tcdata.HostRootQdiscTree()
-	rootQdisc := expectTree.RootQdisc()
-	rootClass := expectTree.RootClass()
-	for who, section := range tm.book {
-		if who == tcManHostLocalWho {
+	for _, ifname := range ifnames {
+		qt, err := tm.tcBackend.QdiscShow(ctx, ifname)
+		if err != nil {
+			log.Errorf("tcman: qdisc show %s failed: %s", ifname, err)
 			continue
 		}
-		for _, guestnicTcData := range section.pages {
-			if guestnicTcData.Bridge != tcdata.Bridge {
-				continue
-			}
-			guestNicTree := guestnicTcData.HostGuestQdiscTree(rootClass, rootQdisc)
-			expectTree.Merge(guestNicTree)
+		var ops []tc.TcOp
+		if tcdata.UplinkShaping && ifname == tcdata.Ifname {
+			ops = tcdata.HostUplinkQdiscTree(tm.bridgeGuestNics(tcdata.Bridge)).DeltaOps(qt)
+		} else if utils.IsHostUplinkTree(qt) {
+			ops = []tc.TcOp{{Action: tc.TcOpDelete, Obj: qt.RootQdisc()}}
 		}
-	}
-
-	cmds := expectTree.Delta(qt, tcdata.Ifname)
-	if len(cmds) > 0 {
-		output, stderr, err := tm.tcCli.Batch(ctx, cmds)
+		if len(ops) == 0 {
+			continue
+		}
+		cmds := tc.TcOpsLines(ops, ifname)
+		err = tm.tcBackend.Apply(ctx, ifname, ops)
 		if err != nil {
-			log.Errorf("tcman: batch failed: %s cmds: %s\n%s\nstderr:\n%s", err, cmds, output, stderr)
+			log.Errorf("tcman: apply failed: %s", err)
 			for _, cmd := range cmds {
 				log.Debugf("tcman: %s", cmd)
 			}
-			return
+			continue
 		}
-		log.Debugf("tcman: %s: updated qdisc\n%s", tcdata.Ifname, output)
+		log.Debugf("tcman: %s: updated qdisc\n%s", ifname, cmds)
 	}
 }
 
+// bridgeGuestNics returns tc data of guest nics on bridge
+func (tm *TcMan) bridgeGuestNics(bridge string) []*utils.TcData {
+	r := []*utils.TcData{}
+	for who, section := range tm.book {
+		if who == tcManHostLocalWho {
+			continue
+		}
+		for _, tcdata := range section.pages {
+			if tcdata.Bridge == bridge {
+				r = append(r, tcdata)
+			}
+		}
+	}
+	return r
+}
+
 func (tm *TcMan) doCmd(ctx context.Context, cmd *TcManCmd) {
 	switch cmd.typ {
 	case TcManCmdAdd:
@@ -298,12 +442,66 @@ func (tm *TcMan) doCmd(ctx context.Context, cmd *TcManCmd) {
 		if ok {
 			tm.doCleanSection(ctx, cmd.who, section)
 			delete(tm.book, cmd.who)
+			tm.hostDirty = true
 		}
 	case TcManCmdSync:
 		tm.doIdleCheck(ctx)
+	case TcManCmdStats:
+		cmd.statsChan <- tm.doGuestStats(ctx, cmd.who)
 	}
 }
 
+func (tm *TcMan) devStats(ctx context.Context, ifname string, match func(st *tc.STcStats) bool) []*TcManStats {
+	stats, err := tm.tcBackend.Stats(ctx, ifname)
+	if err != nil {
+		log.Errorf("tcman: stats of %s failed: %s", ifname, err)
+		return nil
+	}
+	r := []*TcManStats{}
+	for _, st := range stats {
+		if match(st) {
+			r = append(r, &TcManStats{Ifname: ifname, STcStats: st})
+		}
+	}
+	return r
+}
+
+func (tm *TcMan) doGuestStats(ctx context.Context, who string) []*TcManNicStats {
+	section, ok := tm.book[who]
+	if !ok || who == tcManHostLocalWho {
+		return nil
+	}
+	ifnames := make([]string, 0, len(section.pages))
+	for ifname := range section.pages {
+		ifnames = append(ifnames, ifname)
+	}
+	sort.Strings(ifnames)
+
+	r := make([]*TcManNicStats, 0, len(ifnames))
+	for _, ifname := range ifnames {
+		tcdata := section.pages[ifname]
+		nicStats := &TcManNicStats{
+			Ifname: tcdata.Ifname,
+			MAC:    tcdata.MAC,
+			Stats:  tm.rateLimiter.stats(ctx, tcdata),
+		}
+		if classId, ok := tcdata.HostGuestClassId(); ok {
+			if hostSection := tm.book[tcManHostLocalWho]; hostSection != nil {
+				for _, hostTcData := range hostSection.pages {
+					if !hostTcData.UplinkShaping || hostTcData.Bridge != tcdata.Bridge {
+						continue
+					}
+					nicStats.Stats = append(nicStats.Stats, tm.devStats(ctx, hostTcData.Ifname, func(st *tc.STcStats) bool {
+						return st.Type == tc.TcStatsClass && st.Id == classId
+					})...)
+				}
+			}
+		}
+		r = append(r, nicStats)
+	}
+	return r
+}
+
 func (tm *TcMan) sendCmd(ctx context.Context, cmd *TcManCmd) {
 	select {
 	case tm.cmdChan <- cmd:
@@ -337,6 +535,25 @@ func (tm *TcMan) ClearIfaces(ctx context.Context, who string) {
 	tm.sendCmd(ctx, cmd)
 }
 
+// GuestStats returns statistics of tc objects of nics of guest who
+func (tm *TcMan) GuestStats(ctx context.Context, who string) ([]*TcManNicStats, error) {
+	cmd := &TcManCmd{
+		typ:       TcManCmdStats,
+		who:       who,
+		statsChan: make(chan []*TcManNicStats, 1),
+	}
+	tm.sendCmd(ctx, cmd)
+	select {
+	case stats := <-cmd.statsChan:
+		if stats == nil {
+			return nil, errors.Wrapf(errors.ErrNotFound, "guest %s", who)
+		}
+		return stats, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (tm *TcMan) SyncAll(ctx context.Context) {
 	cmd := &TcManCmd{
 		typ: TcManCmdSync,
@@ -0,0 +1,346 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+// ovsRateLimiter polices packets from the guest with ingress_policing of
+// its ovs interface, and meters packets towards the guest with openflow
+// meters in utils.GuestMeterTable.  Netem and packet rate limits are left
+// to tc on the tap
+type ovsRateLimiter struct {
+	tm *TcMan
+	// execOvsctl runs ovs-vsctl and ovs-ofctl commands
+	execOvsctl func(ctx context.Context, args []string) ([]byte, error)
+	// stale is set when another backend is in use.  Fallback flows are
+	// then deleted as guest nics are cleaned
+	stale bool
+
+	// meters are meters added for guest nics, keyed by ifname.  Meter id
+	// follows the port number, which changes when the tap is added again
+	meters map[string]ovsGuestMeter
+	// bridges whose fallback flow was deleted by the stale limiter
+	fallbackCleaned map[string]bool
+}
+
+// ovsStatsMeter is TcManStats.Type of meters
+const ovsStatsMeter = "meter"
+
+type ovsGuestMeter struct {
+	bridge string
+	id     uint32
+}
+
+func newOvsRateLimiter(tm *TcMan, stale bool) *ovsRateLimiter {
+	return &ovsRateLimiter{
+		tm:              tm,
+		execOvsctl:      utils.ExecOvsctl,
+		stale:           stale,
+		meters:          map[string]ovsGuestMeter{},
+		fallbackCleaned: map[string]bool{},
+	}
+}
+
+func (l *ovsRateLimiter) check(ctx context.Context, tcdata *utils.TcData) error {
+	err := l.tm.doCheckGuestTcData(ctx, tcdata, (*utils.TcData).GuestOvsQdiscTree)
+	if err != nil {
+		return err
+	}
+	rate, burst := tcdata.OvsIngressPolicing()
+	if err := l.ensurePolicing(ctx, tcdata.Ifname, rate, burst); err != nil {
+		return errors.Wrapf(err, "ensure ingress policing of %s", tcdata.Ifname)
+	}
+	if !tcdata.HasGuestMeter() {
+		return l.cleanMeter(ctx, tcdata)
+	}
+	if err := l.ensureFallbackFlow(ctx, tcdata.Bridge); err != nil {
+		return errors.Wrapf(err, "ensure meter fallback flow of %s", tcdata.Bridge)
+	}
+	if err := l.ensureMeter(ctx, tcdata); err != nil {
+		return errors.Wrapf(err, "ensure meter of %s", tcdata.Ifname)
+	}
+	if err := l.ensureMeterFlow(ctx, tcdata); err != nil {
+		return errors.Wrapf(err, "ensure meter flow of %s", tcdata.Ifname)
+	}
+	if err := l.ensureGuardFlow(ctx, tcdata); err != nil {
+		return errors.Wrapf(err, "ensure meter guard flow of %s", tcdata.Ifname)
+	}
+	// the meter flow no longer refers to the meter of the old port
+	meter := ovsGuestMeter{bridge: tcdata.Bridge, id: tcdata.GuestMeterId()}
+	if old, ok := l.meters[tcdata.Ifname]; ok && old != meter {
+		if err := l.deleteMeter(ctx, tcdata.Ifname, old); err != nil {
+			return errors.Wrapf(err, "delete old meter of %s", tcdata.Ifname)
+		}
+	}
+	l.meters[tcdata.Ifname] = meter
+	return nil
+}
+
+func (l *ovsRateLimiter) clean(ctx context.Context, tcdata *utils.TcData) error {
+	if err := l.ensurePolicing(ctx, tcdata.Ifname, 0, 0); err != nil {
+		return errors.Wrapf(err, "reset ingress policing of %s", tcdata.Ifname)
+	}
+	if err := l.cleanMeter(ctx, tcdata); err != nil {
+		return err
+	}
+	if l.stale && tcdata.Bridge != "" && !l.fallbackCleaned[tcdata.Bridge] {
+		_, err := l.execOvsctl(ctx, []string{
+			"ovs-ofctl", "-O", "OpenFlow13", "del-flows", "--strict", tcdata.Bridge,
+			fmt.Sprintf("table=%d,priority=0", utils.GuestMeterTable),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "delete meter fallback flow of %s", tcdata.Bridge)
+		}
+		l.fallbackCleaned[tcdata.Bridge] = true
+	}
+	return nil
+}
+
+// stats returns statistics of the ingress qdisc of the tap, whose drops
+// are packets from the guest over ingress_policing_rate, and of the meter
+// of the guest nic
+func (l *ovsRateLimiter) stats(ctx context.Context, tcdata *utils.TcData) []*TcManStats {
+	r := l.tm.devStats(ctx, tcdata.Ifname, func(st *tc.STcStats) bool {
+		return st.Type == tc.TcStatsQdisc && (st.Kind == "ingress" || st.Kind == "clsact")
+	})
+	if !tcdata.HasGuestMeter() {
+		return r
+	}
+	output, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "meter-stats", tcdata.Bridge,
+		fmt.Sprintf("meter=%d", tcdata.GuestMeterId()),
+	})
+	if err != nil {
+		log.Errorf("tcman: meter stats of %s failed: %s", tcdata.Ifname, err)
+		return r
+	}
+	st, err := parseOvsMeterStats(output)
+	if err != nil {
+		log.Errorf("tcman: meter stats of %s: %s", tcdata.Ifname, err)
+		return r
+	}
+	return append(r, &TcManStats{Ifname: tcdata.Bridge, STcStats: st})
+}
+
+// parseOvsMeterStats parses output of "ovs-ofctl meter-stats" of a meter
+// with a drop band, e.g.
+//
+//	OFPST_METER reply (OF1.3) (xid=0x2):
+//	meter:26 flow_count:1 packet_in_count:120 byte_in_count:9000 duration:5.123s bands:
+//	0: packet_count:20 byte_count:1500
+func parseOvsMeterStats(output []byte) (*tc.STcStats, error) {
+	var st *tc.STcStats
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "meter:"):
+			st = &tc.STcStats{
+				Type: ovsStatsMeter,
+				Kind: "drop",
+				Id:   strings.TrimPrefix(fields[0], "meter:"),
+			}
+			for _, f := range fields[1:] {
+				if v, ok := ovsStatsField(f, "packet_in_count:"); ok {
+					st.Packets = v
+				} else if v, ok := ovsStatsField(f, "byte_in_count:"); ok {
+					st.Bytes = v
+				}
+			}
+		case fields[0] == "0:" && st != nil:
+			for _, f := range fields[1:] {
+				if v, ok := ovsStatsField(f, "packet_count:"); ok {
+					st.Drops = v
+				}
+			}
+		}
+	}
+	if st == nil {
+		return nil, errors.Wrap(errors.ErrNotFound, "meter")
+	}
+	return st, nil
+}
+
+func ovsStatsField(f, prefix string) (uint64, bool) {
+	if !strings.HasPrefix(f, prefix) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(f, prefix), 10, 64)
+	return v, err == nil
+}
+
+func (l *ovsRateLimiter) ensurePolicing(ctx context.Context, ifname string, rate, burst uint64) error {
+	output, err := l.execOvsctl(ctx, []string{
+		"ovs-vsctl", "get", "interface", ifname,
+		"ingress_policing_rate", "ingress_policing_burst",
+	})
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 2 {
+		curRate, _ := strconv.ParseUint(fields[0], 10, 64)
+		curBurst, _ := strconv.ParseUint(fields[1], 10, 64)
+		if curRate == rate && (rate == 0 || curBurst == burst) {
+			return nil
+		}
+	}
+	if rate == 0 {
+		burst = 0
+	}
+	_, err = l.execOvsctl(ctx, []string{
+		"ovs-vsctl", "set", "interface", ifname,
+		fmt.Sprintf("ingress_policing_rate=%d", rate),
+		fmt.Sprintf("ingress_policing_burst=%d", burst),
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("tcman: %s: set ingress policing rate %d burst %d", ifname, rate, burst)
+	return nil
+}
+
+func (l *ovsRateLimiter) ensureFallbackFlow(ctx context.Context, bridge string) error {
+	output, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "dump-flows", "--strict", bridge,
+		fmt.Sprintf("table=%d,priority=0", utils.GuestMeterTable),
+	})
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(output), "actions=") {
+		return nil
+	}
+	_, err = l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "add-flow", bridge, utils.GuestMeterFallbackFlow(),
+	})
+	return err
+}
+
+func (l *ovsRateLimiter) ensureMeter(ctx context.Context, tcdata *utils.TcData) error {
+	meterId := tcdata.GuestMeterId()
+	output, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "dump-meters", tcdata.Bridge,
+		fmt.Sprintf("meter=%d", meterId),
+	})
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(output), tcdata.GuestMeterBand()) {
+		return nil
+	}
+	cmd := "add-meter"
+	if strings.Contains(string(output), fmt.Sprintf("meter=%d ", meterId)) {
+		cmd = "mod-meter"
+	}
+	_, err = l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", cmd, tcdata.Bridge, tcdata.GuestMeterSpec(),
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("tcman: %s: %s %s", tcdata.Ifname, cmd, tcdata.GuestMeterSpec())
+	return nil
+}
+
+func (l *ovsRateLimiter) ensureMeterFlow(ctx context.Context, tcdata *utils.TcData) error {
+	output, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "dump-flows", tcdata.Bridge, tcdata.GuestMeterMatch(),
+	})
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(output), fmt.Sprintf("meter:%d,", tcdata.GuestMeterId())) {
+		return nil
+	}
+	_, err = l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "add-flow", tcdata.Bridge, tcdata.GuestMeterFlow(),
+	})
+	return err
+}
+
+func (l *ovsRateLimiter) ensureGuardFlow(ctx context.Context, tcdata *utils.TcData) error {
+	output, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "dump-flows", "--strict", tcdata.Bridge, tcdata.GuestMeterGuardMatch(),
+	})
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(output), "actions=") {
+		return nil
+	}
+	_, err = l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "add-flow", tcdata.Bridge, tcdata.GuestMeterGuardFlow(),
+	})
+	return err
+}
+
+func (l *ovsRateLimiter) cleanMeter(ctx context.Context, tcdata *utils.TcData) error {
+	if tcdata.Bridge == "" || tcdata.MAC == "" {
+		return nil
+	}
+	_, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "del-flows", "--strict", tcdata.Bridge, tcdata.GuestMeterGuardMatch(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "delete meter guard flow")
+	}
+	_, err = l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "del-flows", tcdata.Bridge, tcdata.GuestMeterMatch(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "delete meter flow")
+	}
+	meter, ok := l.meters[tcdata.Ifname]
+	if !ok {
+		if tcdata.PortNo <= 0 {
+			return nil
+		}
+		meter = ovsGuestMeter{bridge: tcdata.Bridge, id: tcdata.GuestMeterId()}
+	}
+	if err := l.deleteMeter(ctx, tcdata.Ifname, meter); err != nil {
+		return errors.Wrap(err, "delete meter")
+	}
+	delete(l.meters, tcdata.Ifname)
+	return nil
+}
+
+// deleteMeter deletes meter of guest nic ifname, unless the port number
+// was taken by another guest nic, whose meter it is now
+func (l *ovsRateLimiter) deleteMeter(ctx context.Context, ifname string, meter ovsGuestMeter) error {
+	for other, m := range l.meters {
+		if other != ifname && m == meter {
+			return nil
+		}
+	}
+	_, err := l.execOvsctl(ctx, []string{
+		"ovs-ofctl", "-O", "OpenFlow13", "del-meter", meter.bridge,
+		fmt.Sprintf("meter=%d", meter.id),
+	})
+	return err
+}
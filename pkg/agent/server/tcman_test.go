@@ -0,0 +1,383 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+// fakeTcBackend returns trees and stats of devices from maps, and records
+// ops applied
+type fakeTcBackend struct {
+	trees map[string]*tc.QdiscTree
+	stats map[string][]*tc.STcStats
+	ops   map[string][]tc.TcOp
+}
+
+func (b *fakeTcBackend) QdiscShow(ctx context.Context, ifname string) (*tc.QdiscTree, error) {
+	if qt, ok := b.trees[ifname]; ok {
+		return qt, nil
+	}
+	return tc.NewQdiscTree(nil, nil, nil), nil
+}
+
+func (b *fakeTcBackend) Apply(ctx context.Context, ifname string, ops []tc.TcOp) error {
+	if b.ops == nil {
+		b.ops = map[string][]tc.TcOp{}
+	}
+	b.ops[ifname] = append(b.ops[ifname], ops...)
+	return nil
+}
+
+func (b *fakeTcBackend) Stats(ctx context.Context, ifname string) ([]*tc.STcStats, error) {
+	return b.stats[ifname], nil
+}
+
+func TestTcManGuestStats(t *testing.T) {
+	tm := NewTcMan(tc.TcBackendCli, utils.RateLimitBackendIfb)
+	tm.tcBackend = &fakeTcBackend{
+		stats: map[string][]*tc.STcStats{
+			"sdnt-vnet1": {
+				{Type: tc.TcStatsQdisc, Kind: "tbf", Id: "1:", Parent: "root", Bytes: 1532, Packets: 2, Drops: 398},
+				{Type: tc.TcStatsQdisc, Kind: "ingress", Id: "ffff:", Parent: "ffff:fff1"},
+			},
+			"sdnt-eth0": {
+				{Type: tc.TcStatsQdisc, Kind: "htb", Id: "1:", Parent: "root"},
+				{Type: tc.TcStatsClass, Kind: "htb", Id: "1:1", Parent: "root"},
+				{Type: tc.TcStatsClass, Kind: "htb", Id: "1:1a", Parent: "1:1", Overlimits: 80},
+				{Type: tc.TcStatsClass, Kind: "htb", Id: "1:1b", Parent: "1:1"},
+			},
+		},
+	}
+	guest := NewTcManSection()
+	guest.pages["sdnt-vnet1"] = &utils.TcData{
+		Ifname:     "sdnt-vnet1",
+		MAC:        "00:22:33:44:55:66",
+		Bridge:     "br0",
+		PortNo:     0x1a,
+		EgressMbps: 100,
+	}
+	host := NewTcManSection()
+	host.pages["sdnt-eth0"] = &utils.TcData{Ifname: "sdnt-eth0", Bridge: "br0", UplinkShaping: true}
+	tm.book["g1"] = guest
+	tm.book[tcManHostLocalWho] = host
+
+	ctx := context.Background()
+	if stats := tm.doGuestStats(ctx, "g2"); stats != nil {
+		t.Errorf("unknown guest: want nil, got %v", stats)
+	}
+	stats := tm.doGuestStats(ctx, "g1")
+	if len(stats) != 1 {
+		t.Fatalf("want stats of 1 nic, got %d", len(stats))
+	}
+	nic := stats[0]
+	if nic.MAC != "00:22:33:44:55:66" || nic.Ifname != "sdnt-vnet1" {
+		t.Errorf("unexpected nic %s %s", nic.MAC, nic.Ifname)
+	}
+	want := []string{"sdnt-vnet1 qdisc 1:", "sdnt-eth0 class 1:1a"}
+	if len(nic.Stats) != len(want) {
+		t.Fatalf("want %d stats, got %d", len(want), len(nic.Stats))
+	}
+	for i, st := range nic.Stats {
+		if got := st.Ifname + " " + st.Type + " " + st.Id; got != want[i] {
+			t.Errorf("stats %d: want %s, got %s", i, want[i], got)
+		}
+	}
+	if nic.Stats[0].Drops != 398 || nic.Stats[1].Overlimits != 80 {
+		t.Errorf("unexpected counters %+v %+v", *nic.Stats[0].STcStats, *nic.Stats[1].STcStats)
+	}
+}
+
+func TestTcManKeepClsact(t *testing.T) {
+	current, err := tc.NewQdiscTreeFromString(
+		`qdisc tbf 1: root refcnt 2 rate 100Mbit burst 12500b lat 100ms
+qdisc clsact ffff: parent ffff:fff1`,
+		"",
+		`filter ingress protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 97 name cls_main tag 59f4a931744dcdc6 jited
+filter ingress protocol all pref 49153 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device rsdnt-vnet1) stolen`,
+	)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	backend := &fakeTcBackend{
+		trees: map[string]*tc.QdiscTree{"sdnt-vnet1": current},
+	}
+	tm := NewTcMan(tc.TcBackendCli, utils.RateLimitBackendIfb)
+	tm.tcBackend = backend
+	tcdata := &utils.TcData{
+		Ifname:      "sdnt-vnet1",
+		IngressMbps: 100,
+		EgressMbps:  100,
+	}
+	if err := tm.doCheckGuestTcData(context.Background(), tcdata, (*utils.TcData).GuestQdiscTree); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if ops := backend.ops["sdnt-vnet1"]; len(ops) > 0 {
+		t.Errorf("want clsact and program kept, got %v", tc.TcOpsLines(ops, "sdnt-vnet1"))
+	}
+}
+
+func TestOvsRateLimiterGuardFlow(t *testing.T) {
+	tm := NewTcMan(tc.TcBackendCli, utils.RateLimitBackendOvs)
+	tm.tcBackend = &fakeTcBackend{}
+	cmds := []string{}
+	l := tm.rateLimiter.(*ovsRateLimiter)
+	l.execOvsctl = func(ctx context.Context, args []string) ([]byte, error) {
+		cmds = append(cmds, strings.Join(args, " "))
+		if args[0] == "ovs-vsctl" {
+			// no ingress policing
+			return []byte("0\n0\n"), nil
+		}
+		return nil, nil
+	}
+	tcdata := &utils.TcData{
+		Ifname:      "sdnt-vnet1",
+		MAC:         "00:22:33:44:55:66",
+		Bridge:      "br0",
+		PortNo:      0x1a,
+		IngressMbps: 100,
+	}
+	// index of the first command containing each of subs, in order
+	indexes := func(subs ...string) []int {
+		r := []int{}
+		for _, sub := range subs {
+			idx := -1
+			for i, cmd := range cmds {
+				if strings.Contains(cmd, sub) {
+					idx = i
+					break
+				}
+			}
+			r = append(r, idx)
+		}
+		return r
+	}
+	ctx := context.Background()
+
+	// packets are diverted by the guard only after the meter flow is
+	// there to take them back
+	if err := l.check(ctx, tcdata); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	idx := indexes("add-meter", "add-flow br0 table=14,dl_dst=", "add-flow br0 table=0,priority=29110,")
+	if idx[0] < 0 || idx[0] > idx[1] || idx[1] > idx[2] {
+		t.Errorf("want meter, meter flow, guard flow added in order, got %q", cmds)
+	}
+
+	cmds = nil
+	if err := l.clean(ctx, tcdata); err != nil {
+		t.Fatalf("clean: %v", err)
+	}
+	idx = indexes("del-flows --strict br0 table=0,priority=29110,", "del-flows br0 table=14,dl_dst=", "del-meter")
+	if idx[0] < 0 || idx[0] > idx[1] || idx[1] > idx[2] {
+		t.Errorf("want guard flow, meter flow, meter deleted in order, got %q", cmds)
+	}
+}
+
+func TestOvsRateLimiterOldMeter(t *testing.T) {
+	tm := NewTcMan(tc.TcBackendCli, utils.RateLimitBackendOvs)
+	tm.tcBackend = &fakeTcBackend{}
+	cmds := []string{}
+	l := tm.rateLimiter.(*ovsRateLimiter)
+	l.execOvsctl = func(ctx context.Context, args []string) ([]byte, error) {
+		cmds = append(cmds, strings.Join(args, " "))
+		if args[0] == "ovs-vsctl" {
+			return []byte("0\n0\n"), nil
+		}
+		return nil, nil
+	}
+	vnet1 := &utils.TcData{
+		Ifname:      "sdnt-vnet1",
+		MAC:         "00:22:33:44:55:66",
+		Bridge:      "br0",
+		PortNo:      0x1a,
+		IngressMbps: 100,
+	}
+	ctx := context.Background()
+	if err := l.check(ctx, vnet1); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	hasCmd := func(cmd string) bool {
+		for _, c := range cmds {
+			if c == cmd {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the tap is added again with another port number
+	cmds = nil
+	vnet1.PortNo = 0x1b
+	if err := l.check(ctx, vnet1); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if !hasCmd("ovs-ofctl -O OpenFlow13 del-meter br0 meter=26") {
+		t.Errorf("want meter of the old port deleted, got %q", cmds)
+	}
+
+	// the old port number is taken by another nic before vnet1 is checked
+	vnet2 := &utils.TcData{
+		Ifname:      "sdnt-vnet2",
+		MAC:         "00:22:33:44:55:77",
+		Bridge:      "br0",
+		PortNo:      0x1b,
+		IngressMbps: 50,
+	}
+	vnet1.PortNo = 0x1c
+	if err := l.check(ctx, vnet2); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	cmds = nil
+	if err := l.check(ctx, vnet1); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if hasCmd("ovs-ofctl -O OpenFlow13 del-meter br0 meter=27") {
+		t.Errorf("want meter of the other nic kept, got %q", cmds)
+	}
+
+	// the stale limiter deletes the fallback flow once per bridge
+	tm = NewTcMan(tc.TcBackendCli, utils.RateLimitBackendIfb)
+	l = tm.staleLimiters[0].(*ovsRateLimiter)
+	l.execOvsctl = func(ctx context.Context, args []string) ([]byte, error) {
+		cmds = append(cmds, strings.Join(args, " "))
+		return nil, nil
+	}
+	cmds = nil
+	for _, tcdata := range []*utils.TcData{vnet1, vnet2} {
+		if err := l.clean(ctx, tcdata); err != nil {
+			t.Fatalf("clean: %v", err)
+		}
+	}
+	n := 0
+	for _, cmd := range cmds {
+		if cmd == "ovs-ofctl -O OpenFlow13 del-flows --strict br0 table=14,priority=0" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("want fallback flow deleted once, got %q", cmds)
+	}
+}
+
+func TestTcManGuestStatsOvs(t *testing.T) {
+	tm := NewTcMan(tc.TcBackendCli, utils.RateLimitBackendOvs)
+	tm.tcBackend = &fakeTcBackend{
+		stats: map[string][]*tc.STcStats{
+			"sdnt-vnet1": {
+				{Type: tc.TcStatsQdisc, Kind: "noqueue", Id: "0:", Parent: "root"},
+				{Type: tc.TcStatsQdisc, Kind: "ingress", Id: "ffff:", Parent: "ffff:fff1", Packets: 30, Drops: 7},
+			},
+		},
+	}
+	l := tm.rateLimiter.(*ovsRateLimiter)
+	l.execOvsctl = func(ctx context.Context, args []string) ([]byte, error) {
+		if got := strings.Join(args, " "); got != "ovs-ofctl -O OpenFlow13 meter-stats br0 meter=26" {
+			t.Errorf("unexpected command %s", got)
+		}
+		return []byte(`OFPST_METER reply (OF1.3) (xid=0x2):
+meter:26 flow_count:1 packet_in_count:120 byte_in_count:9000 duration:5.123s bands:
+0: packet_count:20 byte_count:1500
+`), nil
+	}
+	guest := NewTcManSection()
+	guest.pages["sdnt-vnet1"] = &utils.TcData{
+		Ifname:      "sdnt-vnet1",
+		MAC:         "00:22:33:44:55:66",
+		Bridge:      "br0",
+		PortNo:      0x1a,
+		IngressMbps: 100,
+		EgressMbps:  100,
+	}
+	tm.book["g1"] = guest
+
+	stats := tm.doGuestStats(context.Background(), "g1")
+	if len(stats) != 1 || len(stats[0].Stats) != 2 {
+		t.Fatalf("want policing and meter stats of 1 nic, got %v", stats)
+	}
+	policing, meter := stats[0].Stats[0], stats[0].Stats[1]
+	if policing.Ifname != "sdnt-vnet1" || policing.Kind != "ingress" || policing.Drops != 7 {
+		t.Errorf("unexpected policing stats %s %+v", policing.Ifname, *policing.STcStats)
+	}
+	want := tc.STcStats{Type: "meter", Kind: "drop", Id: "26", Bytes: 9000, Packets: 120, Drops: 20}
+	if meter.Ifname != "br0" || *meter.STcStats != want {
+		t.Errorf("want meter stats %+v, got %s %+v", want, meter.Ifname, *meter.STcStats)
+	}
+}
+
+func TestTcManHostTrees(t *testing.T) {
+	newTree := func() *tc.QdiscTree {
+		qt, err := tc.NewQdiscTreeFromString(
+			"qdisc htb 1: root refcnt 2 r2q 10 default 0xfffe direct_packets_stat 0",
+			"class htb 1:1 root rate 1Tbit ceil 1Tbit burst 0b cburst 0b",
+			"",
+		)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		return qt
+	}
+	guest := NewTcManSection()
+	guest.pages["sdnt-vnet1"] = &utils.TcData{
+		Ifname:     "sdnt-vnet1",
+		Bridge:     "br0",
+		PortNo:     0x1a,
+		EgressMbps: 100,
+	}
+	for _, shaping := range []bool{false, true} {
+		backend := &fakeTcBackend{
+			trees: map[string]*tc.QdiscTree{"br0": newTree(), "eth0": newTree()},
+		}
+		tm := NewTcMan(tc.TcBackendCli, utils.RateLimitBackendIfb)
+		tm.tcBackend = backend
+		tm.book["g1"] = guest
+		tm.doCheckHostTcData(context.Background(), &utils.TcData{
+			Ifname:        "eth0",
+			Bridge:        "br0",
+			EgressMbps:    1000,
+			UplinkShaping: shaping,
+		})
+
+		// the tree left on the bridge goes anyway
+		want := []string{"qdisc delete dev br0 root handle 1:"}
+		if got := opsLines(backend.ops["br0"], "br0"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("shaping %v: bridge: want %q, got %q", shaping, want, got)
+		}
+		got := opsLines(backend.ops["eth0"], "eth0")
+		if !shaping {
+			want := []string{"qdisc delete dev eth0 root handle 1:"}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("uplink: want %q, got %q", want, got)
+			}
+		} else if !strings.Contains(strings.Join(got, "\n"), "classid 1:1a htb rate 100Mbit") {
+			t.Errorf("uplink: want class of the guest nic, got %q", got)
+		}
+	}
+}
+
+func opsLines(ops []tc.TcOp, ifname string) []string {
+	r := []string{}
+	for _, line := range tc.TcOpsLines(ops, ifname) {
+		r = append(r, strings.Join(line, " "))
+	}
+	return r
+}
@@ -23,14 +23,16 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/digitalocean/go-openvswitch/ovs"
 	"github.com/fsnotify/fsnotify"
 
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
 
-	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
 	fwdpb "yunion.io/x/onecloud/pkg/hostman/guestman/forwarder/api"
 	"yunion.io/x/onecloud/pkg/util/hashcache"
 
@@ -47,20 +49,27 @@ var REGEX_UUID = regexp.MustCompile(`^[a-f0-9]{8}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-
 type wCmd int
 
 const (
-	wCmdFindGuestDescByIdIP wCmd = iota
-	wCmdFindGuestDescByHostLocalIP
+	wCmdAnnounceGuest wCmd = iota
+	wCmdGuestEvent
 )
 
-type wCmdFindGuestDescByIdIPData struct {
-	NetId  string
-	IP     string
-	RespCh chan<- *desc.SGuestDesc
+type wCmdAnnounceGuestData struct {
+	GuestId string
+	MAC     string
+	Count   int
+	RespCh  chan<- error
 }
 
-type wCmdFindGuestDescByHostLocalIPData struct {
-	HostLocal *utils.HostLocal
-	IP        string
-	RespCh    chan<- *desc.SGuestDesc
+type wCmdGuestEventData struct {
+	GuestId string
+	Event   string
+	Desc    []byte
+	RespCh  chan<- *wGuestEventResult
+}
+
+type wGuestEventResult struct {
+	Status *guestStatus
+	Err    error
 }
 
 type wCmdReq struct {
@@ -79,9 +88,30 @@ type serversWatcher struct {
 	hostLocal  *HostLocal
 	guests     map[string]*Guest
 	zoneMan    *utils.ZoneMan
+	// portMappingMan keeps host ports of guests from being taken by
+	// others
+	portMappingMan *utils.PortMappingMan
+
+	// workers update guests in parallel.  Guests are only changed by
+	// tasks submitted by the watcher goroutine, see guestTask
+	workers *guestWorkers
+	// guestDoneCh wakes up the watcher goroutine after guest tasks, to
+	// see if there are guests pending
+	guestDoneCh chan struct{}
+	// dumpPort returns openflow port of guest nic on bridge
+	dumpPort func(bridge, port string) (*ovs.PortStats, error)
+	// runOvsctl configures ports of guest nics
+	runOvsctl func(ctx context.Context, args []string) error
 
 	cmdCh chan wCmdReq
 
+	// lookups and statuses are snapshots of guests keyed by guest id,
+	// for finding guests without waiting for their updates, see
+	// snapshotLookup
+	lookupMu sync.RWMutex
+	lookups  map[string]*utils.Guest
+	statuses map[string]*guestStatus
+
 	bridgeIpNicCache *hashcache.Cache // map[string]*desc.SGuestDesc
 	netIdIpNicCache  *hashcache.Cache // map[string]*desc.SGuestDesc
 }
@@ -91,7 +121,15 @@ func newServersWatcher() (*serversWatcher, error) {
 		guests:  map[string]*Guest{},
 		zoneMan: utils.NewZoneMan(GuestCtZoneBase),
 
-		cmdCh: make(chan wCmdReq),
+		portMappingMan: utils.NewPortMappingMan(),
+
+		guestDoneCh: make(chan struct{}, 1),
+		dumpPort:    utils.DumpPort,
+		runOvsctl:   utils.RunOvsctl,
+
+		cmdCh:    make(chan wCmdReq),
+		lookups:  map[string]*utils.Guest{},
+		statuses: map[string]*guestStatus{},
 
 		// cache for 10 seconds, avoid frequent lookup of guest desc
 		bridgeIpNicCache: hashcache.NewCache(512, 10*time.Second),
@@ -135,76 +173,167 @@ func (w *watchEvent) String() string {
 	return fmt.Sprintf("type: %s guest_id: %s path: %s", watchEventTypeStringMap[w.evType], w.guestId, w.guestPath)
 }
 
-func (w *serversWatcher) scan(ctx context.Context) {
+// reserveOvsCtZones keeps ct zones recorded in ovs by others from being
+// allocated to guest nics.  Nics with colliding zones get new ones on next
+// update
+func (w *serversWatcher) reserveOvsCtZones(ctx context.Context) {
+	zones, err := utils.FetchOvsCtZones(ctx)
+	if err != nil {
+		log.Errorf("fetch ovs ct zones: %v", err)
+		return
+	}
+	if macs := w.zoneMan.Reserve(zones); len(macs) > 0 {
+		log.Warningf("ct zones of macs %s collide with ovs, reallocating", strings.Join(macs, ","))
+	}
+}
+
+// scan updates guests found in servers path, and returns them
+func (w *serversWatcher) scan(ctx context.Context) []*Guest {
 	serversPath := w.hostConfig.ServersPath
 	fis, err := os.ReadDir(serversPath)
 	if err != nil {
 		log.Errorf("scan servers path %s failed: %s", serversPath, err)
-		return
+		return nil
 	}
+	start := time.Now()
+	guests := []*Guest{}
 	for _, fi := range fis {
 		if !fi.IsDir() {
 			continue
 		}
 		id := fi.Name()
 		if REGEX_UUID.MatchString(id) {
-			guestStart := time.Now()
 			log.Debugf("scan guest %s", id)
 			path := path.Join(serversPath, id)
 			g, err := w.addGuestWatch(id, path)
 			if err != nil {
 				log.Errorf("inotify events watch guest failed during scan: %s: %s", path, err)
 			}
-			log.Debugf("end of scan guest %s addGuestWatch: %f", id, time.Since(guestStart).Seconds())
-			g.UpdateSettings(ctx, false)
-			log.Debugf("end of scan guest %s: %f", id, time.Since(guestStart).Seconds())
+			guests = append(guests, g)
+		}
+	}
+	w.updateGuests(ctx, guests, false)
+	log.Debugf("end of scan %d guests: %f", len(guests), time.Since(start).Seconds())
+	return guests
+}
+
+// guestTask runs f on guest g by workers, after tasks of g submitted
+// earlier.  f runs with g locked
+func (w *serversWatcher) guestTask(g *Guest, f func()) {
+	w.workers.Submit(g.Id, func() {
+		g.mu.Lock()
+		f()
+		st := g.status()
+		g.saveStatus(st)
+		w.snapshotLookup(g, st)
+		g.mu.Unlock()
+		select {
+		case w.guestDoneCh <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// updateGuests submits updates of guests to run in parallel, and returns
+// the guests
+func (w *serversWatcher) updateGuests(ctx context.Context, guests []*Guest, syncTc bool) []*Guest {
+	for _, g := range guests {
+		w.guestTask(g, func() { g.UpdateSettings(ctx, syncTc) })
+	}
+	return guests
+}
+
+// idleGuests returns guests with no tasks queued or running.  They can be
+// read by the watcher goroutine without locking, as only it submits tasks
+func (w *serversWatcher) idleGuests() []*Guest {
+	guests := []*Guest{}
+	for _, g := range w.guests {
+		if !w.workers.Busy(g.Id) {
+			guests = append(guests, g)
 		}
 	}
+	return guests
 }
 
 // addGuestWatch adds the server with <id> in <path> to watch list.  It returns
-// error when adding watch failed, but it will always return non-nil *Guest
+// error when adding watch failed, but it will always return non-nil *Guest.
+// Adding watch is retried for guests known before their dir appears, e.g.
+// those with events pushed
 func (w *serversWatcher) addGuestWatch(id, path string) (*Guest, error) {
-	if g, ok := w.guests[id]; ok {
+	g, ok := w.guests[id]
+	if !ok {
+		ug := &utils.Guest{
+			Id:         id,
+			Path:       path,
+			HostConfig: w.hostConfig,
+		}
+		g = NewGuest(ug, w)
+		w.guests[id] = g
+		// no task of the new guest runs yet
+		w.snapshotLookup(g, g.status())
+	}
+	if g.watched {
 		return g, nil
 	}
-	ug := &utils.Guest{
-		Id:         id,
-		Path:       path,
-		HostConfig: w.hostConfig,
+	if err := w.watcher.Add(path); err != nil {
+		return g, err
 	}
-	g := NewGuest(ug, w)
-	w.guests[id] = g
-	err := w.watcher.Add(path)
-	return g, err
+	g.watched = true
+	return g, nil
 }
 
 func GetFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
 
-func (w *serversWatcher) withWait(ctx context.Context, f func(context.Context)) {
-	waitData := map[string]*FlowManWaitData{}
-	ctx = context.WithValue(ctx, "waitData", waitData)
+// withWait runs f, holding off flowmans updated by it till tasks of guests
+// it returns are done, so that each bridge commits once.  Guest tasks are
+// waited for in another goroutine, not to block the watcher goroutine.  The
+// channel returned is closed when flowmans are released
+func (w *serversWatcher) withWait(ctx context.Context, f func(context.Context) []*Guest) <-chan struct{} {
+	fw := NewFlowManWait()
+	ctx = context.WithValue(ctx, "waitData", fw)
 	start := time.Now()
 	funcName := GetFunctionName(f)
 	log.Debugf("serversWatcher.withWait start wait %s context ....", funcName)
-	f(ctx)
-	log.Debugf("serversWatcher.withWait end wait %s context %f....", funcName, time.Since(start).Seconds())
-	for _, wd := range waitData {
-		wd.FlowMan.waitDecr(wd.Count)
-		wd.FlowMan.SyncFlows(ctx)
+	guests := f(ctx)
+	ids := make([]string, 0, len(guests))
+	for _, g := range guests {
+		ids = append(ids, g.Id)
 	}
-	w.tcMan.SyncAll(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.workers.WaitIdle(ids)
+		log.Debugf("serversWatcher.withWait end wait %s context %f....", funcName, time.Since(start).Seconds())
+		fw.Done(ctx)
+		w.tcMan.SyncAll(ctx)
+	}()
+	return done
 }
 
-func (w *serversWatcher) hasRecentPending() bool {
-	for _, g := range w.guests {
+// pendingGuests returns idle guests failed recently, e.g. for ports not
+// ready
+func (w *serversWatcher) pendingGuests() []*Guest {
+	guests := []*Guest{}
+	for _, g := range w.idleGuests() {
 		if g.IsPending() {
-			return true
+			guests = append(guests, g)
 		}
 	}
-	return false
+	return guests
+}
+
+// stagedGuests returns idle guests migrating onto this host and waiting for
+// their ports
+func (w *serversWatcher) stagedGuests() []*Guest {
+	guests := []*Guest{}
+	for _, g := range w.idleGuests() {
+		if g.migration != nil && g.migration.isStaged() {
+			guests = append(guests, g)
+		}
+	}
+	return guests
 }
 
 func (w *serversWatcher) Start(ctx context.Context, agent *AgentServer) {
@@ -231,8 +360,10 @@ func (w *serversWatcher) Start(ctx context.Context, agent *AgentServer) {
 		return
 	}
 
+	w.workers = newGuestWorkers(w.hostConfig.GuestWorkers)
+
 	if w.hostConfig.SdnEnableTcMan {
-		w.tcMan = NewTcMan()
+		w.tcMan = NewTcMan(w.hostConfig.TcBackend, w.hostConfig.RateLimitBackend)
 		wg.Add(1)
 		go w.tcMan.Start(ctx)
 	}
@@ -245,23 +376,42 @@ func (w *serversWatcher) Start(ctx context.Context, agent *AgentServer) {
 		go w.ovnMdMan.Start(ctx)
 	}
 
+	// zones allocated before restart, and those used by others
+	if err := w.zoneMan.Load(w.hostConfig.CtZoneFile); err != nil {
+		log.Errorf("load ct zones: %v", err)
+	}
+	w.reserveOvsCtZones(ctx)
+
 	// init scan
 	w.hostLocal = NewHostLocal(w)
-	w.withWait(ctx, func(ctx context.Context) {
+	<-w.withWait(ctx, func(ctx context.Context) []*Guest {
 		w.hostLocal.UpdateSettings(ctx, false)
-		w.scan(ctx)
-		log.Infof("serversWatcher.Start: Finish initial guests scan")
+		return w.scan(ctx)
 	})
+	log.Infof("serversWatcher.Start: Finish initial guests scan")
+	w.agent.endWarmStart(ctx, "initial scan done")
+	if macs := w.zoneMan.FreeStale(); len(macs) > 0 {
+		log.Infof("freed ct zones of macs no longer seen: %s", strings.Join(macs, ","))
+	}
 
 	refreshTicker := time.NewTicker(WatcherRefreshRate)
 	pendingRefreshTicker := time.NewTicker(WatcherRefreshRateOnError)
+	migrationPollTicker := time.NewTicker(WatcherMigrationPollRate)
 	defer refreshTicker.Stop()
 	defer pendingRefreshTicker.Stop()
+	defer migrationPollTicker.Stop()
+	// batchDone is closed when guests updated in batch are done.  Batches
+	// do not overlap, for flowmans to commit once each
+	var batchDone <-chan struct{}
 	for {
 		var pendingChan <-chan time.Time
-		if w.hasRecentPending() {
+		if len(w.pendingGuests()) > 0 {
 			pendingChan = pendingRefreshTicker.C
 		}
+		var migrationChan <-chan time.Time
+		if len(w.stagedGuests()) > 0 {
+			migrationChan = migrationPollTicker.C
+		}
 		select {
 		case ev, ok := <-w.watcher.Events:
 			if !ok {
@@ -282,39 +432,56 @@ func (w *serversWatcher) Start(ctx context.Context, agent *AgentServer) {
 					if err != nil {
 						log.Errorf("watch guest failed: %s: %s", guestPath, err)
 					}
-					g.UpdateSettings(ctx, true)
+					w.guestTask(g, func() { g.UpdateSettings(ctx, true) })
 				case watchEventTypeDelServerDir:
 					if g, ok := w.guests[guestId]; ok {
 						// this is needed for containers
-						g.ClearSettings(ctx)
+						w.guestTask(g, func() {
+							g.ClearSettings(ctx)
+							g.deleted = true
+						})
 						delete(w.guests, guestId)
 					}
 				case watchEventTypeUpdServer:
 					if g, ok := w.guests[guestId]; ok {
-						g.UpdateSettings(ctx, true)
+						w.guestTask(g, func() { g.UpdateSettings(ctx, true) })
 					} else {
 						log.Warningf("unexpected guest update event: %s", guestPath)
 					}
 				case watchEventTypeDelServer:
 					if g, ok := w.guests[guestId]; ok {
-						g.ClearSettings(ctx)
+						w.guestTask(g, func() { g.ClearSettings(ctx) })
 					} else {
 						log.Warningf("unexpected guest down event: %s", guestPath)
 					}
 				}
 			}
+		case <-w.guestDoneCh:
+			// check pending guests again
+		case <-batchDone:
+			batchDone = nil
 		case <-pendingChan:
-			w.withWait(ctx, func(ctx context.Context) {
-				for _, g := range w.guests {
-					if g.IsPending() {
-						g.UpdateSettings(ctx, false)
-					}
-				}
+			if batchDone != nil {
+				// retried on next tick
+				break
+			}
+			batchDone = w.withWait(ctx, func(ctx context.Context) []*Guest {
+				return w.updateGuests(ctx, w.pendingGuests(), false)
 			})
+		case <-migrationChan:
+			// activate flows as soon as ports of migrating guests appear
+			for _, g := range w.stagedGuests() {
+				w.guestTask(g, func() { g.UpdateSettings(ctx, true) })
+			}
 		case <-refreshTicker.C:
-			w.withWait(ctx, func(ctx context.Context) {
+			if batchDone != nil {
+				log.Debugf("last guests batch not done, skip refresh")
+				break
+			}
+			w.reserveOvsCtZones(ctx)
+			batchDone = w.withWait(ctx, func(ctx context.Context) []*Guest {
 				w.hostLocal.UpdateSettings(ctx, false)
-				w.scan(ctx)
+				return w.scan(ctx)
 			})
 		case err, ok := <-w.watcher.Errors:
 			if !ok {
@@ -326,59 +493,18 @@ func (w *serversWatcher) Start(ctx context.Context, agent *AgentServer) {
 			return
 		case cmd := <-w.cmdCh:
 			switch cmd.cmd {
-			case wCmdFindGuestDescByIdIP:
-				var (
-					data  = cmd.data.(wCmdFindGuestDescByIdIPData)
-					netId = data.NetId
-					ip    = data.IP
-					robj  *desc.SGuestDesc
-				)
-				gDescIntf := w.netIdIpNicCache.Get(netId)
-				if gDescIntf != nil {
-					robj = gDescIntf.(*desc.SGuestDesc)
-				} else {
-					for guestId, guest := range w.guests {
-						if nic := guest.FindNicByNetIdIP(netId, ip); nic != nil {
-							obj, err := guest.GetJSONObjectDesc()
-							if err != nil {
-								log.Errorf("guest %s: GetJSONObjectDesc: %v", guestId, err)
-							}
-							robj = obj
-							break
-						}
-					}
-					if robj != nil {
-						w.netIdIpNicCache.Set(netId, robj)
-					}
+			case wCmdAnnounceGuest:
+				data := cmd.data.(wCmdAnnounceGuestData)
+				g, ok := w.guests[data.GuestId]
+				if !ok {
+					data.RespCh <- errors.Wrapf(errors.ErrNotFound, "guest %s", data.GuestId)
+					break
 				}
-				data.RespCh <- robj
-			case wCmdFindGuestDescByHostLocalIP:
-				var (
-					data      = cmd.data.(wCmdFindGuestDescByHostLocalIPData)
-					hostLocal = data.HostLocal
-					ip        = data.IP
-					robj      *desc.SGuestDesc
-				)
-				mapKey := fmt.Sprintf("%s:%s", hostLocal.Bridge, ip)
-				gDescIntf := w.bridgeIpNicCache.Get(mapKey)
-				if gDescIntf != nil {
-					robj = gDescIntf.(*desc.SGuestDesc)
-				} else {
-					for guestId, guest := range w.guests {
-						if nic := guest.FindNicByHostLocalIP(hostLocal, ip); nic != nil {
-							obj, err := guest.GetJSONObjectDesc()
-							if err != nil {
-								log.Errorf("guest %s: GetJSONObjectDesc: %v", guestId, err)
-							}
-							robj = obj
-							break
-						}
-					}
-					if robj != nil {
-						w.bridgeIpNicCache.Set(mapKey, robj)
-					}
-				}
-				data.RespCh <- robj
+				w.guestTask(g, func() {
+					data.RespCh <- w.announceGuest(g, data.MAC, data.Count)
+				})
+			case wCmdGuestEvent:
+				w.guestEvent(ctx, cmd.data.(wCmdGuestEventData))
 			}
 		case <-ctx.Done():
 			log.Infof("watcher bye")
@@ -388,36 +514,43 @@ func (w *serversWatcher) Start(ctx context.Context, agent *AgentServer) {
 out:
 }
 
-func (w *serversWatcher) FindGuestDescByNetIdIP(netId, ip string) *desc.SGuestDesc {
-	respCh := make(chan *desc.SGuestDesc)
-	reqData := wCmdFindGuestDescByIdIPData{
-		NetId:  netId,
-		IP:     ip,
-		RespCh: respCh,
-	}
+// AnnounceGuest sends gratuitous arp and unsolicited na for addresses of
+// the guest nic with mac, or of all its nics if mac is empty
+func (w *serversWatcher) AnnounceGuest(guestId, mac string, count int) error {
+	// buffered for the guest task not to block
+	respCh := make(chan error, 1)
 	req := wCmdReq{
-		cmd:  wCmdFindGuestDescByIdIP,
-		data: reqData,
+		cmd: wCmdAnnounceGuest,
+		data: wCmdAnnounceGuestData{
+			GuestId: guestId,
+			MAC:     mac,
+			Count:   count,
+			RespCh:  respCh,
+		},
 	}
 	w.cmdCh <- req
-	obj := <-respCh
-	return obj
+	return <-respCh
 }
 
-func (w *serversWatcher) FindGuestDescByHostLocalIp(hostLocal *utils.HostLocal, ip string) *desc.SGuestDesc {
-	respCh := make(chan *desc.SGuestDesc)
-	reqData := wCmdFindGuestDescByHostLocalIPData{
-		HostLocal: hostLocal,
-		IP:        ip,
-		RespCh:    respCh,
+// announceGuest runs as task of guest g, see AnnounceGuest
+func (w *serversWatcher) announceGuest(g *Guest, mac string, count int) error {
+	if !g.flowsActive {
+		return errors.Wrapf(errors.ErrInvalidStatus, "guest %s flows not active", g.Id)
 	}
-	req := wCmdReq{
-		cmd:  wCmdFindGuestDescByHostLocalIP,
-		data: reqData,
+	nics := []*utils.GuestNIC{}
+	for _, nic := range g.NICs {
+		if mac == "" || nic.MAC == mac {
+			nics = append(nics, nic)
+		}
 	}
-	w.cmdCh <- req
-	obj := <-respCh
-	return obj
+	if len(nics) == 0 {
+		return errors.Wrapf(errors.ErrNotFound, "guest %s nic %s", g.Id, mac)
+	}
+	if count <= 0 {
+		count = w.hostConfig.AnnounceCount
+	}
+	go announceNics(w.agent.ctx, g.Who(), nics, count, w.hostConfig.AnnounceInterval)
+	return nil
 }
 
 func (w *serversWatcher) watchEvent(ev *fsnotify.Event) (wev *watchEvent) {
@@ -0,0 +1,290 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+	"github.com/fsnotify/fsnotify"
+
+	pb "yunion.io/x/sdnagent/pkg/agent/proto"
+	"yunion.io/x/sdnagent/pkg/agent/utils"
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+func TestGuestWorkers(t *testing.T) {
+	const (
+		n      = 3
+		guests = 10
+		tasks  = 20
+	)
+	gw := newGuestWorkers(n)
+	var (
+		running    int32
+		maxRunning int32
+		wg         sync.WaitGroup
+		// guest of each task, and order of tasks of each guest
+		busy  [guests]int32
+		order [guests][]int
+	)
+	for i := 0; i < tasks; i++ {
+		for j := 0; j < guests; j++ {
+			wg.Add(1)
+			gw.Submit(fmt.Sprintf("guest%d", j), func() {
+				defer wg.Done()
+				if atomic.AddInt32(&busy[j], 1) != 1 {
+					t.Errorf("guest%d: tasks run at the same time", j)
+				}
+				r := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+						break
+					}
+				}
+				order[j] = append(order[j], i)
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				atomic.AddInt32(&busy[j], -1)
+			})
+		}
+	}
+	wg.Wait()
+	if maxRunning > n {
+		t.Errorf("%d tasks run at a time, want at most %d", maxRunning, n)
+	}
+	for j := 0; j < guests; j++ {
+		if gw.Busy(fmt.Sprintf("guest%d", j)) {
+			t.Errorf("guest%d busy after tasks done", j)
+		}
+		for i, k := range order[j] {
+			if i != k {
+				t.Errorf("guest%d: task %d run as %dth", j, k, i)
+				break
+			}
+		}
+	}
+}
+
+// fakeFlowMan returns flowman not started, with commands buffered
+func fakeFlowMan(bridge string) *FlowMan {
+	return &FlowMan{
+		bridge:  bridge,
+		cmdChan: make(chan *flowManCmd, 1024),
+		flowSets: map[string]*utils.FlowSet{
+			THEMAN:   utils.NewFlowSet(),
+			FAILSAFE: utils.NewFlowSet(),
+		},
+	}
+}
+
+func TestFlowManWait(t *testing.T) {
+	ctx := context.Background()
+	fms := []*FlowMan{fakeFlowMan("br0"), fakeFlowMan("br1")}
+	fw := NewFlowManWait()
+	wctx := context.WithValue(ctx, "waitData", fw)
+
+	const updates = 50
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fm := fms[i%len(fms)]
+			fm.updateFlows(wctx, fmt.Sprintf("guest%d", i), nil)
+		}()
+	}
+	wg.Wait()
+	for _, fm := range fms {
+		if got := atomic.LoadInt32(&fm.waitCount); got != updates/2 {
+			t.Errorf("%s: wait count %d, want %d", fm.bridge, got, updates/2)
+		}
+	}
+
+	fw.Done(ctx)
+	for _, fm := range fms {
+		if got := atomic.LoadInt32(&fm.waitCount); got != 0 {
+			t.Errorf("%s: wait count %d after done", fm.bridge, got)
+		}
+		nUpdate, nSync := 0, 0
+		close(fm.cmdChan)
+		for cmd := range fm.cmdChan {
+			switch cmd.Type {
+			case flowManCmdUpdateFlows:
+				nUpdate++
+			case flowManCmdSyncFlows:
+				nSync++
+			}
+		}
+		if nUpdate != updates/2 || nSync != 1 {
+			t.Errorf("%s: %d updates and %d syncs, want %d and 1", fm.bridge, nUpdate, nSync, updates/2)
+		}
+	}
+}
+
+func TestServersWatcherUpdateGuests(t *testing.T) {
+	ctx := context.Background()
+	serversPath := t.TempDir()
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.agent = Server()
+	w.workers = newGuestWorkers(4)
+	w.hostConfig = &utils.HostConfig{}
+	w.hostConfig.ServersPath = serversPath
+	w.hostConfig.DisableLocalVpc = true
+	w.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("new fsnotify watcher: %v", err)
+	}
+	defer w.watcher.Close()
+
+	// ports of nics are found after a while
+	var portNo int32
+	w.dumpPort = func(bridge, port string) (*ovs.PortStats, error) {
+		time.Sleep(time.Millisecond)
+		return &ovs.PortStats{PortID: int(atomic.AddInt32(&portNo, 1))}, nil
+	}
+	w.tcMan = NewTcMan(tc.TcBackendCli, utils.RateLimitBackendIfb)
+	w.tcMan.tcBackend = &fakeTcBackend{}
+
+	const guests = 40
+	for i := 0; i < guests; i++ {
+		id := fmt.Sprintf("00000000-0000-4000-8000-%012d", i)
+		dir := path.Join(serversPath, id)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		desc := fmt.Sprintf(`{"name":"vm%d","host_id":"host0","nics":[{"bridge":"br%d","ifname":"vnet%d","mac":"00:22:00:00:%02x:%02x","ip":"10.0.%d.%d","bw":100}]}`,
+			i, i%2, i, i/256, i%256, i/256, i%256+2)
+		if err := os.WriteFile(path.Join(dir, "desc"), []byte(desc), 0644); err != nil {
+			t.Fatalf("write desc: %v", err)
+		}
+	}
+
+	<-w.withWait(ctx, w.scan)
+
+	if len(w.guests) != guests {
+		t.Fatalf("%d guests scanned, want %d", len(w.guests), guests)
+	}
+	zones := map[uint16]string{}
+	for id, g := range w.guests {
+		if w.workers.Busy(id) {
+			t.Errorf("guest %s busy after scan", id)
+		}
+		if st := g.status(); st.Phase != pb.GuestPhaseActive {
+			t.Errorf("guest %s: phase %s: %s", id, st.Phase, st.Error)
+		}
+		for _, nic := range g.NICs {
+			if other, ok := zones[nic.CtZoneId]; ok {
+				t.Errorf("ct zone %d of %s used by %s", nic.CtZoneId, id, other)
+			}
+			zones[nic.CtZoneId] = id
+		}
+	}
+	if got := w.agent.GetHostId(); got != "host0" {
+		t.Errorf("host id: %q", got)
+	}
+
+	// each guest adds its nics to tcman without sync, and tcman syncs
+	// once after all of them
+	nAdd := 0
+	for i := 0; i < guests+1; i++ {
+		cmd := <-w.tcMan.cmdChan
+		switch {
+		case i < guests && cmd.typ == TcManCmdAdd && !cmd.sync:
+			nAdd++
+		case i == guests && cmd.typ == TcManCmdSync:
+		default:
+			t.Fatalf("tcman cmd %d: type %v sync %v", i, cmd.typ, cmd.sync)
+		}
+	}
+	if nAdd != guests {
+		t.Errorf("%d guests added to tcman, want %d", nAdd, guests)
+	}
+}
+
+func TestServersWatcherLookups(t *testing.T) {
+	w, err := newServersWatcher()
+	if err != nil {
+		t.Fatalf("new servers watcher: %v", err)
+	}
+	w.workers = newGuestWorkers(1)
+
+	const id = "00000000-0000-4000-8000-000000000000"
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "desc"), []byte(`{"name":"vm0"}`), 0644); err != nil {
+		t.Fatalf("write desc: %v", err)
+	}
+	g := NewGuest(&utils.Guest{
+		Id:   id,
+		Path: dir,
+		NICs: []*utils.GuestNIC{{
+			Bridge: "br0",
+			PortNo: 3,
+			MAC:    "00:22:00:00:00:01",
+			IP:     "10.0.0.2",
+			NetId:  "net0",
+		}},
+	}, w)
+
+	if _, _, ok := w.FindGuestNicByPort("br0", 3); ok {
+		t.Errorf("nic found before guest updated")
+	}
+
+	// lookups see the guest as of its last update, while it is being
+	// updated again
+	started := make(chan struct{})
+	release := make(chan struct{})
+	w.guestTask(g, func() {})
+	w.guestTask(g, func() {
+		g.NICs[0].PortNo = 4
+		close(started)
+		<-release
+	})
+	<-started
+	guestId, mac, ok := w.FindGuestNicByPort("br0", 3)
+	if !ok || guestId != id || mac != "00:22:00:00:00:01" {
+		t.Errorf("find nic by port: got %q %q %v", guestId, mac, ok)
+	}
+	if d := w.FindGuestDescByNetIdIP("net0", "10.0.0.2"); d == nil || d.Name != "vm0" {
+		t.Errorf("find desc by net id ip: got %#v", d)
+	}
+	close(release)
+
+	done := make(chan struct{})
+	w.guestTask(g, func() { close(done) })
+	<-done
+	if _, _, ok := w.FindGuestNicByPort("br0", 4); !ok {
+		t.Errorf("nic not found by port after update")
+	}
+
+	done = make(chan struct{})
+	w.guestTask(g, func() { g.deleted = true })
+	w.guestTask(g, func() { close(done) })
+	<-done
+	if _, _, ok := w.FindGuestNicByPort("br0", 4); ok {
+		t.Errorf("nic found after guest deleted")
+	}
+}
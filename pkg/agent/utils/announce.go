@@ -0,0 +1,173 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+
+	"yunion.io/x/pkg/errors"
+)
+
+var (
+	macBroadcast     = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	macAllNodes      = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01}
+	ip6AllNodes      = net.ParseIP("ff02::1")
+	ethTypeArp       = uint16(0x0806)
+	ethTypeIPv6      = uint16(0x86dd)
+	ndNaFlagOverride = uint32(0x20000000)
+)
+
+func ethHeader(dst, src net.HardwareAddr, ethType uint16) []byte {
+	b := make([]byte, 14)
+	copy(b[0:6], dst)
+	copy(b[6:12], src)
+	binary.BigEndian.PutUint16(b[12:14], ethType)
+	return b
+}
+
+// GarpPacket returns a gratuitous arp request announcing ip at mac
+func GarpPacket(mac, ip string) ([]byte, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse mac %q", mac)
+	}
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "invalid ipv4 address %q", ip)
+	}
+	arp := make([]byte, 28)
+	binary.BigEndian.PutUint16(arp[0:2], 1)      // ethernet
+	binary.BigEndian.PutUint16(arp[2:4], 0x0800) // ipv4
+	arp[4] = 6
+	arp[5] = 4
+	binary.BigEndian.PutUint16(arp[6:8], 1) // request
+	copy(arp[8:14], hw)
+	copy(arp[14:18], ip4)
+	copy(arp[24:28], ip4)
+	return append(ethHeader(macBroadcast, hw, ethTypeArp), arp...), nil
+}
+
+// UnsolicitedNaPacket returns a neighbor advertisement to all nodes with
+// override flag set, announcing ip6 at mac
+func UnsolicitedNaPacket(mac, ip6 string) ([]byte, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse mac %q", mac)
+	}
+	src := net.ParseIP(ip6)
+	if src == nil || src.To4() != nil {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "invalid ipv6 address %q", ip6)
+	}
+	src = src.To16()
+	dst := ip6AllNodes.To16()
+
+	// icmpv6 with target link-layer address option
+	icmp := make([]byte, 32)
+	icmp[0] = 136
+	binary.BigEndian.PutUint32(icmp[4:8], ndNaFlagOverride)
+	copy(icmp[8:24], src)
+	icmp[24] = 2
+	icmp[25] = 1
+	copy(icmp[26:32], hw)
+
+	// checksum over pseudo header and icmpv6 message
+	pseudo := make([]byte, 40, 40+len(icmp))
+	copy(pseudo[0:16], src)
+	copy(pseudo[16:32], dst)
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(icmp)))
+	pseudo[39] = 58
+	binary.BigEndian.PutUint16(icmp[2:4], inetChecksum(append(pseudo, icmp...)))
+
+	ip := make([]byte, 40)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(icmp)))
+	ip[6] = 58
+	ip[7] = 255
+	copy(ip[8:24], src)
+	copy(ip[24:40], dst)
+
+	pkt := ethHeader(macAllNodes, hw, ethTypeIPv6)
+	pkt = append(pkt, ip...)
+	return append(pkt, icmp...), nil
+}
+
+func inetChecksum(b []byte) uint16 {
+	sum := uint32(0)
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// AnnouncePackets returns gratuitous arp for ipv4 addresses, including sub
+// ips and virtual ips, and unsolicited neighbor advertisement for ipv6
+// addresses, including secondary ones, of the nic
+func (nic *GuestNIC) AnnouncePackets() ([][]byte, error) {
+	ips := []string{}
+	if nic.IP != "" {
+		ips = append(ips, nic.IP)
+	}
+	ips = append(ips, nic.SubIPs()...)
+	if nic.IP6 != "" {
+		ips = append(ips, nic.IP6)
+	}
+	ips = append(ips, nic.SubIP6s()...)
+	pkts := [][]byte{}
+	seen := map[string]bool{}
+	for _, ip := range ips {
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		var (
+			pkt []byte
+			err error
+		)
+		if addr := net.ParseIP(ip); addr != nil && addr.To4() == nil {
+			pkt, err = UnsolicitedNaPacket(nic.MAC, ip)
+		} else {
+			pkt, err = GarpPacket(nic.MAC, ip)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pkts = append(pkts, pkt)
+	}
+	return pkts, nil
+}
+
+// AnnounceKey identifies where the nic was announced.  The nic is announced
+// again when it changes
+func (nic *GuestNIC) AnnounceKey() string {
+	return fmt.Sprintf("%s/%d", nic.Bridge, nic.PortNo)
+}
+
+// PacketOutArgs returns ovs-ofctl command line sending pkt into bridge as
+// if it came from port portNo
+func PacketOutArgs(bridge string, portNo int, pkt []byte) []string {
+	return []string{
+		"ovs-ofctl", "packet-out", bridge,
+		fmt.Sprintf("%d", portNo), "normal", hex.EncodeToString(pkt),
+	}
+}
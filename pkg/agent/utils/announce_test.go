@@ -0,0 +1,118 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestGarpPacket(t *testing.T) {
+	pkt, err := GarpPacket("00:22:00:00:00:10", "192.168.1.10")
+	if err != nil {
+		t.Fatalf("GarpPacket: %v", err)
+	}
+	want := "ffffffffffff" + "002200000010" + "0806" +
+		"0001" + "0800" + "06" + "04" + "0001" +
+		"002200000010" + "c0a8010a" +
+		"000000000000" + "c0a8010a"
+	if got := hex.EncodeToString(pkt); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if _, err := GarpPacket("00:22:00:00:00:10", "fd00::10"); err == nil {
+		t.Errorf("want error for ipv6 address")
+	}
+}
+
+func TestUnsolicitedNaPacket(t *testing.T) {
+	pkt, err := UnsolicitedNaPacket("00:22:00:00:00:10", "fd00::10")
+	if err != nil {
+		t.Fatalf("UnsolicitedNaPacket: %v", err)
+	}
+	got := hex.EncodeToString(pkt)
+	for _, w := range []string{
+		// ethernet to all nodes
+		"333300000001" + "002200000010" + "86dd",
+		// ipv6 header, icmpv6 payload, hop limit 255
+		"60000000" + "0020" + "3a" + "ff" +
+			"fd000000000000000000000000000010" +
+			"ff020000000000000000000000000001",
+		// override flag, target and target link-layer address option
+		"20000000" + "fd000000000000000000000000000010" + "0201" + "002200000010",
+	} {
+		if !strings.Contains(got, w) {
+			t.Errorf("want %s in %s", w, got)
+		}
+	}
+	if len(pkt) != 14+40+32 {
+		t.Fatalf("want packet length %d, got %d", 14+40+32, len(pkt))
+	}
+	// checksum over pseudo header and message with checksum field is zero
+	ip6, icmp := pkt[14:54], pkt[54:]
+	pseudo := append([]byte{}, ip6[8:40]...)
+	pseudo = append(pseudo, 0, 0, 0, byte(len(icmp)), 0, 0, 0, 58)
+	if sum := inetChecksum(append(pseudo, icmp...)); sum != 0 {
+		t.Errorf("bad icmpv6 checksum, verified as 0x%04x", sum)
+	}
+}
+
+func TestPacketOutArgs(t *testing.T) {
+	nic := &GuestNIC{MAC: "00:22:00:00:00:10", IP: "192.168.1.10", IP6: "fd00::10"}
+	pkts, err := nic.AnnouncePackets()
+	if err != nil {
+		t.Fatalf("AnnouncePackets: %v", err)
+	}
+	if len(pkts) != 2 {
+		t.Fatalf("want 2 packets, got %d", len(pkts))
+	}
+	args := strings.Join(PacketOutArgs("br0", 3, pkts[0]), " ")
+	want := "ovs-ofctl packet-out br0 3 normal ffffffffffff002200000010"
+	if !strings.HasPrefix(args, want) {
+		t.Errorf("want prefix %q, got %q", want, args)
+	}
+}
+
+func TestAnnouncePackets(t *testing.T) {
+	nic := &GuestNIC{
+		MAC:        "00:22:00:00:00:10",
+		IP:         "192.168.1.10",
+		IP6:        "fd00::10",
+		VirtualIps: []string{"192.168.1.100", "192.168.1.10"},
+		NetworkAddresses: []GuestNICNetworkAddress{
+			{Type: "sub_ip", IpAddr: "192.168.1.11"},
+			{Type: "sub_ip", IpAddr: "fd00::11"},
+		},
+	}
+	pkts, err := nic.AnnouncePackets()
+	if err != nil {
+		t.Fatalf("AnnouncePackets: %v", err)
+	}
+	want := []string{
+		"0806" + "0001080006040001" + "002200000010" + "c0a8010a",
+		"0806" + "0001080006040001" + "002200000010" + "c0a8010b",
+		"0806" + "0001080006040001" + "002200000010" + "c0a80164",
+		"86dd" + "60000000" + "00203aff" + "fd000000000000000000000000000010",
+		"86dd" + "60000000" + "00203aff" + "fd000000000000000000000000000011",
+	}
+	if len(pkts) != len(want) {
+		t.Fatalf("want %d packets, got %d", len(want), len(pkts))
+	}
+	for i, w := range want {
+		if got := hex.EncodeToString(pkts[i]); !strings.Contains(got, w) {
+			t.Errorf("packet %d: want %s in %s", i, w, got)
+		}
+	}
+}
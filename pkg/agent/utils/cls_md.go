@@ -17,10 +17,14 @@ package utils
 import (
 	"crypto/sha256"
 	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 	"time"
 
 	"yunion.io/x/log"
 
+	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/cloudcommon/app"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
@@ -91,9 +95,15 @@ func (h *HostLocal) StartMetadataServer(watcher IServerWatcher) {
 	if h.metadataPort == 0 {
 		log.Fatalf("Failed to find a free metadata port")
 	}
+	// handlers are added and served on loopback by metadata.Start.  Guests
+	// are served the same app through the limiter once they are added
+	loPort, err := freeLoopbackPort()
+	if err != nil {
+		log.Fatalf("Failed to find a free loopback metadata port: %v", err)
+	}
 	svc := &metadata.Service{
-		Address: addr,
-		Port:    h.metadataPort,
+		Address: "127.0.0.1",
+		Port:    loPort,
 
 		DescGetter: &sClassicMetadataDescGetter{
 			hostLocal: h,
@@ -105,12 +115,81 @@ func (h *HostLocal) StartMetadataServer(watcher IServerWatcher) {
 		RequestWorkerCount:     4,
 		RequestWorkerQueueSize: 128,
 	}, false)
+	go metadata.Start(h.metadataApp, svc)
+	// metadata.Start adds handlers before listening on loopback
+	if err := waitTcpListening(svc.Address, svc.Port, metadataStartTimeout); err != nil {
+		log.Fatalf("metadata server at %s: %v", h.Bridge, err)
+	}
+
+	listenAddr := net.JoinHostPort(addr, strconv.Itoa(h.metadataPort))
+	srv := appsrv.InitHTTPServer(h.metadataApp, listenAddr)
+	srv.Handler = h.metadataLimiter.Handler(h.metadataApp)
 	log.Infof("Start metadata server at %s on port %s:%d", h.Bridge, addr, h.metadataPort)
-	metadata.Start(h.metadataApp, svc)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("metadata server at %s: %v", h.Bridge, err)
+	}
+}
+
+// metadataStartTimeout is how long to wait for metadata.Start to add
+// handlers and listen on loopback
+const metadataStartTimeout = 10 * time.Second
+
+// freeLoopbackPort returns a tcp port free on loopback
+func freeLoopbackPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitTcpListening waits until addr:port accepts connections
+func waitTcpListening(addr string, port int, timeout time.Duration) error {
+	hostPort := net.JoinHostPort(addr, strconv.Itoa(port))
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", hostPort, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not listening after %s: %v", hostPort, timeout, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// newMetadataLimiter returns limiter of metadata requests from guests on
+// the bridge.  It is created before the metadata server is started, for
+// stats to be read without racing the server
+func (h *HostLocal) newMetadataLimiter(watcher IServerWatcher) *MetadataLimiter {
+	hc := h.HostConfig
+	return NewMetadataLimiter(hc.MetadataRateLimit, hc.MetadataBurst, hc.MetadataConcurrency,
+		func(ip string) *MetadataGuest {
+			return watcher.FindMetadataGuestByHostLocalIp(h, ip)
+		},
+	)
+}
+
+// HostLocalMetadataStats returns counters of metadata requests from guests,
+// keyed by bridge and guest id
+func HostLocalMetadataStats() map[string]map[string]MetadataStats {
+	r := map[string]map[string]MetadataStats{}
+	hostLocalMap.Range(func(k, v interface{}) bool {
+		h := v.(*HostLocal)
+		if h.metadataLimiter != nil {
+			r[k.(string)] = h.metadataLimiter.Stats()
+		}
+		return true
+	})
+	return r
 }
 
 type IServerWatcher interface {
 	FindGuestDescByHostLocalIp(hostLocal *HostLocal, ip string) *desc.SGuestDesc
+	FindMetadataGuestByHostLocalIp(hostLocal *HostLocal, ip string) *MetadataGuest
 }
 
 type sClassicMetadataDescGetter struct {
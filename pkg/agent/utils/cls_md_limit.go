@@ -0,0 +1,223 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"yunion.io/x/log"
+)
+
+const (
+	// metadataGuestIdle is how long counters and limiters of a guest are
+	// kept after its last request
+	metadataGuestIdle = 10 * time.Minute
+	// metadataThrottleLogInterval limits how often throttling of a guest
+	// is logged
+	metadataThrottleLogInterval = time.Minute
+)
+
+// MetadataGuest identifies the guest a metadata request comes from
+type MetadataGuest struct {
+	Id string
+	// Paths are metadata paths the guest may access.  Empty for all
+	Paths []string
+}
+
+// AllowPath returns true if the guest may access metadata path p.  A path
+// is allowed if it equals or is under one of Paths
+func (mg *MetadataGuest) AllowPath(p string) bool {
+	if len(mg.Paths) == 0 {
+		return true
+	}
+	for _, allowed := range mg.Paths {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if p == allowed || strings.HasPrefix(p, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataStats counts metadata requests of a guest
+type MetadataStats struct {
+	Requests  uint64
+	Throttled uint64
+	Denied    uint64
+	Errors    uint64
+}
+
+type metadataGuestLimit struct {
+	limiter  *rate.Limiter
+	inflight int
+	lastSeen time.Time
+	lastLog  time.Time
+	stats    MetadataStats
+}
+
+// MetadataLimiter limits rate and concurrency of metadata requests per
+// guest, and counts them
+type MetadataLimiter struct {
+	rate        rate.Limit
+	burst       int
+	concurrency int
+	lookup      func(ip string) *MetadataGuest
+
+	mu        sync.Mutex
+	guests    map[string]*metadataGuestLimit
+	lastPrune time.Time
+}
+
+// NewMetadataLimiter returns limiter allowing ratePerSec requests per
+// second with burst, and concurrency requests at a time for each guest.
+// Zero for no limit.  lookup finds guest by source ip of requests
+func NewMetadataLimiter(ratePerSec float64, burst, concurrency int, lookup func(ip string) *MetadataGuest) *MetadataLimiter {
+	l := &MetadataLimiter{
+		rate:        rate.Inf,
+		burst:       burst,
+		concurrency: concurrency,
+		lookup:      lookup,
+		guests:      map[string]*metadataGuestLimit{},
+	}
+	if ratePerSec > 0 {
+		l.rate = rate.Limit(ratePerSec)
+		if l.burst <= 0 {
+			l.burst = 1
+		}
+	}
+	return l
+}
+
+func (l *MetadataLimiter) guestLimit(id string, now time.Time) *metadataGuestLimit {
+	if now.Sub(l.lastPrune) > metadataGuestIdle {
+		for gid, gl := range l.guests {
+			if gl.inflight == 0 && now.Sub(gl.lastSeen) > metadataGuestIdle {
+				delete(l.guests, gid)
+			}
+		}
+		l.lastPrune = now
+	}
+	gl, ok := l.guests[id]
+	if !ok {
+		gl = &metadataGuestLimit{
+			limiter: rate.NewLimiter(l.rate, l.burst),
+		}
+		l.guests[id] = gl
+	}
+	gl.lastSeen = now
+	return gl
+}
+
+// acquire returns false if the guest is over its limits
+func (l *MetadataLimiter) acquire(id string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	gl := l.guestLimit(id, now)
+	gl.stats.Requests += 1
+	if (l.concurrency > 0 && gl.inflight >= l.concurrency) || !gl.limiter.AllowN(now, 1) {
+		gl.stats.Throttled += 1
+		if now.Sub(gl.lastLog) > metadataThrottleLogInterval {
+			gl.lastLog = now
+			log.Warningf("metadata: guest %s throttled, %d of %d requests so far", id, gl.stats.Throttled, gl.stats.Requests)
+		}
+		return false
+	}
+	gl.inflight += 1
+	return true
+}
+
+func (l *MetadataLimiter) release(id string, status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	gl := l.guestLimit(id, time.Now())
+	gl.inflight -= 1
+	if status >= 500 {
+		gl.stats.Errors += 1
+	}
+}
+
+func (l *MetadataLimiter) deny(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	gl := l.guestLimit(id, time.Now())
+	gl.stats.Requests += 1
+	gl.stats.Denied += 1
+}
+
+// Stats returns counters of guests seen recently, keyed by guest id
+func (l *MetadataLimiter) Stats() map[string]MetadataStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := make(map[string]MetadataStats, len(l.guests))
+	for id, gl := range l.guests {
+		r[id] = gl.stats
+	}
+	return r
+}
+
+type metadataStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *metadataStatusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metadataStatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Handler returns handler checking requests against limits and allowed
+// paths of their guest before passing them to next.  Requests from unknown
+// sources are passed as is
+func (l *MetadataLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mg := l.lookup(ip)
+		if mg == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !mg.AllowPath(r.URL.Path) {
+			l.deny(mg.Id)
+			http.Error(w, "metadata path not allowed", http.StatusForbidden)
+			return
+		}
+		if !l.acquire(mg.Id) {
+			http.Error(w, "too many metadata requests", http.StatusTooManyRequests)
+			return
+		}
+		sw := &metadataStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			l.release(mg.Id, sw.status)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
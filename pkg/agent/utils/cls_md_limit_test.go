@@ -0,0 +1,117 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataGuestAllowPath(t *testing.T) {
+	mg := &MetadataGuest{Paths: []string{"/latest/meta-data/", "/monitor"}}
+	cases := map[string]bool{
+		"/latest/meta-data":          true,
+		"/latest/meta-data/hostname": true,
+		"/latest/meta-datax":         false,
+		"/latest/user-data":          false,
+		"/monitor/write":             true,
+	}
+	for p, want := range cases {
+		if got := mg.AllowPath(p); got != want {
+			t.Errorf("path %s: want %v, got %v", p, want, got)
+		}
+	}
+	if !(&MetadataGuest{}).AllowPath("/latest/user-data") {
+		t.Errorf("empty paths should allow all")
+	}
+}
+
+func TestMetadataLimiter(t *testing.T) {
+	guests := map[string]*MetadataGuest{
+		"100.64.0.1": {Id: "g1"},
+		"100.64.0.2": {Id: "g2", Paths: []string{"/latest/meta-data"}},
+	}
+	lookup := func(ip string) *MetadataGuest {
+		return guests[ip]
+	}
+	do := func(h http.Handler, ip, p string) int {
+		r := httptest.NewRequest("GET", p, nil)
+		r.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("rate", func(t *testing.T) {
+		l := NewMetadataLimiter(0.001, 2, 0, lookup)
+		h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for i, want := range []int{200, 200, 429} {
+			if got := do(h, "100.64.0.1", "/latest/meta-data"); got != want {
+				t.Errorf("request %d: want %d, got %d", i, want, got)
+			}
+		}
+		// other guests are not affected
+		if got := do(h, "100.64.0.2", "/latest/meta-data"); got != 200 {
+			t.Errorf("other guest: want 200, got %d", got)
+		}
+		// unknown sources are passed
+		if got := do(h, "100.64.0.3", "/latest/meta-data"); got != 200 {
+			t.Errorf("unknown source: want 200, got %d", got)
+		}
+		want := MetadataStats{Requests: 3, Throttled: 1}
+		if got := l.Stats()["g1"]; got != want {
+			t.Errorf("want stats %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		l := NewMetadataLimiter(0, 0, 1, lookup)
+		var h http.Handler
+		inner := 0
+		h = l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner += 1
+			if inner == 1 {
+				// a second request while the first one is in flight
+				if got := do(h, "100.64.0.1", "/latest/meta-data"); got != 429 {
+					t.Errorf("concurrent request: want 429, got %d", got)
+				}
+			}
+		}))
+		if got := do(h, "100.64.0.1", "/latest/meta-data"); got != 200 {
+			t.Errorf("want 200, got %d", got)
+		}
+		if got := do(h, "100.64.0.1", "/latest/meta-data"); got != 200 {
+			t.Errorf("after release: want 200, got %d", got)
+		}
+	})
+
+	t.Run("paths and errors", func(t *testing.T) {
+		l := NewMetadataLimiter(0, 0, 0, lookup)
+		h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		if got := do(h, "100.64.0.2", "/latest/user-data"); got != 403 {
+			t.Errorf("disallowed path: want 403, got %d", got)
+		}
+		if got := do(h, "100.64.0.2", "/latest/meta-data/hostname"); got != 500 {
+			t.Errorf("allowed path: want 500, got %d", got)
+		}
+		want := MetadataStats{Requests: 2, Denied: 1, Errors: 1}
+		if got := l.Stats()["g2"]; got != want {
+			t.Errorf("want stats %+v, got %+v", want, got)
+		}
+	})
+}
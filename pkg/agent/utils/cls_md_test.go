@@ -15,7 +15,10 @@
 package utils
 
 import (
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	"yunion.io/x/pkg/util/netutils"
 )
@@ -106,3 +109,21 @@ func TestFakeMdSrcIp6Mac(t *testing.T) {
 		}
 	}
 }
+
+func TestWaitTcpListening(t *testing.T) {
+	port, err := freeLoopbackPort()
+	if err != nil {
+		t.Fatalf("free loopback port: %v", err)
+	}
+	if err := waitTcpListening("127.0.0.1", port, 100*time.Millisecond); err == nil {
+		t.Fatalf("port %d: want error before listening", port)
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	if err := waitTcpListening("127.0.0.1", port, time.Second); err != nil {
+		t.Fatalf("port %d: %v", port, err)
+	}
+}
@@ -15,30 +15,70 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 )
 
+// ZoneMan allocates ct zones to macs.  It is safe for concurrent use.
+//
+// Allocations are saved to file when loaded from there, so that macs get
+// the same zones after restart, no matter in which order hash collisions
+// are resolved.  Zones reserved for others are skipped
 type ZoneMan struct {
+	mu   sync.Mutex
 	zm   map[string]uint16
 	zmr  map[uint16]string
 	base uint16
+
+	// path is the file allocations are saved to.  Empty for not saving
+	path string
+	// stale are macs loaded from file and not allocated since then
+	stale map[string]bool
+	// reserved are zones used by others, keyed by offset from base, with
+	// their owners
+	reserved map[uint16]string
+}
+
+// CtZone is a zone allocated to mac, or used by owner other than us
+type CtZone struct {
+	Zone  uint16
+	MAC   string
+	Owner string
+	// Stale is true for zones loaded from file and not allocated since
+	Stale bool
 }
 
 func NewZoneMan(base uint16) *ZoneMan {
 	return &ZoneMan{
-		zm:   map[string]uint16{},
-		zmr:  map[uint16]string{},
-		base: base,
+		zm:       map[string]uint16{},
+		zmr:      map[uint16]string{},
+		base:     base,
+		stale:    map[string]bool{},
+		reserved: map[uint16]string{},
 	}
 }
 
 func (zm *ZoneMan) AllocateZoneId(mac string) (uint16, error) {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
 	if i, ok := zm.zm[mac]; ok {
+		delete(zm.stale, mac)
 		return zm.base + i, nil
 	}
 	total := (1 << 16) - uint32(zm.base)
-	if len(zm.zm) >= int(total) {
+	if len(zm.zm)+len(zm.reserved) >= int(total) {
 		return 0, errors.New("id depleted")
 	}
 	h := fnv.New32()
@@ -46,9 +86,12 @@ func (zm *ZoneMan) AllocateZoneId(mac string) (uint16, error) {
 	i := uint16(h.Sum32() % total)
 	j := i
 	for {
-		if _, ok := zm.zmr[i]; !ok {
+		_, used := zm.zmr[i]
+		_, reserved := zm.reserved[i]
+		if !used && !reserved {
 			zm.zmr[i] = mac
 			zm.zm[mac] = i
+			zm.save()
 			return zm.base + i, nil
 		}
 		i = (i + 1) % uint16(total)
@@ -60,10 +103,208 @@ func (zm *ZoneMan) AllocateZoneId(mac string) (uint16, error) {
 }
 
 func (zm *ZoneMan) FreeZoneId(mac string) bool {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
 	if i, ok := zm.zm[mac]; ok {
 		delete(zm.zm, mac)
 		delete(zm.zmr, i)
+		delete(zm.stale, mac)
+		zm.save()
 		return true
 	}
 	return false
 }
+
+// Load reads allocations from file at path, and saves them there from now
+// on.  Missing file is not an error
+func (zm *ZoneMan) Load(path string) error {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+	zm.path = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	zones := map[string]uint16{}
+	if err := json.Unmarshal(data, &zones); err != nil {
+		return fmt.Errorf("parse %s: %v", path, err)
+	}
+	for mac, zone := range zones {
+		if zone < zm.base {
+			continue
+		}
+		i := zone - zm.base
+		if _, ok := zm.zm[mac]; ok {
+			continue
+		}
+		if _, ok := zm.zmr[i]; ok {
+			continue
+		}
+		zm.zm[mac] = i
+		zm.zmr[i] = mac
+		zm.stale[mac] = true
+	}
+	return nil
+}
+
+// save writes allocations to file.  It is called with zm.mu held
+func (zm *ZoneMan) save() {
+	if zm.path == "" {
+		return
+	}
+	zones := map[string]uint16{}
+	for mac, i := range zm.zm {
+		zones[mac] = zm.base + i
+	}
+	data, err := json.Marshal(zones)
+	if err != nil {
+		log.Errorf("ct zones: marshal: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(zm.path), 0755); err != nil {
+		log.Errorf("ct zones: mkdir: %v", err)
+		return
+	}
+	tmp := zm.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Errorf("ct zones: write %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, zm.path); err != nil {
+		log.Errorf("ct zones: rename %s: %v", tmp, err)
+	}
+}
+
+// FreeStale frees zones loaded from file and not allocated since then, and
+// returns their macs.  It is meant to be called once all guests are loaded
+func (zm *ZoneMan) FreeStale() []string {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+	macs := []string{}
+	for mac := range zm.stale {
+		i := zm.zm[mac]
+		delete(zm.zm, mac)
+		delete(zm.zmr, i)
+		macs = append(macs, mac)
+	}
+	zm.stale = map[string]bool{}
+	if len(macs) > 0 {
+		zm.save()
+	}
+	sort.Strings(macs)
+	return macs
+}
+
+// Reserve sets zones used by others, keyed by zone with their owners, so
+// that they are not allocated.  Allocations colliding with them are freed,
+// and their macs returned for reallocation
+func (zm *ZoneMan) Reserve(zones map[uint16]string) []string {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+	zm.reserved = map[uint16]string{}
+	macs := []string{}
+	for zone, owner := range zones {
+		if zone < zm.base {
+			continue
+		}
+		i := zone - zm.base
+		zm.reserved[i] = owner
+		if mac, ok := zm.zmr[i]; ok {
+			delete(zm.zm, mac)
+			delete(zm.zmr, i)
+			delete(zm.stale, mac)
+			macs = append(macs, mac)
+		}
+	}
+	if len(macs) > 0 {
+		zm.save()
+	}
+	sort.Strings(macs)
+	return macs
+}
+
+// Zones returns zones allocated and reserved, ordered by zone
+func (zm *ZoneMan) Zones() []CtZone {
+	zm.mu.Lock()
+	defer zm.mu.Unlock()
+	zones := []CtZone{}
+	for mac, i := range zm.zm {
+		zones = append(zones, CtZone{
+			Zone:  zm.base + i,
+			MAC:   mac,
+			Stale: zm.stale[mac],
+		})
+	}
+	for i, owner := range zm.reserved {
+		zones = append(zones, CtZone{
+			Zone:  zm.base + i,
+			Owner: owner,
+		})
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].Zone < zones[j].Zone
+	})
+	return zones
+}
+
+// ovsCtZonePrefix prefixes keys of zones ovn-controller records in
+// external_ids of the integration bridge, e.g. ct-zone-<logical port>
+const ovsCtZonePrefix = "ct-zone-"
+
+// FetchOvsCtZones returns ct zones recorded in external_ids of bridges,
+// with owners in the form of "<bridge>:<key>"
+func FetchOvsCtZones(ctx context.Context) (map[uint16]string, error) {
+	args := []string{
+		"ovs-vsctl", "--format=json", "--columns=name,external_ids", "list", "Bridge",
+	}
+	output, err := ExecOvsctl(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseOvsCtZones(output)
+}
+
+func parseOvsCtZones(output []byte) (map[uint16]string, error) {
+	ret := map[uint16]string{}
+	obj, err := jsonutils.Parse(output)
+	if err != nil {
+		return nil, fmt.Errorf("parse bridge output: %v", err)
+	}
+	dataList, err := obj.GetArray("data")
+	if err != nil {
+		return nil, fmt.Errorf("get data list: %v", err)
+	}
+	// ["br-int",["map",[["ct-zone-lsp0","1"],["ovn-nb-cfg","5"]]]]
+	for i := range dataList {
+		data, err := dataList[i].GetArray()
+		if err != nil || len(data) < 2 {
+			return nil, fmt.Errorf("get data at %d: %v", i, err)
+		}
+		bridge, _ := data[0].GetString()
+		m, err := data[1].GetArray()
+		if err != nil || len(m) < 2 {
+			continue
+		}
+		pairs, _ := m[1].GetArray()
+		for _, pair := range pairs {
+			kv, _ := pair.GetArray()
+			if len(kv) < 2 {
+				continue
+			}
+			k, _ := kv[0].GetString()
+			v, _ := kv[1].GetString()
+			if !strings.HasPrefix(k, ovsCtZonePrefix) {
+				continue
+			}
+			zone, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				continue
+			}
+			ret[uint16(zone)] = bridge + ":" + k
+		}
+	}
+	return ret, nil
+}
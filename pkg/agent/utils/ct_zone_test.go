@@ -17,6 +17,8 @@ package utils
 import "testing"
 import (
 	"fmt"
+	"path/filepath"
+	"reflect"
 )
 
 func TestCtZone(t *testing.T) {
@@ -57,3 +59,99 @@ func TestCtZone(t *testing.T) {
 		}
 	}
 }
+
+func TestCtZoneLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zones.json")
+	man := NewZoneMan(60000)
+	if err := man.Load(path); err != nil {
+		t.Fatalf("load missing file: %v", err)
+	}
+	macs := []string{"00:22:00:00:00:01", "00:22:00:00:00:02", "00:22:00:00:00:03"}
+	zones := map[string]uint16{}
+	for _, mac := range macs {
+		zone, err := man.AllocateZoneId(mac)
+		if err != nil {
+			t.Fatalf("allocate %s: %v", mac, err)
+		}
+		zones[mac] = zone
+	}
+
+	man2 := NewZoneMan(60000)
+	if err := man2.Load(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	// allocated in a different order, zones are kept
+	for i := len(macs) - 1; i > 0; i-- {
+		mac := macs[i]
+		zone, err := man2.AllocateZoneId(mac)
+		if err != nil {
+			t.Fatalf("allocate %s: %v", mac, err)
+		}
+		if zone != zones[mac] {
+			t.Errorf("zone of %s: want %d, got %d", mac, zones[mac], zone)
+		}
+	}
+	stale := man2.FreeStale()
+	if !reflect.DeepEqual(stale, []string{macs[0]}) {
+		t.Errorf("stale macs: want %v, got %v", macs[:1], stale)
+	}
+	if len(man2.Zones()) != 2 {
+		t.Errorf("zones after freeing stale: %#v", man2.Zones())
+	}
+
+	man3 := NewZoneMan(60000)
+	if err := man3.Load(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := man3.FreeStale(); !reflect.DeepEqual(got, macs[1:]) {
+		t.Errorf("saved macs: want %v, got %v", macs[1:], got)
+	}
+}
+
+func TestCtZoneReserve(t *testing.T) {
+	man := NewZoneMan(60000)
+	mac := "00:22:00:00:00:01"
+	zone, err := man.AllocateZoneId(mac)
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	macs := man.Reserve(map[uint16]string{
+		zone: "br-int:ct-zone-lsp0",
+		1:    "br-int:ct-zone-lsp1",
+	})
+	if !reflect.DeepEqual(macs, []string{mac}) {
+		t.Errorf("colliding macs: want %v, got %v", []string{mac}, macs)
+	}
+	zone2, err := man.AllocateZoneId(mac)
+	if err != nil {
+		t.Fatalf("allocate again: %v", err)
+	}
+	if zone2 == zone {
+		t.Errorf("reserved zone %d allocated", zone)
+	}
+	want := []CtZone{
+		{Zone: zone, Owner: "br-int:ct-zone-lsp0"},
+		{Zone: zone2, MAC: mac},
+	}
+	if zone2 < zone {
+		want[0], want[1] = want[1], want[0]
+	}
+	if got := man.Zones(); !reflect.DeepEqual(got, want) {
+		t.Errorf("zones: want %#v, got %#v", want, got)
+	}
+}
+
+func TestParseOvsCtZones(t *testing.T) {
+	output := `{"data":[["br-int",["map",[["ct-zone-lsp0","60001"],["ct-zone-lsp1_dnat","3"],["ovn-nb-cfg","5"]]]],["br0",["map",[]]]],"headings":["name","external_ids"]}`
+	zones, err := parseOvsCtZones([]byte(output))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := map[uint16]string{
+		60001: "br-int:ct-zone-lsp0",
+		3:     "br-int:ct-zone-lsp1_dnat",
+	}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("want %v, got %v", want, zones)
+	}
+}
@@ -15,11 +15,26 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/digitalocean/go-openvswitch/ovs"
 )
 
+// marshalFlows returns text of flows, one per line
+func marshalFlows(t *testing.T, flows []*ovs.Flow) string {
+	t.Helper()
+	lines := []string{}
+	for _, f := range flows {
+		txt, err := f.MarshalText()
+		if err != nil {
+			t.Fatalf("marshal flow: %v", err)
+		}
+		lines = append(lines, string(txt))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func TestFlowSet(t *testing.T) {
 	flowStrs := []string{
 		`priority=24770,ipv6,dl_dst=00:22:1b:04:95:b3,ipv6_dst=fc00:0:1:1004:ac1f:68f2:1b04:95b3,table=0,idle_timeout=0,actions=load:0xf2e5->NXM_NX_REG0[0..15],ct(table=1,zone=62181)`,
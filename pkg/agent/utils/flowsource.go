@@ -30,7 +30,6 @@ import (
 	"yunion.io/x/pkg/util/netutils"
 	"yunion.io/x/pkg/util/stringutils"
 
-	"yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/util/iproute2"
 	"yunion.io/x/onecloud/pkg/util/netutils2"
 )
@@ -234,6 +233,18 @@ func (h *HostLocal) FlowsMap() (map[string][]*ovs.Flow, error) {
 			// 其他 drop
 			F(9, 1000, "", "drop"),
 		)
+		// the same for sctp and ipv6 port mappings
+		for _, proto := range []string{"sctp", "tcp6", "udp6", "sctp6"} {
+			flows = append(flows,
+				F(9, 40000, proto+",ct_state=-trk", "ct(table=9)"),
+				F(9, 31000, "reg0=0x4,"+proto+",ct_state=+new+trk", "drop"),
+				F(9, 30000, "reg0=0x1,"+proto+",ct_state=+new+trk", "ct(commit),output:NXM_NX_REG1[]"),
+				F(9, 30000, "reg0=0x2,"+proto+",ct_state=+new+trk", "ct(commit),local"),
+				F(9, 20002, "reg0=0x4,"+proto+",ct_state=+est+trk", "resubmit(,10)"),
+				F(9, 10000, "reg0=0x1,"+proto+",ct_state=+est+trk", "output:NXM_NX_REG1[]"),
+				F(9, 10000, "reg0=0x2,"+proto+",ct_state=+est+trk", "local"),
+			)
+		}
 	} else {
 		flows = append(flows,
 			F(10, 1000, "", "drop"),
@@ -375,137 +386,198 @@ func ip6ToHex(ip6str string) string {
 	return stringutils.Bytes2Str(ip6[0:16])
 }
 
-func guestNicPortMappingFlows(nic *GuestNIC, nicPortNo int, nicIP string, nicMAC string, phyPortNo int, vlanMatch string) []*ovs.Flow {
+func guestNicPortMappingFlows(nic *GuestNIC, nicPortNo int, nicMAC string, hcn *HostConfigNetwork, phyPortNo int, vlanMatch string) []*ovs.Flow {
 	flows := make([]*ovs.Flow, 0, 128)
+	hostMAC := ""
+	if hcn.mac != nil {
+		hostMAC = hcn.mac.String()
+	}
 	for _, pm := range nic.PortMappings {
-		flows = append(flows, eachGuestNicPortMappingFlows(pm, nicPortNo, nicIP, nicMAC, phyPortNo, vlanMatch)...)
+		if nic.EnableIPv4() {
+			flows = append(flows, eachGuestNicPortMappingFlows(pm, portMappingIPv4, nicPortNo, nic.IP, hcn.IpAddr(), hostMAC, nicMAC, phyPortNo, vlanMatch)...)
+		}
+		if nic.EnableIPv6() {
+			flows = append(flows, eachGuestNicPortMappingFlows(pm, portMappingIPv6, nicPortNo, nic.IP6, hcn.Ip6Addr(), hostMAC, nicMAC, phyPortNo, vlanMatch)...)
+		}
 	}
 	return flows
 }
 
-func eachGuestNicPortMappingFlows(pm *compute.GuestPortMapping, nicPortNo int, nicIP string, nicMAC string, phyPortNo int, vlanMatch string) []*ovs.Flow {
+func eachGuestNicPortMappingFlows(pm *GuestPortMapping, fam *portMappingFamily, nicPortNo int, nicIP string, hostIP string, hostMAC string, nicMAC string, phyPortNo int, vlanMatch string) []*ovs.Flow {
 	flows := make([]*ovs.Flow, 0, 16)
-	if len(pm.RemoteIps) == 0 {
-		pm.RemoteIps = []string{"0.0.0.0/0"}
+	remoteNets := fam.remoteNets(pm.RemoteIps)
+	if len(remoteNets) == 0 {
+		return flows
+	}
+	pp := getPortMappingProto(pm.Protocol)
+	protoMatch := pp.match(fam)
+	dstIpStr := ""
+	if hostIP != "" && fam == portMappingIPv6 {
+		// ipv4 mappings take over the port of all destinations
+		dstIpStr = fmt.Sprintf("%s=%s,", fam.nwDst, hostIP)
+	}
+	nicPortNoStr := fmt.Sprintf("%d", nicPortNo)
+	if nicPortNo < 0 {
+		nicPortNoStr = "LOCAL"
 	}
-	for _, remoteNet := range pm.RemoteIps {
-		srcIpStr := ""
-		if remoteNet != "0.0.0.0/0" {
-			srcIpStr = fmt.Sprintf("nw_src=%s,", remoteNet)
+	// hairpin from guests on the same bridge, to the host address
+	hairpin := nicPortNo >= 0 && hostIP != "" && hostMAC != ""
+	for _, port := range pm.ports() {
+		learnMatch := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=%s,eth_type=%s,%s=%s,%s=%s,nw_proto=%d,%s", nicPortNoStr, fam.ethType, fam.nwSrc, nicIP, fam.nxmIpDst, fam.nxmIpSrc, pp.num, pp.learnPortMatch(port))
+		learnStr1 := learnMatch + fmt.Sprintf("load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],load:%s->%s,load:%s->%s,output:NXM_OF_IN_PORT[]", fam.nxmIpDst, fam.nxmIpSrc, pp.nxmDst, pp.nxmSrc)
+		learnStr2 := learnMatch + "output:NXM_OF_IN_PORT[]"
+		dnatActs := fmt.Sprintf("mod_dl_dst:%s,%s", nicMAC, fam.modNwDst(nicIP))
+		if port.dnatPort > 0 {
+			dnatActs += fmt.Sprintf(",mod_tp_dst:%d", port.dnatPort)
 		}
-		protoNum := 6
-		var tpSrcField string
-		var tpDstMatch string
-		var nxmTpSrc string
-		var nxmTpDst string
-		switch pm.Protocol {
-		case "udp":
-			protoNum = 17
-			tpSrcField = "udp_src"
-			tpDstMatch = "NXM_OF_UDP_DST[]=NXM_OF_UDP_SRC[]"
-			nxmTpSrc = "NXM_OF_UDP_SRC[]"
-			nxmTpDst = "NXM_OF_UDP_DST[]"
-		default:
-			// tcp
-			protoNum = 6
-			tpSrcField = "tcp_src"
-			tpDstMatch = "NXM_OF_TCP_DST[]=NXM_OF_TCP_SRC[]"
-			nxmTpSrc = "NXM_OF_TCP_SRC[]"
-			nxmTpDst = "NXM_OF_TCP_DST[]"
+		for _, remoteNet := range remoteNets {
+			srcIpStr := fam.srcMatch(remoteNet)
+			if nicPortNo < 0 {
+				// to ports on hostlocal bridge
+				flows = append(flows,
+					// 外部访问的流量, 需要DNAT, reg0=1
+					F(0, 28200, fmt.Sprintf("%s,%s%stp_dst=%s", protoMatch, srcIpStr, dstIpStr, port.hostPort), fmt.Sprintf("learn(table=10,%s),load:0x2->NXM_NX_REG0[],%s,resubmit(,9)", learnStr1, dnatActs)),
+					// 外部直接访问的流量，不需要DNAT，reg0=2
+					F(0, 28205, fmt.Sprintf("%s,%s%s=%s,tp_dst=%s", protoMatch, srcIpStr, fam.nwDst, nicIP, port.guestPort), fmt.Sprintf("learn(table=10,%s),load:0x2->NXM_NX_REG0[],resubmit(,9)", learnStr2)),
+				)
+			} else {
+				// to local port
+				flows = append(flows,
+					// 外部访问的流量, 需要DNAT, reg0=1
+					F(0, 28200, fmt.Sprintf("in_port=%d,%s,%s%stp_dst=%s", phyPortNo, protoMatch, srcIpStr, dstIpStr, port.hostPort), fmt.Sprintf("learn(table=10,%s),load:0x1->NXM_NX_REG0[],load:0x%x->NXM_NX_REG1[],%s,resubmit(,9)", learnStr1, nicPortNo, dnatActs)),
+					// 外部直接访问的流量，不需要DNAT，reg0=2
+					F(0, 28205, fmt.Sprintf("in_port=%d,%s,%s%s=%s,tp_dst=%s,%s", phyPortNo, protoMatch, srcIpStr, fam.nwDst, nicIP, port.guestPort, vlanMatch), fmt.Sprintf("learn(table=10,%s),load:0x1->NXM_NX_REG0[],load:0x%x->NXM_NX_REG1[],strip_vlan,resubmit(,9)", learnStr2, nicPortNo)),
+				)
+			}
+			if hairpin {
+				flows = append(flows,
+					// 同一bridge上的其他虚拟机访问宿主机地址, 需要DNAT, reg0=1
+					// only for sources validated by guestNicHairpinSrcFlows
+					F(0, 28190, fmt.Sprintf("%s,%s%s=%s,tp_dst=%s,reg0=0x20000/0x20000", protoMatch, srcIpStr, fam.nwDst, hostIP, port.hostPort), fmt.Sprintf("learn(table=10,%s),load:0x1->NXM_NX_REG0[],load:0x%x->NXM_NX_REG1[],%s,resubmit(,9)", learnStr1, nicPortNo, dnatActs)),
+					// 访问自身映射端口, 需要DNAT和SNAT, reg0=1
+					guestNicPortMappingHairpinFlow(pp, fam, port, nicPortNo, nicIP, hostIP, srcIpStr, fmt.Sprintf("load:0x1->NXM_NX_REG0[],load:0x%x->NXM_NX_REG1[],mod_dl_src:%s,%s", nicPortNo, hostMAC, dnatActs), "resubmit(,9)"),
+				)
+			}
 		}
-
-		if nicPortNo < 0 {
-			learnStr1 := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=LOCAL,eth_type=0x0800,nw_src=%s,NXM_OF_IP_DST[]=NXM_OF_IP_SRC[],nw_proto=%d,%s=%d,%s,load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],load:NXM_OF_IP_DST[]->NXM_OF_IP_SRC[],load:%s->%s,output:NXM_OF_IN_PORT[]", nicIP, protoNum, tpSrcField, pm.Port, tpDstMatch, nxmTpDst, nxmTpSrc)
-			learnStr2 := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=LOCAL,eth_type=0x0800,nw_src=%s,NXM_OF_IP_DST[]=NXM_OF_IP_SRC[],nw_proto=%d,%s=%d,%s,output:NXM_OF_IN_PORT[]", nicIP, protoNum, tpSrcField, pm.Port, tpDstMatch)
-			// to ports on hostlocal bridge
-			flows = append(flows,
-				// 外部访问的流量, 需要DNAT, reg0=1
-				F(0, 28200, fmt.Sprintf("ip,%s%s,tp_dst=%d", srcIpStr, pm.Protocol, *pm.HostPort), fmt.Sprintf("learn(table=10,%s),load:0x2->NXM_NX_REG0[],mod_dl_dst:%s,mod_nw_dst:%s,mod_tp_dst:%d,resubmit(,9)", learnStr1, nicMAC, nicIP, pm.Port)),
-				// 外部直接访问的流量，不需要DNAT，reg0=2
-				F(0, 28205, fmt.Sprintf("ip,%snw_dst=%s,%s,tp_dst=%d", srcIpStr, nicIP, pm.Protocol, pm.Port), fmt.Sprintf("learn(table=10,%s),load:0x2->NXM_NX_REG0[],resubmit(,9)", learnStr2)),
-			)
-		} else {
-			learnStr1 := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=%d,eth_type=0x0800,nw_src=%s,NXM_OF_IP_DST[]=NXM_OF_IP_SRC[],nw_proto=%d,%s=%d,%s,load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],load:NXM_OF_IP_DST[]->NXM_OF_IP_SRC[],load:%s->%s,output:NXM_OF_IN_PORT[]", nicPortNo, nicIP, protoNum, tpSrcField, pm.Port, tpDstMatch, nxmTpDst, nxmTpSrc)
-			learnStr2 := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=%d,eth_type=0x0800,nw_src=%s,NXM_OF_IP_DST[]=NXM_OF_IP_SRC[],nw_proto=%d,%s=%d,%s,output:NXM_OF_IN_PORT[]", nicPortNo, nicIP, protoNum, tpSrcField, pm.Port, tpDstMatch)
-			// to local port
+		flows = append(flows,
+			// 本地流量, 直接访问，不需要DNAT, reg0=2 QIUJIAN: no local traffic, local traffic cannot go through ovs bridge
+			// F(0, 28201, fmt.Sprintf("in_port=LOCAL,ip,nw_dst=%s,%s,tp_dst=%d", nicIP, pm.Protocol, pm.Port), "load:0x2->NXM_NX_REG0[],resubmit(,9)"),
+			// 返回流量, reg0=4
+			F(0, 28202, fmt.Sprintf("in_port=%s,%s,%s=%s,tp_src=%s", nicPortNoStr, protoMatch, fam.nwSrc, nicIP, port.guestPort), "load:0x4->NXM_NX_REG0[],resubmit(,9)"),
+		)
+		if hairpin {
 			flows = append(flows,
-				// 外部访问的流量, 需要DNAT, reg0=1
-				// F(0, 28200, fmt.Sprintf("in_port=%d,ip,%s%s,tp_dst=%d", portNoPhy, srcIpStr, pm.Protocol, *pm.HostPort), fmt.Sprintf("learn(%s),load:0x1->NXM_NX_REG0[],mod_dl_dst:%s,mod_nw_dst:%s,mod_tp_dst:%d,resubmit(,9)", learnStr, nicMAC, nicIP, pm.Port)),
-				F(0, 28200, fmt.Sprintf("in_port=%d,ip,%s%s,tp_dst=%d", phyPortNo, srcIpStr, pm.Protocol, *pm.HostPort), fmt.Sprintf("learn(table=10,%s),load:0x1->NXM_NX_REG0[],load:0x%x->NXM_NX_REG1[],mod_dl_dst:%s,mod_nw_dst:%s,mod_tp_dst:%d,resubmit(,9)", learnStr1, nicPortNo, nicMAC, nicIP, pm.Port)),
-				// 外部直接访问的流量，不需要DNAT，reg0=2
-				// F(0, 28205, fmt.Sprintf("in_port=%d,ip,%snw_dst=%s,%s,tp_dst=%d", portNoPhy, srcIpStr, nicIP, pm.Protocol, pm.Port), "load:0x2->NXM_NX_REG0[],resubmit(,9)"),
-				F(0, 28205, fmt.Sprintf("in_port=%d,ip,%snw_dst=%s,%s,tp_dst=%d,%s", phyPortNo, srcIpStr, nicIP, pm.Protocol, pm.Port, vlanMatch), fmt.Sprintf("learn(table=10,%s),load:0x1->NXM_NX_REG0[],load:0x%x->NXM_NX_REG1[],strip_vlan,resubmit(,9)", learnStr2, nicPortNo)),
+				// 访问自身映射端口的返回流量, reg0=4
+				F(0, 28203, fmt.Sprintf("in_port=%d,%s,%s=%s,%s=%s,tp_src=%s", nicPortNo, protoMatch, fam.nwSrc, nicIP, fam.nwDst, hostIP, port.guestPort), "load:0x4->NXM_NX_REG0[],load:0->NXM_OF_IN_PORT[],resubmit(,9)"),
 			)
 		}
+	}
+	return flows
+}
+
+// guestNicPortMappingHairpinFlow returns flow for the guest accessing its
+// own port mapping.  Source address is translated to the host address so
+// that replies come back through the mapping, in_port is cleared to allow
+// sending back to the same port
+func guestNicPortMappingHairpinFlow(pp *portMappingProto, fam *portMappingFamily, port portMappingPort, nicPortNo int, nicIP string, hostIP string, srcIpStr string, natActs string, outputAct string) *ovs.Flow {
+	learnStr := fmt.Sprintf("priority=10000,idle_timeout=300,eth_type=%s,%s=%s,%s=%s,nw_proto=%d,%sload:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],load:%s->%s,load:%s->%s,load:%s->%s,output:NXM_OF_IN_PORT[]", fam.ethType, fam.nwSrc, nicIP, fam.nwDst, hostIP, pp.num, pp.learnPortMatch(port), fam.nxmIpDst, fam.nxmIpSrc, fam.nxmIpSrc, fam.nxmIpDst, pp.nxmDst, pp.nxmSrc)
+	return F(0, 28201,
+		fmt.Sprintf("in_port=%d,%s,%s%s=%s,tp_dst=%s", nicPortNo, pp.match(fam), srcIpStr, fam.nwDst, hostIP, port.hostPort),
+		fmt.Sprintf("learn(table=10,%s),%s,%s,load:0->NXM_OF_IN_PORT[],%s", learnStr, natActs, fam.modNwSrc(hostIP), outputAct),
+	)
+}
 
+// guestNicHairpinSrcFlows returns flows marking traffic of the guest nic to
+// the host address with reg0[17] if it is from the port, mac, and with source
+// ip check, ip addresses of the nic.  Only marked traffic is taken by hairpin
+// flows of port mappings on the same bridge
+func guestNicHairpinSrcFlows(nic *GuestNIC, hcn *HostConfigNetwork, srcIpCheck bool) []*ovs.Flow {
+	flows := []*ovs.Flow{}
+	each := func(fam *portMappingFamily, hostIP string, nicIPs []string) {
+		if hostIP == "" {
+			return
+		}
+		if !srcIpCheck {
+			nicIPs = []string{""}
+		}
+		for _, nicIP := range nicIPs {
+			srcIpStr := ""
+			if nicIP != "" {
+				srcIpStr = fmt.Sprintf("%s=%s,", fam.nwSrc, nicIP)
+			}
+			flows = append(flows, F(0, 28195,
+				fmt.Sprintf("in_port=%d,dl_src=%s,%s,%s%s=%s,reg0=0x0/0x20000", nic.PortNo, nic.MAC, fam.match, srcIpStr, fam.nwDst, hostIP),
+				// again in the current table, i.e. table 0
+				fmt.Sprintf("load:0x1->NXM_NX_REG0[17],resubmit(%d,)", nic.PortNo),
+			))
+		}
 	}
-	nicPortNoStr := fmt.Sprintf("%d", nicPortNo)
-	if nicPortNo < 0 {
-		nicPortNoStr = "LOCAL"
+	if nic.EnableIPv4() {
+		each(portMappingIPv4, hcn.IpAddr(), append([]string{nic.IP}, nic.SubIPs()...))
+	}
+	if nic.EnableIPv6() {
+		each(portMappingIPv6, hcn.Ip6Addr(), append([]string{nic.IP6}, nic.SubIP6s()...))
 	}
-	flows = append(flows,
-		// 本地流量, 直接访问，不需要DNAT, reg0=2 QIUJIAN: no local traffic, local traffic cannot go through ovs bridge
-		// F(0, 28201, fmt.Sprintf("in_port=LOCAL,ip,nw_dst=%s,%s,tp_dst=%d", nicIP, pm.Protocol, pm.Port), "load:0x2->NXM_NX_REG0[],resubmit(,9)"),
-		// 返回流量, reg0=4
-		F(0, 28202, fmt.Sprintf("in_port=%s,ip,nw_src=%s,%s,tp_src=%d", nicPortNoStr, nicIP, pm.Protocol, pm.Port), "load:0x4->NXM_NX_REG0[],resubmit(,9)"),
-	)
 	return flows
 }
 
-func guestNicPortMappingFlowsLocal(nic *GuestNIC, masterIp string, gwMAC string, nicPortNo int, nicIP string, nicMAC string) []*ovs.Flow {
+func guestNicPortMappingFlowsLocal(nic *GuestNIC, masterIp string, masterIp6 string, gwMAC string, nicPortNo int, nicMAC string) []*ovs.Flow {
 	flows := make([]*ovs.Flow, 0, 128)
 	for _, pm := range nic.PortMappings {
-		flows = append(flows, eachGuestNicPortMappingFlowsLocal(pm, masterIp, gwMAC, nicPortNo, nicIP, nicMAC)...)
+		if nic.EnableIPv4() {
+			flows = append(flows, eachGuestNicPortMappingFlowsLocal(pm, portMappingIPv4, masterIp, gwMAC, nicPortNo, nic.IP, nicMAC)...)
+		}
+		if nic.EnableIPv6() {
+			flows = append(flows, eachGuestNicPortMappingFlowsLocal(pm, portMappingIPv6, masterIp6, gwMAC, nicPortNo, nic.IP6, nicMAC)...)
+		}
 	}
 	return flows
 }
 
-func eachGuestNicPortMappingFlowsLocal(pm *compute.GuestPortMapping, masterIp string, gwMAC string, nicPortNo int, nicIP string, nicMAC string) []*ovs.Flow {
+func eachGuestNicPortMappingFlowsLocal(pm *GuestPortMapping, fam *portMappingFamily, masterIp string, gwMAC string, nicPortNo int, nicIP string, nicMAC string) []*ovs.Flow {
 	flows := make([]*ovs.Flow, 0, 16)
-	if len(pm.RemoteIps) == 0 {
-		pm.RemoteIps = []string{"0.0.0.0/0"}
+	remoteNets := fam.remoteNets(pm.RemoteIps)
+	if len(remoteNets) == 0 {
+		return flows
 	}
-	for _, remoteNet := range pm.RemoteIps {
-		srcIpStr := ""
-		if remoteNet != "0.0.0.0/0" {
-			srcIpStr = fmt.Sprintf("nw_src=%s,", remoteNet)
+	pp := getPortMappingProto(pm.Protocol)
+	protoMatch := pp.match(fam)
+	for _, port := range pm.ports() {
+		learnMatch := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=%d,eth_type=%s,%s=%s,%s=%s,nw_proto=%d,%s", nicPortNo, fam.ethType, fam.nwSrc, nicIP, fam.nxmIpDst, fam.nxmIpSrc, pp.num, pp.learnPortMatch(port))
+		learnStr1 := learnMatch + fmt.Sprintf("load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],load:%s->%s,load:%s->%s,load:%s->%s,load:%s->%s,output:NXM_OF_IN_PORT[]", fam.nxmIpDst, fam.nxmIpSrc, fam.nxmIpSrc, fam.nxmIpDst, pp.nxmDst, pp.nxmSrc, pp.nxmSrc, pp.nxmDst)
+		learnStr2 := learnMatch + "load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],output:NXM_OF_IN_PORT[]"
+		dnatActs := fmt.Sprintf("mod_dl_src:%s,mod_dl_dst:%s,%s", gwMAC, nicMAC, fam.modNwDst(nicIP))
+		if port.dnatPort > 0 {
+			dnatActs += fmt.Sprintf(",mod_tp_dst:%d", port.dnatPort)
 		}
-		protoNum := 6
-		var tpSrcField string
-		var tpDstMatch string
-		var nxmTpSrc string
-		var nxmTpDst string
-		switch pm.Protocol {
-		case "udp":
-			protoNum = 17
-			tpSrcField = "udp_src"
-			tpDstMatch = "NXM_OF_UDP_DST[]=NXM_OF_UDP_SRC[]"
-			nxmTpSrc = "NXM_OF_UDP_SRC[]"
-			nxmTpDst = "NXM_OF_UDP_DST[]"
-		default:
-			// tcp
-			protoNum = 6
-			tpSrcField = "tcp_src"
-			tpDstMatch = "NXM_OF_TCP_DST[]=NXM_OF_TCP_SRC[]"
-			nxmTpSrc = "NXM_OF_TCP_SRC[]"
-			nxmTpDst = "NXM_OF_TCP_DST[]"
+		for _, remoteNet := range remoteNets {
+			srcIpStr := fam.srcMatch(remoteNet)
+			if masterIp != "" {
+				flows = append(flows,
+					// 只允许bridge内主机之间的互访流量
+					F(0, 28200, fmt.Sprintf("%s,%s%s=%s,tp_dst=%s", protoMatch, srcIpStr, fam.nwDst, masterIp, port.hostPort), fmt.Sprintf("learn(table=10,%s),%s,output:%d", learnStr1, dnatActs, nicPortNo)),
+					// 访问自身映射端口
+					guestNicPortMappingHairpinFlow(pp, fam, port, nicPortNo, nicIP, masterIp, srcIpStr, dnatActs, fmt.Sprintf("output:%d", nicPortNo)),
+				)
+			}
+			flows = append(flows,
+				// 外部直接访问的流量，不需要DNAT
+				F(0, 28205, fmt.Sprintf("%s,%s%s=%s,tp_dst=%s", protoMatch, srcIpStr, fam.nwDst, nicIP, port.guestPort), fmt.Sprintf("learn(table=10,%s),mod_dl_dst:%s,output:%d", learnStr2, nicMAC, nicPortNo)),
+			)
 		}
-
-		learnStr1 := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=%d,eth_type=0x0800,nw_src=%s,NXM_OF_IP_DST[]=NXM_OF_IP_SRC[],nw_proto=%d,%s=%d,%s,load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],load:NXM_OF_IP_DST[]->NXM_OF_IP_SRC[],load:NXM_OF_IP_SRC[]->NXM_OF_IP_DST[],load:%s->%s,load:%s->%s,output:NXM_OF_IN_PORT[]", nicPortNo, nicIP, protoNum, tpSrcField, pm.Port, tpDstMatch, nxmTpDst, nxmTpSrc, nxmTpSrc, nxmTpDst)
-		learnStr2 := fmt.Sprintf("priority=10000,idle_timeout=300,in_port=%d,eth_type=0x0800,nw_src=%s,NXM_OF_IP_DST[]=NXM_OF_IP_SRC[],nw_proto=%d,%s=%d,%s,load:NXM_OF_ETH_DST[]->NXM_OF_ETH_SRC[],load:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],output:NXM_OF_IN_PORT[]", nicPortNo, nicIP, protoNum, tpSrcField, pm.Port, tpDstMatch)
 		flows = append(flows,
-			// 只允许bridge内主机之间的互访流量
-			F(0, 28200, fmt.Sprintf("ip,%s%s,nw_dst=%s,tp_dst=%d", srcIpStr, pm.Protocol, masterIp, *pm.HostPort), fmt.Sprintf("learn(table=10,%s),mod_dl_src:%s,mod_dl_dst:%s,mod_nw_dst:%s,mod_tp_dst:%d,output:%d", learnStr1, gwMAC, nicMAC, nicIP, pm.Port, nicPortNo)),
-			// 外部直接访问的流量，不需要DNAT
-			F(0, 28205, fmt.Sprintf("ip,%snw_dst=%s,%s,tp_dst=%d", srcIpStr, nicIP, pm.Protocol, pm.Port), fmt.Sprintf("learn(table=10,%s),mod_dl_dst:%s,output:%d", learnStr2, nicMAC, nicPortNo)),
+			// 本地流量, 直接访问，不需要DNAT, reg0=2 QIUJIAN: no local traffic, local traffic cannot go through ovs bridge
+			// F(0, 28201, fmt.Sprintf("in_port=LOCAL,ip,nw_dst=%s,%s,tp_dst=%d", nicIP, pm.Protocol, pm.Port), "load:0x2->NXM_NX_REG0[],resubmit(,9)"),
+			// 返回流量
+			F(0, 28202, fmt.Sprintf("in_port=%d,%s,%s=%s,tp_src=%s", nicPortNo, protoMatch, fam.nwSrc, nicIP, port.guestPort), "resubmit(,10)"),
 		)
+		if masterIp != "" {
+			flows = append(flows,
+				// 访问自身映射端口的返回流量
+				F(0, 28203, fmt.Sprintf("in_port=%d,%s,%s=%s,%s=%s,tp_src=%s", nicPortNo, protoMatch, fam.nwSrc, nicIP, fam.nwDst, masterIp, port.guestPort), "load:0->NXM_OF_IN_PORT[],resubmit(,10)"),
+			)
+		}
 	}
-	flows = append(flows,
-		// 本地流量, 直接访问，不需要DNAT, reg0=2 QIUJIAN: no local traffic, local traffic cannot go through ovs bridge
-		// F(0, 28201, fmt.Sprintf("in_port=LOCAL,ip,nw_dst=%s,%s,tp_dst=%d", nicIP, pm.Protocol, pm.Port), "load:0x2->NXM_NX_REG0[],resubmit(,9)"),
-		// 返回流量
-		F(0, 28202, fmt.Sprintf("in_port=%d,ip,nw_src=%s,%s,tp_src=%d", nicPortNo, nicIP, pm.Protocol, pm.Port), "resubmit(,10)"),
-	)
 	return flows
 }
 
@@ -672,7 +744,11 @@ func (g *Guest) FlowsMapForNic(nic *GuestNIC) (map[string][]*ovs.Flow, error) {
 		F(0, 26700, T("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}}"), "normal"),
 	)
 	if !g.SrcMacCheck() {
-		flows = append(flows, F(0, 24670, T("in_port={{.PortNo}}"), "normal"))
+		if nic.HasMacLimit() {
+			flows = append(flows, guestNicMacLimitFlows(nic)...)
+		} else {
+			flows = append(flows, F(0, 24670, T("in_port={{.PortNo}}"), "normal"))
+		}
 		if nic.EnableIPv6() {
 			flows = append(flows,
 				// allow nb solicite from VM port to outside
@@ -719,23 +795,28 @@ func (g *Guest) FlowsMapForNic(nic *GuestNIC) (map[string][]*ovs.Flow, error) {
 							F(0, 27770, T2("in_port={{.PortNo}},arp,dl_src={{.MAC}},arp_sha={{.MAC}},arp_spa={{.IP}}"), "normal"),
 						)
 					})
+					flows = append(flows, guestNicVipOwnerFlows(nic, g.vipAllowIpActions(nic))...)
 				}
 			}
 			if nic.EnableIPv6() {
+				g.eachIP6(m, func(T2 func(string) string) {
+					flows = append(flows,
+						// allow nb solicitate from VM src IP to outside
+						F(0, 27774, T2("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}},icmp6,icmp_type=135"), "normal"),
+						// allow nb advert from VM src IP to outside
+						F(0, 27772, T2("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}},icmp6,icmp_type=136"), "normal"),
+					)
+				})
 				flows = append(flows,
-					// allow nb solicitate from VM src IP to outside
-					F(0, 27774, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}},icmp6,icmp_type=135"), "normal"),
 					// allow nb solicitate from VM src IP to outside
 					F(0, 27773, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6LOCAL}},icmp6,icmp_type=135"), "normal"),
 					// allow nb advert from VM src IP to outside
-					F(0, 27772, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}},icmp6,icmp_type=136"), "normal"),
-					// allow nb advert from VM src IP to outside
 					F(0, 27771, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6LOCAL}},icmp6,icmp_type=136"), "normal"),
 				)
 			}
 		}
 
-		if nic.EnableIPv4() && len(nic.PortMappings) > 0 {
+		if len(nic.PortMappings) > 0 {
 			if nic.IsOnHostLocalBridge() {
 				hcns := g.HostConfig.HostNetworkConfigs()
 				for i := range hcns {
@@ -743,7 +824,7 @@ func (g *Guest) FlowsMapForNic(nic *GuestNIC) (map[string][]*ovs.Flow, error) {
 					if hcn.Bridge == nic.Bridge {
 						continue
 					}
-					if hcn.IP == nil {
+					if hcn.IP == nil && hcn.IP6 == nil {
 						continue
 					}
 					if hcn.Ifname == "" {
@@ -753,18 +834,23 @@ func (g *Guest) FlowsMapForNic(nic *GuestNIC) (map[string][]*ovs.Flow, error) {
 					if err != nil {
 						continue
 					}
-					localFlows := guestNicPortMappingFlows(nic, -1, nic.IP, mac.String(), 0, "")
+					localFlows := guestNicPortMappingFlows(nic, -1, mac.String(), hcn, 0, "")
 					if fs, ok := flowsMap[hcn.Bridge]; ok {
 						flowsMap[hcn.Bridge] = append(fs, localFlows...)
 					} else {
 						flowsMap[hcn.Bridge] = localFlows
 					}
 				}
-				flows = append(flows, guestNicPortMappingFlowsLocal(nic, g.HostConfig.MasterNic().Addr, m["MACPhy"].(string), nic.PortNo, nic.IP, nic.MAC)...)
+				masterNic := g.HostConfig.MasterNic()
+				flows = append(flows, guestNicPortMappingFlowsLocal(nic, masterNic.Addr, masterNic.Addr6, m["MACPhy"].(string), nic.PortNo, nic.MAC)...)
 			} else {
-				flows = append(flows, guestNicPortMappingFlows(nic, nic.PortNo, nic.IP, nic.MAC, m["PortNoPhy"].(int), m["_dl_vlan"].(string))...)
+				flows = append(flows, guestNicPortMappingFlows(nic, nic.PortNo, nic.MAC, hcn, m["PortNoPhy"].(int), m["_dl_vlan"].(string))...)
 			}
 		}
+		if !nic.IsOnHostLocalBridge() {
+			// hairpin to port mappings of other guests on the bridge
+			flows = append(flows, guestNicHairpinSrcFlows(nic, hcn, g.SrcIpCheck())...)
+		}
 
 		if g.HostConfig.DisableSecurityGroup {
 			if !g.SrcIpCheck() {
@@ -798,11 +884,15 @@ func (g *Guest) FlowsMapForNic(nic *GuestNIC) (map[string][]*ovs.Flow, error) {
 					)
 				}
 				if nic.EnableIPv6() {
+					g.eachIP6(m, func(T2 func(string) string) {
+						flows = append(flows,
+							// allow for ipv6 IP
+							F(0, 26870, T2("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}},ipv6,ipv6_dst={{.IP6}}"), "normal"),
+							F(0, 25870, T2("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}}"), "normal"),
+							F(0, 24770, T2("dl_dst={{.MAC}},ipv6,ipv6_dst={{.IP6}}"), "normal"),
+						)
+					})
 					flows = append(flows,
-						// allow for ipv6 IP
-						F(0, 26870, T("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}},ipv6,ipv6_dst={{.IP6}}"), "normal"),
-						F(0, 25870, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}}"), "normal"),
-						F(0, 24770, T("dl_dst={{.MAC}},ipv6,ipv6_dst={{.IP6}}"), "normal"),
 						// allow for link local IP
 						F(0, 26871, T("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}},ipv6,ipv6_dst={{.IP6LOCAL}}"), "normal"),
 						F(0, 25871, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6LOCAL}}"), "normal"),
@@ -828,6 +918,15 @@ func (g *Guest) FlowsMapForNic(nic *GuestNIC) (map[string][]*ovs.Flow, error) {
 
 		flows = append(flows, secRules.Flows(g, nic, m)...)
 	}
+	if nic.IsTrunk() && !nic.IsOnHostLocalBridge() {
+		flows = guestNicTrunkFlows(nic, portNoPhy, g.SrcMacCheck(), !g.HostConfig.DisableSecurityGroup, flows)
+	}
+	if !nic.IsOnHostLocalBridge() {
+		flows = append(flows, guestNicIsolationFlows(nic, m["MACPhy"].(string), g.HostConfig.IsolatedVlanPcp)...)
+	}
+	if !nic.IsOnHostLocalBridge() && g.HostConfig.SdnHostUplinkShaping {
+		flows = append(flows, guestNicFwMarkFlows(nic)...)
+	}
 	flowsMap[nic.Bridge] = flows
 	return flowsMap, nil
 }
@@ -872,6 +971,26 @@ func (g *Guest) eachIP(data map[string]interface{}, cb func(func(string) string)
 	}
 }
 
+// eachIP6 calls cb with IP6 set to the ipv6 address, each secondary ipv6
+// address and each delegated ipv6 prefix of the nic in turn
+func (g *Guest) eachIP6(data map[string]interface{}, cb func(func(string) string)) {
+	data2 := map[string]interface{}{}
+	for k, v := range data {
+		data2[k] = v
+	}
+	var ipAddrs []string
+	if ip6, ok := data2["IP6"]; ok {
+		ipAddrs = append(ipAddrs, ip6.(string))
+	}
+	ipAddrs = append(ipAddrs, data2["SubIP6s"].([]string)...)
+	ipAddrs = append(ipAddrs, data2["IP6Prefixes"].([]string)...)
+	for _, ipAddr := range ipAddrs {
+		data2["IP6"] = ipAddr
+		T2 := t(data2)
+		cb(T2)
+	}
+}
+
 func (sr *SecurityRules) Flows(g *Guest, nic *GuestNIC, data map[string]interface{}) []*ovs.Flow {
 	if len(nic.IP) > 0 {
 		data["IP"] = nic.IP
@@ -942,14 +1061,16 @@ func (sr *SecurityRules) Flows(g *Guest, nic *GuestNIC, data map[string]interfac
 		}
 
 		if len(nic.IP6) > 0 {
-			flows = append(flows,
-				F(0, 26870, T("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}},ipv6,ipv6_dst={{.IP6}}"),
-					loadZone+T(",ct(table=1,zone={{.CT_ZONE}})")),
-				F(0, 25870, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}}"),
-					loadReg0BitVm+","+loadZone+T(",ct(table=1,zone={{.CT_ZONE}})")),
-				F(0, 24770, T("dl_dst={{.MAC}},ipv6,ipv6_dst={{.IP6}}"),
-					loadZone+T(",ct(table=1,zone={{.CT_ZONE}})")),
-			)
+			g.eachIP6(data, func(T2 func(string) string) {
+				flows = append(flows,
+					F(0, 26870, T2("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}},ipv6,ipv6_dst={{.IP6}}"),
+						loadZone+T2(",ct(table=1,zone={{.CT_ZONE}})")),
+					F(0, 25870, T2("in_port={{.PortNo}},dl_src={{.MAC}},ipv6,ipv6_src={{.IP6}}"),
+						loadReg0BitVm+","+loadZone+T2(",ct(table=1,zone={{.CT_ZONE}})")),
+					F(0, 24770, T2("dl_dst={{.MAC}},ipv6,ipv6_dst={{.IP6}}"),
+						loadZone+T2(",ct(table=1,zone={{.CT_ZONE}})")),
+				)
+			})
 			flows = append(flows,
 				F(0, 26860, T("in_port={{.PortNoPhy}},dl_dst={{.MAC}},{{._dl_vlan}},ipv6"), "drop"),
 				F(0, 25860, T("in_port={{.PortNo}},dl_src={{.MAC}},ipv6"), "drop"),
@@ -21,8 +21,10 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/netutils"
 	"yunion.io/x/pkg/util/regutils"
@@ -46,6 +48,8 @@ type guestDesc struct {
 
 	SrcIpCheck  bool `json:"src_ip_check"`
 	SrcMacCheck bool `json:"src_mac_check"`
+
+	MetadataPaths []string `json:"metadata_paths"`
 }
 
 func newGuestDesc() *guestDesc {
@@ -92,6 +96,15 @@ type GuestNIC struct {
 	Gateway6 string `json:"gateway6"`
 	Masklen6 int    `json:"masklen6"`
 
+	// optional tbf burst in bytes and latency in milliseconds
+	TxBurst     int `json:"tx_burst"`
+	RxBurst     int `json:"rx_burst"`
+	TxLatencyMs int `json:"tx_latency_ms"`
+	RxLatencyMs int `json:"rx_latency_ms"`
+	// optional packets per second ceiling
+	TxPpsLimit int `json:"tx_pps_limit"`
+	RxPpsLimit int `json:"rx_pps_limit"`
+
 	CtZoneId    uint16 `json:"-"`
 	CtZoneIdSet bool   `json:"-"`
 	PortNo      int    `json:"-"`
@@ -100,7 +113,40 @@ type GuestNIC struct {
 
 	NetworkAddresses []GuestNICNetworkAddress `json:"networkaddresses"`
 
-	PortMappings computeapi.GuestPortMappings `json:"port_mappings"`
+	PortMappings GuestPortMappings `json:"port_mappings"`
+
+	// TrunkVlans are tagged vlans allowed on the nic besides the native
+	// VLAN
+	TrunkVlans []int `json:"trunk_vlans"`
+
+	// MacLimit is the max number of source macs allowed from the nic
+	// when src mac check is off.  Zero for no limit
+	MacLimit int `json:"mac_limit"`
+
+	// Isolated nics cannot reach each other at layer 2, only the gateway
+	// and external networks
+	Isolated bool `json:"isolated"`
+
+	// Netem emulates wide area network on traffic towards the guest,
+	// e.g. for test guests
+	Netem *GuestNICNetem `json:"netem"`
+}
+
+// GuestNICNetem is delay and impairments of netem.  Percentages are from 0
+// to 100
+type GuestNICNetem struct {
+	DelayMs   float64 `json:"delay_ms"`
+	JitterMs  float64 `json:"jitter_ms"`
+	Loss      float64 `json:"loss"`
+	Duplicate float64 `json:"duplicate"`
+	Reorder   float64 `json:"reorder"`
+	Corrupt   float64 `json:"corrupt"`
+	// queue limit in packets, zero for default
+	Limit int `json:"limit"`
+}
+
+func (n *GuestNICNetem) IsEnabled() bool {
+	return n != nil && (n.DelayMs > 0 || n.Loss > 0 || n.Duplicate > 0 || n.Corrupt > 0)
 }
 
 func (nic *GuestNIC) EnableIPv4() bool {
@@ -144,19 +190,31 @@ func (n *GuestNIC) TcData() *TcData {
 		IngressMbps: ingressMbps,
 		EgressMbps:  egressMbps,
 
+		IngressBurst:     uint64(n.RxBurst),
+		EgressBurst:      uint64(n.TxBurst),
+		IngressLatencyMs: uint64(n.RxLatencyMs),
+		EgressLatencyMs:  uint64(n.TxLatencyMs),
+		IngressPps:       uint64(n.RxPpsLimit),
+		EgressPps:        uint64(n.TxPpsLimit),
+
+		Netem: n.Netem,
+
 		Bridge: n.Bridge,
 		PortNo: n.PortNo,
+		MAC:    n.MAC,
 	}
 }
 
 func (n *GuestNIC) Map() map[string]interface{} {
 	m := map[string]interface{}{
 		// "IP":      n.IP,
-		"SubIPs":  n.SubIPs(),
-		"MAC":     n.MAC,
-		"VLAN":    n.VLAN & 0xfff,
-		"CT_ZONE": n.CtZoneId,
-		"PortNo":  n.PortNo,
+		"SubIPs":      n.SubIPs(),
+		"SubIP6s":     n.SubIP6s(),
+		"IP6Prefixes": n.IP6Prefixes(),
+		"MAC":         n.MAC,
+		"VLAN":        n.VLAN & 0xfff,
+		"CT_ZONE":     n.CtZoneId,
+		"PortNo":      n.PortNo,
 	}
 	if len(n.IP) > 0 {
 		m["IP"] = n.IP
@@ -188,7 +246,7 @@ func (n *GuestNIC) SubIPs() []string {
 	)
 	for i := range nas {
 		na := &nas[i]
-		if na.Type == "sub_ip" {
+		if na.Type == GuestNICNetworkAddressTypeSubIP && !na.isIPv6() {
 			ipAddrs = append(ipAddrs, na.IpAddr)
 		}
 	}
@@ -206,12 +264,20 @@ type Guest struct {
 	NICs          []*GuestNIC
 	VpcNICs       []*GuestNIC
 	HostId        string
+	// MetadataPaths are metadata paths the guest may access.  Empty for
+	// all
+	MetadataPaths []string
 
 	srcIpCheck  bool
 	srcMacCheck bool
 
 	isSlave        bool
 	isVolatileHost bool
+
+	// pushedDesc is desc pushed by host agent at pushedDescAt.  It is
+	// loaded instead of the desc file, unless the file is written later
+	pushedDesc   []byte
+	pushedDescAt time.Time
 }
 
 func (g *Guest) IsVM() bool {
@@ -257,9 +323,34 @@ func (g *Guest) IsVolatileHost() bool {
 	return g.isVolatileHost || g.isSlave
 }
 
-func (g *Guest) GetJSONObjectDesc() (*desc.SGuestDesc, error) {
+// IsMigrationTarget returns true if the guest is being live migrated onto
+// this host
+func (g *Guest) IsMigrationTarget() bool {
+	return g.isVolatileHost && !g.isSlave
+}
+
+// SetDesc records desc pushed by host agent, to be loaded by LoadDesc
+func (g *Guest) SetDesc(data []byte) {
+	g.pushedDesc = data
+	g.pushedDescAt = time.Now()
+}
+
+// descData returns the pushed desc, or content of the desc file if it was
+// not pushed or the file was modified after that
+func (g *Guest) descData() ([]byte, error) {
 	descPath := path.Join(g.Path, "desc")
-	data, err := os.ReadFile(descPath)
+	if g.pushedDesc != nil {
+		fi, err := os.Stat(descPath)
+		if err != nil || !fi.ModTime().After(g.pushedDescAt) {
+			return g.pushedDesc, nil
+		}
+		g.pushedDesc = nil
+	}
+	return os.ReadFile(descPath)
+}
+
+func (g *Guest) GetJSONObjectDesc() (*desc.SGuestDesc, error) {
+	data, err := g.descData()
 	if err != nil {
 		return nil, errors.Wrap(err, "ReadFile")
 	}
@@ -276,21 +367,28 @@ func (g *Guest) GetJSONObjectDesc() (*desc.SGuestDesc, error) {
 }
 
 func (g *Guest) LoadDesc() error {
-	descPath := path.Join(g.Path, "desc")
-	descFile, err := os.Open(descPath)
+	data, err := g.descData()
 	if err != nil {
 		return err
 	}
-	defer descFile.Close()
-	dec := json.NewDecoder(descFile)
 	desc := newGuestDesc()
-	err = dec.Decode(&desc)
+	err = json.Unmarshal(data, &desc)
 	if err != nil {
 		return err
 	}
+	for _, err := range FilterGuestPortMappings(desc.NICs) {
+		log.Warningf("guest %s: %v, skipped", g.Id, err)
+	}
+	if err := ValidateGuestTrunkVlans(desc.NICs); err != nil {
+		return errors.Wrap(err, "ValidateGuestTrunkVlans")
+	}
+	if err := ValidateGuestIP6Addrs(desc.NICs); err != nil {
+		return errors.Wrap(err, "ValidateGuestIP6Addrs")
+	}
 	g.Name = desc.Name
 	g.HostId = desc.HostId
 	g.NICs = desc.NICs
+	g.MetadataPaths = desc.MetadataPaths
 
 	g.VpcNICs = nil
 
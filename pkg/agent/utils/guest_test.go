@@ -18,6 +18,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func TestGuestLoadDesc(t *testing.T) {
@@ -53,3 +54,52 @@ func TestGuestLoadDesc(t *testing.T) {
 		t.Logf("%s: running: %v", id, g.Running())
 	}
 }
+
+func TestGuestSetDesc(t *testing.T) {
+	dir := t.TempDir()
+	descPath := path.Join(dir, "desc")
+	writeDesc := func(name string, mtime time.Time) {
+		if err := os.WriteFile(descPath, []byte(`{"name":"`+name+`"}`), 0644); err != nil {
+			t.Fatalf("write desc: %v", err)
+		}
+		if err := os.Chtimes(descPath, mtime, mtime); err != nil {
+			t.Fatalf("chtimes desc: %v", err)
+		}
+	}
+	g := &Guest{
+		Id:   "1a2b3c4d-0000-0000-0000-000000000000",
+		Path: dir,
+	}
+	load := func(want string) {
+		t.Helper()
+		if err := g.LoadDesc(); err != nil {
+			t.Fatalf("load desc: %v", err)
+		}
+		if g.Name != want {
+			t.Errorf("name: want %q, got %q", want, g.Name)
+		}
+	}
+
+	writeDesc("file0", time.Now().Add(-time.Minute))
+	load("file0")
+
+	// pushed desc wins over file written before
+	g.SetDesc([]byte(`{"name":"pushed"}`))
+	load("pushed")
+	if err := os.Remove(descPath); err != nil {
+		t.Fatalf("remove desc: %v", err)
+	}
+	load("pushed")
+
+	// file written after the push wins
+	writeDesc("file1", time.Now().Add(time.Minute))
+	load("file1")
+	writeDesc("file2", time.Now().Add(time.Minute))
+	load("file2")
+
+	writeDesc("file3", time.Now().Add(-time.Minute))
+	g.SetDesc([]byte(`{"name":`))
+	if err := g.LoadDesc(); err == nil {
+		t.Errorf("expect error loading partial desc")
+	}
+}
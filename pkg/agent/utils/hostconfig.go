@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
 	"reflect"
 	"strings"
 	"time"
@@ -33,6 +34,8 @@ import (
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 	"yunion.io/x/onecloud/pkg/util/fileutils2"
 	"yunion.io/x/onecloud/pkg/util/netutils2"
+
+	"yunion.io/x/sdnagent/pkg/tc"
 )
 
 type HostConfigNetwork struct {
@@ -180,6 +183,39 @@ func (hcn *HostConfigNetwork) loadHostLocalNetconfs(hc *HostConfig) {
 
 type HostConfig struct {
 	options.SHostOptions
+	SSdnOptions
+
+	// AnnounceCount is the number of gratuitous arp and unsolicited na sent
+	// for each guest address, with AnnounceInterval in between
+	AnnounceCount    int
+	AnnounceInterval time.Duration
+	// IsolatedVlanPcp is the 802.1p priority marking traffic from isolated
+	// nics for upstream switches.  Zero for no marking
+	IsolatedVlanPcp int
+	// MetadataRateLimit, MetadataBurst and MetadataConcurrency limit
+	// requests per second, burst and requests at a time of each guest to
+	// the classic metadata server.  Zero for no limit
+	MetadataRateLimit   float64
+	MetadataBurst       int
+	MetadataConcurrency int
+	// TcBackend is how tcman reads and writes qdiscs, either
+	// tc.TcBackendCli or tc.TcBackendNetlink
+	TcBackend string
+	// RateLimitBackend is how bandwidth of guest nics is limited, either
+	// RateLimitBackendIfb or RateLimitBackendOvs
+	RateLimitBackend string
+	// GuestBpfIngress and GuestBpfEgress are bpf programs attached to
+	// taps of guest nics.  Nil for none
+	GuestBpfIngress *GuestBpfProgram
+	GuestBpfEgress  *GuestBpfProgram
+	// GuestWorkers is the max number of guests updated at a time
+	GuestWorkers int
+	// WarmStartTimeout is how long flows are not deleted after start,
+	// unless guests are all loaded before that.  Zero to delete right away
+	WarmStartTimeout time.Duration
+	// CtZoneFile is where ct zones allocated to guest nics are kept
+	// across restarts
+	CtZoneFile string
 
 	networks  []*HostConfigNetwork
 	masterNic *netutils2.SNetInterface
@@ -190,14 +226,21 @@ func (hc *HostConfig) MetadataPort() int {
 }
 
 func NewHostConfig() (*HostConfig, error) {
-	hostOpts := options.Parse()
+	hostOpts, sdnOpts := parseHostOptions(os.Args)
 	hc := &HostConfig{
 		SHostOptions: hostOpts,
+		SSdnOptions:  sdnOpts,
 	}
 
 	if hc.AllowSwitchVMs && !hc.AllowRouterVMs {
 		hc.AllowRouterVMs = true
 	}
+	hc.loadAnnounceOptions()
+	hc.loadIsolationOptions()
+	hc.loadMetadataLimitOptions()
+	hc.loadTcOptions()
+	hc.loadWatcherOptions()
+	hc.loadCtZoneOptions()
 
 	for _, network := range hc.Networks {
 		hcn, err := NewHostConfigNetwork(network)
@@ -225,6 +268,110 @@ func NewHostConfig() (*HostConfig, error) {
 	return hc, nil
 }
 
+// nonNegative returns value of option name, or zero if it is negative
+func nonNegative(name string, v int) int {
+	if v < 0 {
+		log.Errorf("invalid %s %d, use 0", name, v)
+		return 0
+	}
+	return v
+}
+
+// loadAnnounceOptions reads guest address announcement settings from
+// SdnAnnounceCount and SdnAnnounceIntervalMs
+func (hc *HostConfig) loadAnnounceOptions() {
+	hc.AnnounceCount = nonNegative("sdn_announce_count", hc.SdnAnnounceCount)
+	hc.AnnounceInterval = time.Duration(nonNegative("sdn_announce_interval_ms", hc.SdnAnnounceIntervalMs)) * time.Millisecond
+}
+
+// loadIsolationOptions reads priority marking traffic from isolated nics
+// from SdnIsolatedVlanPcp
+func (hc *HostConfig) loadIsolationOptions() {
+	pcp := hc.SdnIsolatedVlanPcp
+	if pcp < 0 || pcp > 7 {
+		log.Errorf("invalid sdn_isolated_vlan_pcp %d, isolated traffic not marked", pcp)
+		return
+	}
+	hc.IsolatedVlanPcp = pcp
+}
+
+// loadMetadataLimitOptions reads limits of metadata requests from guests
+// from SdnMetadataRateLimit, SdnMetadataBurst and SdnMetadataConcurrency
+func (hc *HostConfig) loadMetadataLimitOptions() {
+	hc.MetadataRateLimit = hc.SdnMetadataRateLimit
+	if hc.MetadataRateLimit < 0 {
+		log.Errorf("invalid sdn_metadata_rate_limit %v, no limit", hc.SdnMetadataRateLimit)
+		hc.MetadataRateLimit = 0
+	}
+	hc.MetadataBurst = nonNegative("sdn_metadata_burst", hc.SdnMetadataBurst)
+	hc.MetadataConcurrency = nonNegative("sdn_metadata_concurrency", hc.SdnMetadataConcurrency)
+}
+
+// loadTcOptions reads backend of tcman from SdnTcBackend, backend of
+// guest bandwidth limit from SdnRateLimitBackend, and bpf programs of
+// guest nics from SdnGuestBpfIngress and SdnGuestBpfEgress
+func (hc *HostConfig) loadTcOptions() {
+	hc.TcBackend = tc.TcBackendCli
+	switch v := hc.SdnTcBackend; v {
+	case "", tc.TcBackendCli:
+	case tc.TcBackendNetlink:
+		hc.TcBackend = v
+	default:
+		log.Errorf("invalid sdn_tc_backend %q, use %s", v, tc.TcBackendCli)
+	}
+
+	hc.RateLimitBackend = RateLimitBackendIfb
+	switch v := hc.SdnRateLimitBackend; v {
+	case "", RateLimitBackendIfb:
+	case RateLimitBackendOvs:
+		hc.RateLimitBackend = v
+	default:
+		log.Errorf("invalid sdn_rate_limit_backend %q, use %s", v, RateLimitBackendIfb)
+	}
+
+	for _, opt := range []struct {
+		name string
+		v    string
+		prog **GuestBpfProgram
+	}{
+		{"sdn_guest_bpf_ingress", hc.SdnGuestBpfIngress, &hc.GuestBpfIngress},
+		{"sdn_guest_bpf_egress", hc.SdnGuestBpfEgress, &hc.GuestBpfEgress},
+	} {
+		if opt.v == "" {
+			continue
+		}
+		p, err := ParseGuestBpfProgram(opt.v)
+		if err != nil {
+			log.Errorf("invalid %s %q: %v", opt.name, opt.v, err)
+			continue
+		}
+		*opt.prog = p
+	}
+}
+
+// loadWatcherOptions reads number of guests updated at a time from
+// SdnGuestWorkers, and warm start timeout from SdnWarmStartTimeoutSec
+func (hc *HostConfig) loadWatcherOptions() {
+	hc.GuestWorkers = nonNegative("sdn_guest_workers", hc.SdnGuestWorkers)
+	if hc.GuestWorkers == 0 {
+		hc.GuestWorkers = 1
+	}
+	hc.WarmStartTimeout = time.Duration(nonNegative("sdn_warm_start_timeout_sec", hc.SdnWarmStartTimeoutSec)) * time.Second
+}
+
+// defaultCtZoneFile is owned by sdnagent.  ServersPath belongs to the host
+// agent and is not a place for files of other services
+const defaultCtZoneFile = "/var/lib/sdnagent/ct_zones.json"
+
+// loadCtZoneOptions reads path of ct zone allocations from SdnCtZoneFile,
+// which defaults to defaultCtZoneFile
+func (hc *HostConfig) loadCtZoneOptions() {
+	hc.CtZoneFile = hc.SdnCtZoneFile
+	if hc.CtZoneFile == "" {
+		hc.CtZoneFile = defaultCtZoneFile
+	}
+}
+
 func (hc *HostConfig) WaitMacReady() error {
 	ready := false
 	const TIMEOUT = 5 * 60 * time.Second // 5 minutes
@@ -276,7 +423,8 @@ func (hc *HostConfig) HostNetworkConfig(bridge string) *HostConfigNetwork {
 }
 
 func (hc *HostConfig) Equals(hc1 *HostConfig) bool {
-	return reflect.DeepEqual(hc.SHostOptions, hc1.SHostOptions)
+	return reflect.DeepEqual(hc.SHostOptions, hc1.SHostOptions) &&
+		reflect.DeepEqual(hc.SSdnOptions, hc1.SSdnOptions)
 }
 
 func (hc *HostConfig) WatchChange(ctx context.Context, cb func()) {
@@ -29,8 +29,9 @@ type HostLocal struct {
 
 	*HostConfigNetwork
 
-	metadataPort int
-	metadataApp  *appsrv.Application
+	metadataPort    int
+	metadataApp     *appsrv.Application
+	metadataLimiter *MetadataLimiter
 }
 
 func (h *HostLocal) String() string {
@@ -56,6 +57,7 @@ func init() {
 func FetchHostLocal(hl *HostLocal, watcher IServerWatcher) *HostLocal {
 	if uhl, ok := hostLocalMap.Load(hl.Bridge); !ok {
 		// not found, register
+		hl.metadataLimiter = hl.newMetadataLimiter(watcher)
 		go hl.StartMetadataServer(watcher)
 		hostLocalMap.Store(hl.Bridge, hl)
 		return hl
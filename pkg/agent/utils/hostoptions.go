@@ -0,0 +1,85 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"yunion.io/x/log"
+	"yunion.io/x/structarg"
+
+	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+// SSdnOptions are options of sdnagent in host.conf besides those of
+// options.SHostOptions.  Like SdnEnableGuestMan and friends, they default
+// to environment variables of the same names in upper case
+type SSdnOptions struct {
+	SdnAnnounceCount      int `help:"times gratuitous arp and unsolicited na are sent for each guest address" default:"$SDN_ANNOUNCE_COUNT|3"`
+	SdnAnnounceIntervalMs int `help:"milliseconds between gratuitous arp and unsolicited na of guest addresses" default:"$SDN_ANNOUNCE_INTERVAL_MS|1000"`
+
+	SdnIsolatedVlanPcp int `help:"802.1p priority marking traffic from isolated guest nics, 0 for no marking" default:"$SDN_ISOLATED_VLAN_PCP|0"`
+
+	SdnMetadataRateLimit   float64 `help:"requests per second of each guest to the metadata server, 0 for no limit" default:"$SDN_METADATA_RATE_LIMIT|0"`
+	SdnMetadataBurst       int     `help:"burst of requests of each guest to the metadata server, 1 if 0 with a rate limit" default:"$SDN_METADATA_BURST|0"`
+	SdnMetadataConcurrency int     `help:"requests of each guest to the metadata server at a time, 0 for no limit" default:"$SDN_METADATA_CONCURRENCY|0"`
+
+	SdnTcBackend         string `help:"how tcman reads and writes qdiscs, either cli or netlink, cli if empty" default:"$SDN_TC_BACKEND"`
+	SdnRateLimitBackend  string `help:"how bandwidth of guest nics is limited, either ifb or ovs" default:"$SDN_RATE_LIMIT_BACKEND|ifb"`
+	SdnTapQueueShaping   bool   `help:"shape each tx queue of multiqueue guest taps with an even share of the rate instead of all queues at root, capping a single flow at the share" default:"$SDN_TAP_QUEUE_SHAPING|false"`
+	SdnHostUplinkShaping bool   `help:"shape packets from guest nics with htb classes on host uplinks, all behind the lock of the uplink root qdisc" default:"$SDN_HOST_UPLINK_SHAPING|false"`
+
+	SdnGuestBpfIngress string `help:"bpf program attached to ingress of taps of guest nics, in the form of object[:section]" default:"$SDN_GUEST_BPF_INGRESS"`
+	SdnGuestBpfEgress  string `help:"bpf program attached to egress of taps of guest nics, in the form of object[:section]" default:"$SDN_GUEST_BPF_EGRESS"`
+
+	SdnGuestWorkers        int `help:"max number of guests updated at a time" default:"$SDN_GUEST_WORKERS|8"`
+	SdnWarmStartTimeoutSec int `help:"seconds flows are not deleted after start unless guests are all loaded, 0 to delete right away" default:"$SDN_WARM_START_TIMEOUT_SEC|120"`
+
+	SdnCtZoneFile string `help:"file ct zones allocated to guest nics are kept in across restarts, /var/lib/sdnagent/ct_zones.json if empty" default:"$SDN_CT_ZONE_FILE"`
+}
+
+// sdnHostOptions are options of host.conf read by sdnagent
+type sdnHostOptions struct {
+	options.SHostOptions
+	SSdnOptions
+}
+
+// parseHostOptions parses host.conf and command line args the same way as
+// options.Parse does, with SSdnOptions
+func parseHostOptions(args []string) (options.SHostOptions, SSdnOptions) {
+	var opts sdnHostOptions
+	common_options.ParseOptions(&opts, args, "host.conf", "host")
+	if len(opts.CommonConfigFile) > 0 && fileutils2.Exists(opts.CommonConfigFile) {
+		commonCfg := &options.SHostBaseOptions{}
+		commonCfg.Config = opts.CommonConfigFile
+		common_options.ParseOptions(commonCfg, []string{args[0]}, "common.conf", "host")
+		baseOpt := opts.BaseOptions.BaseOptions
+		opts.SHostBaseOptions = *commonCfg
+		// keep base options
+		opts.BaseOptions.BaseOptions = baseOpt
+	}
+	if len(opts.LocalConfigFile) > 0 && fileutils2.Exists(opts.LocalConfigFile) {
+		log.Infof("Use local configuration file: %s", opts.LocalConfigFile)
+		parser, err := structarg.NewArgumentParser(&opts, "", "", "")
+		if err != nil {
+			log.Fatalf("fail to create local parse %s", err)
+		}
+		err = parser.ParseFile(opts.LocalConfigFile)
+		if err != nil {
+			log.Fatalf("Parse local configuration file: %v", err)
+		}
+	}
+	return opts.SHostOptions, opts.SSdnOptions
+}
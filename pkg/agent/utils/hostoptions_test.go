@@ -0,0 +1,76 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseHostOptions(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "host.conf")
+	err := os.WriteFile(conf, []byte(`servers_path: /opt/cloud/workspace/servers
+sdn_announce_count: 2
+sdn_isolated_vlan_pcp: 5
+sdn_metadata_rate_limit: 2.5
+sdn_metadata_burst: 5
+sdn_tc_backend: netlink
+sdn_guest_bpf_ingress: /opt/sdn/guest.o:ingress
+sdn_tap_queue_shaping: true
+sdn_host_uplink_shaping: true
+sdn_guest_workers: 4
+sdn_ct_zone_file: /var/lib/sdn/ct_zones.json
+`), 0644)
+	if err != nil {
+		t.Fatalf("write host.conf: %v", err)
+	}
+	// environment variables are defaults of options not in host.conf
+	t.Setenv("SDN_ANNOUNCE_COUNT", "5")
+	t.Setenv("SDN_ANNOUNCE_INTERVAL_MS", "200")
+	t.Setenv("SDN_METADATA_BURST", "50")
+	t.Setenv("SDN_METADATA_CONCURRENCY", "3")
+	t.Setenv("SDN_TC_BACKEND", "cli")
+	t.Setenv("SDN_RATE_LIMIT_BACKEND", "ovs")
+	t.Setenv("SDN_GUEST_BPF_EGRESS", "/opt/sdn/guest.o")
+	t.Setenv("SDN_GUEST_WORKERS", "16")
+	t.Setenv("SDN_WARM_START_TIMEOUT_SEC", "30")
+	t.Setenv("SDN_CT_ZONE_FILE", "/tmp/ct_zones.json")
+
+	hostOpts, sdnOpts := parseHostOptions([]string{"sdnagent", "--config", conf})
+	if hostOpts.ServersPath != "/opt/cloud/workspace/servers" {
+		t.Errorf("servers_path: got %q", hostOpts.ServersPath)
+	}
+	want := SSdnOptions{
+		SdnAnnounceCount:       2,
+		SdnAnnounceIntervalMs:  200,
+		SdnIsolatedVlanPcp:     5,
+		SdnMetadataRateLimit:   2.5,
+		SdnMetadataBurst:       5,
+		SdnMetadataConcurrency: 3,
+		SdnTcBackend:           "netlink",
+		SdnRateLimitBackend:    "ovs",
+		SdnGuestBpfIngress:     "/opt/sdn/guest.o:ingress",
+		SdnGuestBpfEgress:      "/opt/sdn/guest.o",
+		SdnTapQueueShaping:     true,
+		SdnHostUplinkShaping:   true,
+		SdnGuestWorkers:        4,
+		SdnWarmStartTimeoutSec: 30,
+		SdnCtZoneFile:          "/var/lib/sdn/ct_zones.json",
+	}
+	if sdnOpts != want {
+		t.Errorf("want %+v, got %+v", want, sdnOpts)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	// GuestNICNetworkAddressTypeSubIP is secondary address of the nic,
+	// either ipv4 or ipv6
+	GuestNICNetworkAddressTypeSubIP = "sub_ip"
+	// GuestNICNetworkAddressTypeIP6Prefix is ipv6 prefix routed to the nic
+	GuestNICNetworkAddressTypeIP6Prefix = "ip6_prefix"
+)
+
+func (na *GuestNICNetworkAddress) isIPv6() bool {
+	ip := net.ParseIP(na.IpAddr)
+	return ip != nil && ip.To4() == nil
+}
+
+func (na *GuestNICNetworkAddress) ip6Prefix() (*net.IPNet, error) {
+	ip := net.ParseIP(na.IpAddr)
+	if ip == nil || ip.To4() != nil {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "invalid ipv6 prefix address %q", na.IpAddr)
+	}
+	if na.Masklen <= 0 || na.Masklen > 128 {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "invalid ipv6 prefix length %d", na.Masklen)
+	}
+	mask := net.CIDRMask(na.Masklen, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// SubIP6s returns secondary ipv6 addresses of the nic
+func (n *GuestNIC) SubIP6s() []string {
+	ipAddrs := []string{}
+	for i := range n.NetworkAddresses {
+		na := &n.NetworkAddresses[i]
+		if na.Type == GuestNICNetworkAddressTypeSubIP && na.isIPv6() {
+			ipAddrs = append(ipAddrs, na.IpAddr)
+		}
+	}
+	return ipAddrs
+}
+
+// IP6Prefixes returns ipv6 prefixes delegated to the nic in cidr notation
+func (n *GuestNIC) IP6Prefixes() []string {
+	prefixes := []string{}
+	for i := range n.NetworkAddresses {
+		na := &n.NetworkAddresses[i]
+		if na.Type != GuestNICNetworkAddressTypeIP6Prefix {
+			continue
+		}
+		if ipnet, err := na.ip6Prefix(); err == nil {
+			prefixes = append(prefixes, ipnet.String())
+		}
+	}
+	return prefixes
+}
+
+// ValidateGuestIP6Addrs checks secondary ipv6 addresses and delegated
+// prefixes of nics
+func ValidateGuestIP6Addrs(nics []*GuestNIC) error {
+	for _, nic := range nics {
+		for i := range nic.NetworkAddresses {
+			na := &nic.NetworkAddresses[i]
+			switch na.Type {
+			case GuestNICNetworkAddressTypeSubIP:
+				if net.ParseIP(na.IpAddr) == nil {
+					return errors.Wrapf(errors.ErrInvalidFormat, "nic %s: invalid sub ip %q", nic.MAC, na.IpAddr)
+				}
+			case GuestNICNetworkAddressTypeIP6Prefix:
+				if _, err := na.ip6Prefix(); err != nil {
+					return errors.Wrapf(err, "nic %s", nic.MAC)
+				}
+			}
+		}
+	}
+	return nil
+}
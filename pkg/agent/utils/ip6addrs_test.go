@@ -0,0 +1,130 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGuestNicIP6Addrs(t *testing.T) {
+	nic := &GuestNIC{
+		MAC:        "00:22:00:00:00:10",
+		IP:         "192.168.1.10",
+		IP6:        "fd00::10",
+		VirtualIps: []string{"192.168.1.100"},
+		NetworkAddresses: []GuestNICNetworkAddress{
+			{Type: GuestNICNetworkAddressTypeSubIP, IpAddr: "192.168.1.11"},
+			{Type: GuestNICNetworkAddressTypeSubIP, IpAddr: "fd00::11"},
+			{Type: GuestNICNetworkAddressTypeIP6Prefix, IpAddr: "fd01:0:0:1::1", Masklen: 64},
+			{Type: GuestNICNetworkAddressTypeIP6Prefix, IpAddr: "fd02::", Masklen: 56},
+		},
+	}
+	if got, want := nic.SubIPs(), []string{"192.168.1.11", "192.168.1.100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubIPs: want %v, got %v", want, got)
+	}
+	if got, want := nic.SubIP6s(), []string{"fd00::11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubIP6s: want %v, got %v", want, got)
+	}
+	if got, want := nic.IP6Prefixes(), []string{"fd01:0:0:1::/64", "fd02::/56"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IP6Prefixes: want %v, got %v", want, got)
+	}
+}
+
+func TestGuestLoadDescIP6Addrs(t *testing.T) {
+	cases := []struct {
+		name  string
+		addrs string
+		valid bool
+	}{
+		{
+			name:  "sub ip6 and prefix",
+			addrs: `[{"type":"sub_ip","ip_addr":"fd00::11"},{"type":"ip6_prefix","ip_addr":"fd01::","masklen":64}]`,
+			valid: true,
+		},
+		{
+			name:  "bad sub ip",
+			addrs: `[{"type":"sub_ip","ip_addr":"fd00::zz"}]`,
+			valid: false,
+		},
+		{
+			name:  "ipv4 prefix",
+			addrs: `[{"type":"ip6_prefix","ip_addr":"10.0.0.0","masklen":24}]`,
+			valid: false,
+		},
+		{
+			name:  "bad prefix length",
+			addrs: `[{"type":"ip6_prefix","ip_addr":"fd01::","masklen":129}]`,
+			valid: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			desc := `{"name":"test","nics":[{"mac":"00:22:00:00:00:10","ip6":"fd00::10","networkaddresses":` + c.addrs + `}]}`
+			if err := os.WriteFile(path.Join(dir, "desc"), []byte(desc), 0644); err != nil {
+				t.Fatalf("write desc: %v", err)
+			}
+			g := &Guest{
+				Id:   "test",
+				Path: dir,
+			}
+			err := g.LoadDesc()
+			if c.valid && err != nil {
+				t.Errorf("load desc: %v", err)
+			} else if !c.valid && err == nil {
+				t.Errorf("want error, got nil")
+			}
+		})
+	}
+}
+
+func TestSecurityRulesFlowsIP6Addrs(t *testing.T) {
+	nic := &GuestNIC{
+		MAC:      "00:22:00:00:00:10",
+		IP6:      "fd00::10",
+		PortNo:   3,
+		CtZoneId: 5,
+		NetworkAddresses: []GuestNICNetworkAddress{
+			{Type: GuestNICNetworkAddressTypeSubIP, IpAddr: "fd00::11"},
+			{Type: GuestNICNetworkAddressTypeIP6Prefix, IpAddr: "fd01::", Masklen: 64},
+		},
+	}
+	g := &Guest{
+		HostConfig: &HostConfig{},
+	}
+	sr, err := NewSecurityRules("")
+	if err != nil {
+		t.Fatalf("NewSecurityRules: %v", err)
+	}
+	data := nic.Map()
+	data["PortNoPhy"] = 1
+	data["_dl_vlan"] = "vlan_tci=0"
+	txt := marshalFlows(t, sr.Flows(g, nic, data))
+	for _, w := range []string{
+		"priority=25870,ipv6,in_port=3,dl_src=00:22:00:00:00:10,ipv6_src=fd00::10,",
+		"priority=25870,ipv6,in_port=3,dl_src=00:22:00:00:00:10,ipv6_src=fd00::11,",
+		"priority=25870,ipv6,in_port=3,dl_src=00:22:00:00:00:10,ipv6_src=fd01::/64,",
+		"priority=24770,ipv6,dl_dst=00:22:00:00:00:10,ipv6_dst=fd01::/64,",
+		"priority=25860,ipv6,in_port=3,dl_src=00:22:00:00:00:10,table=0,idle_timeout=0,actions=drop",
+	} {
+		if !strings.Contains(txt, w) {
+			t.Errorf("want %q in flows:\n%s", w, txt)
+		}
+	}
+}
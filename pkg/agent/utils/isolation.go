@@ -0,0 +1,66 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+// OvsPortIsolationArgs returns ovs-vsctl command line making the nic port
+// protected or not.  The NORMAL action does not forward between protected
+// ports, unicast or broadcast, so isolated nics on the same bridge cannot
+// reach each other whatever flows they went through before
+func (nic *GuestNIC) OvsPortIsolationArgs() []string {
+	return []string{
+		"ovs-vsctl", "--", "set", "Port", nic.IfnameHost,
+		fmt.Sprintf("protected=%t", nic.Isolated),
+	}
+}
+
+// IsolationTable holds flows telling whether traffic of isolated nics leaves
+// the host, by destinations local to the bridge
+const IsolationTable = 17
+
+// guestNicIsolationFlows returns flows marking untagged traffic from the
+// isolated nic with priority pcp, so that upstream switches can isolate it
+// from other hosts.  The priority tag is kept when the port vlan is added
+// on the way out.  Traffic to the host and nics on the bridge, which do
+// not leave through the physical port, is not marked.  Every nic adds its
+// mac to IsolationTable for it.  Trunk nics are not marked as their flows
+// match untagged traffic of the native vlan
+//
+// reg0[18] is set once marking is decided, and the packet goes through
+// table 0 again
+func guestNicIsolationFlows(nic *GuestNIC, hostMAC string, pcp int) []*ovs.Flow {
+	if pcp <= 0 {
+		return nil
+	}
+	flows := []*ovs.Flow{
+		F(IsolationTable, 100, fmt.Sprintf("dl_dst=%s", nic.MAC), "load:0x1->NXM_NX_REG0[18]"),
+	}
+	if !nic.Isolated || nic.IsTrunk() {
+		return flows
+	}
+	tci := uint16(pcp)<<13 | 0x1000
+	flows = append(flows,
+		F(0, 29000, fmt.Sprintf("in_port=%d,vlan_tci=0x0000/0x1fff,reg0=0x0/0x40000", nic.PortNo),
+			fmt.Sprintf("load:0x1->NXM_NX_REG0[18],resubmit(,%d),resubmit:%d", IsolationTable, nic.PortNo)),
+		F(IsolationTable, 100, fmt.Sprintf("dl_dst=%s", hostMAC), "load:0x1->NXM_NX_REG0[18]"),
+		F(IsolationTable, 0, "", fmt.Sprintf("set_field:0x%04x->vlan_tci", tci)),
+	)
+	return flows
+}
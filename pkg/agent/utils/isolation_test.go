@@ -0,0 +1,85 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOvsPortIsolationArgs(t *testing.T) {
+	nic := &GuestNIC{IfnameHost: "vnet1", Isolated: true}
+	want := "ovs-vsctl -- set Port vnet1 protected=true"
+	if got := strings.Join(nic.OvsPortIsolationArgs(), " "); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	nic.Isolated = false
+	want = "ovs-vsctl -- set Port vnet1 protected=false"
+	if got := strings.Join(nic.OvsPortIsolationArgs(), " "); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestGuestNicIsolationFlows(t *testing.T) {
+	const hostMAC = "00:22:00:00:00:01"
+	cases := []struct {
+		name string
+		nic  *GuestNIC
+		pcp  int
+		want []string
+	}{
+		{
+			name: "marked",
+			nic:  &GuestNIC{PortNo: 3, VLAN: 10, MAC: "00:22:00:00:00:10", Isolated: true},
+			pcp:  5,
+			want: []string{
+				"priority=100,dl_dst=00:22:00:00:00:10,table=17,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[18]",
+				"priority=29000,in_port=3,vlan_tci=0x0000/0x1fff,reg0=0x0/0x40000,table=0,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[18],resubmit(,17),resubmit:3",
+				// not to the host
+				"priority=100,dl_dst=00:22:00:00:00:01,table=17,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[18]",
+				"priority=0,table=17,idle_timeout=0,actions=set_field:0xb000->vlan_tci",
+			},
+		},
+		{
+			name: "not isolated",
+			nic:  &GuestNIC{PortNo: 3, VLAN: 10, MAC: "00:22:00:00:00:10"},
+			pcp:  5,
+			want: []string{
+				// traffic of isolated nics to it is not marked
+				"priority=100,dl_dst=00:22:00:00:00:10,table=17,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[18]",
+			},
+		},
+		{
+			name: "no marking",
+			nic:  &GuestNIC{PortNo: 3, VLAN: 10, MAC: "00:22:00:00:00:10", Isolated: true},
+		},
+		{
+			name: "trunk",
+			nic:  &GuestNIC{PortNo: 3, VLAN: 10, MAC: "00:22:00:00:00:10", TrunkVlans: []int{20}, Isolated: true},
+			pcp:  5,
+			want: []string{
+				"priority=100,dl_dst=00:22:00:00:00:10,table=17,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[18]",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := marshalFlows(t, guestNicIsolationFlows(c.nic, hostMAC, c.pcp))
+			if want := strings.Join(c.want, "\n"); got != want {
+				t.Errorf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
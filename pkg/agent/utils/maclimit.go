@@ -0,0 +1,89 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+const (
+	// MacLimitTable holds learn flows of guest ports with mac limit, and
+	// flows they learned for source macs seen from the ports.  Learn specs
+	// matching on packet fields are not understood by FlowMan, so flows of
+	// the table are managed by guests with ovs-ofctl and excluded from
+	// FlowMan dumps
+	MacLimitTable = 13
+	// MacLimitCheckTable forwards packets from guest ports with mac limit
+	// whose source macs are learned in MacLimitTable, and drops others
+	MacLimitCheckTable = 18
+
+	// macLimitIdleTimeout is seconds a learned source mac is kept without
+	// packets from it, so that guests may move on to other macs
+	macLimitIdleTimeout = 300
+
+	macLimitCookieBase = uint64(0x6d6c) << 48
+)
+
+// MacLimitCookie returns cookie of the flow dropping packets from source
+// macs beyond the limit of the guest port.  Its packet count tells how many
+// packets were dropped
+func MacLimitCookie(portNo int) uint64 {
+	return macLimitCookieBase | uint64(portNo)
+}
+
+// HasMacLimit returns true if the number of source macs from the nic is
+// limited when src mac check is off
+func (nic *GuestNIC) HasMacLimit() bool {
+	return nic.MacLimit > 0
+}
+
+// MacLimitMatch returns match of flows of the guest port in MacLimitTable,
+// for "ovs-ofctl del-flows"
+func MacLimitMatch(portNo int) string {
+	return fmt.Sprintf("table=%d,in_port=%d", MacLimitTable, portNo)
+}
+
+// MacLimitLearnFlow returns the learn flow of the nic in MacLimitTable for
+// "ovs-ofctl add-flow".  Packets from known source macs of the port hit
+// learned flows setting bit 0 of reg7.  Others hit the learn flow, which
+// learns their source macs and sets the bit unless MacLimit flows of the
+// port are learned already
+func (nic *GuestNIC) MacLimitLearnFlow() string {
+	learn := fmt.Sprintf("learn(table=%d,idle_timeout=%d,priority=20000,limit=%d,result_dst=NXM_NX_REG7[0],in_port=%d,NXM_OF_ETH_SRC[],load:0x1->NXM_NX_REG7[0])",
+		MacLimitTable, macLimitIdleTimeout, nic.MacLimit, nic.PortNo)
+	return fmt.Sprintf("%s,priority=10000,actions=%s", MacLimitMatch(nic.PortNo), learn)
+}
+
+// guestNicMacLimitFlows returns flows forwarding packets from the guest port
+// whose source macs are learned in MacLimitTable.  Packets from other macs
+// are dropped by a flow with MacLimitCookie
+func guestNicMacLimitFlows(nic *GuestNIC) []*ovs.Flow {
+	vm := fmt.Sprintf("in_port=%d", nic.PortNo)
+	dropFlow := F(MacLimitCheckTable, 10000, vm, "drop")
+	dropFlow.Cookie = MacLimitCookie(nic.PortNo)
+	return []*ovs.Flow{
+		F(0, 24670, vm, guestNicMacLimitActions()),
+		F(MacLimitCheckTable, 20000, vm+",reg7=0x1/0x1", "normal"),
+		dropFlow,
+	}
+}
+
+// guestNicMacLimitActions returns actions of table 0 checking source macs
+// of packets from guest ports with mac limit
+func guestNicMacLimitActions() string {
+	return fmt.Sprintf("resubmit(,%d),resubmit(,%d)", MacLimitTable, MacLimitCheckTable)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+func TestGuestNicMacLimitFlows(t *testing.T) {
+	cases := []struct {
+		name    string
+		flows   func() []*ovs.Flow
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "mac limit",
+			flows: func() []*ovs.Flow {
+				nic := &GuestNIC{PortNo: 3, MacLimit: 2}
+				return guestNicMacLimitFlows(nic)
+			},
+			want: []string{
+				"priority=24670,in_port=3,table=0,idle_timeout=0,actions=resubmit(,13),resubmit(,18)",
+				"priority=20000,in_port=3,reg7=0x1/0x1,table=18,idle_timeout=0,actions=normal",
+				"priority=10000,in_port=3,table=18,idle_timeout=0,cookie=0x6d6c000000000003,actions=drop",
+			},
+			notWant: []string{
+				"table=13",
+				"dl_src=",
+			},
+		},
+		{
+			name: "trunk",
+			flows: func() []*ovs.Flow {
+				nic := &GuestNIC{MAC: "00:22:00:00:00:10", PortNo: 3, MacLimit: 2, TrunkVlans: []int{20}}
+				return guestNicTrunkFlows(nic, 1, false, false, guestNicMacLimitFlows(nic))
+			},
+			want: []string{
+				"priority=24670,in_port=3,vlan_tci=0x0000/0x1fff,table=0,idle_timeout=0,actions=resubmit(,13),resubmit(,18)",
+				"priority=24670,in_port=3,dl_vlan=20,table=0,idle_timeout=0,actions=resubmit(,13),resubmit(,18)",
+			},
+			notWant: []string{
+				"priority=24670,in_port=3,dl_vlan=20,table=0,idle_timeout=0,actions=normal",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			txt := marshalFlows(t, c.flows())
+			for _, w := range c.want {
+				if !strings.Contains(txt, w) {
+					t.Errorf("want %q in flows:\n%s", w, txt)
+				}
+			}
+			for _, w := range c.notWant {
+				if strings.Contains(txt, w) {
+					t.Errorf("do not want %q in flows:\n%s", w, txt)
+				}
+			}
+		})
+	}
+}
+
+func TestMacLimitLearnFlow(t *testing.T) {
+	nic := &GuestNIC{PortNo: 3, MacLimit: 2}
+	want := "table=13,in_port=3,priority=10000,actions=learn(table=13,idle_timeout=300,priority=20000,limit=2,result_dst=NXM_NX_REG7[0],in_port=3,NXM_OF_ETH_SRC[],load:0x1->NXM_NX_REG7[0])"
+	if got := nic.MacLimitLearnFlow(); got != want {
+		t.Errorf("want learn flow\n%s\ngot\n%s", want, got)
+	}
+}
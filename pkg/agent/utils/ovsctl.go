@@ -15,8 +15,14 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
 
 	"yunion.io/x/pkg/errors"
 )
@@ -50,3 +56,50 @@ func ExecOvsctl(ctx context.Context, args []string) ([]byte, error) {
 	}
 	return output, nil
 }
+
+var dumpFlowsTableRe = regexp.MustCompile(`(?:^|[ ,])table=(\d+),`)
+
+// ParseDumpFlows parses output of "ovs-ofctl dump-flows", skipping flows in
+// excludeTables before they are parsed.  Flows of these tables may not be
+// understood by the flow parser, e.g. those with meter actions, or learn
+// actions matching on packet fields
+func ParseDumpFlows(output []byte, excludeTables []int) ([]*ovs.Flow, error) {
+	excluded := map[int]bool{}
+	for _, table := range excludeTables {
+		excluded[table] = true
+	}
+	flows := []*ovs.Flow{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 || bytes.Contains(line, []byte("ST_FLOW reply")) {
+			continue
+		}
+		table := 0
+		match := line
+		if i := bytes.Index(line, []byte("actions=")); i >= 0 {
+			match = line[:i]
+		}
+		if m := dumpFlowsTableRe.FindSubmatch(match); m != nil {
+			table, _ = strconv.Atoi(string(m[1]))
+		}
+		if excluded[table] {
+			continue
+		}
+		f := &ovs.Flow{}
+		if err := f.UnmarshalText(line); err != nil {
+			return nil, errors.Wrapf(err, "parse flow %q", line)
+		}
+		flows = append(flows, f)
+	}
+	return flows, scanner.Err()
+}
+
+// DumpFlows returns flows of the bridge, except those in excludeTables
+func DumpFlows(ctx context.Context, bridge string, excludeTables []int) ([]*ovs.Flow, error) {
+	output, err := ExecOvsctl(ctx, []string{"ovs-ofctl", "dump-flows", bridge})
+	if err != nil {
+		return nil, err
+	}
+	return ParseDumpFlows(output, excludeTables)
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestParseDumpFlows(t *testing.T) {
+	output := `NXST_FLOW reply (xid=0x4):
+ cookie=0x0, duration=5.1s, table=0, n_packets=0, n_bytes=0, idle_age=5, priority=24670,in_port=3 actions=resubmit(,13),resubmit(,18)
+ cookie=0x0, duration=5.1s, table=13, n_packets=0, n_bytes=0, idle_age=5, priority=10000,in_port=3 actions=learn(table=13,idle_timeout=300,priority=20000,limit=2,result_dst=NXM_NX_REG7[0],in_port=3,NXM_OF_ETH_SRC[],load:0x1->NXM_NX_REG7[0])
+ cookie=0x0, duration=5.1s, table=14, n_packets=0, n_bytes=0, idle_age=5, priority=10000,dl_dst=00:22:00:00:00:01 actions=meter:3,load:0x1->NXM_NX_REG6[],resubmit(,0)
+ cookie=0x0, duration=5.1s, table=18, n_packets=0, n_bytes=0, idle_age=5, priority=10000,in_port=3 actions=drop
+`
+	if _, err := ParseDumpFlows([]byte(output), nil); err == nil {
+		t.Errorf("want error parsing learn and meter flows")
+	}
+	flows, err := ParseDumpFlows([]byte(output), []int{MacLimitTable, GuestMeterTable})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(flows) != 2 || flows[0].Table != 0 || flows[1].Table != MacLimitCheckTable {
+		t.Errorf("want flows of table 0 and %d, got:\n%s", MacLimitCheckTable, marshalFlows(t, flows))
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"yunion.io/x/pkg/errors"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+const (
+	GuestPortMappingProtocolSCTP computeapi.GuestPortMappingProtocol = "sctp"
+)
+
+// GuestPortMapping is compute.GuestPortMapping with an optional guest port
+// range.  When PortEnd is set, ports [Port, PortEnd] of the guest are exposed
+// as the same ports on the host
+type GuestPortMapping struct {
+	computeapi.GuestPortMapping
+
+	PortEnd int `json:"port_end,omitempty"`
+}
+
+type GuestPortMappings []*GuestPortMapping
+
+func (pm *GuestPortMapping) IsRange() bool {
+	return pm.PortEnd > pm.Port
+}
+
+func (pm *GuestPortMapping) hostPortStart() int {
+	return *pm.HostPort
+}
+
+func (pm *GuestPortMapping) hostPortEnd() int {
+	if pm.IsRange() {
+		return *pm.HostPort + pm.PortEnd - pm.Port
+	}
+	return *pm.HostPort
+}
+
+func (pm *GuestPortMapping) String() string {
+	hostIp := pm.HostIp
+	if hostIp == "" {
+		hostIp = "*"
+	}
+	if pm.IsRange() {
+		return fmt.Sprintf("%s %s:%d-%d->%d-%d", pm.Protocol, hostIp, pm.hostPortStart(), pm.hostPortEnd(), pm.Port, pm.PortEnd)
+	}
+	return fmt.Sprintf("%s %s:%d->%d", pm.Protocol, hostIp, pm.hostPortStart(), pm.Port)
+}
+
+func (pm *GuestPortMapping) Validate() error {
+	switch pm.Protocol {
+	case computeapi.GuestPortMappingProtocolTCP,
+		computeapi.GuestPortMappingProtocolUDP,
+		GuestPortMappingProtocolSCTP:
+	default:
+		return errors.Wrapf(errors.ErrInvalidFormat, "unknown protocol %q", pm.Protocol)
+	}
+	if pm.HostPort == nil {
+		return errors.Wrapf(errors.ErrInvalidFormat, "%s port %d: no host port", pm.Protocol, pm.Port)
+	}
+	if pm.Port <= 0 || pm.Port > 65535 {
+		return errors.Wrapf(errors.ErrInvalidFormat, "invalid port %d", pm.Port)
+	}
+	if pm.PortEnd != 0 && (pm.PortEnd < pm.Port || pm.PortEnd > 65535) {
+		return errors.Wrapf(errors.ErrInvalidFormat, "invalid port range %d-%d", pm.Port, pm.PortEnd)
+	}
+	if pm.IsRange() && *pm.HostPort != pm.Port {
+		// tp_dst can only be rewritten to a single value, so ranges
+		// must map to the same ports
+		return errors.Wrapf(errors.ErrInvalidFormat, "port range %d-%d must use the same host ports, got %d", pm.Port, pm.PortEnd, *pm.HostPort)
+	}
+	if pm.hostPortStart() <= 0 || pm.hostPortEnd() > 65535 {
+		return errors.Wrapf(errors.ErrInvalidFormat, "invalid host port %d", *pm.HostPort)
+	}
+	return nil
+}
+
+func (pm *GuestPortMapping) Overlaps(pm1 *GuestPortMapping) bool {
+	if pm.Protocol != pm1.Protocol {
+		return false
+	}
+	if pm.HostIp != "" && pm1.HostIp != "" && pm.HostIp != pm1.HostIp {
+		return false
+	}
+	return pm.hostPortStart() <= pm1.hostPortEnd() && pm1.hostPortStart() <= pm.hostPortEnd()
+}
+
+// GuestPortMappingError tells why port mapping of nic is skipped
+type GuestPortMappingError struct {
+	MAC         string
+	PortMapping *GuestPortMapping
+	Err         error
+}
+
+func (e *GuestPortMappingError) Error() string {
+	return fmt.Sprintf("nic %s: port mapping %s: %v", e.MAC, e.PortMapping, e.Err)
+}
+
+// FilterGuestPortMappings removes invalid port mappings of nics and those
+// sharing host ports with ones before them, and returns why they are
+// removed
+func FilterGuestPortMappings(nics []*GuestNIC) []*GuestPortMappingError {
+	errs := []*GuestPortMappingError{}
+	pms := GuestPortMappings{}
+	for _, nic := range nics {
+		nicPms := GuestPortMappings{}
+		for _, pm := range nic.PortMappings {
+			err := pm.Validate()
+			if err == nil {
+				for _, pm0 := range pms {
+					if pm.Overlaps(pm0) {
+						err = errors.Wrapf(errors.ErrInvalidFormat, "overlaps with %s", pm0)
+						break
+					}
+				}
+			}
+			if err != nil {
+				errs = append(errs, &GuestPortMappingError{
+					MAC:         nic.MAC,
+					PortMapping: pm,
+					Err:         err,
+				})
+				continue
+			}
+			pms = append(pms, pm)
+			nicPms = append(nicPms, pm)
+		}
+		nic.PortMappings = nicPms
+	}
+	return errs
+}
+
+// PortMappingMan keeps host ports claimed by port mappings of guests, so
+// that one guest cannot take host ports of another.  It is safe for
+// concurrent use
+type PortMappingMan struct {
+	mu     sync.Mutex
+	owners map[string]GuestPortMappings
+}
+
+func NewPortMappingMan() *PortMappingMan {
+	return &PortMappingMan{
+		owners: map[string]GuestPortMappings{},
+	}
+}
+
+// Claim replaces host ports claimed by owner with those of port mappings of
+// nics.  Port mappings sharing host ports with those of other owners are
+// removed from nics, and why returned
+func (pmm *PortMappingMan) Claim(owner string, nics []*GuestNIC) []*GuestPortMappingError {
+	pmm.mu.Lock()
+	defer pmm.mu.Unlock()
+
+	errs := []*GuestPortMappingError{}
+	claimed := GuestPortMappings{}
+	for _, nic := range nics {
+		nicPms := GuestPortMappings{}
+		for _, pm := range nic.PortMappings {
+			if owner0, pm0 := pmm.findOverlap(owner, pm); pm0 != nil {
+				errs = append(errs, &GuestPortMappingError{
+					MAC:         nic.MAC,
+					PortMapping: pm,
+					Err:         fmt.Errorf("overlaps with %s of %s", pm0, owner0),
+				})
+				continue
+			}
+			claimed = append(claimed, pm)
+			nicPms = append(nicPms, pm)
+		}
+		nic.PortMappings = nicPms
+	}
+	if len(claimed) > 0 {
+		pmm.owners[owner] = claimed
+	} else {
+		delete(pmm.owners, owner)
+	}
+	return errs
+}
+
+// findOverlap returns port mapping of owners other than owner sharing host
+// ports with pm.  It is called with pmm.mu held
+func (pmm *PortMappingMan) findOverlap(owner string, pm *GuestPortMapping) (string, *GuestPortMapping) {
+	for owner0, pms := range pmm.owners {
+		if owner0 == owner {
+			continue
+		}
+		for _, pm0 := range pms {
+			if pm.Overlaps(pm0) {
+				return owner0, pm0
+			}
+		}
+	}
+	return "", nil
+}
+
+// Release frees host ports claimed by owner
+func (pmm *PortMappingMan) Release(owner string) {
+	pmm.mu.Lock()
+	defer pmm.mu.Unlock()
+	delete(pmm.owners, owner)
+}
+
+type portMappingPort struct {
+	// host side tp_dst match
+	hostPort string
+	// guest side tp_dst, tp_src match
+	guestPort string
+	// non-zero if guest port differs from host port and needs rewrite
+	dnatPort int
+	// learned reverse flows match on a literal port instead of
+	// comparing with tp_dst of the original packet
+	literal bool
+}
+
+func (pm *GuestPortMapping) ports() []portMappingPort {
+	if !pm.IsRange() {
+		return []portMappingPort{
+			{
+				hostPort:  fmt.Sprintf("%d", *pm.HostPort),
+				guestPort: fmt.Sprintf("%d", pm.Port),
+				dnatPort:  pm.Port,
+				literal:   true,
+			},
+		}
+	}
+	ret := []portMappingPort{}
+	for _, m := range PortRangeToMasks(uint16(pm.Port), uint16(pm.PortEnd)) {
+		var ms string
+		if m[1] == 0xffff {
+			ms = fmt.Sprintf("%d", m[0])
+		} else {
+			ms = fmt.Sprintf("0x%x/0x%x", m[0], m[1])
+		}
+		ret = append(ret, portMappingPort{
+			hostPort:  ms,
+			guestPort: ms,
+		})
+	}
+	return ret
+}
+
+type portMappingFamily struct {
+	match    string
+	ethType  string
+	nwSrc    string
+	nwDst    string
+	nxmIpSrc string
+	nxmIpDst string
+	anyNet   string
+	suffix   string
+}
+
+var (
+	portMappingIPv4 = &portMappingFamily{
+		match:    "ip",
+		ethType:  "0x0800",
+		nwSrc:    "nw_src",
+		nwDst:    "nw_dst",
+		nxmIpSrc: "NXM_OF_IP_SRC[]",
+		nxmIpDst: "NXM_OF_IP_DST[]",
+		anyNet:   "0.0.0.0/0",
+	}
+	portMappingIPv6 = &portMappingFamily{
+		match:    "ipv6",
+		ethType:  "0x86dd",
+		nwSrc:    "ipv6_src",
+		nwDst:    "ipv6_dst",
+		nxmIpSrc: "NXM_NX_IPV6_SRC[]",
+		nxmIpDst: "NXM_NX_IPV6_DST[]",
+		anyNet:   "::/0",
+		suffix:   "6",
+	}
+)
+
+func (fam *portMappingFamily) modNwDst(ip string) string {
+	if fam == portMappingIPv6 {
+		return fmt.Sprintf("set_field:%s->ipv6_dst", ip)
+	}
+	return fmt.Sprintf("mod_nw_dst:%s", ip)
+}
+
+func (fam *portMappingFamily) modNwSrc(ip string) string {
+	if fam == portMappingIPv6 {
+		return fmt.Sprintf("set_field:%s->ipv6_src", ip)
+	}
+	return fmt.Sprintf("mod_nw_src:%s", ip)
+}
+
+// remoteNets returns remote networks of the family.  nil means the mapping
+// is not accessible from this family at all
+func (fam *portMappingFamily) remoteNets(remoteIps []string) []string {
+	if len(remoteIps) == 0 {
+		return []string{fam.anyNet}
+	}
+	ret := []string{}
+	for _, remoteNet := range remoteIps {
+		isV6 := strings.Contains(remoteNet, ":")
+		if isV6 == (fam == portMappingIPv6) {
+			ret = append(ret, remoteNet)
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+func (fam *portMappingFamily) srcMatch(remoteNet string) string {
+	if remoteNet == fam.anyNet {
+		return ""
+	}
+	return fmt.Sprintf("%s=%s,", fam.nwSrc, remoteNet)
+}
+
+type portMappingProto struct {
+	name     string
+	num      int
+	srcField string
+	nxmSrc   string
+	nxmDst   string
+}
+
+func getPortMappingProto(proto computeapi.GuestPortMappingProtocol) *portMappingProto {
+	switch proto {
+	case computeapi.GuestPortMappingProtocolUDP:
+		return &portMappingProto{
+			name:     "udp",
+			num:      17,
+			srcField: "udp_src",
+			nxmSrc:   "NXM_OF_UDP_SRC[]",
+			nxmDst:   "NXM_OF_UDP_DST[]",
+		}
+	case GuestPortMappingProtocolSCTP:
+		// sctp ports cannot be matched in learn() specs that FlowMan
+		// has to parse back, reverse flows are keyed by addresses only
+		return &portMappingProto{
+			name:   "sctp",
+			num:    132,
+			nxmSrc: "OXM_OF_SCTP_SRC[]",
+			nxmDst: "OXM_OF_SCTP_DST[]",
+		}
+	default:
+		return &portMappingProto{
+			name:     "tcp",
+			num:      6,
+			srcField: "tcp_src",
+			nxmSrc:   "NXM_OF_TCP_SRC[]",
+			nxmDst:   "NXM_OF_TCP_DST[]",
+		}
+	}
+}
+
+func (pp *portMappingProto) match(fam *portMappingFamily) string {
+	return fam.match + "," + pp.name + fam.suffix
+}
+
+// learnPortMatch returns tp matches of the learned reverse flow, including
+// the trailing comma
+func (pp *portMappingProto) learnPortMatch(port portMappingPort) string {
+	if pp.srcField == "" {
+		return ""
+	}
+	srcMatch := fmt.Sprintf("%s=%s", pp.nxmSrc, pp.nxmDst)
+	if port.literal {
+		srcMatch = fmt.Sprintf("%s=%s", pp.srcField, port.guestPort)
+	}
+	return fmt.Sprintf("%s,%s=%s,", srcMatch, pp.nxmDst, pp.nxmSrc)
+}
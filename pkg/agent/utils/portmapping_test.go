@@ -0,0 +1,275 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+func TestFilterGuestPortMappings(t *testing.T) {
+	cases := []struct {
+		name string
+		nics string
+		// kept is number of port mappings kept of each nic
+		kept []int
+	}{
+		{
+			name: "single",
+			nics: `[{"port_mappings":[{"protocol":"tcp","port":22,"host_port":20022}]}]`,
+			kept: []int{1},
+		},
+		{
+			name: "range",
+			nics: `[{"port_mappings":[{"protocol":"udp","port":30000,"port_end":30100,"host_port":30000}]}]`,
+			kept: []int{1},
+		},
+		{
+			name: "range shifted",
+			nics: `[{"port_mappings":[{"protocol":"udp","port":30000,"port_end":30100,"host_port":31000}]}]`,
+			kept: []int{0},
+		},
+		{
+			name: "no host port",
+			nics: `[{"port_mappings":[{"protocol":"tcp","port":22},{"protocol":"tcp","port":23,"host_port":20023}]}]`,
+			kept: []int{1},
+		},
+		{
+			name: "unknown protocol",
+			nics: `[{"port_mappings":[{"protocol":"icmp","port":22,"host_port":20022}]}]`,
+			kept: []int{0},
+		},
+		{
+			name: "different protocols",
+			nics: `[{"port_mappings":[{"protocol":"tcp","port":22,"host_port":20022},{"protocol":"sctp","port":22,"host_port":20022}]}]`,
+			kept: []int{2},
+		},
+		{
+			name: "overlap across nics",
+			nics: `[{"port_mappings":[{"protocol":"tcp","port":22,"host_port":20022}]},{"port_mappings":[{"protocol":"tcp","port":20000,"port_end":20100,"host_port":20000}]}]`,
+			kept: []int{1, 0},
+		},
+		{
+			name: "different host ips",
+			nics: `[{"port_mappings":[{"protocol":"tcp","port":22,"host_port":20022,"host_ip":"10.0.0.1"},{"protocol":"tcp","port":23,"host_port":20022,"host_ip":"10.0.0.2"}]}]`,
+			kept: []int{2},
+		},
+		{
+			name: "any host ip",
+			nics: `[{"port_mappings":[{"protocol":"tcp","port":22,"host_port":20022,"host_ip":"10.0.0.1"},{"protocol":"tcp","port":23,"host_port":20022}]}]`,
+			kept: []int{1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nics := []*GuestNIC{}
+			if err := json.Unmarshal([]byte(c.nics), &nics); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			total := 0
+			for _, nic := range nics {
+				total += len(nic.PortMappings)
+			}
+			errs := FilterGuestPortMappings(nics)
+			kept := 0
+			for i, nic := range nics {
+				if len(nic.PortMappings) != c.kept[i] {
+					t.Errorf("nic %d: want %d port mappings kept, got %d", i, c.kept[i], len(nic.PortMappings))
+				}
+				kept += len(nic.PortMappings)
+			}
+			if len(errs) != total-kept {
+				t.Errorf("want %d errors, got %v", total-kept, errs)
+			}
+		})
+	}
+}
+
+func TestPortMappingMan(t *testing.T) {
+	nicsOf := func(mac string, pms string) []*GuestNIC {
+		nics := []*GuestNIC{}
+		if err := json.Unmarshal([]byte(`[{"mac":"`+mac+`","port_mappings":`+pms+`}]`), &nics); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return nics
+	}
+	pmm := NewPortMappingMan()
+
+	nics0 := nicsOf("00:22:00:00:00:10", `[{"protocol":"tcp","port":22,"host_port":20022}]`)
+	if errs := pmm.Claim("vm0", nics0); len(errs) != 0 {
+		t.Fatalf("vm0: %v", errs)
+	}
+	// claims of the same owner are replaced
+	if errs := pmm.Claim("vm0", nics0); len(errs) != 0 {
+		t.Fatalf("vm0 again: %v", errs)
+	}
+
+	nics1 := nicsOf("00:22:00:00:00:11", `[{"protocol":"tcp","port":20000,"port_end":20100,"host_port":20000},{"protocol":"udp","port":22,"host_port":20022}]`)
+	errs := pmm.Claim("vm1", nics1)
+	if len(errs) != 1 || errs[0].MAC != "00:22:00:00:00:11" || errs[0].PortMapping.Protocol != "tcp" {
+		t.Fatalf("vm1: want tcp range rejected, got %v", errs)
+	}
+	if len(nics1[0].PortMappings) != 1 {
+		t.Errorf("vm1: want 1 port mapping kept, got %d", len(nics1[0].PortMappings))
+	}
+
+	pmm.Release("vm0")
+	nics1 = nicsOf("00:22:00:00:00:11", `[{"protocol":"tcp","port":20000,"port_end":20100,"host_port":20000}]`)
+	if errs := pmm.Claim("vm1", nics1); len(errs) != 0 {
+		t.Errorf("vm1 after vm0 released: %v", errs)
+	}
+	if errs := pmm.Claim("vm0", nicsOf("00:22:00:00:00:10", `[{"protocol":"tcp","port":22,"host_port":20022}]`)); len(errs) != 1 {
+		t.Errorf("vm0 after vm1 claimed: want 1 error, got %v", errs)
+	}
+}
+
+func TestGuestNicPortMappingFlows(t *testing.T) {
+	nic := &GuestNIC{}
+	err := json.Unmarshal([]byte(`{
+		"ip": "192.168.1.10",
+		"ip6": "fd00::10",
+		"mac": "00:22:00:00:00:10",
+		"port_mappings": [
+			{"protocol":"tcp","port":22,"host_port":20022},
+			{"protocol":"sctp","port":3868,"host_port":23868,"remote_ips":["fd00:1::/64"]},
+			{"protocol":"udp","port":30000,"port_end":30100,"host_port":30000}
+		]
+	}`), nic)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	nic.PortNo = 3
+	hostMAC, _ := net.ParseMAC("00:22:00:00:00:01")
+	hcn := &HostConfigNetwork{
+		Bridge: "br0",
+		Ifname: "eth0",
+		IP:     net.ParseIP("10.0.0.1"),
+		IP6:    net.ParseIP("fd00::1"),
+		mac:    hostMAC,
+	}
+	cases := []struct {
+		name    string
+		flows   []*ovs.Flow
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "local port",
+			flows: guestNicPortMappingFlows(nic, 3, nic.MAC, hcn, 1, "dl_vlan=0xffff"),
+			want: []string{
+				"tcp,in_port=1,tp_dst=20022,",
+				"tcp6,in_port=1,ipv6_dst=fd00::1,tp_dst=20022,",
+				"set_field:fd00::10->ipv6_dst,mod_tp_dst:22",
+				"sctp6,in_port=1,ipv6_src=fd00:1::/64,ipv6_dst=fd00::1,tp_dst=23868,",
+				"nw_proto=132,idle_timeout=300,load:NXM_OF_ETH_DST[]",
+				"load:OXM_OF_SCTP_DST[]->OXM_OF_SCTP_SRC[]",
+				"udp,in_port=1,tp_dst=0x7530/0xfff0,",
+				"NXM_OF_UDP_SRC[]=NXM_OF_UDP_DST[]",
+				"udp6,in_port=3,ipv6_src=fd00::10,tp_src=30100,",
+			},
+			notWant: []string{
+				// remote ips of sctp mapping are all ipv6
+				"sctp,in_port=1",
+			},
+		},
+		{
+			name:  "hairpin",
+			flows: guestNicPortMappingFlows(nic, 3, nic.MAC, hcn, 1, "dl_vlan=0xffff"),
+			want: []string{
+				// from other guests on the same bridge
+				"priority=28190,tcp,nw_dst=10.0.0.1,tp_dst=20022,reg0=0x20000/0x20000,table=0,idle_timeout=0,actions=learn(table=10,priority=10000,in_port=3,",
+				"load:0x1->NXM_NX_REG0[],load:0x3->NXM_NX_REG1[],mod_dl_dst:00:22:00:00:00:10,mod_nw_dst:192.168.1.10,mod_tp_dst:22,resubmit(,9)",
+				"priority=28190,tcp6,ipv6_dst=fd00::1,tp_dst=20022,reg0=0x20000/0x20000,",
+				// from the same guest
+				"priority=28201,tcp,in_port=3,nw_dst=10.0.0.1,tp_dst=20022,",
+				"learn(table=10,priority=10000,dl_type=0x0800,nw_src=192.168.1.10,nw_dst=10.0.0.1,nw_proto=6,tcp_src=22,",
+				"mod_dl_src:00:22:00:00:00:01,mod_dl_dst:00:22:00:00:00:10,mod_nw_dst:192.168.1.10,mod_tp_dst:22,mod_nw_src:10.0.0.1,load:0->NXM_OF_IN_PORT[],resubmit(,9)",
+				"priority=28203,tcp,in_port=3,nw_src=192.168.1.10,nw_dst=10.0.0.1,tp_src=22,table=0,idle_timeout=0,actions=load:0x4->NXM_NX_REG0[],load:0->NXM_OF_IN_PORT[],resubmit(,9)",
+				"set_field:fd00::1->ipv6_src,load:0->NXM_OF_IN_PORT[]",
+			},
+		},
+		{
+			name:  "hairpin source validation",
+			flows: guestNicHairpinSrcFlows(nic, hcn, true),
+			want: []string{
+				"priority=28195,ip,in_port=3,dl_src=00:22:00:00:00:10,nw_src=192.168.1.10,nw_dst=10.0.0.1,reg0=0x0/0x20000,table=0,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[17],resubmit(3,)",
+				"priority=28195,ipv6,in_port=3,dl_src=00:22:00:00:00:10,ipv6_src=fd00::10,ipv6_dst=fd00::1,reg0=0x0/0x20000,",
+			},
+			notWant: []string{
+				// spoofed sources are not marked and so not taken by
+				// hairpin flows of other guests
+				"dl_src=00:22:00:00:00:10,nw_dst=10.0.0.1,",
+				"dl_src=00:22:00:00:00:10,ipv6_dst=fd00::1,",
+			},
+		},
+		{
+			name:  "hairpin source validation without source ip check",
+			flows: guestNicHairpinSrcFlows(nic, hcn, false),
+			want: []string{
+				"priority=28195,ip,in_port=3,dl_src=00:22:00:00:00:10,nw_dst=10.0.0.1,reg0=0x0/0x20000,",
+				"priority=28195,ipv6,in_port=3,dl_src=00:22:00:00:00:10,ipv6_dst=fd00::1,reg0=0x0/0x20000,",
+			},
+			notWant: []string{
+				"nw_src=",
+				"ipv6_src=",
+			},
+		},
+		{
+			name:  "no hairpin towards hostlocal bridge",
+			flows: guestNicPortMappingFlows(nic, -1, hcn.mac.String(), hcn, 0, ""),
+			notWant: []string{
+				"priority=28190,",
+				"priority=28201,",
+				"priority=28203,",
+			},
+		},
+		{
+			name:  "hostlocal bridge",
+			flows: guestNicPortMappingFlowsLocal(nic, "10.0.0.1", "", "00:22:00:00:00:01", 3, nic.MAC),
+			want: []string{
+				"tcp,nw_dst=10.0.0.1,tp_dst=20022,",
+				"tcp6,ipv6_dst=fd00::10,tp_dst=22,",
+				"udp,in_port=3,nw_src=192.168.1.10,tp_src=0x7530/0xfff0,",
+				// hairpin from the same guest
+				"priority=28201,tcp,in_port=3,nw_dst=10.0.0.1,tp_dst=20022,",
+				"mod_nw_src:10.0.0.1,load:0->NXM_OF_IN_PORT[],output:3",
+				"priority=28203,tcp,in_port=3,nw_src=192.168.1.10,nw_dst=10.0.0.1,tp_src=22,table=0,idle_timeout=0,actions=load:0->NXM_OF_IN_PORT[],resubmit(,10)",
+			},
+			notWant: []string{
+				// no host ipv6 address to map on
+				"tcp6,ipv6_dst=fd00::1,",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			txt := marshalFlows(t, c.flows)
+			for _, w := range c.want {
+				if !strings.Contains(txt, w) {
+					t.Errorf("want %q in flows:\n%s", w, txt)
+				}
+			}
+			for _, w := range c.notWant {
+				if strings.Contains(txt, w) {
+					t.Errorf("do not want %q in flows:\n%s", w, txt)
+				}
+			}
+		})
+	}
+}
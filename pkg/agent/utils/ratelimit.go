@@ -0,0 +1,143 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+const (
+	// RateLimitBackendIfb shapes packets from guest nics with tbf on ifb
+	// devices they are redirected to, and packets towards them with tbf
+	// on the tap
+	RateLimitBackendIfb = "ifb"
+	// RateLimitBackendOvs polices packets from guest nics with
+	// ingress_policing of ovs interfaces, and packets towards them with
+	// openflow meters
+	RateLimitBackendOvs = "ovs"
+
+	// GuestMeterTable holds flows metering packets towards guest nics.
+	// Flows of the table, and guard flows in table 0 diverting packets to
+	// it, are managed by tcman with ovs-ofctl, as meter actions are not
+	// understood by FlowMan.  Guard flows are added after the meter flows
+	// and deleted before them, so that no packet is diverted to the table
+	// without a flow to take it back
+	GuestMeterTable = 14
+
+	guestNicMeterGuardPrio = 29110
+	guestNicMeterFlowPrio  = 10000
+
+	// burst of policing and meters, in fraction of a second of the rate
+	ovsPolicingBurstDivisor = 10
+)
+
+// ovsPolicingBurstKb returns burst in kilobits for rateKbps, from burst in
+// bytes if it is set
+func ovsPolicingBurstKb(rateKbps uint64, burst uint64) uint64 {
+	if burst > 0 {
+		return burst * 8 / 1000
+	}
+	return rateKbps / ovsPolicingBurstDivisor
+}
+
+// OvsIngressPolicing returns ingress_policing_rate and
+// ingress_policing_burst of the interface of guest nic, limiting packets
+// from the guest.  Zero rate disables policing
+func (td *TcData) OvsIngressPolicing() (rateKbps uint64, burstKb uint64) {
+	rateKbps = uint64(float64(td.EgressMbps) * egressAmplifier * 1000)
+	if rateKbps == 0 {
+		return 0, 0
+	}
+	return rateKbps, ovsPolicingBurstKb(rateKbps, td.EgressBurst)
+}
+
+// HasGuestMeter tells whether packets towards the guest nic are metered
+func (td *TcData) HasGuestMeter() bool {
+	return td.IngressMbps > 0 && td.PortNo > 0 && len(td.MAC) > 0
+}
+
+// GuestMeterId returns id of the meter of the guest nic, unique in the
+// bridge
+func (td *TcData) GuestMeterId() uint32 {
+	return uint32(td.PortNo)
+}
+
+// GuestMeterBand returns the drop band of the meter as shown by
+// "ovs-ofctl dump-meters"
+func (td *TcData) GuestMeterBand() string {
+	rateKbps := uint64(float64(td.IngressMbps) * ingressAmplifier * 1000)
+	burstKb := ovsPolicingBurstKb(rateKbps, td.IngressBurst)
+	return fmt.Sprintf("type=drop rate=%d burst_size=%d", rateKbps, burstKb)
+}
+
+// GuestMeterSpec returns argument of "ovs-ofctl add-meter" for the meter
+func (td *TcData) GuestMeterSpec() string {
+	return fmt.Sprintf("meter=%d,kbps,burst,band=%s", td.GuestMeterId(), strings.ReplaceAll(td.GuestMeterBand(), " ", ","))
+}
+
+// GuestMeterMatch returns match of the meter flow of guest nic in
+// GuestMeterTable
+func (td *TcData) GuestMeterMatch() string {
+	return fmt.Sprintf("table=%d,dl_dst=%s", GuestMeterTable, td.MAC)
+}
+
+// GuestMeterFlow returns the meter flow of guest nic for "ovs-ofctl
+// add-flow".  Metered packets go back to table 0 with reg6 set
+func (td *TcData) GuestMeterFlow() string {
+	return fmt.Sprintf("%s,priority=%d,actions=meter:%d,load:0x1->NXM_NX_REG6[],resubmit(,0)", td.GuestMeterMatch(), guestNicMeterFlowPrio, td.GuestMeterId())
+}
+
+// GuestMeterFallbackFlow returns flow of GuestMeterTable sending packets
+// without meter flows back to table 0, e.g. before tcman adds them
+func GuestMeterFallbackFlow() string {
+	return fmt.Sprintf("table=%d,priority=0,actions=load:0x1->NXM_NX_REG6[],resubmit(,0)", GuestMeterTable)
+}
+
+// GuestMeterGuardMatch returns match of the guard flow diverting packets
+// towards the guest nic to GuestMeterTable, for "ovs-ofctl --strict"
+func (td *TcData) GuestMeterGuardMatch() string {
+	return fmt.Sprintf("table=0,priority=%d,dl_dst=%s,reg6=0", guestNicMeterGuardPrio, td.MAC)
+}
+
+// GuestMeterGuardFlow returns the guard flow of guest nic for "ovs-ofctl
+// add-flow".  reg6 records that the packet was metered
+func (td *TcData) GuestMeterGuardFlow() string {
+	return fmt.Sprintf("%s,actions=resubmit(,%d)", td.GuestMeterGuardMatch(), GuestMeterTable)
+}
+
+// IsGuestMeterGuardFlow tells whether f is a guard flow managed by tcman
+func IsGuestMeterGuardFlow(f *ovs.Flow) bool {
+	return f.Table == 0 && f.Priority == guestNicMeterGuardPrio
+}
+
+// GuestOvsQdiscTree returns qdiscs of the tap of guest nic when bandwidth
+// is limited by ovs.  Only netem, packet rate limits and bpf programs are
+// left to tc
+func (td *TcData) GuestOvsQdiscTree() *tc.QdiscTree {
+	qs := []tc.IQdisc{}
+	if td.Netem.IsEnabled() {
+		qs = append(qs, td.netemQdisc())
+	}
+	if td.useClsact() {
+		qs = append(qs, td.ingressQdisc())
+	}
+	filters := append(td.guestNicPpsFilter(), td.guestNicBpfFilter()...)
+	return tc.NewQdiscTree(qs, nil, filters)
+}
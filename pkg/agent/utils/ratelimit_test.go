@@ -0,0 +1,71 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTcDataGuestMeterGuardFlow(t *testing.T) {
+	td := (&GuestNIC{PortNo: 0x1a, Bw: 100, MAC: "00:22:33:44:55:66"}).TcData()
+	want := "table=0,priority=29110,dl_dst=00:22:33:44:55:66,reg6=0,actions=resubmit(,14)"
+	if got := td.GuestMeterGuardFlow(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	f := F(0, 29110, "dl_dst=00:22:33:44:55:66,reg6=0", "resubmit(,14)")
+	if !IsGuestMeterGuardFlow(f) {
+		t.Errorf("want guard flow %s recognized", want)
+	}
+}
+
+func TestTcDataOvsRateLimit(t *testing.T) {
+	td := (&GuestNIC{
+		IfnameHost: "vnet1",
+		PortNo:     0x1a,
+		MAC:        "00:22:33:44:55:66",
+		Bw:         100,
+		TxBurst:    250000,
+	}).TcData()
+	rate, burst := td.OvsIngressPolicing()
+	if rate != 110000 || burst != 2000 {
+		t.Errorf("policing: want 110000 2000, got %d %d", rate, burst)
+	}
+	if want, got := "meter=26,kbps,burst,band=type=drop,rate=100000,burst_size=10000", td.GuestMeterSpec(); got != want {
+		t.Errorf("meter spec: want %q, got %q", want, got)
+	}
+	if want, got := "table=14,dl_dst=00:22:33:44:55:66,priority=10000,actions=meter:26,load:0x1->NXM_NX_REG6[],resubmit(,0)", td.GuestMeterFlow(); got != want {
+		t.Errorf("meter flow: want %q, got %q", want, got)
+	}
+
+	td = (&GuestNIC{IfnameHost: "vnet1", PortNo: 0x1a}).TcData()
+	if rate, burst := td.OvsIngressPolicing(); rate != 0 || burst != 0 {
+		t.Errorf("no bandwidth: want no policing, got %d %d", rate, burst)
+	}
+}
+
+func TestTcDataGuestOvsQdiscTree(t *testing.T) {
+	// switching from ifb to ovs leaves only pps limits on the tap
+	nic := &GuestNIC{IfnameHost: "vnet1", Bw: 100, RxPpsLimit: 10000}
+	current := nic.TcData().GuestQdiscTree()
+	got := nic.TcData().GuestOvsQdiscTree().Delta(current, "vnet1")
+	want := [][]string{
+		{"filter", "delete", "dev", "vnet1", "ingress", "protocol", "all", "prio", "49153", "u32"},
+		{"qdisc", "delete", "dev", "vnet1", "root", "handle", "1:"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+const (
+	// guestNicBpfPrio is the prio of bpf programs on taps of guest nics.
+	// They run after packet rate policing and before redirecting to ifb,
+	// and should return TC_ACT_UNSPEC for packets to go on to the
+	// following filters
+	guestNicBpfPrio   = 2
+	guestNicBpfHandle = 1
+)
+
+// GuestBpfProgram is a bpf program attached with direct action to a hook
+// of clsact qdisc on taps of guest nics
+type GuestBpfProgram struct {
+	// Object is path of the ELF object file
+	Object string `json:"object"`
+	// Section is the ELF section of the program, empty for tc default
+	Section string `json:"section,omitempty"`
+}
+
+// ParseGuestBpfProgram parses program in the form of "object[:section]"
+func ParseGuestBpfProgram(s string) (*GuestBpfProgram, error) {
+	object, section, _ := strings.Cut(s, ":")
+	if object == "" {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "empty object file in %q", s)
+	}
+	return &GuestBpfProgram{
+		Object:  object,
+		Section: section,
+	}, nil
+}
+
+// useClsact tells whether taps need clsact qdisc instead of ingress, for
+// packet rate limits, bpf programs, or clsact found there
+func (td *TcData) useClsact() bool {
+	return td.hasPpsLimit() || td.BpfIngress != nil || td.BpfEgress != nil || td.keepClsact
+}
+
+// WithClsact returns copy of td keeping clsact qdisc already on the tap.
+// Programs attached there by others are left alone
+func (td *TcData) WithClsact() *TcData {
+	td2 := *td
+	td2.keepClsact = true
+	return &td2
+}
+
+func (td *TcData) bpfFilter(hook string, prog *GuestBpfProgram) *tc.SBpfFilter {
+	return &tc.SBpfFilter{
+		SBaseTcFilter: &tc.SBaseTcFilter{
+			Kind:     "bpf",
+			Parent:   td.ingressQdisc(),
+			Hook:     hook,
+			Prio:     guestNicBpfPrio,
+			Protocol: "all",
+		},
+		Handle:       guestNicBpfHandle,
+		Object:       prog.Object,
+		Section:      prog.Section,
+		DirectAction: true,
+	}
+}
+
+func (td *TcData) guestNicBpfFilter() []tc.IFilter {
+	filters := []tc.IFilter{}
+	if td.BpfIngress != nil {
+		filters = append(filters, td.bpfFilter(tc.FilterHookIngress, td.BpfIngress))
+	}
+	if td.BpfEgress != nil {
+		filters = append(filters, td.bpfFilter(tc.FilterHookEgress, td.BpfEgress))
+	}
+	return filters
+}
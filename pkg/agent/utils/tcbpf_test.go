@@ -0,0 +1,86 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+func TestParseGuestBpfProgram(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    *GuestBpfProgram
+		wantErr bool
+	}{
+		{in: "/opt/bpf/prog.o", want: &GuestBpfProgram{Object: "/opt/bpf/prog.o"}},
+		{in: "/opt/bpf/prog.o:tc", want: &GuestBpfProgram{Object: "/opt/bpf/prog.o", Section: "tc"}},
+		{in: ":tc", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ParseGuestBpfProgram(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%q: want error, got %v", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: want %v, got %v", c.in, c.want, got)
+		}
+	}
+}
+
+func TestTcDataBpf(t *testing.T) {
+	t.Run("managed programs", func(t *testing.T) {
+		td := (&GuestNIC{IfnameHost: "vnet1", Bw: 100}).TcData()
+		td.BpfIngress = &GuestBpfProgram{Object: "/opt/bpf/prog.o"}
+		td.BpfEgress = &GuestBpfProgram{Object: "/opt/bpf/prog.o", Section: "tc"}
+		got := td.GuestQdiscTree().Delta(tc.NewQdiscTree(nil, nil, nil), "vnet1")
+		want := [][]string{
+			{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+			{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "clsact"},
+			{"filter", "add", "dev", "vnet1", "egress", "protocol", "all", "prio", "2", "handle", "0x1", "bpf", "object-file", "/opt/bpf/prog.o", "section", "tc", "direct-action"},
+			{"filter", "add", "dev", "vnet1", "ingress", "protocol", "all", "prio", "2", "handle", "0x1", "bpf", "object-file", "/opt/bpf/prog.o", "direct-action"},
+			{"filter", "add", "dev", "vnet1", "ingress", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v\ngot  %v", want, got)
+		}
+	})
+	t.Run("foreign programs", func(t *testing.T) {
+		current, err := tc.NewQdiscTreeFromString(
+			`qdisc tbf 1: root refcnt 2 rate 100Mbit burst 12500b lat 100ms
+qdisc clsact ffff: parent ffff:fff1`,
+			"",
+			`filter ingress protocol all pref 1 bpf chain 0 handle 0x1 cilium.o:[from-container] direct-action not_in_hw id 97 name cil_from_container tag 59f4a931744dcdc6 jited`,
+		)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		td := (&GuestNIC{IfnameHost: "vnet1", Bw: 100}).TcData()
+		got := td.WithClsact().GuestQdiscTree().Delta(current, "vnet1")
+		want := [][]string{
+			{"filter", "add", "dev", "vnet1", "ingress", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v\ngot  %v", want, got)
+		}
+	})
+}
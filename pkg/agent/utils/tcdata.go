@@ -16,6 +16,14 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+
+	"yunion.io/x/log"
 
 	"yunion.io/x/sdnagent/pkg/tc"
 )
@@ -27,6 +35,27 @@ const (
 
 	ingressAmplifier = 1.0
 	egressAmplifier  = 1.1
+
+	tbfMinBurst = 3400
+	// tbfDefaultLatency is in microseconds as QdiscTbf.Latency is.  The
+	// former 100000000 meant to be 100ms was 100s
+	tbfDefaultLatency = 100000 // 100ms
+
+	guestNicPolicePrio = 1
+	guestNicFwPrio     = 1
+	// guestNicRedirectPrio is the prio of the u32 filter redirecting all
+	// packets from the guest to ifb.  It differs from 49152 of the former
+	// ip only filter, as kernels may keep an empty u32 of protocol ip at
+	// that prio after its last key is deleted, refusing filters of other
+	// protocols there
+	guestNicRedirectPrio = 49153
+
+	guestNicNetemChildHandle = "10:"
+	// guestNicMqChildHandleBase plus queue number, starting from 1, is the
+	// handle of tbf of the queue
+	guestNicMqChildHandleBase = 0x10
+
+	hostDefaultClassShare = 10
 )
 
 type TcData struct {
@@ -34,35 +63,189 @@ type TcData struct {
 	IngressMbps uint64 `json:"ingress_mbps"`
 	EgressMbps  uint64 `json:"egress_mbps"`
 
+	// optional shaping parameters, zero for defaults derived from the
+	// rate.  Burst is in bytes, latency in milliseconds
+	IngressBurst     uint64 `json:"ingress_burst,omitempty"`
+	EgressBurst      uint64 `json:"egress_burst,omitempty"`
+	IngressLatencyMs uint64 `json:"ingress_latency_ms,omitempty"`
+	EgressLatencyMs  uint64 `json:"egress_latency_ms,omitempty"`
+
+	// packets per second ceiling, zero for no limit
+	IngressPps uint64 `json:"ingress_pps,omitempty"`
+	EgressPps  uint64 `json:"egress_pps,omitempty"`
+
+	// network emulation towards the guest
+	Netem *GuestNICNetem `json:"netem,omitempty"`
+
+	// bpf programs on ingress and egress hooks of the tap
+	BpfIngress *GuestBpfProgram `json:"bpf_ingress,omitempty"`
+	BpfEgress  *GuestBpfProgram `json:"bpf_egress,omitempty"`
+	// QueueShaping shapes each queue of multiqueue taps instead of all
+	// queues together at root
+	QueueShaping bool `json:"queue_shaping,omitempty"`
+	// UplinkShaping is set on host uplinks shaping packets from guest
+	// nics with htb classes
+	UplinkShaping bool `json:"uplink_shaping,omitempty"`
+	// keepClsact is set when clsact is found on the tap
+	keepClsact bool
+	// txQueues is the number of tx queues of the tap
+	txQueues int
+
 	Bridge string `json:"bridge"`
 	PortNo int    `json:"port_no"`
+	MAC    string `json:"mac,omitempty"`
+}
+
+// NewHostTcData returns tc data of the host uplink ifname attached to
+// bridge, with egress rate set to the detected link speed
+func NewHostTcData(bridge, ifname string, shaping bool) *TcData {
+	if ifname == "" {
+		ifname = bridge
+	}
+	return &TcData{
+		Ifname:        ifname,
+		EgressMbps:    linkSpeedMbps(ifname),
+		Bridge:        bridge,
+		UplinkShaping: shaping,
+	}
+}
+
+// LinkTxQueues returns number of tx queues of the link, 0 if unknown
+func LinkTxQueues(ifname string) int {
+	queues, err := filepath.Glob(fmt.Sprintf("/sys/class/net/%s/queues/tx-*", ifname))
+	if err != nil {
+		return 0
+	}
+	return len(queues)
+}
+
+// linkSpeedMbps returns speed of the link as reported by its driver, 0 if
+// unknown, e.g. for virtual devices
+func linkSpeedMbps(ifname string) uint64 {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/speed", ifname))
+	if err != nil {
+		log.Debugf("read speed of %s: %v", ifname, err)
+		return 0
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return uint64(speed)
 }
 
 func (td TcData) IfbIfname() string {
 	return "r" + td.Ifname
 }
 
+// WithTxQueues returns copy of td for tap of n tx queues
+func (td *TcData) WithTxQueues(n int) *TcData {
+	td2 := *td
+	td2.txQueues = n
+	return &td2
+}
+
 func (td *TcData) guestNicRootQdisc() []tc.IQdisc {
+	tbf := td.tbfQdisc(uint64(float64(td.IngressMbps)*ingressAmplifier), td.IngressBurst, td.IngressLatencyMs)
+	if td.QueueShaping && td.txQueues > 1 && !td.Netem.IsEnabled() {
+		return append(td.guestNicMqQdisc(tbf), td.ingressQdisc())
+	}
+	if !td.Netem.IsEnabled() {
+		return []tc.IQdisc{
+			tbf,
+			td.ingressQdisc(),
+		}
+	}
+	// packets are delayed by netem at root before shaped by tbf
+	tbf.Handle = guestNicNetemChildHandle
+	tbf.Parent = "1:1"
+	tbf.Root = false
 	return []tc.IQdisc{
-		td.tbfQdisc(uint64(float64(td.IngressMbps) * ingressAmplifier)),
+		td.netemQdisc(),
+		tbf,
 		td.ingressQdisc(),
 	}
 }
 
+// guestNicMqQdisc keeps mq of multiqueue taps, and shapes each queue with
+// an even share of tbf.  Queues are dequeued without locks of each other,
+// at the cost that a single flow, hashed to one queue, gets its share only.
+// So it is only done with QueueShaping, otherwise tbf at root shapes all
+// queues with the whole rate.  Netem, delaying packets of all queues, still
+// goes at root
+func (td *TcData) guestNicMqQdisc(tbf *tc.QdiscTbf) []tc.IQdisc {
+	mq := &tc.QdiscMq{
+		SBaseTcQdisc: &tc.SBaseTcQdisc{
+			Kind:   "mq",
+			Handle: "1:",
+			Root:   true,
+		},
+	}
+	n := uint64(td.txQueues)
+	burst := tbf.Burst / n
+	if burst < tbfMinBurst {
+		burst = tbfMinBurst
+	}
+	qs := []tc.IQdisc{mq}
+	for i := 0; i < td.txQueues; i++ {
+		qs = append(qs, &tc.QdiscTbf{
+			SBaseTcQdisc: &tc.SBaseTcQdisc{
+				Kind:   "tbf",
+				Handle: fmt.Sprintf("%x:", guestNicMqChildHandleBase+i+1),
+				Parent: mq.QueueClassId(i),
+			},
+			Rate:    tbf.Rate / n,
+			Burst:   burst,
+			Latency: tbf.Latency,
+		})
+	}
+	return qs
+}
+
+func (td *TcData) netemQdisc() *tc.QdiscNetem {
+	n := td.Netem
+	reorder, jitter := n.Reorder, n.JitterMs
+	if n.DelayMs <= 0 {
+		// jitter is of the delay, and reordering works by sending some
+		// packets without delay
+		reorder, jitter = 0, 0
+	}
+	return &tc.QdiscNetem{
+		SBaseTcQdisc: &tc.SBaseTcQdisc{
+			Kind:   "netem",
+			Handle: "1:",
+			Parent: "",
+			Root:   true,
+		},
+		Limit:     uint32(n.Limit),
+		Delay:     uint64(n.DelayMs * 1000),
+		Jitter:    uint64(jitter * 1000),
+		Loss:      n.Loss,
+		Duplicate: n.Duplicate,
+		Reorder:   reorder,
+		Corrupt:   n.Corrupt,
+	}
+}
+
 func (td *TcData) guestIfbNicRootQdisc() []tc.IQdisc {
 	return []tc.IQdisc{
-		td.tbfQdisc(uint64(float64(td.EgressMbps) * egressAmplifier)),
+		td.tbfQdisc(uint64(float64(td.EgressMbps)*egressAmplifier), td.EgressBurst, td.EgressLatencyMs),
 	}
 }
 
-func (td *TcData) tbfQdisc(rateMbps uint64) *tc.QdiscTbf {
+func (td *TcData) tbfQdisc(rateMbps uint64, burst uint64, latencyMs uint64) *tc.QdiscTbf {
 	rates := rateMbps * 1000 * 1000
-	bytesPerSec := rates / 8
-	burst := bytesPerSec / 1000
-	if burst < 3400 {
-		burst = 3400
+	if burst == 0 {
+		bytesPerSec := rates / 8
+		burst = bytesPerSec / 1000
+	}
+	if burst < tbfMinBurst {
+		burst = tbfMinBurst
+	}
+	latency := uint64(tbfDefaultLatency)
+	if latencyMs > 0 {
+		latency = latencyMs * 1000
 	}
-	latency := 100000000 // 100ms
 	return &tc.QdiscTbf{
 		SBaseTcQdisc: &tc.SBaseTcQdisc{
 			Kind:   "tbf",
@@ -72,11 +255,28 @@ func (td *TcData) tbfQdisc(rateMbps uint64) *tc.QdiscTbf {
 		},
 		Rate:    rates,
 		Burst:   burst,
-		Latency: uint64(latency),
+		Latency: latency,
 	}
 }
 
-func (td *TcData) ingressQdisc() *tc.QdiscIngress {
+func (td *TcData) hasPpsLimit() bool {
+	return td.IngressPps > 0 || td.EgressPps > 0
+}
+
+// ingressQdisc returns clsact qdisc when packet rate of either direction is
+// limited, as packets towards the guest can only be policed at the egress
+// hook of clsact.  So is it for bpf programs
+func (td *TcData) ingressQdisc() tc.IQdisc {
+	if td.useClsact() {
+		return &tc.QdiscClsact{
+			SBaseTcQdisc: &tc.SBaseTcQdisc{
+				Kind:   "clsact",
+				Handle: "ffff:",
+				Parent: "",
+				Root:   false,
+			},
+		}
+	}
 	return &tc.QdiscIngress{
 		SBaseTcQdisc: &tc.SBaseTcQdisc{
 			Kind:   "ingress",
@@ -87,6 +287,38 @@ func (td *TcData) ingressQdisc() *tc.QdiscIngress {
 	}
 }
 
+// ingressFilterBase returns base of filters matching packets from the guest
+func (td *TcData) ingressFilterBase(kind string, prio uint32, proto string) *tc.SBaseTcFilter {
+	f := &tc.SBaseTcFilter{
+		Kind:     kind,
+		Parent:   td.ingressQdisc(),
+		Prio:     prio,
+		Protocol: proto,
+	}
+	if td.useClsact() {
+		f.Hook = tc.FilterHookIngress
+	}
+	return f
+}
+
+func (td *TcData) ppsPoliceFilter(hook string, pps uint64) *tc.SMatchallFilter {
+	burst := pps / 10
+	if burst == 0 {
+		burst = 1
+	}
+	return &tc.SMatchallFilter{
+		SBaseTcFilter: &tc.SBaseTcFilter{
+			Kind:     "matchall",
+			Parent:   td.ingressQdisc(),
+			Hook:     hook,
+			Prio:     guestNicPolicePrio,
+			Protocol: "all",
+		},
+		PktsRate:  pps,
+		PktsBurst: burst,
+	}
+}
+
 func (td *TcData) hostRootQdisc() []tc.IQdisc {
 	return []tc.IQdisc{
 		&tc.QdiscHtb{
@@ -101,24 +333,36 @@ func (td *TcData) hostRootQdisc() []tc.IQdisc {
 	}
 }
 
+// hostUplinkRate returns rate of the uplink in bits per second.  For host
+// interfaces EgressMbps is the detected link speed
+func (td *TcData) hostUplinkRate() uint64 {
+	if td.EgressMbps > 0 {
+		return td.EgressMbps * 1000 * 1000
+	}
+	return DefaultHostHtbRate
+}
+
 func (td *TcData) hostRootClass() []tc.IClass {
+	rate := td.hostUplinkRate()
 	rootClass := &tc.SHtbClass{
 		SBaseTcClass: &tc.SBaseTcClass{
 			Kind:    "htb",
 			ClassId: "1:1",
 			Parent:  nil,
 		},
-		Rate: DefaultHostHtbRate,
-		Ceil: DefaultHostHtbRate,
+		Rate: rate,
+		Ceil: rate,
 	}
+	// traffic not from guests, e.g. the host itself, is guaranteed a
+	// fraction of the uplink and may borrow the rest
 	defaultClass := &tc.SHtbClass{
 		SBaseTcClass: &tc.SBaseTcClass{
 			Kind:    "htb",
 			ClassId: fmt.Sprintf("1:%x", OvsLocalPortNo),
 			Parent:  rootClass,
 		},
-		Rate: DefaultHostHtbRate,
-		Ceil: DefaultHostHtbRate,
+		Rate: rate / hostDefaultClassShare,
+		Ceil: rate,
 	}
 	return []tc.IClass{
 		rootClass,
@@ -126,42 +370,92 @@ func (td *TcData) hostRootClass() []tc.IClass {
 	}
 }
 
-func (td *TcData) guestNicClass() []tc.IClass {
+// hasHostGuestClass tells whether the guest nic gets its own class under
+// the host root.  The class minor is the port number, which must not clash
+// with the root and default classes
+func (td *TcData) hasHostGuestClass() bool {
+	return td.EgressMbps > 0 && td.PortNo > 1 && td.PortNo < OvsLocalPortNo
+}
+
+// GuestNicFwMark returns the mark set by openflow on packets from the guest
+// nic, for classifying them with fw filter on the host uplink
+func (td *TcData) GuestNicFwMark() uint32 {
+	return uint32(td.PortNo)
+}
+
+// guestNicFwMarkFlows returns flow setting fw mark on packets from the
+// guest nic.  reg5 records that the mark was set so that the resubmitted
+// packet goes on with the other flows of the port
+func guestNicFwMarkFlows(nic *GuestNIC) []*ovs.Flow {
+	td := nic.TcData()
+	if !td.hasHostGuestClass() {
+		return nil
+	}
+	return []*ovs.Flow{
+		F(0, 29100, fmt.Sprintf("in_port=%d,reg5=0", nic.PortNo),
+			fmt.Sprintf("load:0x1->NXM_NX_REG5[],load:0x%x->NXM_NX_PKT_MARK[],resubmit:%d", td.GuestNicFwMark(), nic.PortNo)),
+	}
+}
+
+func (td *TcData) guestNicClassId() string {
+	return fmt.Sprintf("1:%x", td.PortNo)
+}
+
+// HostGuestClassId returns id of the class of the guest nic under the host
+// root, and whether the nic has one
+func (td *TcData) HostGuestClassId() (string, bool) {
+	return td.guestNicClassId(), td.hasHostGuestClass()
+}
+
+func (td *TcData) guestNicClass(rootCls tc.IClass, rate, ceil uint64) []tc.IClass {
 	return []tc.IClass{
-		/* &tc.SHtbClass{
+		&tc.SHtbClass{
 			SBaseTcClass: &tc.SBaseTcClass{
 				Kind:    "htb",
-				ClassId: fmt.Sprintf("1:%x", td.PortNo),
-				Parent:  hostRootClass,
+				ClassId: td.guestNicClassId(),
+				Parent:  rootCls,
 			},
-			Rate: td.EgressMbps * 1000 * 1000,
-			Ceil: td.EgressMbps * 1000 * 1000,
-		}, */
+			Rate: rate,
+			Ceil: ceil,
+		},
 	}
 }
 
-func (td *TcData) guestNicFilter() []tc.IFilter {
+func (td *TcData) guestNicFwFilter(rootQdisc tc.IQdisc) []tc.IFilter {
 	return []tc.IFilter{
-		/* &tc.SFwFilter{
+		&tc.SFwFilter{
 			SBaseTcFilter: &tc.SBaseTcFilter{
 				Kind:     "fw",
-				Parent:   hostRootQdisc,
-				Prio:     1,
-				Protocol: "ip",
+				Parent:   rootQdisc,
+				Prio:     guestNicFwPrio,
+				Protocol: "all",
 			},
-			ClassId: fmt.Sprintf("1:%x", td.PortNo),
-			Handle:  uint32(td.PortNo),
-		}, */
+			ClassId: td.guestNicClassId(),
+			Handle:  td.GuestNicFwMark(),
+		},
+	}
+}
+
+func (td *TcData) guestNicFilter() []tc.IFilter {
+	filters := []tc.IFilter{
 		&tc.SU32Filter{
-			SBaseTcFilter: &tc.SBaseTcFilter{
-				Kind:     "u32",
-				Parent:   td.ingressQdisc(),
-				Prio:     49152,
-				Protocol: "ip",
-			},
-			RedirectDev: td.IfbIfname(),
+			SBaseTcFilter: td.ingressFilterBase("u32", guestNicRedirectPrio, "all"),
+			RedirectDev:   td.IfbIfname(),
 		},
 	}
+	filters = append(filters, td.guestNicPpsFilter()...)
+	return append(filters, td.guestNicBpfFilter()...)
+}
+
+func (td *TcData) guestNicPpsFilter() []tc.IFilter {
+	filters := []tc.IFilter{}
+	if td.EgressPps > 0 {
+		filters = append(filters, td.ppsPoliceFilter(tc.FilterHookIngress, td.EgressPps))
+	}
+	if td.IngressPps > 0 {
+		filters = append(filters, td.ppsPoliceFilter(tc.FilterHookEgress, td.IngressPps))
+	}
+	return filters
 }
 
 func (td *TcData) GuestQdiscTree() *tc.QdiscTree {
@@ -172,10 +466,42 @@ func (td *TcData) GuestIfbQdiscTree() *tc.QdiscTree {
 	return tc.NewQdiscTree(td.guestIfbNicRootQdisc(), nil, nil)
 }
 
-func (td *TcData) HostRootQdiscTree() *tc.QdiscTree {
-	return tc.NewQdiscTree(td.hostRootQdisc(), td.hostRootClass(), nil)
+// HostUplinkQdiscTree returns tree of the host uplink with classes of the
+// guest nics.  When bandwidth of guest nics adds up to more than the uplink
+// less the share of the default class, rates of their classes are scaled
+// down to fit, and ceils are left at their bandwidth
+func (td *TcData) HostUplinkQdiscTree(guests []*TcData) *tc.QdiscTree {
+	qt := tc.NewQdiscTree(td.hostRootQdisc(), td.hostRootClass(), nil)
+	rootQdisc := qt.RootQdisc()
+	rootCls := qt.RootClass()
+	uplinkRate := td.hostUplinkRate()
+	guestRate := uplinkRate - uplinkRate/hostDefaultClassShare
+	total := uint64(0)
+	for _, guest := range guests {
+		if guest.hasHostGuestClass() {
+			total += guest.EgressMbps * 1000 * 1000
+		}
+	}
+	for _, guest := range guests {
+		if !guest.hasHostGuestClass() {
+			continue
+		}
+		ceil := guest.EgressMbps * 1000 * 1000
+		rate := ceil
+		if total > guestRate {
+			rate = uint64(float64(ceil) * float64(guestRate) / float64(total))
+			if rate == 0 {
+				rate = 1
+			}
+		}
+		qt.Merge(tc.NewQdiscTree(nil, guest.guestNicClass(rootCls, rate, ceil), guest.guestNicFwFilter(rootQdisc)))
+	}
+	return qt
 }
 
-func (td *TcData) HostGuestQdiscTree(rootCls tc.IClass, rootQdisc tc.IQdisc) *tc.QdiscTree {
-	return tc.NewQdiscTree(nil, nil, nil)
+// IsHostUplinkTree tells whether qt has the root htb of trees built by
+// HostUplinkQdiscTree
+func IsHostUplinkTree(qt *tc.QdiscTree) bool {
+	htb, ok := qt.RootQdisc().(*tc.QdiscHtb)
+	return ok && htb.Handle == "1:" && htb.DefaultClass == OvsLocalPortNo
 }
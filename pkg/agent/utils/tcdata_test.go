@@ -0,0 +1,365 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/sdnagent/pkg/tc"
+)
+
+func TestTcDataQdiscTree(t *testing.T) {
+	empty := tc.NewQdiscTree(nil, nil, nil)
+	cases := []struct {
+		name      string
+		nic       *GuestNIC
+		wantGuest [][]string
+		wantIfb   [][]string
+	}{
+		{
+			name: "defaults",
+			nic: &GuestNIC{
+				IfnameHost: "vnet1",
+				Bw:         100,
+			},
+			wantGuest: [][]string{
+				{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+				{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "ingress"},
+				{"filter", "add", "dev", "vnet1", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+			},
+			wantIfb: [][]string{
+				{"qdisc", "add", "dev", "rvnet1", "root", "handle", "1:", "tbf", "rate", "110Mbit", "burst", "13750b", "latency", "100ms"},
+			},
+		},
+		{
+			name: "burst and latency",
+			nic: &GuestNIC{
+				IfnameHost:  "vnet1",
+				Bw:          100,
+				RxBurst:     64000,
+				RxLatencyMs: 20,
+				TxBurst:     1000,
+				TxLatencyMs: 50,
+			},
+			wantGuest: [][]string{
+				{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "64Kb", "latency", "20ms"},
+				{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "ingress"},
+				{"filter", "add", "dev", "vnet1", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+			},
+			wantIfb: [][]string{
+				// burst is no less than 3400 bytes
+				{"qdisc", "add", "dev", "rvnet1", "root", "handle", "1:", "tbf", "rate", "110Mbit", "burst", "3400b", "latency", "50ms"},
+			},
+		},
+		{
+			name: "pps",
+			nic: &GuestNIC{
+				IfnameHost: "vnet1",
+				Bw:         100,
+				RxPpsLimit: 10000,
+				TxPpsLimit: 20000,
+			},
+			wantGuest: [][]string{
+				{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+				{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "clsact"},
+				{"filter", "add", "dev", "vnet1", "egress", "protocol", "all", "prio", "1", "matchall", "action", "police", "pkts_rate", "10000", "pkts_burst", "1000", "conform-exceed", "drop/continue"},
+				{"filter", "add", "dev", "vnet1", "ingress", "protocol", "all", "prio", "1", "matchall", "action", "police", "pkts_rate", "20000", "pkts_burst", "2000", "conform-exceed", "drop/continue"},
+				{"filter", "add", "dev", "vnet1", "ingress", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+			},
+			wantIfb: [][]string{
+				{"qdisc", "add", "dev", "rvnet1", "root", "handle", "1:", "tbf", "rate", "110Mbit", "burst", "13750b", "latency", "100ms"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			td := c.nic.TcData()
+			if got := td.GuestQdiscTree().Delta(empty, td.Ifname); !reflect.DeepEqual(got, c.wantGuest) {
+				t.Errorf("guest tree:\nwant %v\ngot  %v", c.wantGuest, got)
+			}
+			if got := td.GuestIfbQdiscTree().Delta(empty, td.IfbIfname()); !reflect.DeepEqual(got, c.wantIfb) {
+				t.Errorf("ifb tree:\nwant %v\ngot  %v", c.wantIfb, got)
+			}
+		})
+	}
+}
+
+func TestTcDataPpsSwitch(t *testing.T) {
+	// enabling pps limit replaces ingress qdisc with clsact
+	nic := &GuestNIC{IfnameHost: "vnet1", Bw: 100}
+	current := nic.TcData().GuestQdiscTree()
+	nic.RxPpsLimit = 10000
+	got := nic.TcData().GuestQdiscTree().Delta(current, "vnet1")
+	want := [][]string{
+		{"filter", "delete", "dev", "vnet1", "root", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32"},
+		{"qdisc", "delete", "dev", "vnet1", "handle", "ffff:", "ingress"},
+		{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "clsact"},
+		{"filter", "add", "dev", "vnet1", "egress", "protocol", "all", "prio", "1", "matchall", "action", "police", "pkts_rate", "10000", "pkts_burst", "1000", "conform-exceed", "drop/continue"},
+		{"filter", "add", "dev", "vnet1", "ingress", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+}
+
+func TestTcDataRedirectAllProtocols(t *testing.T) {
+	// hosts with the former ip only redirect converge in one pass
+	nic := &GuestNIC{IfnameHost: "vnet1", Bw: 100}
+	qt, err := tc.NewQdiscTreeFromString(`qdisc tbf 1: root refcnt 2 rate 100Mbit burst 12500b lat 100ms
+qdisc ingress ffff: parent ffff:fff1 ----------------`, "", `filter parent ffff: protocol ip pref 49152 u32 chain 0
+filter parent ffff: protocol ip pref 49152 u32 chain 0 fh 800: ht divisor 1
+filter parent ffff: protocol ip pref 49152 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device rvnet1) stolen`)
+	if err != nil {
+		t.Fatalf("parse tree: %v", err)
+	}
+	got := nic.TcData().GuestQdiscTree().Delta(qt, "vnet1")
+	want := [][]string{
+		{"filter", "delete", "dev", "vnet1", "root", "parent", "ffff:", "protocol", "ip", "prio", "49152", "handle", "800::800", "u32"},
+		{"filter", "add", "dev", "vnet1", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("migrate:\nwant %v\ngot  %v", want, got)
+	}
+
+	// kernels may keep the emptied u32 of protocol ip
+	qt, err = tc.NewQdiscTreeFromString(`qdisc tbf 1: root refcnt 2 rate 100Mbit burst 12500b lat 100ms
+qdisc ingress ffff: parent ffff:fff1 ----------------`, "", `filter parent ffff: protocol ip pref 49152 u32 chain 0
+filter parent ffff: protocol ip pref 49152 u32 chain 0 fh 800: ht divisor 1
+filter parent ffff: protocol all pref 49153 u32 chain 0
+filter parent ffff: protocol all pref 49153 u32 chain 0 fh 801: ht divisor 1
+filter parent ffff: protocol all pref 49153 u32 chain 0 fh 801::800 order 2048 key ht 801 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device rvnet1) stolen`)
+	if err != nil {
+		t.Fatalf("parse tree: %v", err)
+	}
+	if got := nic.TcData().GuestQdiscTree().Delta(qt, "vnet1"); len(got) > 0 {
+		t.Errorf("migrated: got %v", got)
+	}
+}
+
+func hostQdiscTree(host *TcData, nics ...*GuestNIC) *tc.QdiscTree {
+	guests := []*TcData{}
+	for _, nic := range nics {
+		guests = append(guests, nic.TcData())
+	}
+	return host.HostUplinkQdiscTree(guests)
+}
+
+func TestTcDataHostQdiscTree(t *testing.T) {
+	empty := tc.NewQdiscTree(nil, nil, nil)
+	host := &TcData{Ifname: "eth0", EgressMbps: 10000, Bridge: "br0"}
+	cases := []struct {
+		name string
+		host *TcData
+		nics []*GuestNIC
+		want [][]string
+	}{
+		{
+			name: "speed unknown",
+			host: &TcData{Ifname: "eth0", Bridge: "br0"},
+			want: [][]string{
+				{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "htb", "default", "0xfffe"},
+				{"class", "add", "dev", "eth0", "parent", "1:", "classid", "1:1", "htb", "rate", "1Tbit", "ceil", "1Tbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:fffe", "htb", "rate", "100Gbit", "ceil", "1Tbit"},
+			},
+		},
+		{
+			name: "guests",
+			host: host,
+			nics: []*GuestNIC{
+				{IfnameHost: "vnet1", Bridge: "br0", PortNo: 3, Bw: 100},
+				{IfnameHost: "vnet2", Bridge: "br0", PortNo: 0x1a, Bw: 500, TxBwLimit: 200},
+				// no class for nics without bandwidth or port number
+				{IfnameHost: "vnet3", Bridge: "br0", PortNo: 5},
+				{IfnameHost: "vnet4", Bridge: "br0", Bw: 100},
+			},
+			want: [][]string{
+				{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "htb", "default", "0xfffe"},
+				{"class", "add", "dev", "eth0", "parent", "1:", "classid", "1:1", "htb", "rate", "10Gbit", "ceil", "10Gbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:3", "htb", "rate", "100Mbit", "ceil", "100Mbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:1a", "htb", "rate", "200Mbit", "ceil", "200Mbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:fffe", "htb", "rate", "1Gbit", "ceil", "10Gbit"},
+				{"filter", "add", "dev", "eth0", "parent", "1:", "protocol", "all", "prio", "1", "handle", "0x1a", "fw", "classid", "1:1a"},
+				{"filter", "add", "dev", "eth0", "parent", "1:", "protocol", "all", "prio", "1", "handle", "0x3", "fw", "classid", "1:3"},
+			},
+		},
+		{
+			// the default class keeps its share of the uplink
+			name: "oversubscribed",
+			host: &TcData{Ifname: "eth0", EgressMbps: 1000, Bridge: "br0"},
+			nics: []*GuestNIC{
+				{IfnameHost: "vnet1", Bridge: "br0", PortNo: 3, Bw: 600},
+				{IfnameHost: "vnet2", Bridge: "br0", PortNo: 4, Bw: 1200},
+			},
+			want: [][]string{
+				{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "htb", "default", "0xfffe"},
+				{"class", "add", "dev", "eth0", "parent", "1:", "classid", "1:1", "htb", "rate", "1Gbit", "ceil", "1Gbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:3", "htb", "rate", "300Mbit", "ceil", "600Mbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:4", "htb", "rate", "600Mbit", "ceil", "1200Mbit"},
+				{"class", "add", "dev", "eth0", "parent", "1:1", "classid", "1:fffe", "htb", "rate", "100Mbit", "ceil", "1Gbit"},
+				{"filter", "add", "dev", "eth0", "parent", "1:", "protocol", "all", "prio", "1", "handle", "0x3", "fw", "classid", "1:3"},
+				{"filter", "add", "dev", "eth0", "parent", "1:", "protocol", "all", "prio", "1", "handle", "0x4", "fw", "classid", "1:4"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := hostQdiscTree(c.host, c.nics...).Delta(empty, c.host.Ifname)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want %v\ngot  %v", c.want, got)
+			}
+		})
+	}
+
+	t.Run("guest removed", func(t *testing.T) {
+		nic1 := &GuestNIC{IfnameHost: "vnet1", Bridge: "br0", PortNo: 3, Bw: 100}
+		nic2 := &GuestNIC{IfnameHost: "vnet2", Bridge: "br0", PortNo: 4, Bw: 100}
+		current := hostQdiscTree(host, nic1, nic2)
+		got := hostQdiscTree(host, nic1).Delta(current, "eth0")
+		want := [][]string{
+			{"filter", "delete", "dev", "eth0", "parent", "1:", "protocol", "all", "prio", "1", "handle", "0x4", "fw", "classid", "1:4"},
+			{"class", "delete", "dev", "eth0", "parent", "1:1", "classid", "1:4", "htb", "rate", "100Mbit", "ceil", "100Mbit"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("want %v\ngot  %v", want, got)
+		}
+	})
+}
+
+func TestGuestNicFwMarkFlows(t *testing.T) {
+	cases := []struct {
+		name string
+		nic  *GuestNIC
+		want string
+	}{
+		{
+			name: "marked",
+			nic:  &GuestNIC{PortNo: 0x1a, Bw: 100},
+			want: "priority=29100,in_port=26,reg5=0,table=0,idle_timeout=0,actions=load:0x1->NXM_NX_REG5[],load:0x1a->NXM_NX_PKT_MARK[],resubmit:26",
+		},
+		{
+			name: "no bandwidth",
+			nic:  &GuestNIC{PortNo: 0x1a},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := marshalFlows(t, guestNicFwMarkFlows(c.nic)); got != c.want {
+				t.Errorf("want %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestTcDataNetem(t *testing.T) {
+	nic := &GuestNIC{IfnameHost: "vnet1", Bw: 100}
+	current := nic.TcData().GuestQdiscTree()
+	nic.Netem = &GuestNICNetem{
+		DelayMs:  100,
+		JitterMs: 10,
+		Loss:     0.5,
+		Reorder:  25,
+	}
+	got := nic.TcData().GuestQdiscTree().Delta(current, "vnet1")
+	want := [][]string{
+		{"qdisc", "delete", "dev", "vnet1", "root", "handle", "1:"},
+		{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "netem", "delay", "100ms", "10ms", "loss", "0.5%", "reorder", "25%"},
+		{"qdisc", "add", "dev", "vnet1", "parent", "1:1", "handle", "10:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("enable:\nwant %v\ngot  %v", want, got)
+	}
+
+	// netem shown by tc is taken as the same
+	qt, err := tc.NewQdiscTreeFromString(`qdisc netem 1: root refcnt 2 limit 1000 delay 100ms  10ms loss 0.5% reorder 25% gap 1
+qdisc tbf 10: parent 1:1 rate 100Mbit burst 12500b lat 100ms
+qdisc ingress ffff: parent ffff:fff1 ----------------`, "", `filter parent ffff: protocol all pref 49153 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device rvnet1) stolen`)
+	if err != nil {
+		t.Fatalf("parse tree: %v", err)
+	}
+	if got := nic.TcData().GuestQdiscTree().Delta(qt, "vnet1"); len(got) > 0 {
+		t.Errorf("unchanged: got %v", got)
+	}
+
+	nic.Netem = nil
+	got = nic.TcData().GuestQdiscTree().Delta(qt, "vnet1")
+	want = [][]string{
+		{"qdisc", "delete", "dev", "vnet1", "root", "handle", "1:"},
+		{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("disable:\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestTcDataMultiqueue(t *testing.T) {
+	// mq with default children of a multiqueue tap
+	qt, err := tc.NewQdiscTreeFromString(`qdisc mq 0: root
+qdisc fq_codel 0: parent :2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64
+qdisc fq_codel 0: parent :1 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64`, "", "")
+	if err != nil {
+		t.Fatalf("parse tree: %v", err)
+	}
+	nic := &GuestNIC{IfnameHost: "vnet1", Bw: 400}
+	queueShaping := func() *TcData {
+		td := nic.TcData()
+		td.QueueShaping = true
+		return td.WithTxQueues(2)
+	}
+
+	// all queues share the rate at root by default
+	got := nic.TcData().WithTxQueues(2).GuestQdiscTree().Delta(qt, "vnet1")
+	want := [][]string{
+		{"qdisc", "delete", "dev", "vnet1", "root", "handle", "0:"},
+		{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "tbf", "rate", "400Mbit", "burst", "50Kb", "latency", "100ms"},
+		{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "ingress"},
+		{"filter", "add", "dev", "vnet1", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shared:\nwant %v\ngot  %v", want, got)
+	}
+
+	got = queueShaping().GuestQdiscTree().Delta(qt, "vnet1")
+	want = [][]string{
+		{"qdisc", "delete", "dev", "vnet1", "root", "handle", "0:"},
+		{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "mq"},
+		{"qdisc", "add", "dev", "vnet1", "parent", "1:1", "handle", "11:", "tbf", "rate", "200Mbit", "burst", "25Kb", "latency", "100ms"},
+		{"qdisc", "add", "dev", "vnet1", "parent", "1:2", "handle", "12:", "tbf", "rate", "200Mbit", "burst", "25Kb", "latency", "100ms"},
+		{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "ingress"},
+		{"filter", "add", "dev", "vnet1", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "rvnet1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mq:\nwant %v\ngot  %v", want, got)
+	}
+
+	// netem of all queues goes at root
+	current := queueShaping().GuestQdiscTree()
+	nic.Netem = &GuestNICNetem{DelayMs: 100}
+	got = queueShaping().GuestQdiscTree().Delta(current, "vnet1")
+	want = [][]string{
+		{"qdisc", "delete", "dev", "vnet1", "root", "handle", "1:"},
+		{"qdisc", "add", "dev", "vnet1", "root", "handle", "1:", "netem", "delay", "100ms"},
+		{"qdisc", "add", "dev", "vnet1", "parent", "1:1", "handle", "10:", "tbf", "rate", "400Mbit", "burst", "50Kb", "latency", "100ms"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("netem:\nwant %v\ngot  %v", want, got)
+	}
+}
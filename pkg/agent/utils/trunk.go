@@ -0,0 +1,134 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// IsTrunk returns true if the nic carries tagged traffic of TrunkVlans.
+// VLAN of a trunk nic is its native vlan, untagged guest traffic belongs to
+// it
+func (nic *GuestNIC) IsTrunk() bool {
+	return len(nic.TrunkVlans) > 0
+}
+
+func (nic *GuestNIC) validateTrunkVlans() error {
+	seen := map[int]bool{}
+	for _, vlan := range nic.TrunkVlans {
+		if vlan < 2 || vlan > 4094 {
+			return errors.Wrapf(errors.ErrInvalidFormat, "invalid trunk vlan %d", vlan)
+		}
+		if nic.VLAN > 1 && vlan == nic.VLAN {
+			return errors.Wrapf(errors.ErrInvalidFormat, "trunk vlan %d is the native vlan", vlan)
+		}
+		if seen[vlan] {
+			return errors.Wrapf(errors.ErrInvalidFormat, "duplicate trunk vlan %d", vlan)
+		}
+		seen[vlan] = true
+	}
+	return nil
+}
+
+// ValidateGuestTrunkVlans checks trunk vlans of each nic
+func ValidateGuestTrunkVlans(nics []*GuestNIC) error {
+	for _, nic := range nics {
+		if err := nic.validateTrunkVlans(); err != nil {
+			return errors.Wrapf(err, "nic %s", nic.MAC)
+		}
+	}
+	return nil
+}
+
+func (nic *GuestNIC) trunksStr() string {
+	vlans := make([]string, len(nic.TrunkVlans))
+	for i, vlan := range nic.TrunkVlans {
+		vlans[i] = fmt.Sprintf("%d", vlan)
+	}
+	return strings.Join(vlans, ",")
+}
+
+// OvsPortVlanArgs returns ovs-vsctl command line configuring vlan settings
+// of the nic port.  Trunk ports carry the native vlan untagged
+func (nic *GuestNIC) OvsPortVlanArgs() []string {
+	args := []string{"ovs-vsctl"}
+	if !nic.IsTrunk() {
+		args = append(args, "--", "clear", "Port", nic.IfnameHost, "trunks", "vlan_mode")
+		if nic.VLAN <= 1 {
+			args = append(args, "tag")
+		}
+	} else if nic.VLAN > 1 {
+		args = append(args, "--", "set", "Port", nic.IfnameHost, "vlan_mode=native-untagged", "trunks="+nic.trunksStr())
+	} else {
+		args = append(args, "--", "set", "Port", nic.IfnameHost, "vlan_mode=trunk", "trunks="+nic.trunksStr())
+		args = append(args, "--", "clear", "Port", nic.IfnameHost, "tag")
+	}
+	if nic.VLAN > 1 {
+		args = append(args, "--", "set", "Port", nic.IfnameHost, fmt.Sprintf("tag=%d", nic.VLAN))
+	}
+	return args
+}
+
+// guestNicTrunkFlows restricts flows from the guest port to untagged
+// traffic of the native vlan, then allows each trunk vlan with source mac
+// check and security rules.  Addresses of the guest on trunk vlans are not
+// known, so traffic there is checked as if src ip check were off
+func guestNicTrunkFlows(nic *GuestNIC, portNoPhy int, srcMacCheck bool, secGroup bool, flows []*ovs.Flow) []*ovs.Flow {
+	for _, f := range flows {
+		if f.Table == 0 && f.InPort == nic.PortNo {
+			f.Matches = append(f.Matches, ovs.VLANTCI(0, 0x1fff))
+		}
+	}
+	zone := "0"
+	if nic.CtZoneId != 0 {
+		zone = fmt.Sprintf("0x%x", nic.CtZoneId)
+	}
+	loadZone := fmt.Sprintf("load:%s->NXM_NX_REG0[0..15]", zone)
+	ctActs := fmt.Sprintf("%s,ct(table=1,zone=%d)", loadZone, nic.CtZoneId)
+	for _, vlan := range nic.TrunkVlans {
+		vm := fmt.Sprintf("in_port=%d,dl_vlan=%d", nic.PortNo, vlan)
+		phy := fmt.Sprintf("in_port=%d,dl_dst=%s,dl_vlan=%d", portNoPhy, nic.MAC, vlan)
+		if srcMacCheck {
+			flows = append(flows,
+				F(0, 27770, fmt.Sprintf("%s,arp,dl_src=%s,arp_sha=%s", vm, nic.MAC, nic.MAC), "normal"),
+				F(0, 27770, fmt.Sprintf("%s,dl_src=%s,ipv6,icmp6,icmp_type=135", vm, nic.MAC), "normal"),
+				F(0, 27770, fmt.Sprintf("%s,dl_src=%s,ipv6,icmp6,icmp_type=136", vm, nic.MAC), "normal"),
+				F(0, 25600, fmt.Sprintf("%s,dl_src=%s", vm, nic.MAC), "normal"),
+				F(0, 25760, fmt.Sprintf("%s,arp", vm), "drop"),
+			)
+		} else if nic.HasMacLimit() {
+			flows = append(flows, F(0, 24670, vm, guestNicMacLimitActions()))
+		} else {
+			flows = append(flows, F(0, 24670, vm, "normal"))
+		}
+		flows = append(flows, F(0, 26700, phy, "normal"))
+		if secGroup {
+			flows = append(flows,
+				F(0, 25870, fmt.Sprintf("%s,dl_src=%s,ip", vm, nic.MAC), "load:0x1->NXM_NX_REG0[16],"+ctActs),
+				F(0, 25870, fmt.Sprintf("%s,dl_src=%s,ipv6", vm, nic.MAC), "load:0x1->NXM_NX_REG0[16],"+ctActs),
+				F(0, 26870, phy+",ip", ctActs),
+				F(0, 26870, phy+",ipv6", ctActs),
+			)
+		}
+	}
+	// tagged traffic of vlans not allowed
+	flows = append(flows, F(0, 24600, fmt.Sprintf("in_port=%d", nic.PortNo), "drop"))
+	return flows
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+func TestGuestLoadDescTrunkVlans(t *testing.T) {
+	cases := []struct {
+		name  string
+		nics  string
+		want  []int
+		valid bool
+	}{
+		{
+			name:  "access",
+			nics:  `[{"mac":"00:22:00:00:00:10","vlan":10}]`,
+			valid: true,
+		},
+		{
+			name:  "trunk",
+			nics:  `[{"mac":"00:22:00:00:00:10","vlan":10,"trunk_vlans":[20,30]}]`,
+			want:  []int{20, 30},
+			valid: true,
+		},
+		{
+			name:  "native vlan in trunks",
+			nics:  `[{"mac":"00:22:00:00:00:10","vlan":10,"trunk_vlans":[10,20]}]`,
+			valid: false,
+		},
+		{
+			name:  "duplicate",
+			nics:  `[{"mac":"00:22:00:00:00:10","trunk_vlans":[20,20]}]`,
+			valid: false,
+		},
+		{
+			name:  "out of range",
+			nics:  `[{"mac":"00:22:00:00:00:10","trunk_vlans":[4095]}]`,
+			valid: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			desc := `{"name":"test","nics":` + c.nics + `}`
+			if err := os.WriteFile(path.Join(dir, "desc"), []byte(desc), 0644); err != nil {
+				t.Fatalf("write desc: %v", err)
+			}
+			g := &Guest{
+				Id:   "test",
+				Path: dir,
+			}
+			err := g.LoadDesc()
+			if !c.valid {
+				if err == nil {
+					t.Errorf("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load desc: %v", err)
+			}
+			if got := g.NICs[0].TrunkVlans; !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want trunk vlans %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestOvsPortVlanArgs(t *testing.T) {
+	cases := []struct {
+		name string
+		nic  *GuestNIC
+		want string
+	}{
+		{
+			name: "native vlan",
+			nic:  &GuestNIC{IfnameHost: "vnet1", VLAN: 10, TrunkVlans: []int{20, 30}},
+			want: "ovs-vsctl -- set Port vnet1 vlan_mode=native-untagged trunks=20,30 -- set Port vnet1 tag=10",
+		},
+		{
+			name: "no native vlan",
+			nic:  &GuestNIC{IfnameHost: "vnet1", VLAN: 1, TrunkVlans: []int{20}},
+			want: "ovs-vsctl -- set Port vnet1 vlan_mode=trunk trunks=20 -- clear Port vnet1 tag",
+		},
+		{
+			name: "back to access",
+			nic:  &GuestNIC{IfnameHost: "vnet1", VLAN: 10},
+			want: "ovs-vsctl -- clear Port vnet1 trunks vlan_mode -- set Port vnet1 tag=10",
+		},
+		{
+			name: "back to untagged",
+			nic:  &GuestNIC{IfnameHost: "vnet1", VLAN: 1},
+			want: "ovs-vsctl -- clear Port vnet1 trunks vlan_mode tag",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := strings.Join(c.nic.OvsPortVlanArgs(), " "); got != c.want {
+				t.Errorf("want %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestGuestNicTrunkFlows(t *testing.T) {
+	nic := &GuestNIC{
+		MAC:        "00:22:00:00:00:10",
+		VLAN:       10,
+		TrunkVlans: []int{20},
+		PortNo:     3,
+		CtZoneId:   5,
+	}
+	base := func() []*ovs.Flow {
+		return []*ovs.Flow{
+			F(0, 28400, "in_port=3,ip,udp,tp_src=68,tp_dst=67", "mod_tp_dst:67,local"),
+			F(0, 26700, "in_port=1,dl_dst=00:22:00:00:00:10,dl_vlan=10", "normal"),
+			F(0, 25600, "in_port=3,dl_src=00:22:00:00:00:10", "normal"),
+		}
+	}
+	cases := []struct {
+		name        string
+		srcMacCheck bool
+		secGroup    bool
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:        "src mac check with security group",
+			srcMacCheck: true,
+			secGroup:    true,
+			want: []string{
+				// native vlan is untagged
+				"priority=28400,udp,in_port=3,tp_src=68,tp_dst=67,vlan_tci=0x0000/0x1fff,",
+				"priority=25600,in_port=3,dl_src=00:22:00:00:00:10,vlan_tci=0x0000/0x1fff,",
+				"priority=26700,in_port=1,dl_dst=00:22:00:00:00:10,dl_vlan=10,table=0,",
+				// trunk vlan
+				"priority=27770,arp,in_port=3,dl_vlan=20,dl_src=00:22:00:00:00:10,arp_sha=00:22:00:00:00:10,",
+				"priority=25600,in_port=3,dl_vlan=20,dl_src=00:22:00:00:00:10,table=0,idle_timeout=0,actions=normal",
+				"priority=25870,ip,in_port=3,dl_vlan=20,dl_src=00:22:00:00:00:10,table=0,idle_timeout=0,actions=load:0x1->NXM_NX_REG0[16],load:0x0005->NXM_NX_REG0[0..15],ct(table=1,zone=5)",
+				"priority=26870,ipv6,in_port=1,dl_dst=00:22:00:00:00:10,dl_vlan=20,table=0,idle_timeout=0,actions=load:0x0005->NXM_NX_REG0[0..15],ct(table=1,zone=5)",
+				"priority=26700,in_port=1,dl_dst=00:22:00:00:00:10,dl_vlan=20,",
+				"priority=24600,in_port=3,table=0,idle_timeout=0,actions=drop",
+			},
+			notWant: []string{
+				"priority=24670,",
+			},
+		},
+		{
+			name: "no src mac check without security group",
+			want: []string{
+				"priority=24670,in_port=3,dl_vlan=20,table=0,idle_timeout=0,actions=normal",
+				"priority=26700,in_port=1,dl_dst=00:22:00:00:00:10,dl_vlan=20,",
+				"priority=24600,in_port=3,table=0,idle_timeout=0,actions=drop",
+			},
+			notWant: []string{
+				"priority=25870,",
+				"priority=26870,",
+				"arp_sha=",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			txt := marshalFlows(t, guestNicTrunkFlows(nic, 1, c.srcMacCheck, c.secGroup, base()))
+			for _, w := range c.want {
+				if !strings.Contains(txt, w) {
+					t.Errorf("want %q in flows:\n%s", w, txt)
+				}
+			}
+			for _, w := range c.notWant {
+				if strings.Contains(txt, w) {
+					t.Errorf("do not want %q in flows:\n%s", w, txt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+const (
+	// VipOwnerTable holds flows learned from gratuitous arp of virtual ips.
+	// Each maps the virtual ip in reg3 to port number of its owner in reg4.
+	// Flows there are dynamic and not managed by FlowMan
+	VipOwnerTable = 15
+	// VipCheckTable only allows the owner to send from virtual ips, or
+	// anyone when the owner is not known yet
+	VipCheckTable = 16
+
+	vipOwnerCookieBase = uint64(0x7670) << 48
+)
+
+func vipUint32(vip string) (uint32, bool) {
+	ip4 := net.ParseIP(vip).To4()
+	if ip4 == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ip4), true
+}
+
+// guestNicVipOwnerFlows returns flows tracking ownership of virtual ips of
+// the nic.  Gratuitous arp from the nic makes it the owner of the virtual
+// ip.  Arp and ip packets from the virtual ip are then checked against the
+// owner in VipCheckTable.  allowIpActs are actions for allowed ip packets
+func guestNicVipOwnerFlows(nic *GuestNIC, allowIpActs string) []*ovs.Flow {
+	flows := []*ovs.Flow{}
+	vm := fmt.Sprintf("in_port=%d,dl_src=%s", nic.PortNo, nic.MAC)
+	for _, vip := range nic.VirtualIps {
+		v, ok := vipUint32(vip)
+		if !ok {
+			continue
+		}
+		// learned flows are removed with the last nic listing the vip
+		learn := fmt.Sprintf("learn(table=%d,priority=10000,cookie=0x%x,delete_learned,reg3=0x%x,load:0x%x->NXM_NX_REG4[])",
+			VipOwnerTable, vipOwnerCookieBase|uint64(v), v, nic.PortNo)
+		check := fmt.Sprintf("load:0x%x->NXM_NX_REG3[],resubmit(,%d),resubmit(,%d)", v, VipOwnerTable, VipCheckTable)
+		flows = append(flows,
+			F(0, 27777, fmt.Sprintf("%s,arp,arp_sha=%s,arp_spa=%s,arp_tpa=%s", vm, nic.MAC, vip, vip), learn+",normal"),
+			F(0, 27776, fmt.Sprintf("%s,arp,arp_sha=%s,arp_spa=%s", vm, nic.MAC, vip), check),
+			F(0, 25875, fmt.Sprintf("%s,ip,nw_src=%s", vm, vip), check),
+		)
+	}
+	if len(flows) == 0 {
+		return flows
+	}
+	owner := fmt.Sprintf("in_port=%d,reg4=0x%x", nic.PortNo, nic.PortNo)
+	noOwner := fmt.Sprintf("in_port=%d,reg4=0", nic.PortNo)
+	flows = append(flows,
+		F(VipCheckTable, 20000, owner+",arp", "normal"),
+		F(VipCheckTable, 20000, owner+",ip", allowIpActs),
+		F(VipCheckTable, 20000, noOwner+",arp", "normal"),
+		F(VipCheckTable, 20000, noOwner+",ip", allowIpActs),
+		F(VipCheckTable, 10000, fmt.Sprintf("in_port=%d", nic.PortNo), "drop"),
+	)
+	return flows
+}
+
+// vipAllowIpActions returns actions for ip packets from virtual ips of the
+// nic, the same as for other addresses of it
+func (g *Guest) vipAllowIpActions(nic *GuestNIC) string {
+	if g.HostConfig.DisableSecurityGroup {
+		return "normal"
+	}
+	zone := "0"
+	if nic.CtZoneId != 0 {
+		zone = fmt.Sprintf("0x%x", nic.CtZoneId)
+	}
+	return fmt.Sprintf("load:0x1->NXM_NX_REG0[16],load:%s->NXM_NX_REG0[0..15],ct(table=1,zone=%d)", zone, nic.CtZoneId)
+}
+
+var (
+	vipOwnerMatchRe  = regexp.MustCompile(`\breg3=0x([0-9a-f]+)\b`)
+	vipOwnerActionRe = regexp.MustCompile(`load:0x([0-9a-f]+)->NXM_NX_REG4\[\]`)
+)
+
+// ParseVipOwnerFlow returns virtual ip and port number of its owner from
+// flow learned in VipOwnerTable
+func ParseVipOwnerFlow(f *ovs.Flow) (string, int, bool) {
+	txt, err := f.MarshalText()
+	if err != nil {
+		return "", 0, false
+	}
+	m := vipOwnerMatchRe.FindSubmatch(txt)
+	a := vipOwnerActionRe.FindSubmatch(txt)
+	if m == nil || a == nil {
+		return "", 0, false
+	}
+	v, err := strconv.ParseUint(string(m[1]), 16, 32)
+	if err != nil {
+		return "", 0, false
+	}
+	portNo, err := strconv.ParseUint(string(a[1]), 16, 32)
+	if err != nil {
+		return "", 0, false
+	}
+	ip4 := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip4, uint32(v))
+	return ip4.String(), int(portNo), true
+}
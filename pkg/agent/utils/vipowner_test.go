@@ -0,0 +1,65 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+func TestGuestNicVipOwnerFlows(t *testing.T) {
+	nic := &GuestNIC{
+		MAC:        "00:22:00:00:00:10",
+		PortNo:     3,
+		VirtualIps: []string{"192.168.1.100", "fd00::100"},
+	}
+	txt := marshalFlows(t, guestNicVipOwnerFlows(nic, "normal"))
+	for _, w := range []string{
+		"priority=27777,arp,in_port=3,dl_src=00:22:00:00:00:10,arp_sha=00:22:00:00:00:10,arp_spa=192.168.1.100,arp_tpa=192.168.1.100,table=0,idle_timeout=0,actions=learn(table=15,priority=10000,reg3=0xc0a80164,delete_learned,cookie=0x76700000c0a80164,load:0x3->NXM_NX_REG4[]),normal",
+		"priority=27776,arp,in_port=3,dl_src=00:22:00:00:00:10,arp_sha=00:22:00:00:00:10,arp_spa=192.168.1.100,table=0,idle_timeout=0,actions=load:0xc0a80164->NXM_NX_REG3[],resubmit(,15),resubmit(,16)",
+		"priority=25875,ip,in_port=3,dl_src=00:22:00:00:00:10,nw_src=192.168.1.100,table=0,idle_timeout=0,actions=load:0xc0a80164->NXM_NX_REG3[],resubmit(,15),resubmit(,16)",
+		"priority=20000,ip,in_port=3,reg4=0x3,table=16,idle_timeout=0,actions=normal",
+		"priority=20000,arp,in_port=3,reg4=0,table=16,idle_timeout=0,actions=normal",
+		"priority=10000,in_port=3,table=16,idle_timeout=0,actions=drop",
+	} {
+		if !strings.Contains(txt, w) {
+			t.Errorf("want %q in flows:\n%s", w, txt)
+		}
+	}
+	if strings.Contains(txt, "fd00::100") {
+		t.Errorf("ipv6 virtual ip should be skipped:\n%s", txt)
+	}
+
+	if flows := guestNicVipOwnerFlows(&GuestNIC{MAC: nic.MAC, PortNo: 3}, "normal"); len(flows) != 0 {
+		t.Errorf("want no flows without virtual ips, got %d", len(flows))
+	}
+}
+
+func TestParseVipOwnerFlow(t *testing.T) {
+	f := &ovs.Flow{}
+	if err := f.UnmarshalText([]byte("cookie=0x76700000c0a80164, duration=3.2s, table=15, n_packets=0, n_bytes=0, priority=10000,reg3=0xc0a80164 actions=load:0x3->NXM_NX_REG4[]")); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	vip, portNo, ok := ParseVipOwnerFlow(f)
+	if !ok || vip != "192.168.1.100" || portNo != 3 {
+		t.Errorf("want 192.168.1.100 owned by 3, got %s %d %v", vip, portNo, ok)
+	}
+	f = F(VipCheckTable, 10000, "in_port=3", "drop")
+	if _, _, ok := ParseVipOwnerFlow(f); ok {
+		t.Errorf("want not ok for other flows")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"context"
+
+	"yunion.io/x/log"
+)
+
+const (
+	TcBackendCli     = "cli"
+	TcBackendNetlink = "netlink"
+)
+
+type TcOpAction string
+
+const (
+	TcOpAdd     TcOpAction = "add"
+	TcOpReplace TcOpAction = "replace"
+	TcOpDelete  TcOpAction = "delete"
+)
+
+// TcOp is one change of qdisc, class or filter to apply on a device
+type TcOp struct {
+	Action TcOpAction
+	Obj    ITcObjAlter
+}
+
+// Line returns the tc command line of the op
+func (op TcOp) Line(ifname string) []string {
+	switch op.Action {
+	case TcOpAdd:
+		return op.Obj.AddLine(ifname)
+	case TcOpReplace:
+		return op.Obj.ReplaceLine(ifname)
+	default:
+		return op.Obj.DeleteLine(ifname)
+	}
+}
+
+func TcOpsLines(ops []TcOp, ifname string) [][]string {
+	lines := make([][]string, 0, len(ops))
+	for i := range ops {
+		lines = append(lines, ops[i].Line(ifname))
+	}
+	return lines
+}
+
+// ITcBackend reads and writes qdiscs, classes and filters of devices
+type ITcBackend interface {
+	QdiscShow(ctx context.Context, ifname string) (*QdiscTree, error)
+	Apply(ctx context.Context, ifname string, ops []TcOp) error
+	// Stats returns statistics of qdiscs and classes of the device
+	Stats(ctx context.Context, ifname string) ([]*STcStats, error)
+}
+
+var (
+	_ ITcBackend = &TcCli{}
+	_ ITcBackend = &TcNetlink{}
+)
+
+// NewTcBackend returns backend of the kind.  The tc command is used unless
+// kind is TcBackendNetlink and the kernel answers qdisc dump requests
+func NewTcBackend(kind string) ITcBackend {
+	switch kind {
+	case "", TcBackendCli:
+	case TcBackendNetlink:
+		if err := probeNetlink(); err != nil {
+			log.Errorf("tc: netlink not usable, use tc command: %v", err)
+			break
+		}
+		return NewTcNetlink()
+	default:
+		log.Errorf("tc: unknown backend %q, use tc command", kind)
+	}
+	return NewTcCli().Details(true).Force(true)
+}
@@ -1,6 +1,9 @@
 package tc
 
-import "sort"
+import (
+	"math"
+	"sort"
+)
 
 func Sort[T IComparable](a []T) {
 	sort.Slice(a, func(i, j int) bool {
@@ -40,3 +43,41 @@ func Split[T IComparable](a, b []T, baseCmp bool) (aNoB []T, aAndB []T, bAndA []
 	}
 	return
 }
+
+func compareUint[T ~uint8 | ~uint16 | ~uint32 | ~uint64](a, b T) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// compareOptUint is like compareUint, except that zero, which leaves the
+// parameter to the kernel default, equals any value
+func compareOptUint[T ~uint8 | ~uint16 | ~uint32 | ~uint64](a, b T) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return compareUint(a, b)
+}
+
+func compareBool(a, b bool) int {
+	if a == b {
+		return 0
+	} else if !a {
+		return -1
+	}
+	return 1
+}
+
+// comparePercent ignores difference from conversion to and from the
+// fraction of 2^32 kept by kernel
+func comparePercent(a, b float64) int {
+	if math.Abs(a-b) < 1e-6 {
+		return 0
+	} else if a < b {
+		return -1
+	}
+	return 1
+}
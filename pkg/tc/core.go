@@ -22,15 +22,21 @@ import (
 // how many ticks within one microsecond
 var tickInUsec = float64(0x3e8) / float64(0x40)
 
+// timer frequency used by tc command to size default burst of htb classes
+var bufferHz = float64(100)
+
 func init() {
 	f, err := os.Open("/proc/net/psched")
 	if err != nil {
 		return
 	}
-	var t2us, us2t, clockRes, bufferHz uint32
-	n, err := fmt.Fscanf(f, "%x %x %x %x", &t2us, &us2t, &clockRes, &bufferHz)
+	var t2us, us2t, clockRes, hz uint32
+	n, err := fmt.Fscanf(f, "%x %x %x %x", &t2us, &us2t, &clockRes, &hz)
 	if n != 4 || err != nil {
 		return
 	}
 	tickInUsec = float64(t2us) / float64(us2t)
+	if clockRes == 1000000 {
+		bufferHz = float64(hz)
+	}
 }
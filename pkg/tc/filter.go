@@ -25,6 +25,14 @@ import (
  *   match 00000000/00000000 at 0
  *   action order 1: mirred (Egress Redirect to device reth0) stolen
  *   index 1 ref 1 bind 1
+ * // add matchall police
+ * tc filter add dev vnet2202-232 egress protocol all prio 1 matchall action police pkts_rate 10000 pkts_burst 1000 conform-exceed drop/continue
+ * // show matchall police
+ * filter protocol all pref 1 matchall chain 0
+ * filter protocol all pref 1 matchall chain 0 handle 0x1
+ *   not_in_hw
+ *   action order 1:  police 0x1 rate 0bit burst 0b mtu 4096Mb pkts_rate 10000 pkts_burst 1000 action drop/continue overhead 0b
+ *   ref 1 bind 1
  */
 
 type IFilter interface {
@@ -39,7 +47,10 @@ type IFilter interface {
 }
 
 type SBaseTcFilter struct {
-	Parent   IQdisc
+	Parent IQdisc
+	// Hook is either FilterHookIngress or FilterHookEgress for filters
+	// attached to clsact qdisc
+	Hook     string
 	Kind     string
 	Protocol string
 	Prio     uint32
@@ -72,6 +83,9 @@ func (f *SBaseTcFilter) Compare(fi IComparable) int {
 	if f.Parent != nil && f2.Parent != nil && f.Parent.Id() != f2.Parent.Id() {
 		return compareClassId(f.Parent.Id(), f2.Parent.Id())
 	}
+	if f.Hook != f2.Hook {
+		return strings.Compare(f.Hook, f2.Hook)
+	}
 	if f.Prio < f2.Prio {
 		return -1
 	} else if f.Prio > f2.Prio {
@@ -97,10 +111,12 @@ func (f *SBaseTcFilter) Equals(fi IComparable) bool {
 // tc filter replace dev eth0 parent 1: prio 1 handle 10: flower src_ip 192.168.1.10 action mirred egress redirect dev ifb0
 func (f *SBaseTcFilter) basicLineElements(action string, ifname string, isRoot bool) []string {
 	elms := []string{"filter", action, "dev", ifname}
-	if isRoot {
+	if isRoot && len(f.Hook) == 0 {
 		elms = append(elms, "root")
 	}
-	if f.Parent != nil {
+	if len(f.Hook) > 0 {
+		elms = append(elms, f.Hook)
+	} else if f.Parent != nil {
 		elms = append(elms, "parent", f.Parent.Id())
 	}
 	if len(f.Protocol) > 0 {
@@ -136,6 +152,30 @@ func parseBaseFilter(chunks []string, parents []IQdisc) (*SBaseTcFilter, error)
 		case "u32":
 			f.Kind = "u32"
 			i += 1
+		case "matchall":
+			f.Kind = "matchall"
+			i += 1
+		case "flower":
+			f.Kind = "flower"
+			i += 1
+		case "bpf":
+			f.Kind = "bpf"
+			i += 1
+		case FilterHookIngress, FilterHookEgress:
+			// "filter ingress protocol ..." for filters of clsact qdisc
+			if i == 1 {
+				f.Hook = c
+				for _, parent := range parents {
+					if parent.Base().Kind == "clsact" {
+						f.Parent = parent
+						break
+					}
+				}
+				if f.Parent == nil {
+					return nil, errors.Wrap(errors.ErrInvalidFormat, "clsact parent not found")
+				}
+			}
+			i += 1
 		case "pref":
 			if i+1 >= len(chunks) {
 				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol before getting pref")
@@ -349,6 +389,105 @@ func parseU32Filter(chunks []string) (*SU32Filter, error) {
 	return nil, errors.Wrapf(errors.ErrInvalidFormat, "unknown u32 filter")
 }
 
+// SMatchallFilter polices all packets of the hook by packet rate.  Packets
+// within the rate continue with filters of lower priority
+type SMatchallFilter struct {
+	*SBaseTcFilter
+	// packets per second
+	PktsRate  uint64
+	PktsBurst uint64
+}
+
+func (f *SMatchallFilter) Base() *SBaseTcFilter {
+	return f.SBaseTcFilter
+}
+
+func (f *SMatchallFilter) Compare(itc IComparable) int {
+	baseFilter, ok := itc.(IFilter)
+	if !ok {
+		return -1
+	}
+	baseCmp := f.Base().Compare(baseFilter.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	f2 := baseFilter.(*SMatchallFilter)
+	if f.PktsRate < f2.PktsRate {
+		return -1
+	} else if f.PktsRate > f2.PktsRate {
+		return 1
+	}
+	if f.PktsBurst < f2.PktsBurst {
+		return -1
+	} else if f.PktsBurst > f2.PktsBurst {
+		return 1
+	}
+	return 0
+}
+
+func (f *SMatchallFilter) Equals(fi IComparable) bool {
+	return f.Compare(fi) == 0
+}
+
+func (f *SMatchallFilter) basicLineElements(action string, ifname string) []string {
+	elms := f.SBaseTcFilter.basicLineElements(action, ifname, false)
+	elms = append(elms,
+		"matchall",
+		"action",
+		"police",
+		"pkts_rate",
+		fmt.Sprintf("%d", f.PktsRate),
+		"pkts_burst",
+		fmt.Sprintf("%d", f.PktsBurst),
+		"conform-exceed",
+		"drop/continue",
+	)
+	return elms
+}
+
+func (f *SMatchallFilter) AddLine(ifname string) []string {
+	elms := f.basicLineElements("add", ifname)
+	return elms
+}
+
+func (f *SMatchallFilter) ReplaceLine(ifname string) []string {
+	elms := f.basicLineElements("replace", ifname)
+	return elms
+}
+
+func (f *SMatchallFilter) DeleteLine(ifname string) []string {
+	elms := f.SBaseTcFilter.basicLineElements("delete", ifname, false)
+	elms = append(elms, "matchall")
+	return elms
+}
+
+func parseMatchallFilter(chunks []string) (*SMatchallFilter, error) {
+	f := &SMatchallFilter{}
+	for i := 0; i < len(chunks); i++ {
+		switch chunks[i] {
+		case "pkts_rate", "pkts_burst":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol before getting %s", chunks[i])
+			}
+			v, err := strconv.ParseUint(chunks[i+1], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s %s", chunks[i], chunks[i+1])
+			}
+			if chunks[i] == "pkts_rate" {
+				f.PktsRate = v
+			} else {
+				f.PktsBurst = v
+			}
+			i++
+		}
+	}
+	if f.PktsRate == 0 {
+		// the header line without actions
+		return nil, errors.Wrap(errors.ErrInvalidFormat, "pkts_rate not found")
+	}
+	return f, nil
+}
+
 func parseFilter(chunks []string, parents []IQdisc) (IFilter, error) {
 	f, err := parseBaseFilter(chunks, parents)
 	if err != nil {
@@ -369,6 +508,27 @@ func parseFilter(chunks []string, parents []IQdisc) (IFilter, error) {
 		}
 		u32Filter.SBaseTcFilter = f
 		return u32Filter, nil
+	case "matchall":
+		matchallFilter, err := parseMatchallFilter(chunks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse matchall filter")
+		}
+		matchallFilter.SBaseTcFilter = f
+		return matchallFilter, nil
+	case "flower":
+		flowerFilter, err := parseFlowerFilter(chunks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse flower filter")
+		}
+		flowerFilter.SBaseTcFilter = f
+		return flowerFilter, nil
+	case "bpf":
+		bpfFilter, err := parseBpfFilter(chunks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse bpf filter")
+		}
+		bpfFilter.SBaseTcFilter = f
+		return bpfFilter, nil
 	}
 	return nil, errors.Wrapf(errors.ErrInvalidFormat, "unknown filter kind %s", f.Kind)
 }
@@ -0,0 +1,216 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * // add bpf
+ * tc filter add dev eth0 ingress protocol all prio 1 handle 0x1 bpf object-file prog.o section classifier direct-action
+ * tc filter add dev eth0 egress protocol ip prio 2 handle 0x2 bpf object-file prog.o section classifier classid 1:2
+ * // show bpf
+ * filter ingress protocol all pref 1 bpf chain 0
+ * filter ingress protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 97 name cls_main tag 59f4a931744dcdc6 jited
+ * filter egress protocol ip pref 2 bpf chain 0 handle 0x2 flowid 1:2 prog.o:[classifier] not_in_hw id 101 name cls_main tag 59f4a931744dcdc6 jited
+ */
+
+// bpfDefaultSection is the section of object file tc loads program from by
+// default
+const bpfDefaultSection = "classifier"
+
+// SBpfFilter runs a BPF program on packets.  Object and Section, or Pinned,
+// tell where to load the program from when adding the filter.  Programs
+// already loaded are told by Name, and by ProgId and Tag reported by kernel
+type SBpfFilter struct {
+	*SBaseTcFilter
+	Handle uint32
+
+	// Object is path of the ELF object file
+	Object string
+	// Section is the ELF section of the program, bpfDefaultSection if empty
+	Section string
+	// Pinned is path of the program pinned in bpf filesystem
+	Pinned string
+
+	// DirectAction takes return code of the program as the action
+	DirectAction bool
+	ClassId      string
+
+	// Name is "object:[section]" as recorded by tc when adding the filter
+	Name string
+	// ProgId and Tag identify the loaded program.  Tag is the hash of
+	// program instructions, so programs loaded from the same object have
+	// the same tag
+	ProgId uint32
+	Tag    string
+}
+
+func (f *SBpfFilter) Base() *SBaseTcFilter {
+	return f.SBaseTcFilter
+}
+
+// name returns Name, or the name tc records for programs loaded from
+// Object
+func (f *SBpfFilter) name() string {
+	if len(f.Name) > 0 || len(f.Object) == 0 {
+		return f.Name
+	}
+	section := f.Section
+	if len(section) == 0 {
+		section = bpfDefaultSection
+	}
+	return fmt.Sprintf("%s:[%s]", filepath.Base(f.Object), section)
+}
+
+// Compare compares programs by tag and id when both sides know them, and by
+// name otherwise
+func (f *SBpfFilter) Compare(itc IComparable) int {
+	baseFilter, ok := itc.(IFilter)
+	if !ok {
+		return -1
+	}
+	baseCmp := f.Base().Compare(baseFilter.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	f2 := baseFilter.(*SBpfFilter)
+	if cmp := compareOptUint(f.Handle, f2.Handle); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareBool(f.DirectAction, f2.DirectAction); cmp != 0 {
+		return cmp
+	}
+	if f.ClassId != f2.ClassId {
+		return compareClassId(f.ClassId, f2.ClassId)
+	}
+	if len(f.Tag) > 0 && len(f2.Tag) > 0 && f.Tag != f2.Tag {
+		return strings.Compare(f.Tag, f2.Tag)
+	}
+	if cmp := compareOptUint(f.ProgId, f2.ProgId); cmp != 0 {
+		return cmp
+	}
+	if n1, n2 := f.name(), f2.name(); len(n1) > 0 && len(n2) > 0 && n1 != n2 {
+		return strings.Compare(n1, n2)
+	}
+	return 0
+}
+
+func (f *SBpfFilter) Equals(fi IComparable) bool {
+	return f.Compare(fi) == 0
+}
+
+func (f *SBpfFilter) basicLineElements(action string, ifname string) []string {
+	elms := f.SBaseTcFilter.basicLineElements(action, ifname, false)
+	if f.Handle > 0 {
+		elms = append(elms, "handle", fmt.Sprintf("0x%x", f.Handle))
+	}
+	elms = append(elms, "bpf")
+	return elms
+}
+
+func (f *SBpfFilter) lineElements(action string, ifname string) []string {
+	elms := f.basicLineElements(action, ifname)
+	if len(f.Pinned) > 0 {
+		elms = append(elms, "object-pinned", f.Pinned)
+	} else if len(f.Object) > 0 {
+		elms = append(elms, "object-file", f.Object)
+		if len(f.Section) > 0 {
+			elms = append(elms, "section", f.Section)
+		}
+	}
+	if f.DirectAction {
+		elms = append(elms, "direct-action")
+	}
+	if len(f.ClassId) > 0 {
+		elms = append(elms, "classid", f.ClassId)
+	}
+	return elms
+}
+
+func (f *SBpfFilter) AddLine(ifname string) []string {
+	elms := f.lineElements("add", ifname)
+	return elms
+}
+
+func (f *SBpfFilter) ReplaceLine(ifname string) []string {
+	elms := f.lineElements("replace", ifname)
+	return elms
+}
+
+func (f *SBpfFilter) DeleteLine(ifname string) []string {
+	elms := f.basicLineElements("delete", ifname)
+	return elms
+}
+
+// canLoad tells whether the program can be loaded by tc command when
+// adding the filter
+func (f *SBpfFilter) canLoad() bool {
+	return len(f.Object) > 0 || len(f.Pinned) > 0
+}
+
+func parseBpfFilter(chunks []string) (*SBpfFilter, error) {
+	f := &SBpfFilter{}
+	hasHandle := false
+	for i := 0; i < len(chunks); i++ {
+		c := chunks[i]
+		switch c {
+		case "direct-action":
+			f.DirectAction = true
+			continue
+		case "handle", "flowid", "classid", "id", "tag":
+		default:
+			if strings.HasSuffix(c, "]") && strings.Contains(c, ":[") {
+				f.Name = c
+			}
+			continue
+		}
+		if i+1 >= len(chunks) {
+			return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol before getting %s", c)
+		}
+		v := chunks[i+1]
+		i++
+		switch c {
+		case "handle":
+			handle, err := strconv.ParseUint(v, 0, 32)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid handle %s", v)
+			}
+			f.Handle = uint32(handle)
+			hasHandle = true
+		case "flowid", "classid":
+			f.ClassId = v
+		case "id":
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid id %s", v)
+			}
+			f.ProgId = uint32(id)
+		case "tag":
+			f.Tag = v
+		}
+	}
+	if !hasHandle {
+		// the header line without program
+		return nil, errors.Wrap(errors.ErrInvalidFormat, "handle not found")
+	}
+	return f, nil
+}
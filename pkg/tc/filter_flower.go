@@ -0,0 +1,454 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * // add flower
+ * tc filter add dev eth0 ingress protocol ip prio 1 handle 0x1 flower ip_proto tcp dst_ip 10.0.0.0/24 dst_port 80 action mirred egress redirect dev ifb0
+ * tc filter add dev eth0 parent 1: protocol 802.1Q prio 2 flower vlan_id 100 vlan_ethtype ip src_ip 10.1.1.1 action police rate 1Mbit burst 10240 conform-exceed drop/pipe action skbedit mark 10 priority 1:3
+ * // show flower
+ * filter ingress protocol ip pref 1 flower chain 0
+ * filter ingress protocol ip pref 1 flower chain 0 handle 0x1
+ *   eth_type ipv4
+ *   ip_proto tcp
+ *   dst_ip 10.0.0.0/24
+ *   dst_port 80
+ *   not_in_hw
+ *   action order 1: mirred (Egress Redirect to device ifb0) stolen
+ *   index 1 ref 1 bind 1
+ * filter parent 1: protocol 802.1Q pref 2 flower chain 0 handle 0x1
+ *   vlan_id 100
+ *   vlan_ethtype ip
+ *   src_ip 10.1.1.1
+ *   not_in_hw
+ *   action order 1:  police 0x1 rate 1Mbit burst 10Kb mtu 2Kb action drop/pipe overhead 0b
+ *   ref 1 bind 1
+ *
+ *   action order 2: skbedit  priority 1:3 mark 10 pipe
+ *   index 1 ref 1 bind 1
+ */
+
+var flowerIpProtos = map[string]uint8{
+	"icmp":   1,
+	"tcp":    6,
+	"udp":    17,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
+// SPoliceAction drops packets beyond the rate.  Packets within the rate go
+// on with following actions
+type SPoliceAction struct {
+	// bits per second
+	Rate uint64
+	// bytes
+	Burst uint64
+	// packets per second
+	PktsRate  uint64
+	PktsBurst uint64
+}
+
+func (p *SPoliceAction) Compare(p2 *SPoliceAction) int {
+	if p == nil || p2 == nil {
+		return compareBool(p != nil, p2 != nil)
+	}
+	if cmp := compareUint(p.Rate, p2.Rate); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareUint(p.Burst, p2.Burst); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareUint(p.PktsRate, p2.PktsRate); cmp != 0 {
+		return cmp
+	}
+	return compareUint(p.PktsBurst, p2.PktsBurst)
+}
+
+func (p *SPoliceAction) lineElements() []string {
+	elms := []string{"action", "police"}
+	if p.Rate > 0 {
+		elms = append(elms,
+			"rate", PrintRate(p.Rate),
+			"burst", fmt.Sprintf("%d", p.Burst),
+		)
+	}
+	if p.PktsRate > 0 {
+		elms = append(elms,
+			"pkts_rate", fmt.Sprintf("%d", p.PktsRate),
+			"pkts_burst", fmt.Sprintf("%d", p.PktsBurst),
+		)
+	}
+	elms = append(elms, "conform-exceed", "drop/pipe")
+	return elms
+}
+
+// SSkbEditAction sets metadata of packets.  Empty Priority and nil
+// QueueMapping are left untouched, so is Mark of zero
+type SSkbEditAction struct {
+	Mark uint32
+	// class id like 1:3
+	Priority     string
+	QueueMapping *uint16
+}
+
+func (s *SSkbEditAction) Compare(s2 *SSkbEditAction) int {
+	if s == nil || s2 == nil {
+		return compareBool(s != nil, s2 != nil)
+	}
+	if cmp := compareUint(s.Mark, s2.Mark); cmp != 0 {
+		return cmp
+	}
+	if s.Priority != s2.Priority {
+		return compareClassId(s.Priority, s2.Priority)
+	}
+	if s.QueueMapping == nil || s2.QueueMapping == nil {
+		return compareBool(s.QueueMapping != nil, s2.QueueMapping != nil)
+	}
+	return compareUint(*s.QueueMapping, *s2.QueueMapping)
+}
+
+func (s *SSkbEditAction) lineElements() []string {
+	elms := []string{"action", "skbedit"}
+	if s.Mark > 0 {
+		elms = append(elms, "mark", fmt.Sprintf("%d", s.Mark))
+	}
+	if len(s.Priority) > 0 {
+		elms = append(elms, "priority", s.Priority)
+	}
+	if s.QueueMapping != nil {
+		elms = append(elms, "queue_mapping", fmt.Sprintf("%d", *s.QueueMapping))
+	}
+	return elms
+}
+
+// SFlowerFilter classifies packets by fields of L2 to L4 headers.  Empty or
+// zero matches are wildcards.  Actions are executed in the order of
+// police, skbedit and mirred redirect.
+//
+// Flower filters sharing the same priority should be given distinct
+// handles, otherwise deleting one of them deletes all
+type SFlowerFilter struct {
+	*SBaseTcFilter
+	// zero to let kernel allocate one
+	Handle uint32
+
+	// EthType is the protocol of vlan payload, like "ip", when Protocol
+	// is 802.1Q or 802.1ad.  It defaults to Protocol
+	EthType string
+	VlanId  uint16
+	// tcp, udp, sctp, icmp, icmpv6 or protocol number in hex
+	IpProto string
+	// address like 10.0.0.1, or prefix like 10.0.0.0/24
+	SrcIp   string
+	DstIp   string
+	SrcPort uint16
+	DstPort uint16
+
+	Police      *SPoliceAction
+	SkbEdit     *SSkbEditAction
+	RedirectDev string
+}
+
+func (f *SFlowerFilter) Base() *SBaseTcFilter {
+	return f.SBaseTcFilter
+}
+
+func (f *SFlowerFilter) ethType() string {
+	if len(f.EthType) > 0 {
+		return f.EthType
+	}
+	if f.Protocol == "all" {
+		return ""
+	}
+	return f.Protocol
+}
+
+func (f *SFlowerFilter) isVlan() bool {
+	return f.Protocol == "802.1Q" || f.Protocol == "802.1ad"
+}
+
+func (f *SFlowerFilter) Compare(itc IComparable) int {
+	baseFilter, ok := itc.(IFilter)
+	if !ok {
+		return -1
+	}
+	baseCmp := f.Base().Compare(baseFilter.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	f2 := baseFilter.(*SFlowerFilter)
+	if cmp := compareOptUint(f.Handle, f2.Handle); cmp != 0 {
+		return cmp
+	}
+	if t1, t2 := f.ethType(), f2.ethType(); t1 != t2 {
+		return strings.Compare(t1, t2)
+	}
+	if cmp := compareUint(f.VlanId, f2.VlanId); cmp != 0 {
+		return cmp
+	}
+	if f.IpProto != f2.IpProto {
+		return strings.Compare(f.IpProto, f2.IpProto)
+	}
+	if ip1, ip2 := normalizeFlowerIp(f.SrcIp), normalizeFlowerIp(f2.SrcIp); ip1 != ip2 {
+		return strings.Compare(ip1, ip2)
+	}
+	if ip1, ip2 := normalizeFlowerIp(f.DstIp), normalizeFlowerIp(f2.DstIp); ip1 != ip2 {
+		return strings.Compare(ip1, ip2)
+	}
+	if cmp := compareUint(f.SrcPort, f2.SrcPort); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareUint(f.DstPort, f2.DstPort); cmp != 0 {
+		return cmp
+	}
+	if cmp := f.Police.Compare(f2.Police); cmp != 0 {
+		return cmp
+	}
+	if cmp := f.SkbEdit.Compare(f2.SkbEdit); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(f.RedirectDev, f2.RedirectDev)
+}
+
+func (f *SFlowerFilter) Equals(fi IComparable) bool {
+	return f.Compare(fi) == 0
+}
+
+func (f *SFlowerFilter) basicLineElements(action string, ifname string) []string {
+	elms := f.SBaseTcFilter.basicLineElements(action, ifname, false)
+	if f.Handle > 0 {
+		elms = append(elms, "handle", fmt.Sprintf("0x%x", f.Handle))
+	}
+	elms = append(elms, "flower")
+	return elms
+}
+
+func (f *SFlowerFilter) lineElements(action string, ifname string) []string {
+	elms := f.basicLineElements(action, ifname)
+	if f.isVlan() {
+		if f.VlanId > 0 {
+			elms = append(elms, "vlan_id", fmt.Sprintf("%d", f.VlanId))
+		}
+		if ethType := f.ethType(); ethType != f.Protocol {
+			elms = append(elms, "vlan_ethtype", ethType)
+		}
+	}
+	if len(f.IpProto) > 0 {
+		elms = append(elms, "ip_proto", f.IpProto)
+	}
+	if len(f.SrcIp) > 0 {
+		elms = append(elms, "src_ip", normalizeFlowerIp(f.SrcIp))
+	}
+	if len(f.DstIp) > 0 {
+		elms = append(elms, "dst_ip", normalizeFlowerIp(f.DstIp))
+	}
+	if f.SrcPort > 0 {
+		elms = append(elms, "src_port", fmt.Sprintf("%d", f.SrcPort))
+	}
+	if f.DstPort > 0 {
+		elms = append(elms, "dst_port", fmt.Sprintf("%d", f.DstPort))
+	}
+	if f.Police != nil {
+		elms = append(elms, f.Police.lineElements()...)
+	}
+	if f.SkbEdit != nil {
+		elms = append(elms, f.SkbEdit.lineElements()...)
+	}
+	if len(f.RedirectDev) > 0 {
+		elms = append(elms,
+			"action",
+			"mirred",
+			"egress",
+			"redirect",
+			"dev",
+			f.RedirectDev,
+		)
+	}
+	return elms
+}
+
+func (f *SFlowerFilter) AddLine(ifname string) []string {
+	elms := f.lineElements("add", ifname)
+	return elms
+}
+
+func (f *SFlowerFilter) ReplaceLine(ifname string) []string {
+	elms := f.lineElements("replace", ifname)
+	return elms
+}
+
+func (f *SFlowerFilter) DeleteLine(ifname string) []string {
+	elms := f.basicLineElements("delete", ifname)
+	return elms
+}
+
+// normalizeFlowerIp returns address as printed by tc, i.e. prefix of full
+// length is printed as plain address
+func normalizeFlowerIp(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		if ip := net.ParseIP(s); ip != nil {
+			return ip.String()
+		}
+		return s
+	}
+	ones, bits := ipNet.Mask.Size()
+	if ones == bits {
+		return ipNet.IP.String()
+	}
+	return ipNet.String()
+}
+
+// flowerEthType returns eth type printed by tc as name of protocol used by
+// tc command, e.g. "ipv4" as "ip" and "8100" as "802.1Q"
+func flowerEthType(s string) (string, error) {
+	if s == "ipv4" {
+		return "ip", nil
+	}
+	if _, ok := tcProtocols[s]; ok {
+		return s, nil
+	}
+	p, err := parseProtocol(s)
+	if err != nil {
+		return "", err
+	}
+	return sprintProtocol(p), nil
+}
+
+// parseFlowerAction parses options of action started at chunks[i] until the
+// next action
+func parseFlowerAction(f *SFlowerFilter, chunks []string, i int) error {
+	kind := chunks[i]
+	switch kind {
+	case "police":
+		f.Police = &SPoliceAction{}
+	case "skbedit":
+		f.SkbEdit = &SSkbEditAction{}
+	default:
+		return nil
+	}
+	for i++; i+1 < len(chunks) && chunks[i] != "order"; i++ {
+		k, v := chunks[i], chunks[i+1]
+		var err error
+		switch kind + " " + k {
+		case "police rate":
+			f.Police.Rate, err = ParseRate(v)
+		case "police burst":
+			f.Police.Burst, err = ParseIprouteSize(v)
+		case "police pkts_rate":
+			f.Police.PktsRate, err = strconv.ParseUint(v, 10, 64)
+		case "police pkts_burst":
+			f.Police.PktsBurst, err = strconv.ParseUint(v, 10, 64)
+		case "skbedit mark":
+			var mark uint64
+			mark, err = strconv.ParseUint(strings.Split(v, "/")[0], 0, 32)
+			f.SkbEdit.Mark = uint32(mark)
+		case "skbedit priority":
+			f.SkbEdit.Priority = v
+		case "skbedit queue_mapping":
+			var queue uint64
+			queue, err = strconv.ParseUint(v, 10, 16)
+			q := uint16(queue)
+			f.SkbEdit.QueueMapping = &q
+		default:
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s %s %s", kind, k, v)
+		}
+		i++
+	}
+	return nil
+}
+
+func parseFlowerFilter(chunks []string) (*SFlowerFilter, error) {
+	f := &SFlowerFilter{}
+	hasHandle := false
+	vlanEthType := ""
+	for i := 0; i < len(chunks); i++ {
+		c := chunks[i]
+		switch c {
+		case "handle", "eth_type", "vlan_id", "vlan_ethtype", "ip_proto", "src_ip", "dst_ip", "src_port", "dst_port":
+		case "police", "skbedit":
+			if err := parseFlowerAction(f, chunks, i); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			continue
+		}
+		if i+1 >= len(chunks) {
+			return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol before getting %s", c)
+		}
+		v := chunks[i+1]
+		i++
+		var err error
+		switch c {
+		case "handle":
+			var handle uint64
+			handle, err = strconv.ParseUint(v, 0, 32)
+			f.Handle = uint32(handle)
+			hasHandle = true
+		case "eth_type":
+			f.EthType, err = flowerEthType(v)
+		case "vlan_ethtype":
+			vlanEthType, err = flowerEthType(v)
+		case "vlan_id":
+			var vlanId uint64
+			vlanId, err = strconv.ParseUint(v, 10, 16)
+			f.VlanId = uint16(vlanId)
+		case "ip_proto":
+			f.IpProto = v
+		case "src_ip":
+			f.SrcIp = normalizeFlowerIp(v)
+		case "dst_ip":
+			f.DstIp = normalizeFlowerIp(v)
+		case "src_port", "dst_port":
+			var port uint64
+			port, err = strconv.ParseUint(v, 10, 16)
+			if c == "src_port" {
+				f.SrcPort = uint16(port)
+			} else {
+				f.DstPort = uint16(port)
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s %s", c, v)
+		}
+	}
+	if !hasHandle {
+		// the header line without matches
+		return nil, errors.Wrap(errors.ErrInvalidFormat, "handle not found")
+	}
+	if len(vlanEthType) > 0 {
+		f.EthType = vlanEthType
+	}
+	if m := ingressMatchReg.FindStringSubmatch(strings.Join(chunks, " ")); m != nil {
+		f.RedirectDev = m[1]
+	}
+	return f, nil
+}
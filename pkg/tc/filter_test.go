@@ -23,6 +23,13 @@ func TestParseFilterLines(t *testing.T) {
 			Parent: "",
 		},
 	}
+	parentClsactQdisc := &QdiscClsact{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "clsact",
+			Handle: "ffff:",
+			Parent: "",
+		},
+	}
 	cases := []struct {
 		parent      IQdisc
 		ifname      string
@@ -132,6 +139,248 @@ func TestParseFilterLines(t *testing.T) {
 				{"filter", "add", "dev", "eth0", "parent", "ffff:", "protocol", "ip", "prio", "49152", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "reth0"},
 			},
 		},
+		{
+			parent: parentIngressQdisc,
+			ifname: "eth0",
+			in: []string{
+				"filter parent ffff: protocol all pref 49153 u32 chain 0",
+				"filter parent ffff: protocol all pref 49153 u32 chain 0 fh 800: ht divisor 1",
+				"filter parent ffff: protocol all pref 49153 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid ??? not_in_hw",
+				"   match 00000000/00000000 at 0",
+				"   action order 1: mirred (Egress Redirect to device reth0) stolen",
+				"   index 1 ref 1 bind 1",
+			},
+			want: []IFilter{
+				&SU32Filter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "u32",
+						Prio:     49153,
+						Protocol: "all",
+						Parent:   parentIngressQdisc,
+					},
+					RedirectDev: "reth0",
+				},
+			},
+			delLine: [][]string{
+				{"filter", "delete", "dev", "eth0", "root", "parent", "ffff:", "protocol", "all", "prio", "49153", "handle", "800::800", "u32"},
+			},
+			replaceLine: [][]string{
+				{"filter", "add", "dev", "eth0", "parent", "ffff:", "protocol", "all", "prio", "49153", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "reth0"},
+			},
+		},
+		{
+			parent: parentClsactQdisc,
+			ifname: "eth0",
+			in: []string{
+				"filter ingress protocol ip pref 49152 u32 chain 0",
+				"filter ingress protocol ip pref 49152 u32 chain 0 fh 800: ht divisor 1",
+				"filter ingress protocol ip pref 49152 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid ??? not_in_hw",
+				"   match 00000000/00000000 at 0",
+				"   action order 1: mirred (Egress Redirect to device reth0) stolen",
+				"   index 1 ref 1 bind 1",
+				"filter ingress protocol all pref 1 matchall chain 0",
+				"filter ingress protocol all pref 1 matchall chain 0 handle 0x1",
+				"  not_in_hw",
+				"\taction order 1:  police 0x1 rate 0bit burst 0b mtu 4096Mb pkts_rate 20000 pkts_burst 2000 action drop/continue overhead 0b",
+				"\tref 1 bind 1",
+				"filter egress protocol all pref 1 matchall chain 0",
+				"filter egress protocol all pref 1 matchall chain 0 handle 0x1",
+				"  not_in_hw",
+				"\taction order 1:  police 0x2 rate 0bit burst 0b mtu 4096Mb pkts_rate 10000 pkts_burst 1000 action drop/continue overhead 0b",
+				"\tref 1 bind 1",
+			},
+			want: []IFilter{
+				&SU32Filter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "u32",
+						Prio:     49152,
+						Protocol: "ip",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					RedirectDev: "reth0",
+				},
+				&SMatchallFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "matchall",
+						Prio:     1,
+						Protocol: "all",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					PktsRate:  20000,
+					PktsBurst: 2000,
+				},
+				&SMatchallFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "matchall",
+						Prio:     1,
+						Protocol: "all",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookEgress,
+					},
+					PktsRate:  10000,
+					PktsBurst: 1000,
+				},
+			},
+			delLine: [][]string{
+				{"filter", "delete", "dev", "eth0", "ingress", "protocol", "ip", "prio", "49152", "handle", "800::800", "u32"},
+				{"filter", "delete", "dev", "eth0", "ingress", "protocol", "all", "prio", "1", "matchall"},
+				{"filter", "delete", "dev", "eth0", "egress", "protocol", "all", "prio", "1", "matchall"},
+			},
+			replaceLine: [][]string{
+				{"filter", "add", "dev", "eth0", "ingress", "protocol", "ip", "prio", "49152", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "reth0"},
+				{"filter", "add", "dev", "eth0", "ingress", "protocol", "all", "prio", "1", "matchall", "action", "police", "pkts_rate", "20000", "pkts_burst", "2000", "conform-exceed", "drop/continue"},
+				{"filter", "add", "dev", "eth0", "egress", "protocol", "all", "prio", "1", "matchall", "action", "police", "pkts_rate", "10000", "pkts_burst", "1000", "conform-exceed", "drop/continue"},
+			},
+		},
+		{
+			parent: parentClsactQdisc,
+			ifname: "eth0",
+			in: []string{
+				"filter ingress protocol ip pref 1 flower chain 0",
+				"filter ingress protocol ip pref 1 flower chain 0 handle 0x1",
+				"  eth_type ipv4",
+				"  ip_proto tcp",
+				"  dst_ip 10.0.0.0/24",
+				"  dst_port 80",
+				"  not_in_hw",
+				"\taction order 1: mirred (Egress Redirect to device ifb0) stolen",
+				"\tindex 1 ref 1 bind 1",
+				"filter ingress protocol 802.1Q pref 2 flower chain 0",
+				"filter ingress protocol 802.1Q pref 2 flower chain 0 handle 0x2",
+				"  vlan_id 100",
+				"  vlan_ethtype ip",
+				"  eth_type 8100",
+				"  src_ip 10.1.1.1",
+				"  not_in_hw",
+				"\taction order 1:  police 0x1 rate 1Mbit burst 10Kb mtu 2Kb action drop/pipe overhead 0b",
+				"\tref 1 bind 1",
+				"",
+				"\taction order 2: skbedit  queue_mapping 2 priority 1:3 mark 10 pipe",
+				"\t index 1 ref 1 bind 1",
+				"filter egress protocol ipv6 pref 3 flower chain 0",
+				"filter egress protocol ipv6 pref 3 flower chain 0 handle 0x1",
+				"  eth_type ipv6",
+				"  ip_proto udp",
+				"  src_ip fd00::/64",
+				"  src_port 53",
+				"  not_in_hw",
+				"\taction order 1:  police 0x2 rate 0bit burst 0b mtu 4096Mb pkts_rate 1000 pkts_burst 100 action drop/pipe overhead 0b",
+				"\tref 1 bind 1",
+			},
+			want: []IFilter{
+				&SFlowerFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "flower",
+						Prio:     1,
+						Protocol: "ip",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					Handle:      1,
+					IpProto:     "tcp",
+					DstIp:       "10.0.0.0/24",
+					DstPort:     80,
+					RedirectDev: "ifb0",
+				},
+				&SFlowerFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "flower",
+						Prio:     2,
+						Protocol: "802.1Q",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					Handle:  2,
+					EthType: "ip",
+					VlanId:  100,
+					SrcIp:   "10.1.1.1/32",
+					Police: &SPoliceAction{
+						Rate:  1000000,
+						Burst: 10240,
+					},
+					SkbEdit: &SSkbEditAction{
+						Mark:         10,
+						Priority:     "1:3",
+						QueueMapping: func() *uint16 { q := uint16(2); return &q }(),
+					},
+				},
+				&SFlowerFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "flower",
+						Prio:     3,
+						Protocol: "ipv6",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookEgress,
+					},
+					Handle:  1,
+					IpProto: "udp",
+					SrcIp:   "fd00::/64",
+					SrcPort: 53,
+					Police: &SPoliceAction{
+						PktsRate:  1000,
+						PktsBurst: 100,
+					},
+				},
+			},
+			delLine: [][]string{
+				{"filter", "delete", "dev", "eth0", "ingress", "protocol", "ip", "prio", "1", "handle", "0x1", "flower"},
+				{"filter", "delete", "dev", "eth0", "ingress", "protocol", "802.1Q", "prio", "2", "handle", "0x2", "flower"},
+				{"filter", "delete", "dev", "eth0", "egress", "protocol", "ipv6", "prio", "3", "handle", "0x1", "flower"},
+			},
+			replaceLine: [][]string{
+				{"filter", "add", "dev", "eth0", "ingress", "protocol", "ip", "prio", "1", "handle", "0x1", "flower", "ip_proto", "tcp", "dst_ip", "10.0.0.0/24", "dst_port", "80", "action", "mirred", "egress", "redirect", "dev", "ifb0"},
+				{"filter", "add", "dev", "eth0", "ingress", "protocol", "802.1Q", "prio", "2", "handle", "0x2", "flower", "vlan_id", "100", "vlan_ethtype", "ip", "src_ip", "10.1.1.1", "action", "police", "rate", "1Mbit", "burst", "10240", "conform-exceed", "drop/pipe", "action", "skbedit", "mark", "10", "priority", "1:3", "queue_mapping", "2"},
+				{"filter", "add", "dev", "eth0", "egress", "protocol", "ipv6", "prio", "3", "handle", "0x1", "flower", "ip_proto", "udp", "src_ip", "fd00::/64", "src_port", "53", "action", "police", "pkts_rate", "1000", "pkts_burst", "100", "conform-exceed", "drop/pipe"},
+			},
+		},
+		{
+			parent: parentClsactQdisc,
+			ifname: "eth0",
+			in: []string{
+				"filter ingress protocol all pref 1 bpf chain 0",
+				"filter ingress protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 97 name cls_main tag 59f4a931744dcdc6 jited",
+				"filter egress protocol ip pref 2 bpf chain 0",
+				"filter egress protocol ip pref 2 bpf chain 0 handle 0x2 flowid 1:2 prog.o:[classifier] not_in_hw id 101 name cls_main tag 59f4a931744dcdc6 jited",
+			},
+			want: []IFilter{
+				&SBpfFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "bpf",
+						Prio:     1,
+						Protocol: "all",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					Handle:       1,
+					Name:         "prog.o:[classifier]",
+					DirectAction: true,
+					ProgId:       97,
+					Tag:          "59f4a931744dcdc6",
+				},
+				&SBpfFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "bpf",
+						Prio:     2,
+						Protocol: "ip",
+						Parent:   parentClsactQdisc,
+						Hook:     FilterHookEgress,
+					},
+					Handle:  2,
+					ClassId: "1:2",
+					Object:  "/var/lib/bpf/prog.o",
+				},
+			},
+			delLine: [][]string{
+				{"filter", "delete", "dev", "eth0", "ingress", "protocol", "all", "prio", "1", "handle", "0x1", "bpf"},
+				{"filter", "delete", "dev", "eth0", "egress", "protocol", "ip", "prio", "2", "handle", "0x2", "bpf"},
+			},
+			replaceLine: [][]string{
+				{"filter", "add", "dev", "eth0", "ingress", "protocol", "all", "prio", "1", "handle", "0x1", "bpf", "direct-action"},
+				{"filter", "add", "dev", "eth0", "egress", "protocol", "ip", "prio", "2", "handle", "0x2", "bpf", "classid", "1:2"},
+			},
+		},
 	}
 	for _, c := range cases {
 		filters, err := parseFilterLines(c.in, []IQdisc{c.parent})
@@ -195,3 +444,11 @@ func TestIngressMatchReg(t *testing.T) {
 		}
 	}
 }
+
+func TestTagFilterHook(t *testing.T) {
+	in := "filter protocol all pref 1 matchall chain 0 \n  not_in_hw\n"
+	want := "filter egress protocol all pref 1 matchall chain 0 \n  not_in_hw\n"
+	if got := tagFilterHook(in, FilterHookEgress); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	// seconds waiting for acks of a batch
+	netlinkApplyTimeout = 10
+)
+
+// TcNetlink reads and writes qdiscs, classes and filters with rtnetlink
+// messages, the same as tc command does
+type TcNetlink struct {
+	linkIndex func(ifname string) (int, error)
+	linkName  func(index int) (string, error)
+}
+
+func NewTcNetlink() *TcNetlink {
+	return &TcNetlink{
+		linkIndex: func(ifname string) (int, error) {
+			iface, err := net.InterfaceByName(ifname)
+			if err != nil {
+				return 0, err
+			}
+			return iface.Index, nil
+		},
+		linkName: func(index int) (string, error) {
+			iface, err := net.InterfaceByIndex(index)
+			if err != nil {
+				return "", err
+			}
+			return iface.Name, nil
+		},
+	}
+}
+
+func tcDump(proto int, resType uint16, msg *nl.TcMsg) ([][]byte, error) {
+	req := nl.NewNetlinkRequest(proto, unix.NLM_F_DUMP)
+	req.AddData(msg)
+	return req.Execute(unix.NETLINK_ROUTE, resType)
+}
+
+// probeNetlink checks that the kernel answers qdisc dump of loopback
+func probeNetlink() error {
+	_, err := tcDump(unix.RTM_GETQDISC, unix.RTM_NEWQDISC, &nl.TcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: 1,
+	})
+	return err
+}
+
+func (tn *TcNetlink) QdiscShow(ctx context.Context, ifname string) (*QdiscTree, error) {
+	index, err := tn.linkIndex(ifname)
+	if err != nil {
+		return nil, errors.Wrapf(err, "index of link %s", ifname)
+	}
+	ifindex := int32(index)
+	qdiscMsgs, err := tcDump(unix.RTM_GETQDISC, unix.RTM_NEWQDISC, &nl.TcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: ifindex,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "dump qdisc")
+	}
+	qs, err := decodeQdiscs(ifindex, qdiscMsgs)
+	if err != nil {
+		return nil, err
+	}
+	classMsgs, err := tcDump(unix.RTM_GETTCLASS, unix.RTM_NEWTCLASS, &nl.TcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: ifindex,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "dump class")
+	}
+	filterMsgs := [][]byte{}
+	for _, parent := range filterDumpParents(qs) {
+		msgs, err := tcDump(unix.RTM_GETTFILTER, unix.RTM_NEWTFILTER, &nl.TcMsg{
+			Family:  unix.AF_UNSPEC,
+			Ifindex: ifindex,
+			Parent:  parent,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "dump filter of %s", sprintHandle(parent))
+		}
+		filterMsgs = append(filterMsgs, msgs...)
+	}
+	return decodeQdiscTree(ifindex, qs, classMsgs, filterMsgs, tn.linkName)
+}
+
+func (tn *TcNetlink) Stats(ctx context.Context, ifname string) ([]*STcStats, error) {
+	index, err := tn.linkIndex(ifname)
+	if err != nil {
+		return nil, errors.Wrapf(err, "index of link %s", ifname)
+	}
+	ifindex := int32(index)
+	qdiscMsgs, err := tcDump(unix.RTM_GETQDISC, unix.RTM_NEWQDISC, &nl.TcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: ifindex,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "dump qdisc")
+	}
+	stats, err := decodeStatsMsgs(ifindex, TcStatsQdisc, qdiscMsgs)
+	if err != nil {
+		return nil, err
+	}
+	classMsgs, err := tcDump(unix.RTM_GETTCLASS, unix.RTM_NEWTCLASS, &nl.TcMsg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: ifindex,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "dump class")
+	}
+	classStats, err := decodeStatsMsgs(ifindex, TcStatsClass, classMsgs)
+	if err != nil {
+		return nil, err
+	}
+	return append(stats, classStats...), nil
+}
+
+// encodeOp returns the rtnetlink request of op on device ifindex
+func (tn *TcNetlink) encodeOp(ifindex int32, op TcOp) (*nl.NetlinkRequest, error) {
+	var (
+		m       *tcMessage
+		err     error
+		newType int
+		delType int
+	)
+	withOptions := op.Action != TcOpDelete
+	switch obj := op.Obj.(type) {
+	case IQdisc:
+		m, err = encodeQdisc(ifindex, obj, withOptions)
+		newType, delType = unix.RTM_NEWQDISC, unix.RTM_DELQDISC
+	case IClass:
+		m, err = encodeClass(ifindex, obj, withOptions)
+		newType, delType = unix.RTM_NEWTCLASS, unix.RTM_DELTCLASS
+	case IFilter:
+		m, err = encodeFilter(ifindex, obj, withOptions, tn.linkIndex)
+		newType, delType = unix.RTM_NEWTFILTER, unix.RTM_DELTFILTER
+	default:
+		return nil, errors.Wrapf(errors.ErrNotSupported, "object %T", op.Obj)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var req *nl.NetlinkRequest
+	switch op.Action {
+	case TcOpAdd:
+		req = nl.NewNetlinkRequest(newType, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	case TcOpReplace:
+		flags := unix.NLM_F_CREATE | unix.NLM_F_REPLACE
+		if newType == unix.RTM_NEWTFILTER {
+			flags = unix.NLM_F_CREATE
+		}
+		req = nl.NewNetlinkRequest(newType, flags|unix.NLM_F_ACK)
+	default:
+		req = nl.NewNetlinkRequest(delType, unix.NLM_F_ACK)
+	}
+	req.AddData(m)
+	return req, nil
+}
+
+// Apply sends requests of ops in one batch.  As with "tc -force -batch",
+// failure of one request does not stop the following ones.  Ops loading
+// bpf programs need parsing of ELF object files, these batches are run
+// with tc command instead
+func (tn *TcNetlink) Apply(ctx context.Context, ifname string, ops []TcOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	if loadsBpf(ops) {
+		return NewTcCli().Force(true).Apply(ctx, ifname, ops)
+	}
+	index, err := tn.linkIndex(ifname)
+	if err != nil {
+		return errors.Wrapf(err, "index of link %s", ifname)
+	}
+	pending := map[uint32]TcOp{}
+	batch := []byte{}
+	for _, op := range ops {
+		req, err := tn.encodeOp(int32(index), op)
+		if err != nil {
+			return errors.Wrapf(err, "encode %s", strings.Join(op.Line(ifname), " "))
+		}
+		pending[req.Seq] = op
+		batch = append(batch, req.Serialize()...)
+	}
+
+	s, err := nl.Subscribe(unix.NETLINK_ROUTE)
+	if err != nil {
+		return errors.Wrap(err, "open netlink socket")
+	}
+	defer s.Close()
+	timeout := unix.NsecToTimeval(netlinkApplyTimeout * 1e9)
+	if err := s.SetReceiveTimeout(&timeout); err != nil {
+		return errors.Wrap(err, "set receive timeout")
+	}
+	if err := unix.Sendto(s.GetFd(), batch, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return errors.Wrap(err, "send batch")
+	}
+
+	var errs []error
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		msgs, _, err := s.Receive()
+		if err != nil {
+			return errors.Wrapf(err, "receive acks, %d pending", len(pending))
+		}
+		for _, m := range msgs {
+			op, ok := pending[m.Header.Seq]
+			if !ok || m.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+			delete(pending, m.Header.Seq)
+			if len(m.Data) < 4 {
+				continue
+			}
+			if errno := -int32(nl.NativeEndian().Uint32(m.Data[0:4])); errno != 0 {
+				errs = append(errs, errors.Wrapf(syscall.Errno(errno), "%s", strings.Join(op.Line(ifname), " ")))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.NewAggregate(errs)
+	}
+	return nil
+}
+
+func loadsBpf(ops []TcOp) bool {
+	for _, op := range ops {
+		if f, ok := op.Obj.(*SBpfFilter); ok && op.Action != TcOpDelete {
+			if f.canLoad() {
+				return true
+			}
+		}
+	}
+	return false
+}
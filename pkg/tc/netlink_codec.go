@@ -0,0 +1,860 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+)
+
+// Taken from linux include/uapi/linux/pkt_sched.h, pkt_cls.h and
+// tc_act/tc_mirred.h, tc_act/tc_police.h
+const (
+	TC_H_MIN_INGRESS uint32 = 0xFFF2
+	TC_H_MIN_EGRESS  uint32 = 0xFFF3
+
+	tcActUnspec       = -1
+	tcActShot   int32 = 2
+	tcActPipe   int32 = 3
+	tcActStolen int32 = 4
+
+	tcaEgressRedir int32 = 1
+
+	tcaPolicePktRate64  = 10
+	tcaPolicePktBurst64 = 11
+
+	htbVersion      = 3
+	htbRate2Quantum = 10
+	// mtu used by tc command to size default burst of htb classes
+	htbDefaultMtu = 1600
+
+	nlaTypeMask = ^uint16(unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+)
+
+var tcProtocols = map[string]uint16{
+	"all":     unix.ETH_P_ALL,
+	"ip":      unix.ETH_P_IP,
+	"arp":     unix.ETH_P_ARP,
+	"802.1Q":  unix.ETH_P_8021Q,
+	"ipv6":    unix.ETH_P_IPV6,
+	"802.1ad": unix.ETH_P_8021AD,
+}
+
+func parseProtocol(s string) (uint16, error) {
+	if s == "" {
+		return unix.ETH_P_ALL, nil
+	}
+	if p, ok := tcProtocols[s]; ok {
+		return p, nil
+	}
+	p, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 16)
+	if err != nil {
+		return 0, errors.Wrapf(errors.ErrInvalidFormat, "unknown protocol %s", s)
+	}
+	return uint16(p), nil
+}
+
+func sprintProtocol(p uint16) string {
+	for name, proto := range tcProtocols {
+		if proto == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", p)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// xmitTime returns ticks sending size bytes at rate bytes per second
+func xmitTime(rate uint64, size uint64) uint32 {
+	if rate == 0 {
+		return 0
+	}
+	t := math.Round(1000000 * float64(size) / float64(rate) * tickInUsec)
+	if t > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(t)
+}
+
+// xmitSize returns bytes sent in ticks at rate bytes per second
+func xmitSize(rate uint64, ticks uint32) uint64 {
+	return uint64(math.Round(float64(rate) * float64(ticks) / tickInUsec / 1000000))
+}
+
+// sprintU32Handle prints handle of u32 filters as htid:hash:node
+func sprintU32Handle(h uint32) string {
+	s := ""
+	if htid := h >> 20; htid != 0 {
+		s += fmt.Sprintf("%x:", htid)
+	}
+	hash := (h >> 12) & 0xff
+	node := h & 0xfff
+	if hash != 0 || node != 0 {
+		if hash != 0 {
+			s += fmt.Sprintf("%x", hash)
+		}
+		if node != 0 {
+			s += fmt.Sprintf(":%x", node)
+		}
+	}
+	return s
+}
+
+func parseU32Handle(s string) (uint32, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, errors.Wrapf(errors.ErrInvalidFormat, "invalid u32 handle %s", s)
+	}
+	shifts := []uint{20, 12, 0}
+	bits := []int{12, 8, 12}
+	var h uint32
+	for i, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(part, 16, bits[i])
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid u32 handle %s", s)
+		}
+		h |= uint32(v) << shifts[i]
+	}
+	return h, nil
+}
+
+type tcAttrs map[uint16][]byte
+
+func parseTcAttrs(b []byte) (tcAttrs, error) {
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, err
+	}
+	m := tcAttrs{}
+	for _, attr := range attrs {
+		m[attr.Attr.Type&nlaTypeMask] = attr.Value
+	}
+	return m, nil
+}
+
+func (attrs tcAttrs) nested(typ uint16) (tcAttrs, error) {
+	v, ok := attrs[typ]
+	if !ok {
+		return tcAttrs{}, nil
+	}
+	return parseTcAttrs(v)
+}
+
+func (attrs tcAttrs) str(typ uint16) string {
+	return strings.TrimRight(string(attrs[typ]), "\x00")
+}
+
+func (attrs tcAttrs) uint32(typ uint16) (uint32, bool) {
+	v, ok := attrs[typ]
+	if !ok || len(v) < 4 {
+		return 0, false
+	}
+	return nl.NativeEndian().Uint32(v), true
+}
+
+func (attrs tcAttrs) uint64(typ uint16) (uint64, bool) {
+	v, ok := attrs[typ]
+	if !ok || len(v) < 8 {
+		return 0, false
+	}
+	return nl.NativeEndian().Uint64(v), true
+}
+
+// actions returns kind and options of actions of attribute typ in order
+func (attrs tcAttrs) actions(typ uint16) ([]string, []tcAttrs, error) {
+	acts, err := attrs.nested(typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	kinds := []string{}
+	opts := []tcAttrs{}
+	for order := uint16(1); ; order++ {
+		act, err := acts.nested(order)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "action order %d", order)
+		}
+		if len(act) == 0 {
+			break
+		}
+		opt, err := act.nested(nl.TCA_ACT_OPTIONS)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "action order %d options", order)
+		}
+		kinds = append(kinds, act.str(nl.TCA_ACT_KIND))
+		opts = append(opts, opt)
+	}
+	return kinds, opts, nil
+}
+
+func nlUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	nl.NativeEndian().PutUint32(b, v)
+	return b
+}
+
+func nlUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	nl.NativeEndian().PutUint64(b, v)
+	return b
+}
+
+func nlString(s string) []byte {
+	return nl.ZeroTerminated(s)
+}
+
+// tcRateSpec returns ratespec of rate in bytes per second, with rate beyond
+// 32 bits carried by separate attribute
+func tcRateSpec(rate uint64) nl.TcRateSpec {
+	spec := nl.TcRateSpec{
+		Linklayer: nl.LINKLAYER_ETHERNET,
+	}
+	if rate >= 1<<32 {
+		spec.Rate = math.MaxUint32
+	} else {
+		spec.Rate = uint32(rate)
+	}
+	return spec
+}
+
+// tcMessage is a tcmsg with attributes, as payload of RTM_*QDISC,
+// RTM_*TCLASS and RTM_*TFILTER messages
+type tcMessage struct {
+	msg   nl.TcMsg
+	attrs []*nl.RtAttr
+}
+
+func (m *tcMessage) Len() int {
+	return len(m.Serialize())
+}
+
+func (m *tcMessage) Serialize() []byte {
+	b := append([]byte{}, m.msg.Serialize()...)
+	for _, attr := range m.attrs {
+		b = append(b, attr.Serialize()...)
+	}
+	return b
+}
+
+func newTcMessage(ifindex int32, kind string) *tcMessage {
+	return &tcMessage{
+		msg: nl.TcMsg{
+			Family:  unix.AF_UNSPEC,
+			Ifindex: ifindex,
+		},
+		attrs: []*nl.RtAttr{
+			nl.NewRtAttr(nl.TCA_KIND, nlString(kind)),
+		},
+	}
+}
+
+func (m *tcMessage) options() *nl.RtAttr {
+	opts := nl.NewRtAttr(nl.TCA_OPTIONS, nil)
+	m.attrs = append(m.attrs, opts)
+	return opts
+}
+
+func decodeTcMsg(b []byte) (nl.TcMsg, tcAttrs, error) {
+	if len(b) < nl.SizeofTcMsg {
+		return nl.TcMsg{}, nil, errors.Wrapf(errors.ErrInvalidFormat, "short tcmsg of %d bytes", len(b))
+	}
+	msg := *nl.DeserializeTcMsg(b)
+	attrs, err := parseTcAttrs(b[nl.SizeofTcMsg:])
+	if err != nil {
+		return msg, nil, errors.Wrap(err, "parse attributes")
+	}
+	return msg, attrs, nil
+}
+
+// decodeQdisc returns nil qdisc for default qdiscs of devices, and
+// errors.ErrNotSupported for other kinds not modeled
+func decodeQdisc(b []byte) (int32, IQdisc, error) {
+	msg, attrs, err := decodeTcMsg(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	base := &SBaseTcQdisc{
+		Kind:   attrs.str(nl.TCA_KIND),
+		Handle: sprintHandle(msg.Handle),
+	}
+	if msg.Parent == TC_H_ROOT {
+		base.Root = true
+	} else if base.Kind != "ingress" && base.Kind != "clsact" {
+		base.Parent = sprintHandle(msg.Parent)
+	}
+	switch base.Kind {
+	case "htb", "tbf":
+	case "ingress":
+		return msg.Ifindex, &QdiscIngress{SBaseTcQdisc: base}, nil
+	case "clsact":
+		return msg.Ifindex, &QdiscClsact{SBaseTcQdisc: base}, nil
+	case "mq":
+		return msg.Ifindex, &QdiscMq{SBaseTcQdisc: base}, nil
+	case "pfifo_fast", "noqueue":
+		// kernel defaults, they are replaced like missing qdiscs
+		return msg.Ifindex, nil, nil
+	default:
+		// options of other kinds, e.g. netem, are not always
+		// attributes
+		q, err := decodeQdiscOptions(base, attrs)
+		if err != nil {
+			return msg.Ifindex, nil, errors.Wrapf(err, "qdisc %s options", base.Kind)
+		}
+		return msg.Ifindex, q, nil
+	}
+	opts, err := attrs.nested(nl.TCA_OPTIONS)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "qdisc %s options", base.Kind)
+	}
+	switch base.Kind {
+	case "htb":
+		v, ok := opts[nl.TCA_HTB_INIT]
+		if !ok || len(v) < nl.SizeofTcHtbGlob {
+			return 0, nil, errors.Wrap(errors.ErrInvalidFormat, "htb without init options")
+		}
+		glob := nl.DeserializeTcHtbGlob(v)
+		return msg.Ifindex, &QdiscHtb{
+			SBaseTcQdisc: base,
+			DefaultClass: uint16(glob.Defcls),
+		}, nil
+	case "tbf":
+		v, ok := opts[nl.TCA_TBF_PARMS]
+		if !ok || len(v) < nl.SizeofTcTbfQopt {
+			return 0, nil, errors.Wrap(errors.ErrInvalidFormat, "tbf without parameters")
+		}
+		qopt := nl.DeserializeTcTbfQopt(v)
+		rate := uint64(qopt.Rate.Rate)
+		if rate64, ok := opts.uint64(nl.TCA_TBF_RATE64); ok {
+			rate = rate64
+		}
+		q := &QdiscTbf{
+			SBaseTcQdisc: base,
+			Rate:         rate * 8,
+			Burst:        xmitSize(rate, qopt.Buffer),
+		}
+		if rate > 0 {
+			latency := 1000000*float64(qopt.Limit)/float64(rate) - float64(qopt.Buffer)/tickInUsec
+			if latency > 0 {
+				q.Latency = uint64(math.Round(latency))
+			}
+		}
+		return msg.Ifindex, q, nil
+	}
+	return msg.Ifindex, nil, nil
+}
+
+func encodeQdisc(ifindex int32, q IQdisc, withOptions bool) (*tcMessage, error) {
+	base := q.Base()
+	m := newTcMessage(ifindex, base.Kind)
+	handle, err := parseHandle(base.Handle)
+	if err != nil {
+		return nil, errors.Wrapf(err, "qdisc handle")
+	}
+	m.msg.Handle = handle
+	switch {
+	case base.Root:
+		m.msg.Parent = TC_H_ROOT
+	case base.Kind == "ingress" || base.Kind == "clsact":
+		m.msg.Parent = TC_H_INGRESS
+	case len(base.Parent) > 0:
+		parent, err := parseHandle(base.Parent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "qdisc parent")
+		}
+		m.msg.Parent = parent
+	}
+	if !withOptions {
+		return m, nil
+	}
+	switch q := q.(type) {
+	case *QdiscHtb:
+		glob := &nl.TcHtbGlob{
+			Version:      htbVersion,
+			Rate2Quantum: htbRate2Quantum,
+			Defcls:       uint32(q.DefaultClass),
+		}
+		m.options().AddRtAttr(nl.TCA_HTB_INIT, glob.Serialize())
+	case *QdiscTbf:
+		rate := q.Rate / 8
+		if rate == 0 {
+			return nil, errors.Wrap(errors.ErrInvalidFormat, "tbf rate is zero")
+		}
+		qopt := &nl.TcTbfQopt{
+			Rate:   tcRateSpec(rate),
+			Limit:  uint32(float64(rate)*float64(q.Latency)/1000000) + uint32(q.Burst),
+			Buffer: xmitTime(rate, q.Burst),
+		}
+		opts := m.options()
+		opts.AddRtAttr(nl.TCA_TBF_PARMS, qopt.Serialize())
+		opts.AddRtAttr(nl.TCA_TBF_BURST, nlUint32(uint32(q.Burst)))
+		if rate >= 1<<32 {
+			opts.AddRtAttr(nl.TCA_TBF_RATE64, nlUint64(rate))
+		}
+	case *QdiscIngress, *QdiscClsact, *QdiscMq:
+	default:
+		if err := encodeQdiscOptions(m, q); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+type tcClassMsg struct {
+	id     uint32
+	parent uint32
+	cls    IClass
+}
+
+func decodeClass(b []byte) (int32, *tcClassMsg, error) {
+	msg, attrs, err := decodeTcMsg(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	kind := attrs.str(nl.TCA_KIND)
+	if kind != "htb" {
+		return msg.Ifindex, nil, nil
+	}
+	opts, err := attrs.nested(nl.TCA_OPTIONS)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "class %s options", kind)
+	}
+	v, ok := opts[nl.TCA_HTB_PARMS]
+	if !ok || len(v) < nl.SizeofTcHtbCopt {
+		return 0, nil, errors.Wrap(errors.ErrInvalidFormat, "htb class without parameters")
+	}
+	copt := nl.DeserializeTcHtbCopt(v)
+	rate := uint64(copt.Rate.Rate)
+	if rate64, ok := opts.uint64(nl.TCA_HTB_RATE64); ok {
+		rate = rate64
+	}
+	ceil := uint64(copt.Ceil.Rate)
+	if ceil64, ok := opts.uint64(nl.TCA_HTB_CEIL64); ok {
+		ceil = ceil64
+	}
+	return msg.Ifindex, &tcClassMsg{
+		id:     msg.Handle,
+		parent: msg.Parent,
+		cls: &SHtbClass{
+			SBaseTcClass: &SBaseTcClass{
+				Kind:    kind,
+				ClassId: sprintHandle(msg.Handle),
+			},
+			Rate: rate * 8,
+			Ceil: ceil * 8,
+		},
+	}, nil
+}
+
+// linkClasses sets parents of classes, in the order of parents before
+// children.  Classes with unknown parent are dropped
+func linkClasses(msgs []*tcClassMsg) []IClass {
+	classes := []IClass{}
+	byId := map[uint32]IClass{}
+	for len(msgs) > 0 {
+		var leftover []*tcClassMsg
+		for _, m := range msgs {
+			if m.parent != TC_H_ROOT {
+				parent, ok := byId[m.parent]
+				if !ok {
+					leftover = append(leftover, m)
+					continue
+				}
+				m.cls.Base().Parent = parent
+			}
+			byId[m.id] = m.cls
+			classes = append(classes, m.cls)
+		}
+		if len(leftover) == len(msgs) {
+			for _, m := range leftover {
+				log.Debugf("class %s: parent %s not found", sprintHandle(m.id), sprintHandle(m.parent))
+			}
+			break
+		}
+		msgs = leftover
+	}
+	return classes
+}
+
+func encodeClass(ifindex int32, cls IClass, withOptions bool) (*tcMessage, error) {
+	base := cls.Base()
+	m := newTcMessage(ifindex, base.Kind)
+	id, err := parseHandle(base.ClassId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "classid")
+	}
+	m.msg.Handle = id
+	if base.Parent != nil {
+		parent, err := parseHandle(base.Parent.Id())
+		if err != nil {
+			return nil, errors.Wrapf(err, "parent classid")
+		}
+		m.msg.Parent = parent
+	} else {
+		m.msg.Parent = id & 0xffff0000
+	}
+	if !withOptions {
+		return m, nil
+	}
+	htbCls, ok := cls.(*SHtbClass)
+	if !ok {
+		return nil, errors.Wrapf(errors.ErrNotSupported, "class %s", base.Kind)
+	}
+	rate := htbCls.Rate / 8
+	ceil := htbCls.Ceil / 8
+	if rate == 0 || ceil == 0 {
+		return nil, errors.Wrap(errors.ErrInvalidFormat, "htb class rate or ceil is zero")
+	}
+	copt := &nl.TcHtbCopt{
+		Rate:    tcRateSpec(rate),
+		Ceil:    tcRateSpec(ceil),
+		Buffer:  xmitTime(rate, uint64(float64(rate)/bufferHz)+htbDefaultMtu),
+		Cbuffer: xmitTime(ceil, uint64(float64(ceil)/bufferHz)+htbDefaultMtu),
+	}
+	opts := m.options()
+	opts.AddRtAttr(nl.TCA_HTB_PARMS, copt.Serialize())
+	if rate >= 1<<32 {
+		opts.AddRtAttr(nl.TCA_HTB_RATE64, nlUint64(rate))
+	}
+	if ceil >= 1<<32 {
+		opts.AddRtAttr(nl.TCA_HTB_CEIL64, nlUint64(ceil))
+	}
+	return m, nil
+}
+
+// decodeFilter returns nil filter for kinds not modeled and messages without
+// the match, e.g. headers of filter chains and hash tables of u32
+func decodeFilter(b []byte, qs []IQdisc, linkName func(int) (string, error)) (int32, IFilter, error) {
+	msg, attrs, err := decodeTcMsg(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	base := &SBaseTcFilter{
+		Kind:     attrs.str(nl.TCA_KIND),
+		Protocol: sprintProtocol(htons(uint16(msg.Info & 0xffff))),
+		Prio:     msg.Info >> 16,
+	}
+	switch msg.Parent {
+	case TC_H_CLSACT&0xffff0000 | TC_H_MIN_INGRESS, TC_H_CLSACT&0xffff0000 | TC_H_MIN_EGRESS:
+		base.Hook = FilterHookIngress
+		if msg.Parent&0xffff == TC_H_MIN_EGRESS {
+			base.Hook = FilterHookEgress
+		}
+		for _, q := range qs {
+			if q.Base().Kind == "clsact" {
+				base.Parent = q
+				break
+			}
+		}
+	default:
+		parentId := sprintHandle(msg.Parent & 0xffff0000)
+		for _, q := range qs {
+			if q.Id() == parentId {
+				base.Parent = q
+				break
+			}
+		}
+	}
+	if base.Parent == nil {
+		return msg.Ifindex, nil, errors.Wrapf(errors.ErrNotFound, "parent %s of filter", sprintHandle(msg.Parent))
+	}
+	switch base.Kind {
+	case "fw", "u32", "matchall", "flower", "bpf":
+	default:
+		return msg.Ifindex, nil, nil
+	}
+	opts, err := attrs.nested(nl.TCA_OPTIONS)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "filter %s options", base.Kind)
+	}
+	switch base.Kind {
+	case "fw":
+		classId, ok := opts.uint32(nl.TCA_FW_CLASSID)
+		if !ok {
+			return msg.Ifindex, nil, nil
+		}
+		return msg.Ifindex, &SFwFilter{
+			SBaseTcFilter: base,
+			ClassId:       sprintHandle(classId),
+			Handle:        msg.Handle,
+		}, nil
+	case "u32":
+		kinds, actOpts, err := opts.actions(nl.TCA_U32_ACT)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "u32 actions")
+		}
+		for i, kind := range kinds {
+			if kind != "mirred" {
+				continue
+			}
+			v, ok := actOpts[i][nl.TCA_MIRRED_PARMS]
+			if !ok || len(v) < nl.SizeofTcMirred {
+				continue
+			}
+			mirred := nl.DeserializeTcMirred(v)
+			if mirred.Eaction != tcaEgressRedir {
+				continue
+			}
+			dev, err := linkName(int(mirred.Ifindex))
+			if err != nil {
+				return 0, nil, errors.Wrapf(err, "name of link %d", mirred.Ifindex)
+			}
+			return msg.Ifindex, &SU32Filter{
+				SBaseTcFilter: base,
+				RedirectDev:   dev,
+				Handle:        sprintU32Handle(msg.Handle),
+			}, nil
+		}
+		return msg.Ifindex, nil, nil
+	case "matchall":
+		kinds, actOpts, err := opts.actions(nl.TCA_MATCHALL_ACT)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "matchall actions")
+		}
+		for i, kind := range kinds {
+			if kind != "police" {
+				continue
+			}
+			pktsRate, _ := actOpts[i].uint64(tcaPolicePktRate64)
+			pktsBurst, _ := actOpts[i].uint64(tcaPolicePktBurst64)
+			if pktsRate == 0 {
+				continue
+			}
+			return msg.Ifindex, &SMatchallFilter{
+				SBaseTcFilter: base,
+				PktsRate:      pktsRate,
+				PktsBurst:     xmitSize(pktsRate, uint32(pktsBurst)),
+			}, nil
+		}
+		return msg.Ifindex, nil, nil
+	case "flower":
+		f, err := decodeFlowerFilter(base, msg.Handle, opts, linkName)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "flower")
+		}
+		return msg.Ifindex, f, nil
+	case "bpf":
+		if msg.Handle == 0 {
+			return msg.Ifindex, nil, nil
+		}
+		f := &SBpfFilter{
+			SBaseTcFilter: base,
+			Handle:        msg.Handle,
+			Name:          opts.str(nl.TCA_BPF_NAME),
+		}
+		if flags, ok := opts.uint32(nl.TCA_BPF_FLAGS); ok {
+			f.DirectAction = flags&nl.TCA_BPF_FLAG_ACT_DIRECT != 0
+		}
+		if classId, ok := opts.uint32(nl.TCA_BPF_CLASSID); ok {
+			f.ClassId = sprintHandle(classId)
+		}
+		f.ProgId, _ = opts.uint32(nl.TCA_BPF_ID)
+		if tag, ok := opts[nl.TCA_BPF_TAG]; ok {
+			f.Tag = hex.EncodeToString(tag)
+		}
+		return msg.Ifindex, f, nil
+	}
+	return msg.Ifindex, nil, nil
+}
+
+func filterParentHandle(f *SBaseTcFilter) (uint32, error) {
+	switch f.Hook {
+	case FilterHookIngress:
+		return TC_H_CLSACT&0xffff0000 | TC_H_MIN_INGRESS, nil
+	case FilterHookEgress:
+		return TC_H_CLSACT&0xffff0000 | TC_H_MIN_EGRESS, nil
+	}
+	if f.Parent == nil {
+		return TC_H_ROOT, nil
+	}
+	return parseHandle(f.Parent.Id())
+}
+
+// addTcAction adds action of kind to actions at order, starting from 1
+func addTcAction(actions *nl.RtAttr, order int, kind string) *nl.RtAttr {
+	act := actions.AddRtAttr(order, nil)
+	act.AddRtAttr(nl.TCA_ACT_KIND, nlString(kind))
+	return act.AddRtAttr(nl.TCA_ACT_OPTIONS, nil)
+}
+
+func encodeFilter(ifindex int32, f IFilter, withOptions bool, linkIndex func(string) (int, error)) (*tcMessage, error) {
+	base := f.Base()
+	m := newTcMessage(ifindex, base.Kind)
+	parent, err := filterParentHandle(base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "filter parent")
+	}
+	m.msg.Parent = parent
+	proto, err := parseProtocol(base.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	m.msg.Info = base.Prio<<16 | uint32(htons(proto))
+	switch f := f.(type) {
+	case *SFwFilter:
+		m.msg.Handle = f.Handle
+		if !withOptions {
+			return m, nil
+		}
+		classId, err := parseHandle(f.ClassId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fw classid")
+		}
+		m.options().AddRtAttr(nl.TCA_FW_CLASSID, nlUint32(classId))
+	case *SU32Filter:
+		if !withOptions {
+			if len(f.Handle) > 0 {
+				handle, err := parseU32Handle(f.Handle)
+				if err != nil {
+					return nil, err
+				}
+				m.msg.Handle = handle
+			}
+			return m, nil
+		}
+		index, err := linkIndex(f.RedirectDev)
+		if err != nil {
+			return nil, errors.Wrapf(err, "index of link %s", f.RedirectDev)
+		}
+		sel := &nl.TcU32Sel{
+			Flags: nl.TC_U32_TERMINAL,
+			Nkeys: 1,
+			Keys:  []nl.TcU32Key{{}},
+		}
+		mirred := &nl.TcMirred{
+			TcGen: nl.TcGen{
+				Action: tcActStolen,
+			},
+			Eaction: tcaEgressRedir,
+			Ifindex: uint32(index),
+		}
+		opts := m.options()
+		opts.AddRtAttr(nl.TCA_U32_SEL, sel.Serialize())
+		actOpts := addTcAction(opts.AddRtAttr(nl.TCA_U32_ACT, nil), 1, "mirred")
+		actOpts.AddRtAttr(nl.TCA_MIRRED_PARMS, mirred.Serialize())
+	case *SMatchallFilter:
+		if !withOptions {
+			return m, nil
+		}
+		police := &nl.TcPolice{
+			Action: tcActShot,
+		}
+		opts := m.options()
+		actOpts := addTcAction(opts.AddRtAttr(nl.TCA_MATCHALL_ACT, nil), 1, "police")
+		actOpts.AddRtAttr(nl.TCA_POLICE_TBF, police.Serialize())
+		actOpts.AddRtAttr(tcaPolicePktRate64, nlUint64(f.PktsRate))
+		actOpts.AddRtAttr(tcaPolicePktBurst64, nlUint64(uint64(xmitTime(f.PktsRate, f.PktsBurst))))
+		actOpts.AddRtAttr(nl.TCA_POLICE_RESULT, nlUint32(tcActUnspec&0xffffffff))
+	case *SFlowerFilter:
+		m.msg.Handle = f.Handle
+		if !withOptions {
+			return m, nil
+		}
+		if err := encodeFlowerFilter(m.options(), f, proto, linkIndex); err != nil {
+			return nil, errors.Wrap(err, "flower")
+		}
+	case *SBpfFilter:
+		// loading programs from object files is left to tc command
+		m.msg.Handle = f.Handle
+		if withOptions {
+			return nil, errors.Wrapf(errors.ErrNotSupported, "load bpf program")
+		}
+	default:
+		return nil, errors.Wrapf(errors.ErrNotSupported, "filter %s", base.Kind)
+	}
+	return m, nil
+}
+
+// decodeQdiscs returns qdiscs of device ifindex from payloads of qdisc
+// dump.  Qdiscs of other devices and default qdiscs are skipped
+func decodeQdiscs(ifindex int32, msgs [][]byte) ([]IQdisc, error) {
+	qs := []IQdisc{}
+	for _, b := range msgs {
+		index, q, err := decodeQdisc(b)
+		if err != nil {
+			if index != ifindex && errors.Cause(err) == errors.ErrNotSupported {
+				log.Debugf("decode qdisc: %v", err)
+				continue
+			}
+			return nil, errors.Wrap(err, "decode qdisc")
+		}
+		if index == ifindex && q != nil {
+			qs = append(qs, q)
+		}
+	}
+	return qs, nil
+}
+
+// decodeQdiscTree builds tree of qs and payloads of class and filter dumps
+// of device ifindex
+func decodeQdiscTree(ifindex int32, qs []IQdisc, classMsgs, filterMsgs [][]byte, linkName func(int) (string, error)) (*QdiscTree, error) {
+	clsMsgs := []*tcClassMsg{}
+	for _, b := range classMsgs {
+		index, m, err := decodeClass(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode class")
+		}
+		if index == ifindex && m != nil {
+			clsMsgs = append(clsMsgs, m)
+		}
+	}
+	filters := []IFilter{}
+	for _, b := range filterMsgs {
+		index, f, err := decodeFilter(b, qs, linkName)
+		if err != nil {
+			if errors.Cause(err) == errors.ErrNotFound {
+				log.Debugf("decode filter: %v", err)
+				continue
+			}
+			return nil, errors.Wrap(err, "decode filter")
+		}
+		if index == ifindex && f != nil {
+			filters = append(filters, f)
+		}
+	}
+	return NewQdiscTree(qs, linkClasses(clsMsgs), filters), nil
+}
+
+// filterDumpParents returns parents to dump filters attached to qs
+func filterDumpParents(qs []IQdisc) []uint32 {
+	parents := []uint32{}
+	for _, q := range qs {
+		switch q.Base().Kind {
+		case "clsact":
+			parents = append(parents,
+				TC_H_CLSACT&0xffff0000|TC_H_MIN_INGRESS,
+				TC_H_CLSACT&0xffff0000|TC_H_MIN_EGRESS,
+			)
+		case "htb", "ingress":
+			if h, err := parseHandle(q.Id()); err == nil {
+				parents = append(parents, h)
+			}
+		}
+	}
+	return parents
+}
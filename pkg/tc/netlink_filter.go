@@ -0,0 +1,333 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// Taken from linux include/uapi/linux/pkt_cls.h and tc_act/tc_police.h
+const (
+	tcaPoliceRate64 = 8
+
+	// mtu assumed by tc command when computing rate table of police
+	policeDefaultMtu = 2047
+	rtabSize         = 256
+)
+
+type flowerPortAttrs struct {
+	src uint16
+	dst uint16
+}
+
+var flowerPortKeys = map[uint8]flowerPortAttrs{
+	6:   {nl.TCA_FLOWER_KEY_TCP_SRC, nl.TCA_FLOWER_KEY_TCP_DST},
+	17:  {nl.TCA_FLOWER_KEY_UDP_SRC, nl.TCA_FLOWER_KEY_UDP_DST},
+	132: {nl.TCA_FLOWER_KEY_SCTP_SRC, nl.TCA_FLOWER_KEY_SCTP_DST},
+}
+
+func parseFlowerIpProto(s string) (uint8, error) {
+	if p, ok := flowerIpProtos[s]; ok {
+		return p, nil
+	}
+	p, err := strconv.ParseUint(s, 16, 8)
+	if err != nil {
+		return 0, errors.Wrapf(errors.ErrInvalidFormat, "unknown ip_proto %s", s)
+	}
+	return uint8(p), nil
+}
+
+func sprintFlowerIpProto(p uint8) string {
+	for name, proto := range flowerIpProtos {
+		if proto == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("%02x", p)
+}
+
+func nlBe16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func (attrs tcAttrs) be16(typ uint16) (uint16, bool) {
+	v, ok := attrs[typ]
+	if !ok || len(v) < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(v), true
+}
+
+// policeRtab returns rate table of police at rate in bytes per second, as
+// computed by tc command
+func policeRtab(spec *nl.TcRateSpec, rate uint64) []byte {
+	cellLog := 0
+	for policeDefaultMtu>>cellLog > rtabSize-1 {
+		cellLog++
+	}
+	spec.CellLog = uint8(cellLog)
+	spec.CellAlign = -1
+	rtab := make([]byte, 4*rtabSize)
+	for i := 0; i < rtabSize; i++ {
+		size := uint64(i+1) << cellLog
+		nl.NativeEndian().PutUint32(rtab[4*i:], xmitTime(rate, size))
+	}
+	return rtab
+}
+
+func encodeFlowerIp(opts *nl.RtAttr, s string, v4Type, v6Type int) error {
+	s = normalizeFlowerIp(s)
+	ip := net.ParseIP(s)
+	mask := net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)
+	if ip == nil {
+		var ipNet *net.IPNet
+		var err error
+		ip, ipNet, err = net.ParseCIDR(s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid address %s", s)
+		}
+		mask = ipNet.Mask
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if len(mask) == net.IPv6len {
+			mask = mask[net.IPv6len-net.IPv4len:]
+		}
+		opts.AddRtAttr(v4Type, ip4)
+		opts.AddRtAttr(v4Type+1, mask)
+	} else {
+		opts.AddRtAttr(v6Type, ip.To16())
+		opts.AddRtAttr(v6Type+1, mask)
+	}
+	return nil
+}
+
+func decodeFlowerIp(opts tcAttrs, v4Type, v6Type uint16) string {
+	for _, typ := range []uint16{v4Type, v6Type} {
+		ip, ok := opts[typ]
+		if !ok {
+			continue
+		}
+		ipNet := net.IPNet{
+			IP:   net.IP(ip),
+			Mask: net.IPMask(opts[typ+1]),
+		}
+		if len(ipNet.Mask) != len(ipNet.IP) {
+			return net.IP(ip).String()
+		}
+		return normalizeFlowerIp(ipNet.String())
+	}
+	return ""
+}
+
+func encodeFlowerFilter(opts *nl.RtAttr, f *SFlowerFilter, proto uint16, linkIndex func(string) (int, error)) error {
+	if f.Protocol != "all" && len(f.Protocol) > 0 {
+		opts.AddRtAttr(nl.TCA_FLOWER_KEY_ETH_TYPE, nlBe16(proto))
+	}
+	if f.isVlan() {
+		if f.VlanId > 0 {
+			opts.AddRtAttr(nl.TCA_FLOWER_KEY_VLAN_ID, nl.Uint16Attr(f.VlanId))
+		}
+		if ethType := f.ethType(); ethType != f.Protocol {
+			p, err := parseProtocol(ethType)
+			if err != nil {
+				return errors.Wrap(err, "vlan_ethtype")
+			}
+			opts.AddRtAttr(nl.TCA_FLOWER_KEY_VLAN_ETH_TYPE, nlBe16(p))
+		}
+	}
+	if len(f.IpProto) > 0 {
+		ipProto, err := parseFlowerIpProto(f.IpProto)
+		if err != nil {
+			return err
+		}
+		opts.AddRtAttr(nl.TCA_FLOWER_KEY_IP_PROTO, []byte{ipProto})
+		if f.SrcPort > 0 || f.DstPort > 0 {
+			ports, ok := flowerPortKeys[ipProto]
+			if !ok {
+				return errors.Wrapf(errors.ErrNotSupported, "ports of ip_proto %s", f.IpProto)
+			}
+			if f.SrcPort > 0 {
+				opts.AddRtAttr(int(ports.src), nlBe16(f.SrcPort))
+			}
+			if f.DstPort > 0 {
+				opts.AddRtAttr(int(ports.dst), nlBe16(f.DstPort))
+			}
+		}
+	} else if f.SrcPort > 0 || f.DstPort > 0 {
+		return errors.Wrap(errors.ErrInvalidFormat, "ports without ip_proto")
+	}
+	if len(f.SrcIp) > 0 {
+		if err := encodeFlowerIp(opts, f.SrcIp, nl.TCA_FLOWER_KEY_IPV4_SRC, nl.TCA_FLOWER_KEY_IPV6_SRC); err != nil {
+			return err
+		}
+	}
+	if len(f.DstIp) > 0 {
+		if err := encodeFlowerIp(opts, f.DstIp, nl.TCA_FLOWER_KEY_IPV4_DST, nl.TCA_FLOWER_KEY_IPV6_DST); err != nil {
+			return err
+		}
+	}
+
+	actions := opts.AddRtAttr(nl.TCA_FLOWER_ACT, nil)
+	order := 1
+	if p := f.Police; p != nil {
+		police := &nl.TcPolice{
+			Action: tcActShot,
+		}
+		actOpts := addTcAction(actions, order, "police")
+		if p.Rate > 0 {
+			rate := p.Rate / 8
+			police.Rate = tcRateSpec(rate)
+			police.Burst = xmitTime(rate, p.Burst)
+			rtab := policeRtab(&police.Rate, rate)
+			actOpts.AddRtAttr(nl.TCA_POLICE_TBF, police.Serialize())
+			actOpts.AddRtAttr(nl.TCA_POLICE_RATE, rtab)
+			if rate >= 1<<32 {
+				actOpts.AddRtAttr(tcaPoliceRate64, nlUint64(rate))
+			}
+		} else {
+			actOpts.AddRtAttr(nl.TCA_POLICE_TBF, police.Serialize())
+		}
+		if p.PktsRate > 0 {
+			actOpts.AddRtAttr(tcaPolicePktRate64, nlUint64(p.PktsRate))
+			actOpts.AddRtAttr(tcaPolicePktBurst64, nlUint64(uint64(xmitTime(p.PktsRate, p.PktsBurst))))
+		}
+		actOpts.AddRtAttr(nl.TCA_POLICE_RESULT, nlUint32(uint32(tcActPipe)))
+		order++
+	}
+	if s := f.SkbEdit; s != nil {
+		skbedit := &nl.TcSkbEdit{
+			TcGen: nl.TcGen{
+				Action: tcActPipe,
+			},
+		}
+		actOpts := addTcAction(actions, order, "skbedit")
+		actOpts.AddRtAttr(nl.TCA_SKBEDIT_PARMS, skbedit.Serialize())
+		if len(s.Priority) > 0 {
+			priority, err := parseHandle(s.Priority)
+			if err != nil {
+				return errors.Wrapf(err, "skbedit priority")
+			}
+			actOpts.AddRtAttr(nl.TCA_SKBEDIT_PRIORITY, nlUint32(priority))
+		}
+		if s.QueueMapping != nil {
+			actOpts.AddRtAttr(nl.TCA_SKBEDIT_QUEUE_MAPPING, nl.Uint16Attr(*s.QueueMapping))
+		}
+		if s.Mark > 0 {
+			actOpts.AddRtAttr(nl.TCA_SKBEDIT_MARK, nlUint32(s.Mark))
+		}
+		order++
+	}
+	if len(f.RedirectDev) > 0 {
+		index, err := linkIndex(f.RedirectDev)
+		if err != nil {
+			return errors.Wrapf(err, "index of link %s", f.RedirectDev)
+		}
+		mirred := &nl.TcMirred{
+			TcGen: nl.TcGen{
+				Action: tcActStolen,
+			},
+			Eaction: tcaEgressRedir,
+			Ifindex: uint32(index),
+		}
+		actOpts := addTcAction(actions, order, "mirred")
+		actOpts.AddRtAttr(nl.TCA_MIRRED_PARMS, mirred.Serialize())
+	}
+	return nil
+}
+
+func decodeFlowerFilter(base *SBaseTcFilter, handle uint32, opts tcAttrs, linkName func(int) (string, error)) (*SFlowerFilter, error) {
+	f := &SFlowerFilter{
+		SBaseTcFilter: base,
+		Handle:        handle,
+	}
+	if p, ok := opts.be16(nl.TCA_FLOWER_KEY_ETH_TYPE); ok {
+		f.EthType = sprintProtocol(p)
+	}
+	if p, ok := opts.be16(nl.TCA_FLOWER_KEY_VLAN_ETH_TYPE); ok {
+		f.EthType = sprintProtocol(p)
+	}
+	if v, ok := opts[nl.TCA_FLOWER_KEY_VLAN_ID]; ok && len(v) >= 2 {
+		f.VlanId = nl.NativeEndian().Uint16(v) & 0xfff
+	}
+	if v, ok := opts[nl.TCA_FLOWER_KEY_IP_PROTO]; ok && len(v) >= 1 {
+		f.IpProto = sprintFlowerIpProto(v[0])
+		if ports, ok := flowerPortKeys[v[0]]; ok {
+			f.SrcPort, _ = opts.be16(ports.src)
+			f.DstPort, _ = opts.be16(ports.dst)
+		}
+	}
+	f.SrcIp = decodeFlowerIp(opts, nl.TCA_FLOWER_KEY_IPV4_SRC, nl.TCA_FLOWER_KEY_IPV6_SRC)
+	f.DstIp = decodeFlowerIp(opts, nl.TCA_FLOWER_KEY_IPV4_DST, nl.TCA_FLOWER_KEY_IPV6_DST)
+
+	kinds, actOpts, err := opts.actions(nl.TCA_FLOWER_ACT)
+	if err != nil {
+		return nil, errors.Wrap(err, "actions")
+	}
+	for i, kind := range kinds {
+		switch kind {
+		case "police":
+			p := &SPoliceAction{}
+			if v, ok := actOpts[i][nl.TCA_POLICE_TBF]; ok && len(v) >= nl.SizeofTcPolice {
+				police := nl.DeserializeTcPolice(v)
+				rate := uint64(police.Rate.Rate)
+				if rate64, ok := actOpts[i].uint64(tcaPoliceRate64); ok {
+					rate = rate64
+				}
+				p.Rate = rate * 8
+				p.Burst = xmitSize(rate, police.Burst)
+			}
+			p.PktsRate, _ = actOpts[i].uint64(tcaPolicePktRate64)
+			if pktsBurst, ok := actOpts[i].uint64(tcaPolicePktBurst64); ok {
+				p.PktsBurst = xmitSize(p.PktsRate, uint32(pktsBurst))
+			}
+			f.Police = p
+		case "skbedit":
+			s := &SSkbEditAction{}
+			s.Mark, _ = actOpts[i].uint32(nl.TCA_SKBEDIT_MARK)
+			if priority, ok := actOpts[i].uint32(nl.TCA_SKBEDIT_PRIORITY); ok {
+				s.Priority = sprintHandle(priority)
+			}
+			if v, ok := actOpts[i][nl.TCA_SKBEDIT_QUEUE_MAPPING]; ok && len(v) >= 2 {
+				queue := nl.NativeEndian().Uint16(v)
+				s.QueueMapping = &queue
+			}
+			f.SkbEdit = s
+		case "mirred":
+			v, ok := actOpts[i][nl.TCA_MIRRED_PARMS]
+			if !ok || len(v) < nl.SizeofTcMirred {
+				continue
+			}
+			mirred := nl.DeserializeTcMirred(v)
+			if mirred.Eaction != tcaEgressRedir {
+				continue
+			}
+			dev, err := linkName(int(mirred.Ifindex))
+			if err != nil {
+				return nil, errors.Wrapf(err, "name of link %d", mirred.Ifindex)
+			}
+			f.RedirectDev = dev
+		}
+	}
+	return f, nil
+}
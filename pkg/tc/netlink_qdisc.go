@@ -0,0 +1,304 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// Taken from linux include/uapi/linux/pkt_sched.h
+const (
+	tcaNetemLatency64 = 10
+	tcaNetemJitter64  = 11
+
+	sizeofTcNetemRate = 16
+	netemDefaultLimit = 1000
+
+	tcaCakeBaseRate64   = 2
+	tcaCakeDiffservMode = 3
+	tcaCakeFlowMode     = 5
+	tcaCakeRtt          = 7
+	tcaCakeNat          = 11
+	tcaCakeWash         = 13
+
+	// struct tc_sfq_qopt, and tc_sfq_qopt_v1 extending it
+	sizeofTcSfqQopt   = 20
+	sizeofTcSfqQoptV1 = 72
+
+	fqUnlimitedRate = math.MaxUint32
+)
+
+// netemPercent converts percentage to fraction of 2^32 as kept by kernel
+func netemPercent(p float64) uint32 {
+	v := math.Round(p / 100 * math.MaxUint32)
+	if v > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(v)
+}
+
+func netemPercentOf(v uint32) float64 {
+	return float64(v) * 100 / math.MaxUint32
+}
+
+func usecToTicks(us uint64) uint32 {
+	t := math.Round(float64(us) * tickInUsec)
+	if t > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(t)
+}
+
+func ticksToUsec(ticks uint32) uint64 {
+	return uint64(math.Round(float64(ticks) / tickInUsec))
+}
+
+func boolUint32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// decodeQdiscOptions returns qdisc of kinds added after htb and tbf.
+// Options of netem and sfq are structs, not attributes
+func decodeQdiscOptions(base *SBaseTcQdisc, attrs tcAttrs) (IQdisc, error) {
+	switch base.Kind {
+	case "fq_codel":
+		opts, err := attrs.nested(nl.TCA_OPTIONS)
+		if err != nil {
+			return nil, err
+		}
+		q := &QdiscFqCodel{SBaseTcQdisc: base}
+		q.Limit, _ = opts.uint32(nl.TCA_FQ_CODEL_LIMIT)
+		q.Flows, _ = opts.uint32(nl.TCA_FQ_CODEL_FLOWS)
+		q.Quantum, _ = opts.uint32(nl.TCA_FQ_CODEL_QUANTUM)
+		if v, ok := opts.uint32(nl.TCA_FQ_CODEL_TARGET); ok {
+			q.Target = uint64(v)
+		}
+		if v, ok := opts.uint32(nl.TCA_FQ_CODEL_INTERVAL); ok {
+			q.Interval = uint64(v)
+		}
+		ecn, _ := opts.uint32(nl.TCA_FQ_CODEL_ECN)
+		q.Ecn = ecn != 0
+		return q, nil
+	case "fq":
+		opts, err := attrs.nested(nl.TCA_OPTIONS)
+		if err != nil {
+			return nil, err
+		}
+		q := &QdiscFq{SBaseTcQdisc: base}
+		q.Limit, _ = opts.uint32(nl.TCA_FQ_PLIMIT)
+		q.FlowLimit, _ = opts.uint32(nl.TCA_FQ_FLOW_PLIMIT)
+		q.Quantum, _ = opts.uint32(nl.TCA_FQ_QUANTUM)
+		q.InitialQuantum, _ = opts.uint32(nl.TCA_FQ_INITIAL_QUANTUM)
+		if v, ok := opts.uint32(nl.TCA_FQ_BUCKETS_LOG); ok && v < 32 {
+			q.Buckets = 1 << v
+		}
+		if v, ok := opts.uint32(nl.TCA_FQ_FLOW_MAX_RATE); ok && v != fqUnlimitedRate {
+			q.MaxRate = uint64(v) * 8
+		}
+		return q, nil
+	case "cake":
+		opts, err := attrs.nested(nl.TCA_OPTIONS)
+		if err != nil {
+			return nil, err
+		}
+		q := &QdiscCake{SBaseTcQdisc: base}
+		if v, ok := opts.uint64(tcaCakeBaseRate64); ok {
+			q.Bandwidth = v * 8
+		}
+		if v, ok := opts.uint32(tcaCakeDiffservMode); ok && int(v) < len(cakeDiffservModes) {
+			q.Diffserv = cakeDiffservModes[v]
+		}
+		if v, ok := opts.uint32(tcaCakeFlowMode); ok && int(v) < len(cakeFlowModes) {
+			q.FlowMode = cakeFlowModes[v]
+		}
+		if v, ok := opts.uint32(tcaCakeRtt); ok {
+			q.Rtt = uint64(v)
+		}
+		nat, _ := opts.uint32(tcaCakeNat)
+		wash, _ := opts.uint32(tcaCakeWash)
+		q.Nat = nat != 0
+		q.Wash = wash != 0
+		return q, nil
+	case "netem":
+		v := attrs[nl.TCA_OPTIONS]
+		if len(v) < nl.SizeofTcNetemQopt {
+			return nil, errors.Wrap(errors.ErrInvalidFormat, "netem without parameters")
+		}
+		qopt := nl.DeserializeTcNetemQopt(v)
+		opts, err := parseTcAttrs(v[nl.SizeofTcNetemQopt:])
+		if err != nil {
+			return nil, err
+		}
+		q := &QdiscNetem{
+			SBaseTcQdisc: base,
+			Limit:        qopt.Limit,
+			Delay:        ticksToUsec(qopt.Latency),
+			Jitter:       ticksToUsec(qopt.Jitter),
+			Loss:         netemPercentOf(qopt.Loss),
+			Duplicate:    netemPercentOf(qopt.Duplicate),
+		}
+		if ns, ok := opts.uint64(tcaNetemLatency64); ok {
+			q.Delay = ns / 1000
+		}
+		if ns, ok := opts.uint64(tcaNetemJitter64); ok {
+			q.Jitter = ns / 1000
+		}
+		if v := opts[nl.TCA_NETEM_REORDER]; len(v) >= nl.SizeofTcNetemReorder {
+			q.Reorder = netemPercentOf(nl.DeserializeTcNetemReorder(v).Probability)
+		}
+		if v := opts[nl.TCA_NETEM_CORRUPT]; len(v) >= nl.SizeofTcNetemCorrupt {
+			q.Corrupt = netemPercentOf(nl.DeserializeTcNetemCorrupt(v).Probability)
+		}
+		if v := opts[nl.TCA_NETEM_RATE]; len(v) >= sizeofTcNetemRate {
+			q.Rate = uint64(nl.NativeEndian().Uint32(v)) * 8
+		}
+		if rate, ok := opts.uint64(nl.TCA_NETEM_RATE64); ok {
+			q.Rate = rate * 8
+		}
+		return q, nil
+	case "sfq":
+		v := attrs[nl.TCA_OPTIONS]
+		if len(v) < sizeofTcSfqQopt {
+			return nil, errors.Wrap(errors.ErrInvalidFormat, "sfq without parameters")
+		}
+		ne := nl.NativeEndian()
+		q := &QdiscSfq{
+			SBaseTcQdisc: base,
+			Quantum:      ne.Uint32(v[0:]),
+			Perturb:      ne.Uint32(v[4:]),
+			Limit:        ne.Uint32(v[8:]),
+			Divisor:      ne.Uint32(v[12:]),
+		}
+		if len(v) >= sizeofTcSfqQoptV1 {
+			q.Depth = ne.Uint32(v[20:])
+		}
+		return q, nil
+	}
+	return nil, errors.Wrapf(errors.ErrNotSupported, "qdisc %s", base.Kind)
+}
+
+// encodeQdiscOptions adds options of qdisc of kinds added after htb and tbf
+func encodeQdiscOptions(m *tcMessage, q IQdisc) error {
+	switch q := q.(type) {
+	case *QdiscFqCodel:
+		opts := m.options()
+		if q.Limit > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_CODEL_LIMIT, nlUint32(q.Limit))
+		}
+		if q.Flows > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_CODEL_FLOWS, nlUint32(q.Flows))
+		}
+		if q.Quantum > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_CODEL_QUANTUM, nlUint32(q.Quantum))
+		}
+		if q.Target > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_CODEL_TARGET, nlUint32(uint32(q.Target)))
+		}
+		if q.Interval > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_CODEL_INTERVAL, nlUint32(uint32(q.Interval)))
+		}
+		opts.AddRtAttr(nl.TCA_FQ_CODEL_ECN, nlUint32(boolUint32(q.Ecn)))
+	case *QdiscFq:
+		opts := m.options()
+		if q.Limit > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_PLIMIT, nlUint32(q.Limit))
+		}
+		if q.FlowLimit > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_FLOW_PLIMIT, nlUint32(q.FlowLimit))
+		}
+		if q.Buckets > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_BUCKETS_LOG, nlUint32(uint32(bits.Len32(q.Buckets)-1)))
+		}
+		if q.Quantum > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_QUANTUM, nlUint32(q.Quantum))
+		}
+		if q.InitialQuantum > 0 {
+			opts.AddRtAttr(nl.TCA_FQ_INITIAL_QUANTUM, nlUint32(q.InitialQuantum))
+		}
+		rate := uint64(fqUnlimitedRate)
+		if q.MaxRate > 0 && q.MaxRate/8 < fqUnlimitedRate {
+			rate = q.MaxRate / 8
+		}
+		opts.AddRtAttr(nl.TCA_FQ_FLOW_MAX_RATE, nlUint32(uint32(rate)))
+	case *QdiscCake:
+		opts := m.options()
+		opts.AddRtAttr(tcaCakeBaseRate64, nlUint64(q.Bandwidth/8))
+		if i := indexOf(cakeDiffservModes, q.Diffserv); i >= 0 {
+			opts.AddRtAttr(tcaCakeDiffservMode, nlUint32(uint32(i)))
+		}
+		if i := indexOf(cakeFlowModes, q.FlowMode); i >= 0 {
+			opts.AddRtAttr(tcaCakeFlowMode, nlUint32(uint32(i)))
+		}
+		if q.Rtt > 0 {
+			opts.AddRtAttr(tcaCakeRtt, nlUint32(uint32(q.Rtt)))
+		}
+		opts.AddRtAttr(tcaCakeNat, nlUint32(boolUint32(q.Nat)))
+		opts.AddRtAttr(tcaCakeWash, nlUint32(boolUint32(q.Wash)))
+	case *QdiscNetem:
+		qopt := &nl.TcNetemQopt{
+			Latency:   usecToTicks(q.Delay),
+			Limit:     q.Limit,
+			Loss:      netemPercent(q.Loss),
+			Duplicate: netemPercent(q.Duplicate),
+			Jitter:    usecToTicks(q.Jitter),
+		}
+		if qopt.Limit == 0 {
+			qopt.Limit = netemDefaultLimit
+		}
+		if q.Reorder > 0 {
+			// as tc command does, reorder every other packet by
+			// probability
+			qopt.Gap = 1
+		}
+		opts := nl.NewRtAttr(nl.TCA_OPTIONS, qopt.Serialize())
+		m.attrs = append(m.attrs, opts)
+		// always present so that replace clears them
+		reorder := &nl.TcNetemReorder{Probability: netemPercent(q.Reorder)}
+		corrupt := &nl.TcNetemCorrupt{Probability: netemPercent(q.Corrupt)}
+		opts.AddRtAttr(nl.TCA_NETEM_REORDER, reorder.Serialize())
+		opts.AddRtAttr(nl.TCA_NETEM_CORRUPT, corrupt.Serialize())
+		rate := make([]byte, sizeofTcNetemRate)
+		bytesPerSec := q.Rate / 8
+		if bytesPerSec >= 1<<32 {
+			nl.NativeEndian().PutUint32(rate, math.MaxUint32)
+			opts.AddRtAttr(nl.TCA_NETEM_RATE64, nlUint64(bytesPerSec))
+		} else {
+			nl.NativeEndian().PutUint32(rate, uint32(bytesPerSec))
+		}
+		opts.AddRtAttr(nl.TCA_NETEM_RATE, rate)
+		opts.AddRtAttr(tcaNetemLatency64, nlUint64(q.Delay*1000))
+		opts.AddRtAttr(tcaNetemJitter64, nlUint64(q.Jitter*1000))
+	case *QdiscSfq:
+		v := make([]byte, sizeofTcSfqQoptV1)
+		ne := nl.NativeEndian()
+		ne.PutUint32(v[0:], q.Quantum)
+		ne.PutUint32(v[4:], q.Perturb)
+		ne.PutUint32(v[8:], q.Limit)
+		ne.PutUint32(v[12:], q.Divisor)
+		ne.PutUint32(v[20:], q.Depth)
+		m.attrs = append(m.attrs, nl.NewRtAttr(nl.TCA_OPTIONS, v))
+	default:
+		return errors.Wrapf(errors.ErrNotSupported, "qdisc %s", q.Base().Kind)
+	}
+	return nil
+}
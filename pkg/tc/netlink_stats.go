@@ -0,0 +1,110 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"github.com/vishvananda/netlink/nl"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	// packets counter of TCA_STATS2, not defined by nl
+	tcaStatsPkt64 = 8
+
+	// sizes of struct gnet_stats_basic and struct gnet_stats_queue
+	sizeofGnetStatsBasic = 12
+	sizeofGnetStatsQueue = 20
+	// size of struct tc_stats, before bps and pps
+	sizeofTcStats = 20
+)
+
+// decodeStatsCounters fills counters from TCA_STATS2, or the legacy
+// TCA_STATS of older kernels
+func (st *STcStats) decodeStatsCounters(attrs tcAttrs) error {
+	stats2, err := attrs.nested(nl.TCA_STATS2)
+	if err != nil {
+		return errors.Wrap(err, "stats2")
+	}
+	if len(stats2) > 0 {
+		ne := nl.NativeEndian()
+		if v := stats2[nl.TCA_STATS_BASIC]; len(v) >= sizeofGnetStatsBasic {
+			st.Bytes = ne.Uint64(v[0:8])
+			st.Packets = uint64(ne.Uint32(v[8:12]))
+		}
+		if pkts, ok := stats2.uint64(tcaStatsPkt64); ok {
+			st.Packets = pkts
+		}
+		if v := stats2[nl.TCA_STATS_QUEUE]; len(v) >= sizeofGnetStatsQueue {
+			st.BacklogPackets = uint64(ne.Uint32(v[0:4]))
+			st.BacklogBytes = uint64(ne.Uint32(v[4:8]))
+			st.Drops = uint64(ne.Uint32(v[8:12]))
+			st.Requeues = uint64(ne.Uint32(v[12:16]))
+			st.Overlimits = uint64(ne.Uint32(v[16:20]))
+		}
+		return nil
+	}
+	if v := attrs[nl.TCA_STATS]; len(v) >= sizeofTcStats {
+		ne := nl.NativeEndian()
+		st.Bytes = ne.Uint64(v[0:8])
+		st.Packets = uint64(ne.Uint32(v[8:12]))
+		st.Drops = uint64(ne.Uint32(v[12:16]))
+		st.Overlimits = uint64(ne.Uint32(v[16:20]))
+		if len(v) >= sizeofTcStats+16 {
+			st.BacklogPackets = uint64(ne.Uint32(v[28:32]))
+			st.BacklogBytes = uint64(ne.Uint32(v[32:36]))
+		}
+	}
+	return nil
+}
+
+// decodeStats returns statistics of qdisc or class message of type typ
+func decodeStats(typ string, b []byte) (int32, *STcStats, error) {
+	msg, attrs, err := decodeTcMsg(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	st := &STcStats{
+		Type: typ,
+		Kind: attrs.str(nl.TCA_KIND),
+		Id:   sprintHandle(msg.Handle),
+	}
+	switch msg.Parent {
+	case TC_H_ROOT:
+		st.Parent = "root"
+	default:
+		st.Parent = sprintHandle(msg.Parent)
+	}
+	if err := st.decodeStatsCounters(attrs); err != nil {
+		return 0, nil, errors.Wrapf(err, "%s %s %s", typ, st.Kind, st.Id)
+	}
+	return msg.Ifindex, st, nil
+}
+
+// decodeStatsMsgs returns statistics of device ifindex from payloads of
+// qdisc or class dump
+func decodeStatsMsgs(ifindex int32, typ string, msgs [][]byte) ([]*STcStats, error) {
+	stats := []*STcStats{}
+	for _, b := range msgs {
+		index, st, err := decodeStats(typ, b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode %s stats", typ)
+		}
+		if index == ifindex {
+			stats = append(stats, st)
+		}
+	}
+	return stats, nil
+}
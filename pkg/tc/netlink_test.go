@@ -0,0 +1,541 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+var testLinks = map[int]string{
+	10: "sdnt0",
+	11: "sdnt1",
+	12: "sdnt2",
+}
+
+func testLinkName(index int) (string, error) {
+	if name, ok := testLinks[index]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("link %d not found", index)
+}
+
+func testLinkIndex(ifname string) (int, error) {
+	for index, name := range testLinks {
+		if name == ifname {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("link %s not found", ifname)
+}
+
+type netlinkFixture struct {
+	qdiscs  [][]byte
+	classes [][]byte
+	filters [][]byte
+}
+
+func loadNetlinkFixture(t *testing.T, name string) *netlinkFixture {
+	// fixtures are recorded with psched ticks of 64ns
+	tickInUsec = float64(0x3e8) / float64(0x40)
+
+	f, err := os.Open(filepath.Join("testdata", "netlink", name))
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer f.Close()
+	fixture := &netlinkFixture{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			t.Fatalf("%s: invalid line %q", name, line)
+		}
+		b, err := hex.DecodeString(fields[1])
+		if err != nil {
+			t.Fatalf("%s: invalid hex: %v", name, err)
+		}
+		switch fields[0] {
+		case "qdisc":
+			fixture.qdiscs = append(fixture.qdiscs, b)
+		case "class":
+			fixture.classes = append(fixture.classes, b)
+		case "filter":
+			fixture.filters = append(fixture.filters, b)
+		default:
+			t.Fatalf("%s: unknown message type %s", name, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return fixture
+}
+
+func (fixture *netlinkFixture) tree(t *testing.T, ifindex int32) *QdiscTree {
+	qs, err := decodeQdiscs(ifindex, fixture.qdiscs)
+	if err != nil {
+		t.Fatalf("decode qdiscs: %v", err)
+	}
+	qt, err := decodeQdiscTree(ifindex, qs, fixture.classes, fixture.filters, testLinkName)
+	if err != nil {
+		t.Fatalf("decode tree: %v", err)
+	}
+	return qt
+}
+
+var netlinkFixtureCases = []struct {
+	name    string
+	ifindex int32
+	qdisc   string
+	class   string
+	filter  string
+	// bpf programs are loaded by tc command, not encoded
+	loadsBpf bool
+}{
+	{
+		name:    "htb_ingress.txt",
+		ifindex: 10,
+		qdisc: `qdisc htb 1: root refcnt 2 r2q 10 default 0xfffe direct_packets_stat 0 direct_qlen 32
+qdisc ingress ffff: parent ffff:fff1 ----------------`,
+		class: `class htb 1:fffe parent 1:1 prio 0 rate 1Gbit ceil 10Gbit burst 1375b cburst 0b
+class htb 1:1 root rate 10Gbit ceil 10Gbit burst 0b cburst 0b
+class htb 1:3 parent 1:1 prio 0 rate 40Gbit ceil 40Gbit burst 0b cburst 0b`,
+		filter: `filter parent ffff: protocol ip pref 49152 u32 chain 0
+filter parent ffff: protocol ip pref 49152 u32 chain 0 fh 800: ht divisor 1
+filter parent ffff: protocol ip pref 49152 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device sdnt2) stolen
+	index 1 ref 1 bind 1`,
+	},
+	{
+		name:    "tbf_clsact.txt",
+		ifindex: 12,
+		qdisc: `qdisc tbf 1: root refcnt 2 rate 30Mbit burst 4Kb lat 100ms
+qdisc clsact ffff: parent ffff:fff1`,
+		filter: tagFilterHook(`filter protocol ip pref 49152 u32 chain 0
+filter protocol ip pref 49152 u32 chain 0 fh 800: ht divisor 1
+filter protocol ip pref 49152 u32 chain 0 fh 800::800 order 2048 key ht 800 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device sdnt0) stolen
+	index 2 ref 1 bind 1
+`, FilterHookIngress) + tagFilterHook(`filter protocol ipv6 pref 49153 u32 chain 0
+filter protocol ipv6 pref 49153 u32 chain 0 fh 801: ht divisor 1
+filter protocol ipv6 pref 49153 u32 chain 0 fh 801::800 order 2048 key ht 801 bkt 0 terminal flowid not_in_hw
+  match 00000000/00000000 at 0
+	action order 1: mirred (Egress Redirect to device sdnt1) stolen
+	index 3 ref 1 bind 1`, FilterHookEgress),
+	},
+	{
+		name:    "fw_matchall.txt",
+		ifindex: 10,
+		qdisc: `qdisc htb 1: root refcnt 2 r2q 10 default 0xfffe direct_packets_stat 0 direct_qlen 32
+qdisc clsact ffff: parent ffff:fff1`,
+		filter: `filter parent 1: protocol ip pref 1 fw chain 0
+filter parent 1: protocol ip pref 1 fw chain 0 handle 0x257 classid 1:3
+` + tagFilterHook(`filter protocol all pref 1 matchall chain 0
+filter protocol all pref 1 matchall chain 0 handle 0x1
+  not_in_hw
+	action order 1:  police 0x1 rate 0bit burst 0b mtu 4096Mb pkts_rate 10000 pkts_burst 1000 action drop/continue overhead 0b
+	ref 1 bind 1
+`, FilterHookIngress) + tagFilterHook(`filter protocol all pref 1 matchall chain 0
+filter protocol all pref 1 matchall chain 0 handle 0x1
+  not_in_hw
+	action order 1:  police 0x2 rate 0bit burst 0b mtu 4096Mb pkts_rate 2000 pkts_burst 200 action drop/continue overhead 0b
+	ref 1 bind 1`, FilterHookEgress),
+	},
+	{
+		name:     "bpf_clsact.txt",
+		ifindex:  26,
+		loadsBpf: true,
+		qdisc: `qdisc pfifo_fast 0: root refcnt 2 bands 3 priomap 1 2 2 2 1 2 0 0 1 1 1 1 1 1 1 1
+qdisc clsact ffff: parent ffff:fff1`,
+		filter: tagFilterHook(`filter protocol all pref 1 bpf chain 0
+filter protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 97 name cls_main tag 59f4a931744dcdc6 jited
+`, FilterHookIngress) + tagFilterHook(`filter protocol ip pref 2 bpf chain 0
+filter protocol ip pref 2 bpf chain 0 handle 0x2 flowid 1:2 prog.o:[classifier] not_in_hw id 101 name cls_main tag 59f4a931744dcdc6 jited`, FilterHookEgress),
+	},
+}
+
+func TestNetlinkDecode(t *testing.T) {
+	for _, c := range netlinkFixtureCases {
+		t.Run(c.name, func(t *testing.T) {
+			got := loadNetlinkFixture(t, c.name).tree(t, c.ifindex)
+			want, err := NewQdiscTreeFromString(c.qdisc, c.class, c.filter)
+			if err != nil {
+				t.Fatalf("parse text: %v", err)
+			}
+			if len(got.qdisc) != len(want.qdisc) || len(got.classes) != len(want.classes) || len(got.filters) != len(want.filters) {
+				t.Fatalf("want\n%s\ngot\n%s", want, got)
+			}
+			if lines := want.Delta(got, "eth0"); len(lines) > 0 {
+				t.Errorf("delta from netlink to text: %v", lines)
+			}
+			if lines := got.Delta(want, "eth0"); len(lines) > 0 {
+				t.Errorf("delta from text to netlink: %v", lines)
+			}
+			for i := range want.filters {
+				if u32, ok := want.filters[i].(*SU32Filter); ok {
+					if h := got.filters[i].(*SU32Filter).Handle; h != u32.Handle {
+						t.Errorf("u32 handle want %s got %s", u32.Handle, h)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNetlinkStats(t *testing.T) {
+	fixture := loadNetlinkFixture(t, "tbf_clsact.txt")
+	got, err := decodeStatsMsgs(12, TcStatsQdisc, fixture.qdiscs)
+	if err != nil {
+		t.Fatalf("decode qdisc stats: %v", err)
+	}
+	classStats, err := decodeStatsMsgs(12, TcStatsClass, fixture.classes)
+	if err != nil {
+		t.Fatalf("decode class stats: %v", err)
+	}
+	got = append(got, classStats...)
+	want := []STcStats{
+		{Type: TcStatsQdisc, Kind: "tbf", Id: "1:", Parent: "root", Bytes: 140, Packets: 2},
+		{Type: TcStatsQdisc, Kind: "clsact", Id: "ffff:", Parent: "ffff:fff1", Bytes: 280, Packets: 4},
+		{Type: TcStatsClass, Kind: "tbf", Id: "1:1", Parent: "1:"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %d stats, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("want %+v\ngot  %+v", want[i], *got[i])
+		}
+	}
+}
+
+func TestNetlinkDecodeOtherLink(t *testing.T) {
+	fixture := loadNetlinkFixture(t, "htb_ingress.txt")
+	qt := fixture.tree(t, 11)
+	if len(qt.qdisc) != 0 || len(qt.classes) != 0 || len(qt.filters) != 0 {
+		t.Errorf("want empty tree, got\n%s", qt)
+	}
+}
+
+func TestNetlinkDecodeQdiscKindNotModeled(t *testing.T) {
+	msgs := [][]byte{}
+	for _, c := range []struct {
+		ifindex int32
+		kind    string
+	}{
+		{10, "pfifo_fast"},
+		{10, "noqueue"},
+		{11, "multiq"},
+	} {
+		m := newTcMessage(c.ifindex, c.kind)
+		m.msg.Parent = TC_H_ROOT
+		msgs = append(msgs, m.Serialize())
+	}
+	qs, err := decodeQdiscs(10, msgs)
+	if err != nil || len(qs) != 0 {
+		t.Errorf("default qdiscs and other links: want none, got %v, %v", qs, err)
+	}
+	if _, err := decodeQdiscs(11, msgs); err == nil {
+		t.Errorf("multiq of the link: want error")
+	}
+}
+
+// TestNetlinkRoundTrip encodes objects decoded from fixtures as add requests
+// and decodes the requests back
+func TestNetlinkRoundTrip(t *testing.T) {
+	for _, c := range netlinkFixtureCases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.loadsBpf {
+				t.Skip("bpf programs are not encoded")
+			}
+			qt := loadNetlinkFixture(t, c.name).tree(t, c.ifindex)
+			encoded := &netlinkFixture{}
+			for _, q := range qt.qdisc {
+				m, err := encodeQdisc(c.ifindex, q, true)
+				if err != nil {
+					t.Fatalf("encode qdisc %s: %v", q.Id(), err)
+				}
+				encoded.qdiscs = append(encoded.qdiscs, m.Serialize())
+			}
+			for _, cls := range qt.classes {
+				m, err := encodeClass(c.ifindex, cls, true)
+				if err != nil {
+					t.Fatalf("encode class %s: %v", cls.Id(), err)
+				}
+				// classes of root are dumped with parent of TC_H_ROOT
+				if cls.IsRoot() {
+					m.msg.Parent = TC_H_ROOT
+				}
+				encoded.classes = append(encoded.classes, m.Serialize())
+			}
+			for _, f := range qt.filters {
+				m, err := encodeFilter(c.ifindex, f, true, testLinkIndex)
+				if err != nil {
+					t.Fatalf("encode filter %s: %v", f.Base().Kind, err)
+				}
+				encoded.filters = append(encoded.filters, m.Serialize())
+			}
+			got := encoded.tree(t, c.ifindex)
+			if lines := qt.Delta(got, "eth0"); len(lines) > 0 {
+				t.Errorf("delta after round trip: %v", lines)
+			}
+			if len(got.qdisc) != len(qt.qdisc) || len(got.classes) != len(qt.classes) || len(got.filters) != len(qt.filters) {
+				t.Errorf("want\n%s\ngot\n%s", qt, got)
+			}
+		})
+	}
+}
+
+func TestNetlinkEncodeOp(t *testing.T) {
+	qt := loadNetlinkFixture(t, "tbf_clsact.txt").tree(t, 12)
+	tn := &TcNetlink{
+		linkIndex: testLinkIndex,
+		linkName:  testLinkName,
+	}
+	cases := []struct {
+		op      TcOp
+		typ     uint16
+		flags   uint16
+		handle  uint32
+		parent  uint32
+		info    uint32
+		options bool
+	}{
+		{
+			op:      TcOp{Action: TcOpAdd, Obj: qt.qdisc[0]},
+			typ:     unix.RTM_NEWQDISC,
+			flags:   unix.NLM_F_CREATE | unix.NLM_F_EXCL,
+			handle:  0x10000,
+			parent:  TC_H_ROOT,
+			options: true,
+		},
+		{
+			op:      TcOp{Action: TcOpReplace, Obj: qt.qdisc[1]},
+			typ:     unix.RTM_NEWQDISC,
+			flags:   unix.NLM_F_CREATE | unix.NLM_F_REPLACE,
+			handle:  0xffff0000,
+			parent:  TC_H_INGRESS,
+			options: false,
+		},
+		{
+			op:      TcOp{Action: TcOpDelete, Obj: qt.filters[0]},
+			typ:     unix.RTM_DELTFILTER,
+			handle:  0x80100800,
+			parent:  0xfffffff3,
+			info:    49153<<16 | uint32(htons(unix.ETH_P_IPV6)),
+			options: false,
+		},
+		{
+			op:      TcOp{Action: TcOpReplace, Obj: qt.filters[1]},
+			typ:     unix.RTM_NEWTFILTER,
+			flags:   unix.NLM_F_CREATE,
+			parent:  0xfffffff2,
+			info:    49152<<16 | uint32(htons(unix.ETH_P_IP)),
+			options: true,
+		},
+	}
+	for i, c := range cases {
+		req, err := tn.encodeOp(12, c.op)
+		if err != nil {
+			t.Fatalf("case %d: encode: %v", i, err)
+		}
+		if req.Type != c.typ {
+			t.Errorf("case %d: type want %d got %d", i, c.typ, req.Type)
+		}
+		if flags := req.Flags &^ (unix.NLM_F_REQUEST | unix.NLM_F_ACK); flags != c.flags {
+			t.Errorf("case %d: flags want 0x%x got 0x%x", i, c.flags, flags)
+		}
+		b := req.Serialize()[unix.SizeofNlMsghdr:]
+		msg, attrs, err := decodeTcMsg(b)
+		if err != nil {
+			t.Fatalf("case %d: decode: %v", i, err)
+		}
+		if msg.Ifindex != 12 || msg.Handle != c.handle || msg.Parent != c.parent || msg.Info != c.info {
+			t.Errorf("case %d: want handle %x parent %x info %x, got %#v", i, c.handle, c.parent, c.info, msg)
+		}
+		if _, ok := attrs[nl.TCA_OPTIONS]; ok != c.options {
+			t.Errorf("case %d: options want %v got %v", i, c.options, ok)
+		}
+	}
+}
+
+func TestU32Handle(t *testing.T) {
+	cases := []struct {
+		handle uint32
+		str    string
+	}{
+		{0x80000800, "800::800"},
+		{0x80100800, "801::800"},
+		{0x80000000, "800:"},
+		{0x80001801, "800:1:801"},
+	}
+	for _, c := range cases {
+		if s := sprintU32Handle(c.handle); s != c.str {
+			t.Errorf("sprint 0x%x: want %s got %s", c.handle, c.str, s)
+		}
+		h, err := parseU32Handle(c.str)
+		if err != nil {
+			t.Errorf("parse %s: %v", c.str, err)
+		} else if h != c.handle {
+			t.Errorf("parse %s: want 0x%x got 0x%x", c.str, c.handle, h)
+		}
+	}
+}
+
+func TestNetlinkQdiscKinds(t *testing.T) {
+	tickInUsec = float64(0x3e8) / float64(0x40)
+	lines := []string{
+		"qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64",
+		"qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb drop_batch 64",
+		"qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028b initial_quantum 15140b low_rate_threshold 550Kbit maxrate 1Gbit refill_delay 40ms",
+		"qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028b initial_quantum 15140b low_rate_threshold 550Kbit refill_delay 40ms",
+		"qdisc cake 1: root refcnt 2 bandwidth 100Mbit diffserv3 triple-isolate nonat nowash no-ack-filter split-gso rtt 100ms raw overhead 0",
+		"qdisc cake 1: root refcnt 2 bandwidth unlimited besteffort flows nat wash no-ack-filter split-gso rtt 100ms raw overhead 0",
+		"qdisc netem 1: root refcnt 2 limit 1000 delay 100ms  10ms loss 1% duplicate 0.5% reorder 25% corrupt 0.1% rate 10Mbit gap 1",
+		"qdisc netem 10: parent 1:1 limit 2000 delay 1.5ms rate 40Gbit",
+		"qdisc sfq 10: parent 1:1 limit 127p quantum 1514b depth 127 divisor 1024 perturb 10sec",
+		"qdisc mq 1: root",
+	}
+	for _, line := range lines {
+		qs, err := parseQdiscLines([]string{line})
+		if err != nil || len(qs) != 1 {
+			t.Fatalf("parse %q: %v", line, err)
+		}
+		m, err := encodeQdisc(12, qs[0], true)
+		if err != nil {
+			t.Fatalf("encode %q: %v", line, err)
+		}
+		ifindex, q, err := decodeQdisc(m.Serialize())
+		if err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		if ifindex != 12 || q == nil {
+			t.Fatalf("decode %q: ifindex %d, qdisc %v", line, ifindex, q)
+		}
+		if !q.Equals(qs[0]) || !qs[0].Equals(q) {
+			t.Errorf("round trip of %q, got %v", line, q)
+		}
+	}
+}
+
+func TestNetlinkFlowerFilter(t *testing.T) {
+	tickInUsec = float64(0x3e8) / float64(0x40)
+	qdisc := "qdisc clsact ffff: parent ffff:fff1"
+	filter := tagFilterHook(`filter protocol ip pref 1 flower chain 0 handle 0x1
+  eth_type ipv4
+  ip_proto tcp
+  dst_ip 10.0.0.0/24
+  dst_port 80
+  not_in_hw
+	action order 1: mirred (Egress Redirect to device sdnt0) stolen
+	index 1 ref 1 bind 1
+filter protocol 802.1Q pref 2 flower chain 0 handle 0x2
+  vlan_id 100
+  vlan_ethtype ip
+  eth_type 8100
+  src_ip 10.1.1.1
+  not_in_hw
+	action order 1:  police 0x1 rate 1Mbit burst 10Kb mtu 2Kb action drop/pipe overhead 0b
+	ref 1 bind 1
+
+	action order 2: skbedit  queue_mapping 2 priority 1:3 mark 10 pipe
+	 index 1 ref 1 bind 1
+`, FilterHookIngress) + tagFilterHook(`filter protocol ipv6 pref 3 flower chain 0 handle 0x1
+  eth_type ipv6
+  ip_proto udp
+  src_ip fd00::/64
+  src_port 53
+  not_in_hw
+	action order 1:  police 0x2 rate 0bit burst 0b mtu 4096Mb pkts_rate 1000 pkts_burst 100 action drop/pipe overhead 0b
+	ref 1 bind 1`, FilterHookEgress)
+	qt, err := NewQdiscTreeFromString(qdisc, "", filter)
+	if err != nil {
+		t.Fatalf("parse text: %v", err)
+	}
+	if len(qt.filters) != 3 {
+		t.Fatalf("want 3 filters, got\n%s", qt)
+	}
+	for _, f := range qt.filters {
+		m, err := encodeFilter(12, f, true, testLinkIndex)
+		if err != nil {
+			t.Fatalf("encode %v: %v", f.AddLine("eth0"), err)
+		}
+		ifindex, got, err := decodeFilter(m.Serialize(), qt.qdisc, testLinkName)
+		if err != nil {
+			t.Fatalf("decode %v: %v", f.AddLine("eth0"), err)
+		}
+		if ifindex != 12 || got == nil {
+			t.Fatalf("decode %v: ifindex %d, filter %v", f.AddLine("eth0"), ifindex, got)
+		}
+		if !got.Equals(f) || !f.Equals(got) {
+			t.Errorf("round trip of %v, got %v", f.AddLine("eth0"), got.AddLine("eth0"))
+		}
+	}
+}
+
+func TestNetlinkBpfFilter(t *testing.T) {
+	qt := loadNetlinkFixture(t, "bpf_clsact.txt").tree(t, 26)
+	if len(qt.filters) != 2 {
+		t.Fatalf("want 2 filters, got\n%s", qt)
+	}
+	tn := &TcNetlink{
+		linkIndex: testLinkIndex,
+		linkName:  testLinkName,
+	}
+	for _, f := range qt.filters {
+		bpf := f.(*SBpfFilter)
+		req, err := tn.encodeOp(26, TcOp{Action: TcOpDelete, Obj: f})
+		if err != nil {
+			t.Fatalf("encode delete %v: %v", f.DeleteLine("eth0"), err)
+		}
+		msg, _, err := decodeTcMsg(req.Serialize()[unix.SizeofNlMsghdr:])
+		if err != nil {
+			t.Fatalf("decode delete: %v", err)
+		}
+		if msg.Handle != bpf.Handle || msg.Info>>16 != bpf.Prio {
+			t.Errorf("delete %v: got %#v", f.DeleteLine("eth0"), msg)
+		}
+		if _, err := tn.encodeOp(26, TcOp{Action: TcOpAdd, Obj: f}); err == nil {
+			t.Errorf("encode add %v: want error", f.AddLine("eth0"))
+		}
+	}
+
+	load := &SBpfFilter{
+		SBaseTcFilter: qt.filters[0].Base(),
+		Handle:        1,
+		Object:        "/opt/bpf/prog.o",
+	}
+	if !loadsBpf([]TcOp{{Action: TcOpDelete, Obj: qt.filters[0]}, {Action: TcOpAdd, Obj: load}}) {
+		t.Errorf("want ops loading program run with tc command")
+	}
+	if loadsBpf([]TcOp{{Action: TcOpDelete, Obj: load}}) {
+		t.Errorf("want delete ops sent with netlink")
+	}
+}
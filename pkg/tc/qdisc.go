@@ -107,7 +107,7 @@ func (q *SBaseTcQdisc) basicLineElements(action string, ifname string) []string
 	elms := []string{"qdisc", action, "dev", ifname}
 	if q.Root {
 		elms = append(elms, "root")
-	} else if len(q.Parent) > 0 && q.Kind != "ingress" {
+	} else if len(q.Parent) > 0 && q.Kind != "ingress" && q.Kind != "clsact" {
 		elms = append(elms, "parent", q.Parent)
 	}
 	elms = append(elms, "handle", q.Handle)
@@ -138,8 +138,8 @@ func parseBaseQdisc(chunks []string) (*SBaseTcQdisc, error) {
 			if i+1 >= len(chunks) {
 				return nil, fmt.Errorf("eol getting parent handle")
 			}
-			// ignore parent for ingress qdisc
-			if q.Kind != "ingress" {
+			// ignore parent for ingress and clsact qdisc
+			if q.Kind != "ingress" && q.Kind != "clsact" {
 				q.Parent = chunks[i+1]
 			}
 			i += 2
@@ -180,6 +180,55 @@ func parseQdisc(chunks []string) (IQdisc, error) {
 		}
 		q.SBaseTcQdisc = bq
 		return q, nil
+	case "clsact":
+		q, err := parseQdiscClsact(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscClsact")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
+	case "fq_codel":
+		q, err := parseQdiscFqCodel(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscFqCodel")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
+	case "fq":
+		q, err := parseQdiscFq(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscFq")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
+	case "cake":
+		q, err := parseQdiscCake(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscCake")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
+	case "netem":
+		q, err := parseQdiscNetem(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscNetem")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
+	case "sfq":
+		q, err := parseQdiscSfq(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscSfq")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
+	case "mq":
+		q, err := parseQdiscMq(chunks)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseQdiscMq")
+		}
+		q.SBaseTcQdisc = bq
+		return q, nil
 	}
 	return nil, errors.Wrap(errors.ErrInvalidFormat, "unknown qdisc type")
 }
@@ -187,7 +236,8 @@ func parseQdisc(chunks []string) (IQdisc, error) {
 func parseQdiscLines(lines []string) ([]IQdisc, error) {
 	qs := []IQdisc{}
 	for _, line := range lines {
-		chunks := strings.Split(strings.TrimSpace(line), " ")
+		// netem by older iproute2 separates jitter with two spaces
+		chunks := strings.Fields(line)
 		q, err := parseQdisc(chunks)
 		if err != nil {
 			log.Debugf("parseQdisc %s failed: %s", line, err)
@@ -0,0 +1,192 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * tc qdisc add dev eth0 root handle 1: cake bandwidth 100Mbit diffserv3 triple-isolate nonat nowash rtt 100ms
+ * // show, iproute2 4.19
+ * qdisc cake 1: root refcnt 2 bandwidth 100Mbit diffserv3 triple-isolate nonat nowash no-ack-filter split-gso rtt 100.0ms raw overhead 0
+ * // show, iproute2 5.x and later
+ * qdisc cake 1: root refcnt 2 bandwidth unlimited diffserv3 triple-isolate nonat nowash no-ack-filter split-gso rtt 100ms raw overhead 0
+ */
+
+var (
+	_ IQdisc = &QdiscCake{}
+
+	// in the order of kernel enum values
+	cakeDiffservModes = []string{"diffserv3", "diffserv4", "diffserv8", "besteffort", "precedence"}
+	cakeFlowModes     = []string{"flowblind", "srchost", "dsthost", "hosts", "flows", "dual-srchost", "dual-dsthost", "triple-isolate"}
+)
+
+// QdiscCake is common applications kept enhanced.  Bandwidth of zero means
+// unlimited.  Empty modes and zero Rtt are left to kernel defaults, while
+// Nat and Wash are always set explicitly
+type QdiscCake struct {
+	*SBaseTcQdisc
+	// bits per second
+	Bandwidth uint64
+	Diffserv  string
+	FlowMode  string
+	Nat       bool
+	Wash      bool
+	// microseconds
+	Rtt uint64
+}
+
+func (q *QdiscCake) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscCake) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	baseCmp := q.Base().Compare(baseQdisc.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	q2 := baseQdisc.(*QdiscCake)
+	if r := compareUint(q.Bandwidth, q2.Bandwidth); r != 0 {
+		return r
+	}
+	if r := compareOptMode(q.Diffserv, q2.Diffserv); r != 0 {
+		return r
+	}
+	if r := compareOptMode(q.FlowMode, q2.FlowMode); r != 0 {
+		return r
+	}
+	if r := compareBool(q.Nat, q2.Nat); r != 0 {
+		return r
+	}
+	if r := compareBool(q.Wash, q2.Wash); r != 0 {
+		return r
+	}
+	return compareOptUint(q.Rtt, q2.Rtt)
+}
+
+func compareOptMode(a, b string) int {
+	if a == "" || b == "" || a == b {
+		return 0
+	} else if a < b {
+		return -1
+	}
+	return 1
+}
+
+func (q *QdiscCake) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscCake) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func (q *QdiscCake) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	if q.Bandwidth > 0 {
+		elms = append(elms, "bandwidth", PrintRate(q.Bandwidth))
+	} else {
+		elms = append(elms, "unlimited")
+	}
+	if q.Diffserv != "" {
+		elms = append(elms, q.Diffserv)
+	}
+	if q.FlowMode != "" {
+		elms = append(elms, q.FlowMode)
+	}
+	if q.Nat {
+		elms = append(elms, "nat")
+	} else {
+		elms = append(elms, "nonat")
+	}
+	if q.Wash {
+		elms = append(elms, "wash")
+	} else {
+		elms = append(elms, "nowash")
+	}
+	if q.Rtt > 0 {
+		elms = append(elms, "rtt", PrintTime(q.Rtt))
+	}
+	return elms
+}
+
+func (q *QdiscCake) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscCake) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+func indexOf(ss []string, s string) int {
+	for i := range ss {
+		if ss[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseQdiscCake(chunks []string) (*QdiscCake, error) {
+	q := &QdiscCake{}
+	for i := 0; i < len(chunks); {
+		c := chunks[i]
+		switch {
+		case c == "bandwidth":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting bandwidth")
+			}
+			if chunks[i+1] != "unlimited" {
+				rate, err := ParseRate(chunks[i+1])
+				if err != nil {
+					return nil, errors.Wrap(err, "ParseRate")
+				}
+				q.Bandwidth = rate
+			}
+			i += 2
+		case c == "rtt":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting rtt")
+			}
+			rtt, err := ParseTime(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrap(err, "ParseTime")
+			}
+			q.Rtt = rtt
+			i += 2
+		case c == "nat":
+			q.Nat = true
+			i++
+		case c == "wash":
+			q.Wash = true
+			i++
+		case indexOf(cakeDiffservModes, c) >= 0:
+			q.Diffserv = c
+			i++
+		case indexOf(cakeFlowModes, c) >= 0:
+			q.FlowMode = c
+			i++
+		default:
+			i++
+		}
+	}
+	return q, nil
+}
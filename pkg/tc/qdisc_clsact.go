@@ -0,0 +1,90 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+/*
+ * clsact is a superset of ingress qdisc.  Besides the ingress hook, filters
+ * can also be attached to the egress hook, before packets are enqueued to
+ * the root qdisc
+ *
+ * tc qdisc add dev vnet2202-232 handle ffff: clsact
+ * tc filter add dev vnet2202-232 ingress protocol all prio 49153 u32 match u32 0 0 action mirred egress redirect dev rvnet2202-232
+ * tc filter add dev vnet2202-232 egress protocol all prio 1 matchall action police pkts_rate 10000 pkts_burst 1000 conform-exceed drop/continue
+ * // show
+ * qdisc clsact ffff: parent ffff:fff1
+ *
+ * Packet rate limits of guest nics are matchall filters on clsact hooks.
+ * Bpf programs of guest nics are bpf filters on the same clsact qdisc
+ */
+
+const (
+	FilterHookIngress = "ingress"
+	FilterHookEgress  = "egress"
+)
+
+var _ IQdisc = &QdiscClsact{}
+
+type QdiscClsact struct {
+	*SBaseTcQdisc
+}
+
+func (q *QdiscClsact) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscClsact) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	baseCmp := q.Base().Compare(baseQdisc.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	return 0
+}
+
+func (q *QdiscClsact) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscClsact) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func parseQdiscClsact(chunks []string) (*QdiscClsact, error) {
+	q := &QdiscClsact{}
+	return q, nil
+}
+
+func (q *QdiscClsact) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	return elms
+}
+
+func (q *QdiscClsact) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscClsact) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+// DeleteLine names the kind, tc refuses to delete ingress and clsact qdiscs
+// by handle alone
+func (q *QdiscClsact) DeleteLine(ifname string) []string {
+	return q.basicLine("delete", ifname)
+}
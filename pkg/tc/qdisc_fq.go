@@ -0,0 +1,171 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * tc qdisc add dev eth0 root handle 1: fq limit 10000 flow_limit 100 buckets 1024 quantum 3028 initial_quantum 15140 maxrate 1Gbit
+ * // show, iproute2 4.x
+ * qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028 initial_quantum 15140 maxrate 1Gbit refill_delay 40.0ms
+ * // show, iproute2 5.x and later
+ * qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028b initial_quantum 15140b low_rate_threshold 550Kbit maxrate 1Gbit refill_delay 40ms
+ */
+
+var _ IQdisc = &QdiscFq{}
+
+// QdiscFq is fair queuing with pacing.  Zero values are left to kernel
+// defaults, except MaxRate for which zero means unlimited
+type QdiscFq struct {
+	*SBaseTcQdisc
+	// packets
+	Limit     uint32
+	FlowLimit uint32
+	Buckets   uint32
+	// bytes
+	Quantum        uint32
+	InitialQuantum uint32
+	// per flow pacing rate in bits per second
+	MaxRate uint64
+}
+
+func (q *QdiscFq) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscFq) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	baseCmp := q.Base().Compare(baseQdisc.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	q2 := baseQdisc.(*QdiscFq)
+	if r := compareOptUint(q.Limit, q2.Limit); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.FlowLimit, q2.FlowLimit); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Buckets, q2.Buckets); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Quantum, q2.Quantum); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.InitialQuantum, q2.InitialQuantum); r != 0 {
+		return r
+	}
+	return compareUint(q.MaxRate, q2.MaxRate)
+}
+
+func (q *QdiscFq) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscFq) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func (q *QdiscFq) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	if q.Limit > 0 {
+		elms = append(elms, "limit", fmt.Sprintf("%d", q.Limit))
+	}
+	if q.FlowLimit > 0 {
+		elms = append(elms, "flow_limit", fmt.Sprintf("%d", q.FlowLimit))
+	}
+	if q.Buckets > 0 {
+		elms = append(elms, "buckets", fmt.Sprintf("%d", q.Buckets))
+	}
+	if q.Quantum > 0 {
+		elms = append(elms, "quantum", fmt.Sprintf("%d", q.Quantum))
+	}
+	if q.InitialQuantum > 0 {
+		elms = append(elms, "initial_quantum", fmt.Sprintf("%d", q.InitialQuantum))
+	}
+	if q.MaxRate > 0 {
+		elms = append(elms, "maxrate", PrintRate(q.MaxRate))
+	}
+	return elms
+}
+
+func (q *QdiscFq) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscFq) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+func parseQdiscFq(chunks []string) (*QdiscFq, error) {
+	q := &QdiscFq{}
+	for i := 0; i < len(chunks); {
+		c := chunks[i]
+		switch c {
+		case "limit", "flow_limit", "buckets":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol getting %s", c)
+			}
+			v, err := ParseCount(chunks[i+1], "p")
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse %s", c)
+			}
+			switch c {
+			case "limit":
+				q.Limit = uint32(v)
+			case "flow_limit":
+				q.FlowLimit = uint32(v)
+			case "buckets":
+				q.Buckets = uint32(v)
+			}
+			i += 2
+		case "quantum", "initial_quantum":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol getting %s", c)
+			}
+			v, err := ParseIprouteSize(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse %s", c)
+			}
+			if c == "quantum" {
+				q.Quantum = uint32(v)
+			} else {
+				q.InitialQuantum = uint32(v)
+			}
+			i += 2
+		case "maxrate":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting maxrate")
+			}
+			rate, err := ParseRate(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrap(err, "ParseRate")
+			}
+			q.MaxRate = rate
+			i += 2
+		default:
+			i++
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * tc qdisc add dev eth0 root handle 1: fq_codel limit 10240 flows 1024 quantum 1514 target 5ms interval 100ms ecn
+ * // show, iproute2 4.x
+ * qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5.0ms interval 100.0ms ecn
+ * // show, iproute2 5.x and later
+ * qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64
+ */
+
+var _ IQdisc = &QdiscFqCodel{}
+
+// QdiscFqCodel is fair queuing with controlled delay.  Zero values are left
+// to kernel defaults.  Ecn is always set explicitly, as "noecn" is not shown
+type QdiscFqCodel struct {
+	*SBaseTcQdisc
+	// packets
+	Limit uint32
+	Flows uint32
+	// bytes
+	Quantum uint32
+	// microseconds
+	Target   uint64
+	Interval uint64
+	Ecn      bool
+}
+
+func (q *QdiscFqCodel) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscFqCodel) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	baseCmp := q.Base().Compare(baseQdisc.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	q2 := baseQdisc.(*QdiscFqCodel)
+	if r := compareOptUint(q.Limit, q2.Limit); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Flows, q2.Flows); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Quantum, q2.Quantum); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Target, q2.Target); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Interval, q2.Interval); r != 0 {
+		return r
+	}
+	return compareBool(q.Ecn, q2.Ecn)
+}
+
+func (q *QdiscFqCodel) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscFqCodel) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func (q *QdiscFqCodel) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	if q.Limit > 0 {
+		elms = append(elms, "limit", fmt.Sprintf("%d", q.Limit))
+	}
+	if q.Flows > 0 {
+		elms = append(elms, "flows", fmt.Sprintf("%d", q.Flows))
+	}
+	if q.Quantum > 0 {
+		elms = append(elms, "quantum", fmt.Sprintf("%d", q.Quantum))
+	}
+	if q.Target > 0 {
+		elms = append(elms, "target", PrintTime(q.Target))
+	}
+	if q.Interval > 0 {
+		elms = append(elms, "interval", PrintTime(q.Interval))
+	}
+	if q.Ecn {
+		elms = append(elms, "ecn")
+	} else {
+		elms = append(elms, "noecn")
+	}
+	return elms
+}
+
+func (q *QdiscFqCodel) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscFqCodel) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+func parseQdiscFqCodel(chunks []string) (*QdiscFqCodel, error) {
+	q := &QdiscFqCodel{}
+	for i := 0; i < len(chunks); {
+		c := chunks[i]
+		switch c {
+		case "limit", "flows", "quantum":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol getting %s", c)
+			}
+			v, err := ParseCount(chunks[i+1], "p")
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse %s", c)
+			}
+			switch c {
+			case "limit":
+				q.Limit = uint32(v)
+			case "flows":
+				q.Flows = uint32(v)
+			case "quantum":
+				q.Quantum = uint32(v)
+			}
+			i += 2
+		case "target", "interval":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol getting %s", c)
+			}
+			us, err := ParseTime(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse %s", c)
+			}
+			if c == "target" {
+				q.Target = us
+			} else {
+				q.Interval = us
+			}
+			i += 2
+		case "ecn":
+			q.Ecn = true
+			i++
+		default:
+			i++
+		}
+	}
+	return q, nil
+}
@@ -5,7 +5,7 @@ package tc
  * ip link add dev rvnet2202-232 type ifb
  * ip link set dev rvnet2202-232 up
  * tc qdisc add dev vnet2202-232 handle ffff: ingress
- * tc filter add dev vnet2202-232 parent ffff: protocol ip u32 match u32 0 0 action mirred egress redirect dev rvnet2202-232
+ * tc filter add dev vnet2202-232 parent ffff: protocol all prio 49153 u32 match u32 0 0 action mirred egress redirect dev rvnet2202-232
  * tc qdisc add dev rvnet2202-232 root tbf rate 30mbit burst 32kbit latency 100ms
  */
 
@@ -57,3 +57,9 @@ func (q *QdiscIngress) AddLine(ifname string) []string {
 func (q *QdiscIngress) ReplaceLine(ifname string) []string {
 	return q.basicLine("replace", ifname)
 }
+
+// DeleteLine names the kind, tc refuses to delete ingress and clsact qdiscs
+// by handle alone
+func (q *QdiscIngress) DeleteLine(ifname string) []string {
+	return q.basicLine("delete", ifname)
+}
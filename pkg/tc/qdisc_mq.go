@@ -0,0 +1,87 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+)
+
+/*
+ * mq is the default root qdisc of multiqueue devices.  It has a class for
+ * each tx queue, 1:1 for queue 0, with a child qdisc dequeued without
+ * locks of other queues
+ *
+ * tc qdisc add dev vnet1 root handle 1: mq
+ * tc qdisc add dev vnet1 parent 1:1 handle 11: tbf rate 25Mbit burst 3125b latency 100ms
+ * // show
+ * qdisc mq 1: root
+ * qdisc tbf 11: parent 1:1 rate 25Mbit burst 3125b lat 100ms
+ * qdisc pfifo_fast 0: parent 1:2 bands 3 priomap 1 2 2 2 1 2 0 0 1 1 1 1 1 1 1 1
+ * // show class
+ * class mq 1:1 root
+ * class mq 1:2 root
+ */
+
+var _ IQdisc = &QdiscMq{}
+
+// QdiscMq has no parameters.  Its classes are created by kernel for tx
+// queues of the device, and not modeled
+type QdiscMq struct {
+	*SBaseTcQdisc
+}
+
+func (q *QdiscMq) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscMq) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	return q.Base().Compare(baseQdisc.Base())
+}
+
+func (q *QdiscMq) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscMq) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func (q *QdiscMq) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	return elms
+}
+
+func (q *QdiscMq) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscMq) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+// QueueClassId returns id of class of tx queue, starting from 0
+func (q *QdiscMq) QueueClassId(queue int) string {
+	return fmt.Sprintf("%s%x", q.Handle, queue+1)
+}
+
+func parseQdiscMq(chunks []string) (*QdiscMq, error) {
+	q := &QdiscMq{}
+	return q, nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * tc qdisc add dev eth0 parent 1:1 handle 10: netem limit 1000 delay 100ms 10ms loss 1% duplicate 0.5% reorder 25% corrupt 0.1% rate 10Mbit
+ * // show, iproute2 4.x
+ * qdisc netem 10: parent 1:1 limit 1000 delay 100.0ms  10.0ms loss 1% duplicate 0.5% reorder 25% corrupt 0.1% rate 10Mbit gap 1
+ * // show, iproute2 6.x
+ * qdisc netem 10: parent 1:1 limit 1000 delay 100ms  10ms loss 1% duplicate 0.5% reorder 25% corrupt 0.1% rate 10Mbit seed 7026838624911011946 gap 1
+ */
+
+var _ IQdisc = &QdiscNetem{}
+
+// QdiscNetem emulates properties of wide area networks.  Zero Limit is left
+// to kernel default, other zero values disable the impairment.
+// Correlations are not modeled
+type QdiscNetem struct {
+	*SBaseTcQdisc
+	// packets
+	Limit uint32
+	// microseconds
+	Delay  uint64
+	Jitter uint64
+	// percentages
+	Loss      float64
+	Duplicate float64
+	Reorder   float64
+	Corrupt   float64
+	// bits per second
+	Rate uint64
+}
+
+func (q *QdiscNetem) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscNetem) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	baseCmp := q.Base().Compare(baseQdisc.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	q2 := baseQdisc.(*QdiscNetem)
+	if r := compareOptUint(q.Limit, q2.Limit); r != 0 {
+		return r
+	}
+	if r := compareUint(q.Delay, q2.Delay); r != 0 {
+		return r
+	}
+	if r := compareUint(q.Jitter, q2.Jitter); r != 0 {
+		return r
+	}
+	if r := comparePercent(q.Loss, q2.Loss); r != 0 {
+		return r
+	}
+	if r := comparePercent(q.Duplicate, q2.Duplicate); r != 0 {
+		return r
+	}
+	if r := comparePercent(q.Reorder, q2.Reorder); r != 0 {
+		return r
+	}
+	if r := comparePercent(q.Corrupt, q2.Corrupt); r != 0 {
+		return r
+	}
+	return compareUint(q.Rate, q2.Rate)
+}
+
+func (q *QdiscNetem) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscNetem) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func (q *QdiscNetem) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	if q.Limit > 0 {
+		elms = append(elms, "limit", fmt.Sprintf("%d", q.Limit))
+	}
+	if q.Delay > 0 {
+		elms = append(elms, "delay", PrintTime(q.Delay))
+		if q.Jitter > 0 {
+			elms = append(elms, PrintTime(q.Jitter))
+		}
+	}
+	if q.Loss > 0 {
+		elms = append(elms, "loss", PrintPercent(q.Loss))
+	}
+	if q.Duplicate > 0 {
+		elms = append(elms, "duplicate", PrintPercent(q.Duplicate))
+	}
+	if q.Reorder > 0 {
+		elms = append(elms, "reorder", PrintPercent(q.Reorder))
+	}
+	if q.Corrupt > 0 {
+		elms = append(elms, "corrupt", PrintPercent(q.Corrupt))
+	}
+	if q.Rate > 0 {
+		elms = append(elms, "rate", PrintRate(q.Rate))
+	}
+	return elms
+}
+
+func (q *QdiscNetem) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscNetem) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+// skipPercent returns index after the optional correlation at i
+func skipPercent(chunks []string, i int) int {
+	if i < len(chunks) {
+		if _, err := ParsePercent(chunks[i]); err == nil {
+			return i + 1
+		}
+	}
+	return i
+}
+
+func parseQdiscNetem(chunks []string) (*QdiscNetem, error) {
+	q := &QdiscNetem{}
+	for i := 0; i < len(chunks); {
+		c := chunks[i]
+		switch c {
+		case "limit":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting limit")
+			}
+			v, err := ParseCount(chunks[i+1], "p")
+			if err != nil {
+				return nil, errors.Wrap(err, "parse limit")
+			}
+			q.Limit = uint32(v)
+			i += 2
+		case "delay":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting delay")
+			}
+			delay, err := ParseTime(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrap(err, "parse delay")
+			}
+			q.Delay = delay
+			i += 2
+			if i < len(chunks) {
+				if jitter, err := ParseTime(chunks[i]); err == nil {
+					q.Jitter = jitter
+					i = skipPercent(chunks, i+1)
+				}
+			}
+		case "loss", "duplicate", "reorder", "corrupt":
+			i++
+			if i < len(chunks) && chunks[i] == "random" {
+				i++
+			}
+			if i >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol getting %s", c)
+			}
+			p, err := ParsePercent(chunks[i])
+			if err != nil {
+				// loss models other than random are not modeled
+				if c == "loss" {
+					continue
+				}
+				return nil, errors.Wrapf(err, "parse %s", c)
+			}
+			switch c {
+			case "loss":
+				q.Loss = p
+			case "duplicate":
+				q.Duplicate = p
+			case "reorder":
+				q.Reorder = p
+			case "corrupt":
+				q.Corrupt = p
+			}
+			i = skipPercent(chunks, i+1)
+		case "rate":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting rate")
+			}
+			rate, err := ParseRate(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrap(err, "ParseRate")
+			}
+			q.Rate = rate
+			i += 2
+		default:
+			i++
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"fmt"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * tc qdisc add dev eth0 parent 1:1 handle 10: sfq limit 127 quantum 1514 depth 127 divisor 1024 perturb 10
+ * // show, iproute2 3.x
+ * qdisc sfq 10: parent 1:1 limit 127p quantum 1514b flows 128/1024 perturb 10sec
+ * // show, iproute2 4.x and later
+ * qdisc sfq 10: parent 1:1 limit 127p quantum 1514b depth 127 divisor 1024 perturb 10sec
+ */
+
+var _ IQdisc = &QdiscSfq{}
+
+// QdiscSfq is stochastic fairness queueing.  Zero values are left to kernel
+// defaults, except Perturb for which zero means the hash is never perturbed
+type QdiscSfq struct {
+	*SBaseTcQdisc
+	// packets
+	Limit uint32
+	Depth uint32
+	// bytes
+	Quantum uint32
+	// hash table buckets
+	Divisor uint32
+	// seconds
+	Perturb uint32
+}
+
+func (q *QdiscSfq) Base() *SBaseTcQdisc {
+	return q.SBaseTcQdisc
+}
+
+func (q *QdiscSfq) Compare(itc IComparable) int {
+	baseQdisc, ok := itc.(IQdisc)
+	if !ok {
+		return -1
+	}
+	baseCmp := q.Base().Compare(baseQdisc.Base())
+	if baseCmp != 0 {
+		return baseCmp
+	}
+	q2 := baseQdisc.(*QdiscSfq)
+	if r := compareOptUint(q.Limit, q2.Limit); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Depth, q2.Depth); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Quantum, q2.Quantum); r != 0 {
+		return r
+	}
+	if r := compareOptUint(q.Divisor, q2.Divisor); r != 0 {
+		return r
+	}
+	return compareUint(q.Perturb, q2.Perturb)
+}
+
+func (q *QdiscSfq) CompareBase(qi IComparable) int {
+	return q.Base().CompareBase(qi.(IQdisc).Base())
+}
+
+func (q *QdiscSfq) Equals(qi IComparable) bool {
+	return q.Compare(qi) == 0
+}
+
+func (q *QdiscSfq) basicLine(action string, ifname string) []string {
+	elms := q.SBaseTcQdisc.basicLineElements(action, ifname)
+	elms = append(elms, q.Kind)
+	if q.Limit > 0 {
+		elms = append(elms, "limit", fmt.Sprintf("%d", q.Limit))
+	}
+	if q.Quantum > 0 {
+		elms = append(elms, "quantum", fmt.Sprintf("%d", q.Quantum))
+	}
+	if q.Depth > 0 {
+		elms = append(elms, "depth", fmt.Sprintf("%d", q.Depth))
+	}
+	if q.Divisor > 0 {
+		elms = append(elms, "divisor", fmt.Sprintf("%d", q.Divisor))
+	}
+	if q.Perturb > 0 {
+		elms = append(elms, "perturb", fmt.Sprintf("%d", q.Perturb))
+	}
+	return elms
+}
+
+func (q *QdiscSfq) AddLine(ifname string) []string {
+	return q.basicLine("add", ifname)
+}
+
+func (q *QdiscSfq) ReplaceLine(ifname string) []string {
+	return q.basicLine("replace", ifname)
+}
+
+func parseQdiscSfq(chunks []string) (*QdiscSfq, error) {
+	q := &QdiscSfq{}
+	for i := 0; i < len(chunks); {
+		c := chunks[i]
+		switch c {
+		case "limit", "depth", "divisor", "perturb", "flows":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrapf(errors.ErrInvalidFormat, "eol getting %s", c)
+			}
+			s := chunks[i+1]
+			if c == "flows" {
+				// flows and divisor by iproute2 3.x, or flows alone
+				// with details by later versions
+				_, divisor, ok := strings.Cut(s, "/")
+				if !ok {
+					i += 2
+					continue
+				}
+				s = divisor
+			}
+			v, err := ParseCount(strings.TrimSuffix(s, "sec"), "p")
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse %s", c)
+			}
+			switch c {
+			case "limit":
+				q.Limit = uint32(v)
+			case "depth":
+				q.Depth = uint32(v)
+			case "divisor", "flows":
+				q.Divisor = uint32(v)
+			case "perturb":
+				q.Perturb = uint32(v)
+			}
+			i += 2
+		case "quantum":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol getting quantum")
+			}
+			v, err := ParseIprouteSize(chunks[i+1])
+			if err != nil {
+				return nil, errors.Wrap(err, "parse quantum")
+			}
+			q.Quantum = uint32(v)
+			i += 2
+		default:
+			i++
+		}
+	}
+	return q, nil
+}
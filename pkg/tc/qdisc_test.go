@@ -103,6 +103,18 @@ func TestQdiscTbf(t *testing.T) {
 				Latency: 100000,
 			},
 		},
+		{
+			ifname:      "vnet1",
+			line:        []string{"qdisc", "clsact", "ffff:", "parent", "ffff:fff1"},
+			lineDelete:  []string{"qdisc", "delete", "dev", "vnet1", "handle", "ffff:", "clsact"},
+			lineReplace: []string{"qdisc", "add", "dev", "vnet1", "handle", "ffff:", "clsact"},
+			wantQdisc: &QdiscClsact{
+				SBaseTcQdisc: &SBaseTcQdisc{
+					Kind:   "clsact",
+					Handle: "ffff:",
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -124,3 +136,357 @@ func TestQdiscTbf(t *testing.T) {
 		}
 	}
 }
+
+func TestQdiscKinds(t *testing.T) {
+	fqCodel := &QdiscFqCodel{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "fq_codel",
+			Handle: "1:",
+			Root:   true,
+		},
+		Limit:    10240,
+		Flows:    1024,
+		Quantum:  1514,
+		Target:   5000,
+		Interval: 100000,
+		Ecn:      true,
+	}
+	fq := &QdiscFq{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "fq",
+			Handle: "1:",
+			Root:   true,
+		},
+		Limit:          10000,
+		FlowLimit:      100,
+		Buckets:        1024,
+		Quantum:        3028,
+		InitialQuantum: 15140,
+		MaxRate:        1000000000,
+	}
+	cake := &QdiscCake{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "cake",
+			Handle: "1:",
+			Root:   true,
+		},
+		Bandwidth: 100000000,
+		Diffserv:  "diffserv3",
+		FlowMode:  "triple-isolate",
+		Rtt:       100000,
+	}
+	netem := &QdiscNetem{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "netem",
+			Handle: "1:",
+			Root:   true,
+		},
+		Limit:     1000,
+		Delay:     100000,
+		Jitter:    10000,
+		Loss:      1,
+		Duplicate: 0.5,
+		Reorder:   25,
+		Corrupt:   0.1,
+		Rate:      10000000,
+	}
+	sfq := &QdiscSfq{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "sfq",
+			Handle: "10:",
+			Parent: "1:1",
+		},
+		Limit:   127,
+		Quantum: 1514,
+		Depth:   127,
+		Divisor: 1024,
+		Perturb: 10,
+	}
+	fqCodelAdd := []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "fq_codel", "limit", "10240", "flows", "1024", "quantum", "1514", "target", "5ms", "interval", "100ms", "ecn"}
+	fqAdd := []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "fq", "limit", "10000", "flow_limit", "100", "buckets", "1024", "quantum", "3028", "initial_quantum", "15140", "maxrate", "1Gbit"}
+	cakeAdd := []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "cake", "bandwidth", "100Mbit", "diffserv3", "triple-isolate", "nonat", "nowash", "rtt", "100ms"}
+	netemAdd := []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "netem", "limit", "1000", "delay", "100ms", "10ms", "loss", "1%", "duplicate", "0.5%", "reorder", "25%", "corrupt", "0.1%", "rate", "10Mbit"}
+	sfqAdd := []string{"qdisc", "add", "dev", "eth0", "parent", "1:1", "handle", "10:", "sfq", "limit", "127", "quantum", "1514", "depth", "127", "divisor", "1024", "perturb", "10"}
+	mq := &QdiscMq{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "mq",
+			Handle: "1:",
+			Root:   true,
+		},
+	}
+	mqAdd := []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "mq"}
+	rootDelete := []string{"qdisc", "delete", "dev", "eth0", "root", "handle", "1:"}
+	sfqDelete := []string{"qdisc", "delete", "dev", "eth0", "parent", "1:1", "handle", "10:"}
+	cases := []struct {
+		name string
+		line string
+		tcCase
+	}{
+		{
+			name:   "fq_codel iproute2 4.x",
+			line:   "qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5.0ms interval 100.0ms ecn",
+			tcCase: tcCase{lineReplace: fqCodelAdd, wantQdisc: fqCodel},
+		},
+		{
+			name:   "fq_codel iproute2 5.x",
+			line:   "qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64",
+			tcCase: tcCase{lineReplace: fqCodelAdd, wantQdisc: fqCodel},
+		},
+		{
+			name:   "fq_codel iproute2 6.x",
+			line:   "qdisc fq_codel 1: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms ce_threshold 2ms interval 100ms memory_limit 32Mb ecn drop_batch 64",
+			tcCase: tcCase{lineReplace: fqCodelAdd, wantQdisc: fqCodel},
+		},
+		{
+			name:   "fq iproute2 4.x",
+			line:   "qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028 initial_quantum 15140 maxrate 1Gbit refill_delay 40.0ms",
+			tcCase: tcCase{lineReplace: fqAdd, wantQdisc: fq},
+		},
+		{
+			name:   "fq iproute2 5.x",
+			line:   "qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028b initial_quantum 15140b low_rate_threshold 550Kbit maxrate 1Gbit refill_delay 40ms",
+			tcCase: tcCase{lineReplace: fqAdd, wantQdisc: fq},
+		},
+		{
+			name:   "fq iproute2 6.x",
+			line:   "qdisc fq 1: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028b initial_quantum 15140b low_rate_threshold 550Kbit maxrate 1Gbit refill_delay 40ms timer_slack 10us horizon 10s horizon_drop",
+			tcCase: tcCase{lineReplace: fqAdd, wantQdisc: fq},
+		},
+		{
+			name:   "cake iproute2 4.19",
+			line:   "qdisc cake 1: root refcnt 2 bandwidth 100Mbit diffserv3 triple-isolate nonat nowash no-ack-filter split-gso rtt 100.0ms raw overhead 0",
+			tcCase: tcCase{lineReplace: cakeAdd, wantQdisc: cake},
+		},
+		{
+			name:   "cake iproute2 6.x",
+			line:   "qdisc cake 1: root refcnt 2 bandwidth 100Mbit diffserv3 triple-isolate nonat nowash no-ack-filter split-gso rtt 100ms raw overhead 0",
+			tcCase: tcCase{lineReplace: cakeAdd, wantQdisc: cake},
+		},
+		{
+			name: "cake unlimited",
+			line: "qdisc cake 1: root refcnt 2 bandwidth unlimited besteffort flows nat wash ingress no-ack-filter split-gso rtt 100ms noatm overhead 38 mpu 84",
+			tcCase: tcCase{
+				lineReplace: []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "cake", "unlimited", "besteffort", "flows", "nat", "wash", "rtt", "100ms"},
+				wantQdisc: &QdiscCake{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "cake",
+						Handle: "1:",
+						Root:   true,
+					},
+					Diffserv: "besteffort",
+					FlowMode: "flows",
+					Nat:      true,
+					Wash:     true,
+					Rtt:      100000,
+				},
+			},
+		},
+		{
+			name:   "netem iproute2 4.x",
+			line:   "qdisc netem 1: root refcnt 2 limit 1000 delay 100.0ms  10.0ms loss 1% duplicate 0.5% reorder 25% corrupt 0.1% rate 10Mbit gap 1",
+			tcCase: tcCase{lineReplace: netemAdd, wantQdisc: netem},
+		},
+		{
+			name:   "netem iproute2 6.x",
+			line:   "qdisc netem 1: root refcnt 2 limit 1000 delay 100ms  10ms loss 1% duplicate 0.5% reorder 25% corrupt 0.1% rate 10Mbit seed 7026838624911011946 gap 1",
+			tcCase: tcCase{lineReplace: netemAdd, wantQdisc: netem},
+		},
+		{
+			name:   "netem correlations",
+			line:   "qdisc netem 1: root refcnt 2 limit 1000 delay 100ms  10ms 25% loss 1% 20% duplicate 0.5% 5% reorder 25% 50% corrupt 0.1% 1% rate 10Mbit gap 1",
+			tcCase: tcCase{lineReplace: netemAdd, wantQdisc: netem},
+		},
+		{
+			name: "netem delay only",
+			line: "qdisc netem 1: root refcnt 2 limit 1000 delay 1.5ms",
+			tcCase: tcCase{
+				lineReplace: []string{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "netem", "limit", "1000", "delay", "1500us"},
+				wantQdisc: &QdiscNetem{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "netem",
+						Handle: "1:",
+						Root:   true,
+					},
+					Limit: 1000,
+					Delay: 1500,
+				},
+			},
+		},
+		{
+			name: "sfq iproute2 3.x",
+			line: "qdisc sfq 10: parent 1:1 limit 127p quantum 1514b flows 128/1024 perturb 10sec",
+			tcCase: tcCase{
+				// depth is not shown
+				lineReplace: []string{"qdisc", "add", "dev", "eth0", "parent", "1:1", "handle", "10:", "sfq", "limit", "127", "quantum", "1514", "divisor", "1024", "perturb", "10"},
+				wantQdisc:   sfq,
+			},
+		},
+		{
+			name:   "sfq iproute2 4.x",
+			line:   "qdisc sfq 10: parent 1:1 limit 127p quantum 1514b depth 127 divisor 1024 perturb 10sec",
+			tcCase: tcCase{lineReplace: sfqAdd, wantQdisc: sfq},
+		},
+		{
+			name:   "sfq iproute2 6.x details",
+			line:   "qdisc sfq 10: parent 1:1 limit 127p quantum 1514b depth 127 flows 128 divisor 1024 perturb 10sec",
+			tcCase: tcCase{lineReplace: sfqAdd, wantQdisc: sfq},
+		},
+		{
+			name:   "mq",
+			line:   "qdisc mq 1: root ",
+			tcCase: tcCase{lineReplace: mqAdd, wantQdisc: mq},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			qs, err := parseQdiscLines([]string{c.line})
+			if err != nil || len(qs) != 1 {
+				t.Fatalf("parseQdiscLines: %v, %d qdiscs", err, len(qs))
+			}
+			q := qs[0]
+			if !q.Equals(c.wantQdisc) || !c.wantQdisc.Equals(q) {
+				t.Errorf("Qdisc want %v, got %v", jsonutils.Marshal(c.wantQdisc), jsonutils.Marshal(q))
+			}
+			wantDelete := rootDelete
+			if !q.IsRoot() {
+				wantDelete = sfqDelete
+			}
+			if lineDelete := q.DeleteLine("eth0"); !reflect.DeepEqual(lineDelete, wantDelete) {
+				t.Errorf("delete line want: %s, got: %s", wantDelete, lineDelete)
+			}
+			if lineAdd := q.AddLine("eth0"); !reflect.DeepEqual(lineAdd, c.lineReplace) {
+				t.Errorf("add line want: %s, got: %s", c.lineReplace, lineAdd)
+			}
+			// printed arguments are parsed back to the same qdisc
+			args := c.lineReplace[indexOf(c.lineReplace, q.Base().Kind):]
+			reparsed, err := parseQdisc(append([]string{"qdisc", args[0], q.Base().Handle}, args[1:]...))
+			if err != nil {
+				t.Fatalf("parse add line: %v", err)
+			}
+			reparsed.Base().Root = q.IsRoot()
+			reparsed.Base().Parent = q.Base().Parent
+			if !reparsed.Equals(q) {
+				t.Errorf("add line parsed back to %v", jsonutils.Marshal(reparsed))
+			}
+		})
+	}
+}
+
+func TestQdiscKindsDelta(t *testing.T) {
+	tbf := &QdiscTbf{
+		SBaseTcQdisc: &SBaseTcQdisc{
+			Kind:   "tbf",
+			Handle: "1:",
+			Root:   true,
+		},
+		Rate:    100000000,
+		Burst:   12500,
+		Latency: 100000,
+	}
+	cases := []struct {
+		name  string
+		qdisc string
+		want  *QdiscTree
+		delta [][]string
+	}{
+		{
+			name:  "unchanged",
+			qdisc: "qdisc netem 1: root refcnt 2 limit 1000 delay 100ms  10ms loss 1%\nqdisc sfq 10: parent 1:1 limit 127p quantum 1514b depth 127 divisor 1024 perturb 10sec",
+			want: NewQdiscTree([]IQdisc{
+				&QdiscNetem{
+					SBaseTcQdisc: &SBaseTcQdisc{Kind: "netem", Handle: "1:", Root: true},
+					Delay:        100000,
+					Jitter:       10000,
+					Loss:         1,
+				},
+				&QdiscSfq{
+					SBaseTcQdisc: &SBaseTcQdisc{Kind: "sfq", Handle: "10:", Parent: "1:1"},
+					Perturb:      10,
+				},
+			}, nil, nil),
+			delta: [][]string{},
+		},
+		{
+			name:  "changed",
+			qdisc: "qdisc netem 1: root refcnt 2 limit 1000 delay 100ms  10ms loss 1%",
+			want: NewQdiscTree([]IQdisc{
+				&QdiscNetem{
+					SBaseTcQdisc: &SBaseTcQdisc{Kind: "netem", Handle: "1:", Root: true},
+					Delay:        50000,
+				},
+			}, nil, nil),
+			delta: [][]string{
+				{"qdisc", "replace", "dev", "eth0", "root", "handle", "1:", "netem", "delay", "50ms"},
+			},
+		},
+		{
+			name:  "replaced",
+			qdisc: "qdisc fq_codel 0: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64",
+			want:  NewQdiscTree([]IQdisc{tbf}, nil, nil),
+			delta: [][]string{
+				{"qdisc", "delete", "dev", "eth0", "root", "handle", "0:"},
+				{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+			},
+		},
+		{
+			name:  "root replaced with child",
+			qdisc: "qdisc netem 1: root refcnt 2 limit 1000 delay 100ms\nqdisc tbf 10: parent 1:1 rate 100Mbit burst 12500b lat 100ms",
+			want:  NewQdiscTree([]IQdisc{tbf}, nil, nil),
+			delta: [][]string{
+				{"qdisc", "delete", "dev", "eth0", "root", "handle", "1:"},
+				{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+			},
+		},
+		{
+			// default children of queues are replaced one by one
+			name: "mq children",
+			qdisc: `qdisc mq 1: root
+qdisc fq_codel 0: parent 1:2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64
+qdisc tbf 11: parent 1:1 rate 50Mbit burst 6250b lat 100ms`,
+			want: NewQdiscTree([]IQdisc{
+				&QdiscMq{SBaseTcQdisc: &SBaseTcQdisc{Kind: "mq", Handle: "1:", Root: true}},
+				&QdiscTbf{
+					SBaseTcQdisc: &SBaseTcQdisc{Kind: "tbf", Handle: "11:", Parent: "1:1"},
+					Rate:         50000000,
+					Burst:        6250,
+					Latency:      100000,
+				},
+				&QdiscTbf{
+					SBaseTcQdisc: &SBaseTcQdisc{Kind: "tbf", Handle: "12:", Parent: "1:2"},
+					Rate:         50000000,
+					Burst:        6250,
+					Latency:      100000,
+				},
+			}, nil, nil),
+			delta: [][]string{
+				{"qdisc", "add", "dev", "eth0", "parent", "1:2", "handle", "12:", "tbf", "rate", "50Mbit", "burst", "6250b", "latency", "100ms"},
+			},
+		},
+		{
+			name:  "default root kept",
+			qdisc: "qdisc mq 0: root\nqdisc fq_codel 0: parent :1 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64",
+			want:  NewQdiscTree(nil, nil, nil),
+			delta: [][]string{},
+		},
+		{
+			name:  "mq replaced",
+			qdisc: "qdisc mq 1: root\nqdisc tbf 11: parent 1:1 rate 50Mbit burst 6250b lat 100ms",
+			want:  NewQdiscTree([]IQdisc{tbf}, nil, nil),
+			delta: [][]string{
+				{"qdisc", "delete", "dev", "eth0", "root", "handle", "1:"},
+				{"qdisc", "add", "dev", "eth0", "root", "handle", "1:", "tbf", "rate", "100Mbit", "burst", "12500b", "latency", "100ms"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			qt, err := NewQdiscTreeFromString(c.qdisc, "", "")
+			if err != nil {
+				t.Fatalf("create qdisc tree: %v", err)
+			}
+			if got := c.want.Delta(qt, "eth0"); !reflect.DeepEqual(got, c.delta) {
+				t.Errorf("want %v\ngot  %v", c.delta, got)
+			}
+		})
+	}
+}
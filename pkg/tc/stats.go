@@ -0,0 +1,196 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+)
+
+/*
+ * tc -s qdisc show dev vnet1
+ * qdisc tbf 1: root refcnt 2 rate 100Kbit burst 1600b lat 50ms
+ *  Sent 1532 bytes 2 pkt (dropped 398, overlimits 399 requeues 0)
+ *  backlog 1442b 1p requeues 0
+ *
+ * tc -s class show dev br0
+ * class htb 1:3 parent 1:1 prio 0 rate 100Mbit ceil 1Gbit burst 1600b cburst 1375b
+ *  Sent 0 bytes 0 pkt (dropped 0, overlimits 0 requeues 0)
+ *  backlog 0b 0p requeues 0
+ *  lended: 0 borrowed: 0 giants: 0
+ *  tokens: 2000 ctokens: 187
+ */
+
+const (
+	TcStatsQdisc = "qdisc"
+	TcStatsClass = "class"
+)
+
+// STcStats is statistics of a qdisc or class
+type STcStats struct {
+	// Type is either TcStatsQdisc or TcStatsClass
+	Type string
+	Kind string
+	// Id is handle of qdisc or classid of class
+	Id string
+	// Parent is "root" or id of the parent
+	Parent string
+
+	Bytes      uint64
+	Packets    uint64
+	Drops      uint64
+	Overlimits uint64
+	Requeues   uint64
+
+	BacklogBytes   uint64
+	BacklogPackets uint64
+}
+
+func parseStatsHeader(chunks []string) (*STcStats, error) {
+	if len(chunks) < 3 {
+		return nil, errors.Wrap(errors.ErrInvalidFormat, "eol before getting id")
+	}
+	st := &STcStats{
+		Type: chunks[0],
+		Kind: chunks[1],
+		Id:   chunks[2],
+	}
+	for i := 3; i < len(chunks) && len(st.Parent) == 0; i++ {
+		switch chunks[i] {
+		case "root":
+			st.Parent = "root"
+		case "parent":
+			if i+1 >= len(chunks) {
+				return nil, errors.Wrap(errors.ErrInvalidFormat, "eol before getting parent")
+			}
+			st.Parent = chunks[i+1]
+		}
+	}
+	return st, nil
+}
+
+// parseStatsCounters parses counters following "Sent" of "tc -s" output.
+// Kind specific statistics after "backlog" are ignored
+func (st *STcStats) parseStatsCounters(chunks []string) error {
+	next := func(i int, what string) (string, error) {
+		if i+1 >= len(chunks) {
+			return "", errors.Wrapf(errors.ErrInvalidFormat, "eol before getting %s", what)
+		}
+		return chunks[i+1], nil
+	}
+	for i := 0; i < len(chunks); i++ {
+		var (
+			v   string
+			err error
+		)
+		switch chunks[i] {
+		case "Sent":
+			if v, err = next(i, "bytes"); err == nil {
+				st.Bytes, err = ParseCount(v, "")
+			}
+			if err == nil && i+3 < len(chunks) {
+				st.Packets, err = ParseCount(chunks[i+3], "")
+				i += 3
+			}
+		case "dropped":
+			if v, err = next(i, "dropped"); err == nil {
+				st.Drops, err = ParseCount(v, "")
+			}
+		case "overlimits":
+			if v, err = next(i, "overlimits"); err == nil {
+				st.Overlimits, err = ParseCount(v, "")
+			}
+		case "requeues":
+			if v, err = next(i, "requeues"); err == nil {
+				st.Requeues, err = ParseCount(v, "")
+			}
+		case "backlog":
+			if v, err = next(i, "backlog"); err == nil {
+				st.BacklogBytes, err = ParseIprouteSize(v)
+			}
+			if err == nil {
+				if v, err = next(i+1, "backlog packets"); err == nil {
+					st.BacklogPackets, err = ParseCount(v, "p")
+				}
+			}
+			if err != nil {
+				return errors.Wrapf(err, "%s", chunks[i])
+			}
+			return nil
+		default:
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s", chunks[i])
+		}
+	}
+	return nil
+}
+
+func parseStats(text string) (*STcStats, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		switch r {
+		case ' ', '\t', '\n', '(', ')', ',':
+			return true
+		}
+		return false
+	})
+	sent := len(fields)
+	for i, f := range fields {
+		if f == "Sent" {
+			sent = i
+			break
+		}
+	}
+	st, err := parseStatsHeader(fields[:sent])
+	if err != nil {
+		return nil, err
+	}
+	if err := st.parseStatsCounters(fields[sent:]); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// ParseStatsLines parses output of "tc -s qdisc show" or "tc -s class show".
+// Statistics of an object continue on lines not starting with "qdisc " or
+// "class "
+func ParseStatsLines(lines []string) ([]*STcStats, error) {
+	stats := []*STcStats{}
+	for i := 0; i < len(lines); {
+		text := strings.TrimSpace(lines[i])
+		i++
+		for i < len(lines) && !isStatsHeader(lines[i]) {
+			text += "\n" + strings.TrimSpace(lines[i])
+			i++
+		}
+		if len(text) == 0 {
+			continue
+		}
+		st, err := parseStats(text)
+		if err != nil {
+			log.Debugf("parse stats %s: %v", text, err)
+			continue
+		}
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+func isStatsHeader(line string) bool {
+	return strings.HasPrefix(line, TcStatsQdisc+" ") || strings.HasPrefix(line, TcStatsClass+" ")
+}
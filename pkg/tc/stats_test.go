@@ -0,0 +1,128 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatsLines(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want []*STcStats
+	}{
+		{
+			name: "tbf",
+			in: `qdisc tbf 1: root refcnt 2 rate 100Kbit burst 1600b lat 50ms 
+ Sent 1532 bytes 2 pkt (dropped 398, overlimits 399 requeues 0) 
+ backlog 1442b 1p requeues 0
+qdisc ingress ffff: parent ffff:fff1 ---------------- 
+ Sent 0 bytes 0 pkt (dropped 0, overlimits 0 requeues 0) 
+ backlog 0b 0p requeues 0`,
+			want: []*STcStats{
+				{
+					Type:           TcStatsQdisc,
+					Kind:           "tbf",
+					Id:             "1:",
+					Parent:         "root",
+					Bytes:          1532,
+					Packets:        2,
+					Drops:          398,
+					Overlimits:     399,
+					BacklogBytes:   1442,
+					BacklogPackets: 1,
+				},
+				{
+					Type:   TcStatsQdisc,
+					Kind:   "ingress",
+					Id:     "ffff:",
+					Parent: "ffff:fff1",
+				},
+			},
+		},
+		{
+			name: "htb class",
+			in: `class htb 1:1 root rate 10Gbit ceil 10Gbit burst 0b cburst 0b 
+ Sent 9876543210 bytes 6543210 pkt (dropped 0, overlimits 12 requeues 3) 
+ backlog 0b 0p requeues 3
+ lended: 0 borrowed: 0 giants: 0
+ tokens: 15 ctokens: 15
+
+class htb 1:3 parent 1:1 prio 0 rate 100Mbit ceil 1Gbit burst 1600b cburst 1375b 
+ Sent 123456 bytes 100 pkt (dropped 7, overlimits 80 requeues 0) 
+ backlog 12Kb 9p requeues 0
+ lended: 20 borrowed: 0 giants: 0
+ tokens: 2000 ctokens: 187
+`,
+			want: []*STcStats{
+				{
+					Type:       TcStatsClass,
+					Kind:       "htb",
+					Id:         "1:1",
+					Parent:     "root",
+					Bytes:      9876543210,
+					Packets:    6543210,
+					Overlimits: 12,
+					Requeues:   3,
+				},
+				{
+					Type:           TcStatsClass,
+					Kind:           "htb",
+					Id:             "1:3",
+					Parent:         "1:1",
+					Bytes:          123456,
+					Packets:        100,
+					Drops:          7,
+					Overlimits:     80,
+					BacklogBytes:   12 * 1024,
+					BacklogPackets: 9,
+				},
+			},
+		},
+		{
+			name: "without stats",
+			in:   `qdisc tbf 1: root refcnt 2 rate 100Kbit burst 1600b lat 50ms`,
+			want: []*STcStats{
+				{
+					Type:   TcStatsQdisc,
+					Kind:   "tbf",
+					Id:     "1:",
+					Parent: "root",
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseStatsLines(strings.Split(c.in, "\n"))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want")
+				for _, st := range c.want {
+					t.Errorf("  %+v", *st)
+				}
+				t.Errorf("got")
+				for _, st := range got {
+					t.Errorf("  %+v", *st)
+				}
+			}
+		})
+	}
+}
@@ -57,10 +57,49 @@ func (tc *TcCli) QdiscShow(ctx context.Context, ifname string) (*QdiscTree, erro
 		}
 		outputs[2] += string(output)
 	}
+	if strings.Contains(outputs[0], "qdisc clsact ") {
+		// filters of clsact hooks are not shown without the hook and
+		// are printed without parent, tag them with the hook
+		for _, hook := range []string{FilterHookIngress, FilterHookEgress} {
+			cmd := exec.CommandContext(ctx, "tc", "filter", "show", "dev", ifname, hook)
+			output, err := cmd.Output()
+			if err != nil {
+				return nil, errors.Wrapf(err, "tc filter show %s", hook)
+			}
+			outputs[2] += tagFilterHook(string(output), hook)
+		}
+	}
 	qt, err := NewQdiscTreeFromString(string(outputs[0]), string(outputs[1]), string(outputs[2]))
 	return qt, err
 }
 
+func (tc *TcCli) Stats(ctx context.Context, ifname string) ([]*STcStats, error) {
+	stats := []*STcStats{}
+	for _, tcType := range []string{TcStatsQdisc, TcStatsClass} {
+		cmd := exec.CommandContext(ctx, "tc", "-s", tcType, "show", "dev", ifname)
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "tc -s %s show", tcType)
+		}
+		st, err := ParseStatsLines(strings.Split(string(output), "\n"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s stats", tcType)
+		}
+		stats = append(stats, st...)
+	}
+	return stats, nil
+}
+
+func tagFilterHook(output string, hook string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "filter ") {
+			lines[i] = "filter " + hook + " " + strings.TrimPrefix(line, "filter ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (tc *TcCli) Batch(ctx context.Context, cmdlines [][]string) (string, string, error) {
 	var errs []error
 	var stdout strings.Builder
@@ -85,6 +124,16 @@ func (tc *TcCli) Batch(ctx context.Context, cmdlines [][]string) (string, string
 	return stdout.String(), stderr.String(), err
 }
 
+// Apply runs command lines of ops one by one.  Errors do not stop the
+// following ones
+func (tc *TcCli) Apply(ctx context.Context, ifname string, ops []TcOp) error {
+	stdout, stderr, err := tc.Batch(ctx, TcOpsLines(ops, ifname))
+	if err != nil {
+		return errors.Wrapf(err, "stdout:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+	return nil
+}
+
 func (tc *TcCli) singleCmd(ctx context.Context, cmdline []string) (stdout string, stderr string, err error) {
 	args := make([]string, 0, 4)
 	if tc.details {
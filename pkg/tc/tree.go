@@ -15,6 +15,7 @@
 package tc
 
 import (
+	"fmt"
 	"strings"
 
 	"yunion.io/x/jsonutils"
@@ -75,41 +76,96 @@ func (qt *QdiscTree) Merge(qt2 *QdiscTree) {
 }
 
 func (qt *QdiscTree) Delta(qt2 *QdiscTree, ifname string) [][]string {
-	lines := [][]string{}
+	return TcOpsLines(qt.DeltaOps(qt2), ifname)
+}
+
+// HasQdisc tells whether qt has qdisc of kind
+func (qt *QdiscTree) HasQdisc(kind string) bool {
+	for _, q := range qt.qdisc {
+		if q.Base().Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSlot is where a filter is attached, filters of the same slot
+// replace each other
+func filterSlot(f IFilter) string {
+	base := f.Base()
+	parent := ""
+	if base.Parent != nil {
+		parent = base.Parent.Id()
+	}
+	return fmt.Sprintf("%s/%s/%d", parent, base.Hook, base.Prio)
+}
+
+// DeltaOps returns ops changing qt2 into qt.
+//
+// Bpf programs in qt2 are attached by others, e.g. cilium or custom
+// tools.  They are kept, together with their clsact qdisc, unless qt has
+// filters of the same parent and priority, i.e. qt manages the slot
+func (qt *QdiscTree) DeltaOps(qt2 *QdiscTree) []TcOp {
+	ops := []TcOp{}
 	addedQdisc, updatedQdisc1, updatedQdisc2, removedQdisc := Split(qt.qdisc, qt2.qdisc, true)
 	addedClass, updatedClass1, updatedClass2, removedClass := Split(qt.classes, qt2.classes, true)
 	addedFilter, _, _, removedFilter := Split(qt.filters, qt2.filters, false)
+	managedSlots := map[string]bool{}
+	for _, f := range qt.filters {
+		managedSlots[filterSlot(f)] = true
+	}
+	keptParents := map[string]bool{}
 	for i := len(removedFilter) - 1; i >= 0; i-- {
-		lines = append(lines, removedFilter[i].DeleteLine(ifname))
+		f := removedFilter[i]
+		if _, ok := f.(*SBpfFilter); ok && !managedSlots[filterSlot(f)] {
+			if f.Base().Parent != nil {
+				keptParents[f.Base().Parent.Id()] = true
+			}
+			continue
+		}
+		ops = append(ops, TcOp{Action: TcOpDelete, Obj: f})
 	}
 	for i := len(removedClass) - 1; i >= 0; i-- {
-		lines = append(lines, removedClass[i].DeleteLine(ifname))
+		ops = append(ops, TcOp{Action: TcOpDelete, Obj: removedClass[i]})
 	}
 	for i := len(removedQdisc) - 1; i >= 0; i-- {
-		lines = append(lines, removedQdisc[i].DeleteLine(ifname))
+		// leaf qdiscs attached by kernel or admin under classes are left
+		// alone.  They go away with the root qdisc when it is replaced
+		if q := removedQdisc[i].Base(); !q.Root && len(q.Parent) > 0 {
+			continue
+		}
+		if keptParents[removedQdisc[i].Id()] {
+			continue
+		}
+		// default root attached by kernel, e.g. mq of multiqueue
+		// devices, comes back once deleted
+		if q := removedQdisc[i].Base(); q.Root && q.Handle == "0:" && qt.RootQdisc() == nil {
+			continue
+		}
+		ops = append(ops, TcOp{Action: TcOpDelete, Obj: removedQdisc[i]})
 	}
 	for i := range updatedQdisc1 {
 		if updatedQdisc2[i].Equals(updatedQdisc1[i]) {
 			continue
 		}
-		lines = append(lines, updatedQdisc1[i].ReplaceLine(ifname))
+		ops = append(ops, TcOp{Action: TcOpReplace, Obj: updatedQdisc1[i]})
 	}
 	for i := range updatedClass1 {
 		if updatedClass2[i].Equals(updatedClass1[i]) {
 			continue
 		}
-		lines = append(lines, updatedClass1[i].ReplaceLine(ifname))
+		ops = append(ops, TcOp{Action: TcOpReplace, Obj: updatedClass1[i]})
 	}
 	for i := range addedQdisc {
-		lines = append(lines, addedQdisc[i].AddLine(ifname))
+		ops = append(ops, TcOp{Action: TcOpAdd, Obj: addedQdisc[i]})
 	}
 	for i := range addedClass {
-		lines = append(lines, addedClass[i].AddLine(ifname))
+		ops = append(ops, TcOp{Action: TcOpAdd, Obj: addedClass[i]})
 	}
 	for i := range addedFilter {
-		lines = append(lines, addedFilter[i].AddLine(ifname))
+		ops = append(ops, TcOp{Action: TcOpAdd, Obj: addedFilter[i]})
 	}
-	return lines
+	return ops
 }
 
 func NewQdiscTree(qs []IQdisc, cls []IClass, filters []IFilter) *QdiscTree {
@@ -56,7 +56,13 @@ filter parent 1: protocol ip pref 1 fw chain 0 handle 0x257 classid 1:3`,
 					Rate: 10000000000,
 					Ceil: 10000000000,
 				}
-				return NewQdiscTree([]IQdisc{qdisc}, []IClass{
+				clsactQdisc := &QdiscClsact{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "clsact",
+						Handle: "ffff:",
+					},
+				}
+				return NewQdiscTree([]IQdisc{qdisc, clsactQdisc}, []IClass{
 					rootHtbClass,
 					&SHtbClass{
 						SBaseTcClass: &SBaseTcClass{
@@ -118,7 +124,13 @@ filter parent 1: protocol ip pref 1 fw chain 0 handle 0x257 classid 1:3`,
 					Rate: 10000000000,
 					Ceil: 10000000000,
 				}
-				return NewQdiscTree([]IQdisc{qdisc}, []IClass{
+				clsactQdisc := &QdiscClsact{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "clsact",
+						Handle: "ffff:",
+					},
+				}
+				return NewQdiscTree([]IQdisc{qdisc, clsactQdisc}, []IClass{
 					rootHtbClass,
 					&SHtbClass{
 						SBaseTcClass: &SBaseTcClass{
@@ -302,6 +314,129 @@ qdisc fq_codel 10: parent 1: limit 10240p flows 1024 quantum 1514 target 5ms int
 				{"filter", "add", "dev", "eth0", "parent", "ffff:", "protocol", "ip", "prio", "49152", "u32", "match", "u32", "0", "0", "action", "mirred", "egress", "redirect", "dev", "reth0"},
 			},
 		},
+		{
+			qdisc: `qdisc clsact ffff: parent ffff:fff1`,
+			filter: `filter ingress protocol ip pref 1 flower chain 0
+filter ingress protocol ip pref 1 flower chain 0 handle 0x1
+  eth_type ipv4
+  ip_proto tcp
+  dst_port 80
+  not_in_hw
+	action order 1: mirred (Egress Redirect to device ifb0) stolen
+	index 1 ref 1 bind 1
+filter ingress protocol ip pref 2 flower chain 0
+filter ingress protocol ip pref 2 flower chain 0 handle 0x1
+  eth_type ipv4
+  ip_proto udp
+  dst_port 53
+  not_in_hw
+	action order 1: mirred (Egress Redirect to device ifb0) stolen
+	index 2 ref 1 bind 1`,
+			wantQdiscTree: func() *QdiscTree {
+				clsactQdisc := &QdiscClsact{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "clsact",
+						Handle: "ffff:",
+					},
+				}
+				tcpFilter := &SFlowerFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "flower",
+						Prio:     1,
+						Protocol: "ip",
+						Parent:   clsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					IpProto:     "tcp",
+					DstPort:     80,
+					RedirectDev: "ifb0",
+				}
+				udpFilter := &SFlowerFilter{
+					SBaseTcFilter: &SBaseTcFilter{
+						Kind:     "flower",
+						Prio:     2,
+						Protocol: "ip",
+						Parent:   clsactQdisc,
+						Hook:     FilterHookIngress,
+					},
+					IpProto:     "udp",
+					DstPort:     5353,
+					RedirectDev: "ifb0",
+				}
+				return NewQdiscTree([]IQdisc{clsactQdisc}, []IClass{}, []IFilter{tcpFilter, udpFilter})
+			}(),
+			deltaLines: [][]string{
+				{"filter", "delete", "dev", "eth0", "ingress", "protocol", "ip", "prio", "2", "handle", "0x1", "flower"},
+				{"filter", "add", "dev", "eth0", "ingress", "protocol", "ip", "prio", "2", "flower", "ip_proto", "udp", "dst_port", "5353", "action", "mirred", "egress", "redirect", "dev", "ifb0"},
+			},
+		},
+		{
+			// bpf programs of others are kept with their clsact qdisc
+			qdisc: `qdisc tbf 1: root refcnt 2 rate 100Mbit burst 12500b lat 50ms
+qdisc clsact ffff: parent ffff:fff1`,
+			filter: `filter ingress protocol all pref 1 bpf chain 0
+filter ingress protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 97 name cls_main tag 59f4a931744dcdc6 jited`,
+			wantQdiscTree: NewQdiscTree([]IQdisc{
+				&QdiscTbf{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "tbf",
+						Handle: "1:",
+						Root:   true,
+					},
+					Rate:    100000000,
+					Burst:   12500,
+					Latency: 50000,
+				},
+			}, []IClass{}, []IFilter{}),
+			deltaLines: [][]string{},
+		},
+		{
+			// bpf programs of the same slot are managed
+			qdisc: `qdisc clsact ffff: parent ffff:fff1`,
+			filter: `filter ingress protocol all pref 1 bpf chain 0
+filter ingress protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 97 name cls_main tag 59f4a931744dcdc6 jited
+filter egress protocol all pref 1 bpf chain 0
+filter egress protocol all pref 1 bpf chain 0 handle 0x1 prog.o:[classifier] direct-action not_in_hw id 98 name cls_main tag 59f4a931744dcdc6 jited`,
+			wantQdiscTree: func() *QdiscTree {
+				clsactQdisc := &QdiscClsact{
+					SBaseTcQdisc: &SBaseTcQdisc{
+						Kind:   "clsact",
+						Handle: "ffff:",
+					},
+				}
+				return NewQdiscTree([]IQdisc{clsactQdisc}, []IClass{}, []IFilter{
+					&SBpfFilter{
+						SBaseTcFilter: &SBaseTcFilter{
+							Kind:     "bpf",
+							Prio:     1,
+							Protocol: "all",
+							Parent:   clsactQdisc,
+							Hook:     FilterHookIngress,
+						},
+						Handle:       1,
+						Object:       "/opt/bpf/prog.o",
+						DirectAction: true,
+					},
+					&SBpfFilter{
+						SBaseTcFilter: &SBaseTcFilter{
+							Kind:     "bpf",
+							Prio:     1,
+							Protocol: "all",
+							Parent:   clsactQdisc,
+							Hook:     FilterHookEgress,
+						},
+						Handle:       1,
+						Object:       "/opt/bpf/new.o",
+						Section:      "tc",
+						DirectAction: true,
+					},
+				})
+			}(),
+			deltaLines: [][]string{
+				{"filter", "delete", "dev", "eth0", "egress", "protocol", "all", "prio", "1", "handle", "0x1", "bpf"},
+				{"filter", "add", "dev", "eth0", "egress", "protocol", "all", "prio", "1", "handle", "0x1", "bpf", "object-file", "/opt/bpf/new.o", "section", "tc", "direct-action"},
+			},
+		},
 	}
 	for i, c := range cases {
 		qt, err := NewQdiscTreeFromString(c.qdisc, c.class, c.filter)
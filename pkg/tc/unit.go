@@ -16,6 +16,7 @@ package tc
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -86,7 +87,7 @@ func ParseRate(s string) (bytesPerSec uint64, err error) {
 		err = fmt.Errorf("unknown suffix %s", suffix)
 		return
 	}
-	bytesPerSec = uint64(rate) * scale
+	bytesPerSec = uint64(math.Round(rate * float64(scale)))
 	return
 }
 
@@ -117,17 +118,18 @@ func ParseTime(s string) (us uint64, err error) {
 	if err != nil {
 		return
 	}
-	us = uint64(num)
+	// older iproute2 prints fractions, e.g. 5.0ms
 	switch strings.ToLower(suffix) {
-	case "s", "sec":
-		us = us * TIME_UNIT_PER_SECOND
+	case "s", "sec", "secs":
+		num = num * float64(TIME_UNIT_PER_SECOND)
 	case "ms", "msec", "msecs":
-		us = us * TIME_UNIT_PER_SECOND / 1000
+		num = num * float64(TIME_UNIT_PER_SECOND) / 1000
 	case "us", "usec", "usecs":
-		us = us * TIME_UNIT_PER_SECOND / 1000000
+		num = num * float64(TIME_UNIT_PER_SECOND) / 1000000
 	default:
 		err = fmt.Errorf("unknown time unit %s", suffix)
 	}
+	us = uint64(math.Round(num))
 	return
 }
 
@@ -218,3 +220,54 @@ func PrintSize(bytes uint64) string {
 // burst = bytesPerSec * uint64(float64(buffer)/tickInUsec) / 1000000
 // return burst
 // }
+
+// ParseCount parses numbers printed by iproute2 with optional unit suffix,
+// e.g. "10240p" for packets
+func ParseCount(s string, suffix string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimSuffix(s, suffix), 10, 64)
+}
+
+// ParseIprouteSize parses sizes as iproute2 does, where "Kb" and "Mb" are
+// 1024 based, unlike ParseSize which is kept for tbf burst
+func ParseIprouteSize(s string) (bytes uint64, err error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		return strconv.ParseUint(s, 10, 64)
+	}
+	num, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToLower(s[i:]) {
+	case "b":
+	case "k", "kb":
+		num *= 1024
+	case "m", "mb":
+		num *= 1024 * 1024
+	case "g", "gb":
+		num *= 1024 * 1024 * 1024
+	case "kbit":
+		num *= 1024 / 8
+	case "mbit":
+		num *= 1024 * 1024 / 8
+	case "gbit":
+		num *= 1024 * 1024 * 1024 / 8
+	default:
+		return 0, fmt.Errorf("unknown size suffix %s", s[i:])
+	}
+	return uint64(math.Round(num)), nil
+}
+
+// ParsePercent parses percentage like "0.5%"
+func ParsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("missing percent sign")
+	}
+	return strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+}
+
+func PrintPercent(p float64) string {
+	return strconv.FormatFloat(p, 'g', -1, 64) + "%"
+}
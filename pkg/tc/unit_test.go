@@ -36,6 +36,7 @@ func TestParseRate(t *testing.T) {
 		{s: "1100Mbit", want: 1100 * kiloM, wantp: "1100Mbit"},
 		{s: "1000Mbit", want: 1000 * kiloM, wantp: "1Gbit"},
 		{s: "1Gbit", want: kiloG, wantp: "1Gbit"},
+		{s: "1.5Mbit", want: 1500 * kiloK, wantp: "1500Kbit"},
 	}
 
 	for _, c := range cases {
@@ -64,6 +65,9 @@ func TestParseTime(t *testing.T) {
 		{s: "100ms", want: 100 * 1000, wantp: "100ms"},
 		{s: "1000ms", want: 1000 * 1000, wantp: "1s"},
 		{s: "1001ms", want: 1001 * 1000, wantp: "1001ms"},
+		{s: "5.0ms", want: 5 * 1000, wantp: "5ms"},
+		{s: "1.5ms", want: 1500, wantp: "1500us"},
+		{s: "10sec", want: 10 * 1000 * 1000, wantp: "10s"},
 	}
 
 	for _, c := range cases {
@@ -91,3 +95,23 @@ func TestParseTime(t *testing.T) {
 // 		t.Errorf("TcTbfBurstNormalize(%q), want %d, got %d", burst, want, got)
 // 	}
 // }
+
+func TestParseIprouteSize(t *testing.T) {
+	cases := []struct {
+		s    string
+		want uint64
+	}{
+		{s: "1514", want: 1514},
+		{s: "3028b", want: 3028},
+		{s: "8Kb", want: 8192},
+		{s: "32Mb", want: 32 * 1024 * 1024},
+	}
+	for _, c := range cases {
+		got, err := ParseIprouteSize(c.s)
+		if err != nil {
+			t.Errorf("%s: %v", c.s, err)
+		} else if got != c.want {
+			t.Errorf("%s: want %d, got %d", c.s, c.want, got)
+		}
+	}
+}